@@ -0,0 +1,348 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"eBill-Convert/model"
+	"eBill-Convert/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-openapi/spec"
+)
+
+// knownAccount is a payment account a seller has used (BG-17). Accounts
+// are trusted once confirmed; the accounts of the first invoice seen from
+// a seller are confirmed when recorded.
+type knownAccount struct {
+	IBAN         string    `json:"iban"` // BT-84
+	BIC          string    `json:"bic,omitempty"`
+	FirstInvoice string    `json:"firstInvoice"` // Invoice that introduced the account
+	FirstSeen    time.Time `json:"firstSeen"`
+	LastSeen     time.Time `json:"lastSeen"`
+	Confirmed    bool      `json:"confirmed"`
+}
+
+// accountChange is a payment account of an invoice that is not confirmed
+// for its seller.
+type accountChange struct {
+	Seller string
+	IBAN   string
+	BIC    string
+	Known  []knownAccount // Confirmed accounts
+}
+
+// bankAccountStore remembers the payment accounts of each seller, keyed by
+// accountSellerKey, in a JSON file.
+type bankAccountStore struct {
+	path    string
+	mu      sync.Mutex
+	sellers map[string][]knownAccount
+}
+
+var bankAccounts *bankAccountStore
+
+// newBankAccountStore loads the accounts stored in path.
+func newBankAccountStore(path string) (*bankAccountStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("error creating bank account directory: %w", err)
+	}
+	s := &bankAccountStore{path: path, sellers: make(map[string][]knownAccount)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading bank accounts: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.sellers); err != nil {
+		return nil, fmt.Errorf("error decoding bank accounts: %w", err)
+	}
+	return s, nil
+}
+
+// check returns the credit transfer accounts of the invoice that are not
+// confirmed for its seller, without changing the store. Sellers without
+// recorded accounts are not reported, nor is anything while no store is
+// configured.
+func (s *bankAccountStore) check(inv *model.Invoice) []accountChange {
+	if s == nil || inv == nil {
+		return nil
+	}
+	seller := accountSellerKey(inv.Seller)
+	if seller == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	known := s.sellers[seller]
+	if len(known) == 0 {
+		return nil
+	}
+	var confirmed []knownAccount
+	for _, account := range known {
+		if account.Confirmed {
+			confirmed = append(confirmed, account)
+		}
+	}
+	var changes []accountChange
+	for _, transfer := range inv.PaymentInstructions.CreditTransfers {
+		iban, bic := normalizeAccount(transfer.AccountID), normalizeAccount(transfer.ProviderID)
+		if iban == "" {
+			continue
+		}
+		if i := findAccount(known, iban, bic); i >= 0 && known[i].Confirmed {
+			continue
+		}
+		changes = append(changes, accountChange{Seller: seller, IBAN: iban, BIC: bic, Known: confirmed})
+	}
+	return changes
+}
+
+// record remembers the credit transfer accounts of an invoice and returns
+// those not confirmed for its seller. New accounts stay unconfirmed unless
+// the seller had none before.
+func (s *bankAccountStore) record(inv *model.Invoice) []accountChange {
+	s.update(inv, "", false)
+	return s.check(inv)
+}
+
+// confirm marks the credit transfer accounts of the invoice, or only the
+// one with the given IBAN, as confirmed and returns them.
+func (s *bankAccountStore) confirm(inv *model.Invoice, iban string) []knownAccount {
+	return s.update(inv, normalizeAccount(iban), true)
+}
+
+// update adds the accounts of the invoice matching iban, or all if it is
+// empty, and returns them.
+func (s *bankAccountStore) update(inv *model.Invoice, iban string, confirm bool) []knownAccount {
+	if s == nil || inv == nil {
+		return nil
+	}
+	seller := accountSellerKey(inv.Seller)
+	if seller == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	known := s.sellers[seller]
+	first := len(known) == 0 // All accounts of the first invoice are trusted
+	now := time.Now().UTC()
+	var updated []knownAccount
+	for _, transfer := range inv.PaymentInstructions.CreditTransfers {
+		account, bic := normalizeAccount(transfer.AccountID), normalizeAccount(transfer.ProviderID)
+		if account == "" || (iban != "" && account != iban) {
+			continue
+		}
+		i := findAccount(known, account, bic)
+		if i < 0 {
+			known = append(known, knownAccount{IBAN: account, BIC: bic, FirstInvoice: inv.Number, FirstSeen: now, Confirmed: first})
+			i = len(known) - 1
+		}
+		if known[i].BIC == "" {
+			known[i].BIC = bic
+		}
+		known[i].LastSeen = now
+		if confirm {
+			known[i].Confirmed = true
+		}
+		updated = append(updated, known[i])
+	}
+	if len(updated) == 0 {
+		return nil
+	}
+
+	s.sellers[seller] = known
+	if err := s.save(); err != nil {
+		log.Printf("error saving bank accounts: %v", err)
+	}
+	return updated
+}
+
+func (s *bankAccountStore) save() error {
+	data, err := json.MarshalIndent(s.sellers, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding bank accounts: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("error writing bank accounts: %w", err)
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// findAccount returns the index of the account with the IBAN and BIC, or
+// -1. A missing BIC matches any BIC of the IBAN.
+func findAccount(accounts []knownAccount, iban, bic string) int {
+	for i, account := range accounts {
+		if account.IBAN != iban {
+			continue
+		}
+		if bic == "" || account.BIC == "" || account.BIC == bic {
+			return i
+		}
+	}
+	return -1
+}
+
+// accountSellerKey is the sellerKey of sellers with a VAT ID, tax number,
+// legal registration or global ID. Sellers known by name only are not
+// tracked, as anyone can use a name.
+func accountSellerKey(seller model.Party) string {
+	if seller.VATID == "" && seller.TaxRegistrationID == "" && seller.LegalRegistrationID.ID == "" &&
+		(len(seller.Identifiers) == 0 || seller.Identifiers[0].ID == "") {
+		return ""
+	}
+	return sellerKey(seller)
+}
+
+// normalizeAccount removes the white space of an IBAN or BIC and
+// upper-cases it.
+func normalizeAccount(value string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(value), ""))
+}
+
+// describeAccount formats an IBAN with its BIC if known.
+func describeAccount(iban, bic string) string {
+	if bic == "" {
+		return iban
+	}
+	return fmt.Sprintf("%s (BIC %s)", iban, bic)
+}
+
+// knownAccounts lists the confirmed accounts of a change.
+func knownAccounts(change accountChange) string {
+	if len(change.Known) == 0 {
+		return "keine"
+	}
+	var known []string
+	for _, account := range change.Known {
+		known = append(known, describeAccount(account.IBAN, account.BIC))
+	}
+	return strings.Join(known, ", ")
+}
+
+// accountAlerts words the changes for the warning box of the rendered
+// invoice.
+func accountAlerts(changes []accountChange) []string {
+	var alerts []string
+	for _, change := range changes {
+		alerts = append(alerts, fmt.Sprintf("Die Bankverbindung %s ist für diesen Verkäufer nicht bestätigt. Bestätigte Bankverbindungen: %s. Bitte vor der Zahlung beim Verkäufer auf bekanntem Weg bestätigen lassen.",
+			describeAccount(change.IBAN, change.BIC), knownAccounts(change)))
+	}
+	return alerts
+}
+
+// accountIssues reports the changes as validation warnings.
+func accountIssues(changes []accountChange) []utils.ValidationIssue {
+	var issues []utils.ValidationIssue
+	for _, change := range changes {
+		known := "none"
+		if len(change.Known) > 0 {
+			known = knownAccounts(change)
+		}
+		issues = append(issues, utils.ValidationIssue{
+			Rule:     "BANK-ACCOUNT-CHANGED",
+			Severity: "warning",
+			Field:    "BT-84",
+			Value:    change.IBAN,
+			Message:  fmt.Sprintf("The seller's payment account %s is not confirmed. Confirmed accounts: %s.", describeAccount(change.IBAN, change.BIC), known),
+		})
+	}
+	return issues
+}
+
+// handleConfirmAccounts confirms the payment accounts of the uploaded
+// invoice for its seller.
+func handleConfirmAccounts(c *gin.Context) {
+	data, err := formFileData(c, "xmlFile")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	xmlData, err := invoiceXML(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	inv, err := parseInvoiceModel(xmlData)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	seller := accountSellerKey(inv.Seller)
+	if seller == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "seller has no VAT ID, tax number or identifier"})
+		return
+	}
+	confirmed := bankAccounts.confirm(inv, c.PostForm("iban"))
+	if len(confirmed) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no matching payment account in invoice"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"seller": seller, "accounts": confirmed})
+}
+
+func confirmAccountsPath() spec.PathItem {
+	return spec.PathItem{
+		PathItemProps: spec.PathItemProps{
+			Post: &spec.Operation{
+				OperationProps: spec.OperationProps{
+					Description: "Confirms the payment accounts (BT-84) of the invoice for its seller after they were verified with the seller. Rendering, validating and batch conversions remember the accounts of each seller; the accounts of the first invoice of a seller are trusted, later new accounts are flagged until confirmed.",
+					Consumes:    []string{"multipart/form-data"},
+					Produces:    []string{"application/json"},
+					Parameters: []spec.Parameter{
+						{
+							ParamProps: spec.ParamProps{
+								Name:        "xmlFile",
+								In:          "formData",
+								Description: "The invoice: XML, hybrid PDF, JSON or EDIFACT.",
+								Required:    true,
+								Schema:      &spec.Schema{SchemaProps: spec.SchemaProps{Type: []string{"file"}}},
+							},
+						},
+						{
+							ParamProps: spec.ParamProps{
+								Name:        "iban",
+								In:          "formData",
+								Description: "Confirms only this account of the invoice.",
+							},
+							SimpleSchema: spec.SimpleSchema{
+								Type: "string",
+							},
+						},
+					},
+					Responses: &spec.Responses{
+						ResponsesProps: spec.ResponsesProps{
+							StatusCodeResponses: map[int]spec.Response{
+								200: {
+									ResponseProps: spec.ResponseProps{
+										Description: "Seller key and the confirmed accounts.",
+										Schema: &spec.Schema{
+											SchemaProps: spec.SchemaProps{
+												Type: []string{"object"},
+											},
+										},
+									},
+								},
+								400: errorResponse("File missing, not a readable invoice, or no matching account"),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
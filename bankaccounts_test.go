@@ -0,0 +1,148 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"eBill-Convert/model"
+)
+
+func testAccountInvoice(t *testing.T, number, vatID string, ibans ...string) *model.Invoice {
+	t.Helper()
+	inv, err := parseInvoiceModel(testInvoice(number, vatID, "20240131", ibans...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return inv
+}
+
+// changedIBANs lists the IBANs of the changes.
+func changedIBANs(changes []accountChange) string {
+	var ibans []string
+	for _, change := range changes {
+		ibans = append(ibans, change.IBAN)
+	}
+	return strings.Join(ibans, ",")
+}
+
+func TestBankAccountStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounts.json")
+	s, err := newBankAccountStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The accounts of the first invoice are trusted
+	first := testAccountInvoice(t, "RE-1", "DE136695976", "DE02120300000000202051", "DE02 1001 0010 0006 8201 01")
+	if changes := s.record(first); changes != nil {
+		t.Errorf("first invoice = %+v", changes)
+	}
+	if changes := s.record(first); changes != nil {
+		t.Errorf("first invoice again = %+v", changes)
+	}
+
+	// A new account stays flagged until confirmed
+	changed := testAccountInvoice(t, "RE-2", "DE 136.695.976", "DE02120300000000202051", "DE89370400440532013000")
+	for i := 0; i < 2; i++ {
+		changes := s.record(changed)
+		if changedIBANs(changes) != "DE89370400440532013000" || len(changes[0].Known) != 2 || changes[0].Seller != "DE136695976" {
+			t.Errorf("record %d = %+v", i+1, changes)
+		}
+	}
+	if changes := s.check(changed); changedIBANs(changes) != "DE89370400440532013000" {
+		t.Errorf("check = %+v", changes)
+	}
+
+	// Another seller starts trusted on its own
+	if changes := s.record(testAccountInvoice(t, "RE-1", "DE999999999", "DE89370400440532013000")); changes != nil {
+		t.Errorf("other seller = %+v", changes)
+	}
+
+	if confirmed := s.confirm(changed, "de89 3704 0044 0532 0130 00"); len(confirmed) != 1 || !confirmed[0].Confirmed || confirmed[0].FirstInvoice != "RE-2" {
+		t.Errorf("confirm = %+v", confirmed)
+	}
+	if changes := s.check(changed); changes != nil {
+		t.Errorf("after confirm = %+v", changes)
+	}
+
+	// Confirming without IBAN trusts all accounts of the invoice
+	third := testAccountInvoice(t, "RE-3", "DE136695976", "CH9300762011623852957", "NL91ABNA0417164300")
+	if changes := s.record(third); changedIBANs(changes) != "CH9300762011623852957,NL91ABNA0417164300" {
+		t.Errorf("third invoice = %+v", changes)
+	}
+	if confirmed := s.confirm(third, ""); len(confirmed) != 2 {
+		t.Errorf("confirm all = %+v", confirmed)
+	}
+
+	reloaded, err := newBankAccountStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes := reloaded.check(third); changes != nil {
+		t.Errorf("reloaded = %+v", changes)
+	}
+	if n := len(reloaded.sellers["DE136695976"]); n != 5 {
+		t.Errorf("%d accounts reloaded", n)
+	}
+}
+
+func TestBankAccountsUntracked(t *testing.T) {
+	s, err := newBankAccountStore(filepath.Join(t.TempDir(), "accounts.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inv := testAccountInvoice(t, "RE-1", "DE136695976", "DE02120300000000202051")
+	inv.Seller.VATID = ""
+	s.record(inv)
+	inv.PaymentInstructions.CreditTransfers[0].AccountID = "DE89370400440532013000"
+	if changes := s.record(inv); changes != nil || len(s.sellers) != 0 {
+		t.Errorf("seller known by name = %+v, %v", changes, s.sellers)
+	}
+
+	var none *bankAccountStore
+	if changes := none.record(inv); changes != nil {
+		t.Errorf("no store = %+v", changes)
+	}
+}
+
+func TestFindAccount(t *testing.T) {
+	accounts := []knownAccount{
+		{IBAN: "DE02120300000000202051", BIC: "BYLADEM1001"},
+		{IBAN: "DE89370400440532013000"},
+	}
+	tests := []struct {
+		iban, bic string
+		index     int
+	}{
+		{"DE02120300000000202051", "BYLADEM1001", 0},
+		{"DE02120300000000202051", "", 0},
+		{"DE02120300000000202051", "COBADEFFXXX", -1},
+		{"DE89370400440532013000", "COBADEFFXXX", 1},
+		{"NL91ABNA0417164300", "", -1},
+	}
+	for _, tt := range tests {
+		if got := findAccount(accounts, tt.iban, tt.bic); got != tt.index {
+			t.Errorf("findAccount(%s, %s) = %d, want %d", tt.iban, tt.bic, got, tt.index)
+		}
+	}
+}
+
+func TestAccountWarnings(t *testing.T) {
+	changes := []accountChange{
+		{IBAN: "DE89370400440532013000", BIC: "COBADEFFXXX", Known: []knownAccount{{IBAN: "DE02120300000000202051"}}},
+		{IBAN: "NL91ABNA0417164300"},
+	}
+	alerts := accountAlerts(changes)
+	if len(alerts) != 2 ||
+		!strings.Contains(alerts[0], "DE89370400440532013000 (BIC COBADEFFXXX) ist für diesen Verkäufer nicht bestätigt") ||
+		!strings.Contains(alerts[0], "Bestätigte Bankverbindungen: DE02120300000000202051.") ||
+		!strings.Contains(alerts[1], "Bestätigte Bankverbindungen: keine.") {
+		t.Errorf("alerts = %q", alerts)
+	}
+	issues := accountIssues(changes)
+	if len(issues) != 2 || issues[0].Rule != "BANK-ACCOUNT-CHANGED" || issues[0].Value != "DE89370400440532013000" ||
+		issues[1].Message != "The seller's payment account NL91ABNA0417164300 is not confirmed. Confirmed accounts: none." {
+		t.Errorf("issues = %+v", issues)
+	}
+}
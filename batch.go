@@ -0,0 +1,412 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+
+	"eBill-Convert/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxBatchWorkers     = 16
+	maxBatchRequestSize = 256 << 20 // Upload limit of a batch request
+	maxBatchEntries     = 1000      // Documents per batch
+	maxBatchEntrySize   = 50 << 20  // Per file limit, guards against zip bombs
+	maxBatchTotalSize   = 512 << 20 // Decompressed size of all documents
+)
+
+// batchBudget tracks the documents of a batch request against the limits.
+type batchBudget struct {
+	entries int
+	size    int
+}
+
+// take accounts for one more document, returning an error once the batch
+// holds too many documents.
+func (b *batchBudget) take() error {
+	b.entries++
+	if b.entries > maxBatchEntries {
+		return fmt.Errorf("batch exceeds %d documents", maxBatchEntries)
+	}
+	return nil
+}
+
+// Errors of batchBudget.read
+var (
+	errBatchTooLarge      = fmt.Errorf("batch exceeds %d bytes", maxBatchTotalSize)
+	errBatchEntryTooLarge = fmt.Errorf("file exceeds %d bytes", maxBatchEntrySize)
+)
+
+// read reads a document of at most maxBatchEntrySize bytes within the
+// remaining total size. Only errBatchTooLarge fails the whole batch.
+func (b *batchBudget) read(r io.Reader) ([]byte, error) {
+	limit := min(maxBatchEntrySize, maxBatchTotalSize-b.size)
+	data, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > limit {
+		if limit < maxBatchEntrySize {
+			return nil, errBatchTooLarge
+		}
+		return nil, errBatchEntryTooLarge
+	}
+	b.size += len(data)
+	return data, nil
+}
+
+// batchInput is a single document of a batch request.
+type batchInput struct {
+	Name string
+	Data []byte
+	Err  error // Set if the entry could not be read
+}
+
+// batchResult is a manifest entry describing the conversion of one input.
+type batchResult struct {
+	File          string `json:"file"`
+	Status        string `json:"status"`
+	Profile       string `json:"profile,omitempty"`
+	InvoiceNumber string `json:"invoiceNumber,omitempty"`
+	Output        string `json:"output,omitempty"`
+	Error         string `json:"error,omitempty"`
+
+	Duplicate *duplicateCheck `json:"duplicate,omitempty"`
+
+	data []byte
+	xml  []byte // Invoice fingerprinted once the output is stored
+}
+
+func handleBatch(c *gin.Context) {
+	format, workers, err := parseBatchOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	inputs, err := readBatchInputs(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	results := convertBatch(inputs, format, workers, nil)
+	records := checkBatchDuplicates(results, sourceBatch, "")
+
+	archive, err := writeBatchArchive(results)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("archive creation failed: %v", err)})
+		return
+	}
+	fingerprints.store(records)
+
+	c.Header("Content-Disposition", `attachment; filename="converted.zip"`)
+	c.Data(http.StatusOK, "application/zip", archive)
+}
+
+// parseBatchOptions reads the output format and the number of workers.
+func parseBatchOptions(c *gin.Context) (string, int, error) {
+	format := c.DefaultPostForm("format", "pdf")
+	if format != "pdf" && format != "html" {
+		return "", 0, fmt.Errorf("unsupported format: %s", format)
+	}
+
+	workers := runtime.NumCPU()
+	if value := c.PostForm("workers"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return "", 0, fmt.Errorf("invalid workers value")
+		}
+		workers = n
+	}
+	return format, min(workers, maxBatchWorkers), nil
+}
+
+// limitBatchRequest limits the body of batch requests to
+// maxBatchRequestSize. It runs before the handler, whose first form access
+// parses the whole body.
+func limitBatchRequest(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBatchRequestSize)
+	c.Next()
+}
+
+// readBatchInputs collects the documents of a batch request, either from
+// uploaded ZIP archives ("archive") or from plain files ("xmlFile"). The
+// number of documents and their decompressed size are limited.
+func readBatchInputs(c *gin.Context) ([]batchInput, error) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, fmt.Errorf("request exceeds %d bytes", maxBatchRequestSize)
+		}
+		return nil, fmt.Errorf("multipart form expected")
+	}
+
+	var budget batchBudget
+	var inputs []batchInput
+	for _, file := range form.File["archive"] {
+		src, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("file open error")
+		}
+		data, err := io.ReadAll(src)
+		src.Close()
+		if err != nil {
+			return nil, fmt.Errorf("file read error")
+		}
+		entries, err := readZipInputs(data, &budget)
+		if err != nil {
+			return nil, fmt.Errorf("invalid archive %s: %v", file.Filename, err)
+		}
+		inputs = append(inputs, entries...)
+	}
+
+	for _, file := range form.File["xmlFile"] {
+		if err := budget.take(); err != nil {
+			return nil, err
+		}
+		input := batchInput{Name: path.Base(file.Filename)}
+		src, err := file.Open()
+		if err == nil {
+			input.Data, err = budget.read(src)
+			src.Close()
+		}
+		switch {
+		case errors.Is(err, errBatchTooLarge):
+			return nil, err
+		case errors.Is(err, errBatchEntryTooLarge):
+			input.Err = err
+		case err != nil:
+			input.Err = fmt.Errorf("file read error")
+		}
+		inputs = append(inputs, input)
+	}
+
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("file missing")
+	}
+	return inputs, nil
+}
+
+func readZipInputs(data []byte, budget *batchBudget) ([]batchInput, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	var inputs []batchInput
+	for _, entry := range reader.File {
+		name := strings.TrimPrefix(path.Clean("/"+entry.Name), "/")
+		if entry.FileInfo().IsDir() || strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(path.Base(name), ".") {
+			continue
+		}
+		if err := budget.take(); err != nil {
+			return nil, err
+		}
+
+		input := batchInput{Name: name}
+		src, err := entry.Open()
+		if err == nil {
+			input.Data, err = budget.read(src)
+			src.Close()
+		}
+		switch {
+		case errors.Is(err, errBatchTooLarge):
+			return nil, err
+		case errors.Is(err, errBatchEntryTooLarge):
+			input.Err = err
+		case err != nil:
+			input.Err = fmt.Errorf("archive entry read error: %v", err)
+		}
+		inputs = append(inputs, input)
+	}
+	return inputs, nil
+}
+
+// convertBatch renders all inputs with a bounded pool of workers. Results
+// keep the order of the inputs. If progress is not nil it is called after
+// each converted input.
+func convertBatch(inputs []batchInput, format string, workers int, progress func()) []batchResult {
+	results := make([]batchResult, len(inputs))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = convertBatchInput(inputs[i], format)
+				if progress != nil {
+					progress()
+				}
+			}
+		}()
+	}
+	for i := range inputs {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	// Make output names unique within the archive
+	used := make(map[string]bool)
+	for i := range results {
+		name := results[i].Output
+		if name == "" {
+			continue
+		}
+		ext := path.Ext(name)
+		for n := 2; used[name]; n++ {
+			name = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(results[i].Output, ext), n, ext)
+		}
+		used[name] = true
+		results[i].Output = name
+	}
+
+	return results
+}
+
+// convertBatchInput renders one input. A panic while rendering fails only
+// this input, since the workers run outside the recovery of the server.
+func convertBatchInput(input batchInput, format string) (result batchResult) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("panic converting %s: %v\n%s", input.Name, r, debug.Stack())
+			result = batchResult{File: input.Name, Status: "error", Error: fmt.Sprintf("internal error: %v", r)}
+		}
+	}()
+
+	result = batchResult{File: input.Name, Status: "error"}
+	if input.Err != nil {
+		result.Error = input.Err.Error()
+		return result
+	}
+
+	xmlData, err := invoiceXML(input.Data) // Hybrid PDFs carry the XML as attachment
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	if info, err := utils.DetectDocument(bytes.NewReader(xmlData)); err == nil {
+		result.Profile = info.Profile
+		result.InvoiceNumber = info.InvoiceNumber
+	}
+
+	rendered := xmlData
+	if utils.IsSBDH(input.Data) {
+		rendered = input.Data // Render the envelope as well
+	}
+	switch format {
+	case "pdf":
+		result.data, err = transformXMLToPDF(rendered)
+	case "html":
+		result.data, err = transformXMLToHTML(rendered)
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Status = "ok"
+	result.Output = strings.TrimSuffix(input.Name, path.Ext(input.Name)) + "." + format
+	result.xml = xmlData
+	return result
+}
+
+// checkBatchDuplicates flags the converted inputs matching an earlier
+// invoice or an earlier input of the batch. It returns their fingerprints,
+// to be stored once the results are; job is the ID of the job, if any.
+func checkBatchDuplicates(results []batchResult, source, job string) []fingerprint {
+	var records []fingerprint
+	var converted []int
+	for i, result := range results {
+		if result.Status != "ok" {
+			continue
+		}
+		record, ok := newFingerprint(source, result.File, result.xml)
+		if !ok {
+			continue
+		}
+		record.Job = job
+		records = append(records, record)
+		converted = append(converted, i)
+	}
+	for i, check := range fingerprints.check(records) {
+		results[converted[i]].Duplicate = check
+	}
+	return records
+}
+
+// writeBatchArchive packs the rendered documents together with a JSON and
+// a CSV manifest.
+func writeBatchArchive(results []batchResult) ([]byte, error) {
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+
+	for _, result := range results {
+		if result.Status != "ok" {
+			continue
+		}
+		w, err := archive.Create(result.Output)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(result.data); err != nil {
+			return nil, err
+		}
+	}
+
+	manifest, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	w, err := archive.Create("manifest.json")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(manifest); err != nil {
+		return nil, err
+	}
+
+	w, err = archive.Create("manifest.csv")
+	if err != nil {
+		return nil, err
+	}
+	writer := csv.NewWriter(w)
+	writer.Comma = ';'
+	writer.Write([]string{"file", "status", "profile", "invoice_number", "output", "error", "duplicate"})
+	for _, result := range results {
+		duplicate := ""
+		if result.Duplicate != nil {
+			duplicate = result.Duplicate.Status
+		}
+		writer.Write([]string{result.File, result.Status, result.Profile, result.InvoiceNumber, result.Output, result.Error, duplicate})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, err
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
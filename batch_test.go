@@ -0,0 +1,159 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testInvoice returns a CII invoice of 100.00 EUR plus VAT from the seller
+// with the VAT ID, paid to the IBANs.
+func testInvoice(number, vatID, issueDate string, ibans ...string) []byte {
+	var means strings.Builder
+	for _, iban := range ibans {
+		fmt.Fprintf(&means, `<ram:SpecifiedTradeSettlementPaymentMeans><ram:TypeCode>58</ram:TypeCode><ram:PayeePartyCreditorFinancialAccount><ram:IBANID>%s</ram:IBANID></ram:PayeePartyCreditorFinancialAccount></ram:SpecifiedTradeSettlementPaymentMeans>`, iban)
+	}
+	return []byte(fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<rsm:CrossIndustryInvoice xmlns:rsm="urn:un:unece:uncefact:data:standard:CrossIndustryInvoice:100" xmlns:ram="urn:un:unece:uncefact:data:standard:ReusableAggregateBusinessInformationEntity:100" xmlns:udt="urn:un:unece:uncefact:data:standard:UnqualifiedDataType:100">
+  <rsm:ExchangedDocumentContext><ram:GuidelineSpecifiedDocumentContextParameter><ram:ID>urn:cen.eu:en16931:2017</ram:ID></ram:GuidelineSpecifiedDocumentContextParameter></rsm:ExchangedDocumentContext>
+  <rsm:ExchangedDocument><ram:ID>%s</ram:ID><ram:TypeCode>380</ram:TypeCode><ram:IssueDateTime><udt:DateTimeString format="102">%s</udt:DateTimeString></ram:IssueDateTime></rsm:ExchangedDocument>
+  <rsm:SupplyChainTradeTransaction>
+    <ram:IncludedSupplyChainTradeLineItem>
+      <ram:AssociatedDocumentLineDocument><ram:LineID>1</ram:LineID></ram:AssociatedDocumentLineDocument>
+      <ram:SpecifiedTradeProduct><ram:Name>Beratung</ram:Name></ram:SpecifiedTradeProduct>
+      <ram:SpecifiedLineTradeAgreement><ram:NetPriceProductTradePrice><ram:ChargeAmount>100.00</ram:ChargeAmount></ram:NetPriceProductTradePrice></ram:SpecifiedLineTradeAgreement>
+      <ram:SpecifiedLineTradeDelivery><ram:BilledQuantity unitCode="HUR">1</ram:BilledQuantity></ram:SpecifiedLineTradeDelivery>
+      <ram:SpecifiedLineTradeSettlement>
+        <ram:ApplicableTradeTax><ram:TypeCode>VAT</ram:TypeCode><ram:CategoryCode>S</ram:CategoryCode><ram:RateApplicablePercent>19</ram:RateApplicablePercent></ram:ApplicableTradeTax>
+        <ram:SpecifiedTradeSettlementLineMonetarySummation><ram:LineTotalAmount>100.00</ram:LineTotalAmount></ram:SpecifiedTradeSettlementLineMonetarySummation>
+      </ram:SpecifiedLineTradeSettlement>
+    </ram:IncludedSupplyChainTradeLineItem>
+    <ram:ApplicableHeaderTradeAgreement>
+      <ram:SellerTradeParty>
+        <ram:Name>Muster GmbH</ram:Name>
+        <ram:PostalTradeAddress><ram:PostcodeCode>10115</ram:PostcodeCode><ram:CityName>Berlin</ram:CityName><ram:CountryID>DE</ram:CountryID></ram:PostalTradeAddress>
+        <ram:SpecifiedTaxRegistration><ram:ID schemeID="VA">%s</ram:ID></ram:SpecifiedTaxRegistration>
+      </ram:SellerTradeParty>
+      <ram:BuyerTradeParty><ram:Name>Beispiel AG</ram:Name><ram:PostalTradeAddress><ram:CountryID>DE</ram:CountryID></ram:PostalTradeAddress></ram:BuyerTradeParty>
+    </ram:ApplicableHeaderTradeAgreement>
+    <ram:ApplicableHeaderTradeDelivery/>
+    <ram:ApplicableHeaderTradeSettlement>
+      <ram:InvoiceCurrencyCode>EUR</ram:InvoiceCurrencyCode>
+      %s
+      <ram:ApplicableTradeTax><ram:CalculatedAmount>19.00</ram:CalculatedAmount><ram:TypeCode>VAT</ram:TypeCode><ram:BasisAmount>100.00</ram:BasisAmount><ram:CategoryCode>S</ram:CategoryCode><ram:RateApplicablePercent>19</ram:RateApplicablePercent></ram:ApplicableTradeTax>
+      <ram:SpecifiedTradeSettlementHeaderMonetarySummation>
+        <ram:LineTotalAmount>100.00</ram:LineTotalAmount>
+        <ram:TaxBasisTotalAmount>100.00</ram:TaxBasisTotalAmount>
+        <ram:TaxTotalAmount currencyID="EUR">19.00</ram:TaxTotalAmount>
+        <ram:GrandTotalAmount>119.00</ram:GrandTotalAmount>
+        <ram:DuePayableAmount>119.00</ram:DuePayableAmount>
+      </ram:SpecifiedTradeSettlementHeaderMonetarySummation>
+    </ram:ApplicableHeaderTradeSettlement>
+  </rsm:SupplyChainTradeTransaction>
+</rsm:CrossIndustryInvoice>
+`, number, issueDate, vatID, means.String()))
+}
+
+func TestBatchBudget(t *testing.T) {
+	var budget batchBudget
+	for i := 0; i < maxBatchEntries; i++ {
+		if err := budget.take(); err != nil {
+			t.Fatalf("document %d: %v", i+1, err)
+		}
+	}
+	if err := budget.take(); err == nil {
+		t.Errorf("document %d: no error", maxBatchEntries+1)
+	}
+
+	budget = batchBudget{}
+	if data, err := budget.read(bytes.NewReader(make([]byte, maxBatchEntrySize))); err != nil || len(data) != maxBatchEntrySize {
+		t.Fatalf("entry at limit: %d bytes, %v", len(data), err)
+	}
+	if _, err := budget.read(bytes.NewReader(make([]byte, maxBatchEntrySize+1))); !errors.Is(err, errBatchEntryTooLarge) {
+		t.Errorf("entry above limit: %v", err)
+	}
+
+	// The entries fill the total size, the next one exceeds it
+	budget = batchBudget{size: maxBatchTotalSize - 10}
+	if _, err := budget.read(bytes.NewReader(make([]byte, 11))); !errors.Is(err, errBatchTooLarge) {
+		t.Errorf("total above limit: %v", err)
+	}
+}
+
+func TestReadZipInputs(t *testing.T) {
+	var b bytes.Buffer
+	archive := zip.NewWriter(&b)
+	for _, name := range []string{"a.xml", "sub/../b.xml", "__MACOSX/._a.xml", ".hidden.xml", "dir/"} {
+		archive.Create(name)
+	}
+	archive.Close()
+
+	var budget batchBudget
+	inputs, err := readZipInputs(b.Bytes(), &budget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, input := range inputs {
+		names = append(names, input.Name)
+	}
+	if got := strings.Join(names, ","); got != "a.xml,b.xml" {
+		t.Errorf("inputs = %s", got)
+	}
+
+	budget = batchBudget{entries: maxBatchEntries - 1}
+	if _, err := readZipInputs(b.Bytes(), &budget); err == nil {
+		t.Error("too many documents: no error")
+	}
+}
+
+func TestConvertBatch(t *testing.T) {
+	invoice := testInvoice("RE-1", "DE136695976", "20240131")
+	inputs := []batchInput{
+		{Name: "a/invoice.xml", Data: invoice},
+		{Name: "broken.xml", Data: []byte("<Invoice")},
+		{Name: "b/invoice.xml", Data: invoice},
+		{Name: "missing.xml", Err: errBatchEntryTooLarge},
+	}
+	results := convertBatch(inputs, "html", 3, nil)
+
+	want := []struct{ status, output string }{
+		{"ok", "a/invoice.html"},
+		{"error", ""},
+		{"ok", "b/invoice.html"},
+		{"error", ""},
+	}
+	for i, result := range results {
+		if result.File != inputs[i].Name || result.Status != want[i].status || result.Output != want[i].output {
+			t.Errorf("result %d = %s %s %q, want %s %q", i, result.File, result.Status, result.Output, want[i].status, want[i].output)
+		}
+	}
+	if results[3].Error != errBatchEntryTooLarge.Error() {
+		t.Errorf("error = %q", results[3].Error)
+	}
+
+	// Equal output names within the archive are numbered
+	results = convertBatch([]batchInput{{Name: "x.xml", Data: invoice}, {Name: "x.pdf", Data: invoice}}, "html", 1, nil)
+	if results[0].Output != "x.html" || results[1].Output != "x-2.html" {
+		t.Errorf("outputs = %q, %q", results[0].Output, results[1].Output)
+	}
+
+	archive, err := writeBatchArchive(results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, file := range reader.File {
+		names = append(names, file.Name)
+	}
+	if got := strings.Join(names, ","); got != "x.html,x-2.html,manifest.json,manifest.csv" {
+		t.Errorf("archive = %s", got)
+	}
+}
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"eBill-Convert/model"
+	"eBill-Convert/utils"
+)
+
+// Exit codes of the command line interface
+const (
+	exitOK      = 0
+	exitFailure = 1 // At least one input failed
+	exitUsage   = 2
+)
+
+const cliUsage = `Usage: eBill-Convert <command> [options] [input ...]
+
+Commands:
+  convert   Render or convert invoices (--to pdf|html|xr|json|ubl|cii|edifact|peppol)
+  validate  Check invoices against the EN 16931 mandatory elements and,
+            for Peppol BIS 3.0, the PEPPOL-EN16931 rules; verify IBAN, BIC,
+            VAT ID, Steuernummer, GLN, GTIN and Leitweg-ID
+  detect    Print syntax, profile and invoice number
+  extract   Extract the invoice XML from hybrid PDFs (ZUGFeRD, Factur-X)
+  export    Export invoice and line rows as CSV or XLSX (-format, -table)
+  datev     Export invoices as DATEV Buchungsstapel (-config, -bundle)
+  serve     Run the HTTP API (default when no command is given)
+
+Inputs are files or directories; "-" or no input reads from stdin.
+Hybrid PDFs, JSON invoices and EDIFACT INVOIC messages are accepted
+wherever an XML invoice is expected. ZUGFeRD 1.0 documents are read as
+CII D16B; "convert --to cii" upgrades them. Documents in an SBDH envelope
+are unwrapped; "convert --to peppol -sbdh" wraps the result. Order-X
+orders and UBL despatch advices are rendered by "convert --to pdf|html".
+"convert --to edifact" writes INVOIC D.96A interchanges in the UNOC
+character set, encoded as ISO 8859-1 rather than UTF-8.
+Run "eBill-Convert <command> -h" for the options of a command.
+
+The server watches the input folders listed in WATCH_DIRS if set
+(WATCH_SUCCESS_DIR, WATCH_ERROR_DIR, WATCH_FORMAT, WATCH_INTERVAL).
+DATEV_CONFIG names the JSON account mapping of the DATEV export.
+FINGERPRINT_STORE names the file recording the invoices processed by
+the server for duplicate detection (default fingerprints.jsonl).
+BANK_ACCOUNTS_STORE names the file of seller payment accounts; accounts
+not confirmed via /bankaccounts/confirm are flagged in rendered invoices
+(default bankaccounts.json).
+JOBS_DIR holds the asynchronous jobs (default jobs); finished jobs are
+removed after JOBS_RETENTION (default 168h). JOB_CALLBACK_HOSTS limits
+job callbacks to the listed hosts (comma-separated) instead of any
+public address.
+`
+
+// cliInput is a document read from a file or stdin.
+type cliInput struct {
+	Name string // File path, "-" for stdin
+	Data []byte
+}
+
+// runCLI executes a command and returns the process exit code.
+func runCLI(args []string) int {
+	if len(args) == 0 {
+		return runServe(nil)
+	}
+
+	command, args := args[0], args[1:]
+	switch command {
+	case "convert":
+		return runConvert(args)
+	case "validate":
+		return runValidate(args)
+	case "detect":
+		return runDetect(args)
+	case "extract":
+		return runExtract(args)
+	case "export":
+		return runExport(args)
+	case "datev":
+		return runDATEV(args)
+	case "serve":
+		return runServe(args)
+	case "help", "-h", "--help":
+		fmt.Fprint(os.Stdout, cliUsage)
+		return exitOK
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, cliUsage)
+		return exitUsage
+	}
+}
+
+func runServe(args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := flags.String("addr", ":8080", "listen address")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if err := serve(*addr); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to start server: %v\n", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+func runConvert(args []string) int {
+	flags := flag.NewFlagSet("convert", flag.ContinueOnError)
+	to := flags.String("to", "pdf", "output format: pdf, html, xr, json, ubl, cii, edifact (ISO 8859-1) or peppol")
+	output := flags.String("o", "", "output file or directory (default stdout)")
+	sbdh := flags.Bool("sbdh", false, "wrap ubl or peppol output in an SBDH envelope")
+	sender := flags.String("sender", "", "SBDH sender participant, e.g. 0088:4012345000009 (default seller electronic address)")
+	receiver := flags.String("receiver", "", "SBDH receiver participant (default buyer electronic address)")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	convert, ok := cliConverters[*to]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unsupported output format %q\n", *to)
+		return exitUsage
+	}
+	if *sbdh && !wrapsSBDH(*to) {
+		fmt.Fprintln(os.Stderr, "-sbdh requires --to ubl or peppol")
+		return exitUsage
+	}
+	prepare := invoiceXML
+	if *to == "pdf" || *to == "html" {
+		prepare = renderXML
+	}
+
+	inputs, err := readCLIInputs(flags.Args(), ".xml", ".pdf", ".xr", ".json", ".edi")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	status := exitOK
+	for _, input := range inputs {
+		xmlData, err := prepare(input.Data)
+		if err == nil {
+			var result []byte
+			result, err = convert(xmlData)
+			if err == nil && *sbdh {
+				result, err = utils.WrapSBDH(result, utils.SBDHOptions{Sender: *sender, Receiver: *receiver})
+			}
+			if err == nil {
+				err = writeCLIOutput(*output, input.Name, cliExtensions[*to], len(inputs), result)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", input.Name, err)
+			status = exitFailure
+		}
+	}
+	return status
+}
+
+// cliConverters maps the output formats of the convert command to the
+// renderers shared with the HTTP API.
+var cliConverters = map[string]func([]byte) ([]byte, error){
+	"pdf":  transformXMLToPDF,
+	"html": transformXMLToHTML,
+	"json": transformXMLToJSON,
+	"xr": func(xmlData []byte) ([]byte, error) {
+		xr, err := utils.TransformXML(bytes.NewReader(xmlData))
+		if err != nil {
+			return nil, err
+		}
+		return []byte(xml.Header + xr + "\n"), nil
+	},
+	"ubl":     cliSyntaxConverter(model.SyntaxUBL),
+	"cii":     cliSyntaxConverter(model.SyntaxCII),
+	"edifact": cliSyntaxConverter(model.SyntaxEDIFACT),
+	"peppol":  cliSyntaxConverter(model.SyntaxPeppol),
+}
+
+// cliExtensions are the file extensions of the convert output formats.
+var cliExtensions = map[string]string{
+	"pdf":     "pdf",
+	"html":    "html",
+	"json":    "json",
+	"xr":      "xr",
+	"ubl":     "ubl.xml",
+	"cii":     "cii.xml",
+	"edifact": "edi",
+	"peppol":  "peppol.xml",
+}
+
+// wrapsSBDH reports whether output in the format can be wrapped in an SBDH.
+func wrapsSBDH(format string) bool {
+	return strings.EqualFold(format, model.SyntaxUBL) || strings.EqualFold(format, model.SyntaxPeppol)
+}
+
+// cliSyntaxConverter converts to a CII or UBL document, warning on stderr
+// about fields that cannot be carried over.
+func cliSyntaxConverter(syntax string) func([]byte) ([]byte, error) {
+	return func(xmlData []byte) ([]byte, error) {
+		result, report, err := convertInvoice(xmlData, syntax)
+		if err != nil {
+			return nil, err
+		}
+		for _, dropped := range report.Dropped {
+			fmt.Fprintf(os.Stderr, "warning: %s (%s) not carried over: %s\n", dropped.Path, dropped.Value, dropped.Reason)
+		}
+		return result, nil
+	}
+}
+
+func runValidate(args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the reports as JSON")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	inputs, err := readCLIInputs(flags.Args(), ".xml", ".pdf")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	status := exitOK
+	reports := make(map[string]*utils.ValidationReport)
+	for _, input := range inputs {
+		xmlData, err := invoiceXML(input.Data)
+		var report *utils.ValidationReport
+		if err == nil {
+			report, err = utils.Validate(bytes.NewReader(xmlData))
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", input.Name, err)
+			status = exitFailure
+			continue
+		}
+		if !report.Valid {
+			status = exitFailure
+		}
+		reports[input.Name] = report
+
+		if *asJSON {
+			continue
+		}
+		state := "valid"
+		if !report.Valid {
+			state = "invalid"
+		}
+		fmt.Printf("%s: %s\n", input.Name, state)
+		for _, issue := range report.Issues {
+			fmt.Printf("  %s [%s] %s: %s\n", issue.Severity, issue.Rule, issue.Field, issue.Message)
+		}
+	}
+
+	if *asJSON {
+		if err := printJSON(reports); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+	}
+	return status
+}
+
+func runDetect(args []string) int {
+	flags := flag.NewFlagSet("detect", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the results as JSON")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	inputs, err := readCLIInputs(flags.Args(), ".xml", ".pdf")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	status := exitOK
+	results := make(map[string]*utils.DocumentInfo)
+	for _, input := range inputs {
+		xmlData, err := invoiceXML(input.Data)
+		var info *utils.DocumentInfo
+		if err == nil {
+			info, err = utils.DetectDocument(bytes.NewReader(xmlData))
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", input.Name, err)
+			status = exitFailure
+			continue
+		}
+		results[input.Name] = info
+		if !*asJSON {
+			fmt.Printf("%s\t%s\t%s\t%s\t%s\n", input.Name, info.Syntax, info.DocumentType, info.Profile, info.InvoiceNumber)
+		}
+	}
+
+	if *asJSON {
+		if err := printJSON(results); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+	}
+	return status
+}
+
+func runExtract(args []string) int {
+	flags := flag.NewFlagSet("extract", flag.ContinueOnError)
+	output := flags.String("o", "", "output file or directory (default stdout)")
+	all := flags.Bool("all", false, "extract all attachments into the output directory")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *all && *output == "" {
+		fmt.Fprintln(os.Stderr, "-all requires an output directory")
+		return exitUsage
+	}
+
+	inputs, err := readCLIInputs(flags.Args(), ".pdf")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	status := exitOK
+	for _, input := range inputs {
+		if *all {
+			files, err := utils.ExtractEmbeddedFiles(input.Data)
+			if err == nil {
+				dir := filepath.Join(*output, strings.TrimSuffix(filepath.Base(input.Name), filepath.Ext(input.Name)))
+				err = os.MkdirAll(dir, 0o755)
+				for _, file := range files {
+					if err != nil {
+						break
+					}
+					err = os.WriteFile(filepath.Join(dir, filepath.Base(file.Name)), file.Data, 0o644)
+				}
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", input.Name, err)
+				status = exitFailure
+			}
+			continue
+		}
+
+		file, err := utils.ExtractInvoiceXML(input.Data)
+		if err == nil {
+			err = writeCLIOutput(*output, input.Name, "xml", len(inputs), file.Data)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", input.Name, err)
+			status = exitFailure
+		}
+	}
+	return status
+}
+
+// invoiceXML returns the invoice XML of data, extracting it first if data
+// is a hybrid PDF or wrapped in an SBDH and writing JSON invoices and
+// EDIFACT INVOIC messages as CII.
+func invoiceXML(data []byte) ([]byte, error) {
+	if utils.IsSBDH(data) {
+		_, document, err := utils.UnwrapSBDH(data)
+		return document, err
+	}
+	if isJSON(data) {
+		return jsonToCII(data)
+	}
+	if model.IsEDIFACT(data) {
+		inv, err := model.ParseEDIFACT(data)
+		if err != nil {
+			return nil, err
+		}
+		return model.MarshalCII(inv), nil
+	}
+	if !utils.IsPDF(data) {
+		return data, nil
+	}
+	file, err := utils.ExtractInvoiceXML(data)
+	if err != nil {
+		return nil, err
+	}
+	return file.Data, nil
+}
+
+// renderXML prepares an input of the PDF and HTML renderers. Unlike
+// invoiceXML it keeps an SBDH envelope, whose header is rendered as well.
+func renderXML(data []byte) ([]byte, error) {
+	if utils.IsSBDH(data) {
+		return data, nil
+	}
+	return invoiceXML(data)
+}
+
+// readCLIInputs reads the named files, the files with one of the given
+// extensions below named directories, or stdin if names is empty or "-".
+func readCLIInputs(names []string, extensions ...string) ([]cliInput, error) {
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+
+	var inputs []cliInput
+	for _, name := range names {
+		if name == "-" {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return nil, fmt.Errorf("error reading stdin: %w", err)
+			}
+			inputs = append(inputs, cliInput{Name: "-", Data: data})
+			continue
+		}
+
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			data, err := os.ReadFile(name)
+			if err != nil {
+				return nil, err
+			}
+			inputs = append(inputs, cliInput{Name: name, Data: data})
+			continue
+		}
+
+		err = filepath.WalkDir(name, func(path string, entry os.DirEntry, err error) error {
+			if err != nil || entry.IsDir() {
+				return err
+			}
+			ext := strings.ToLower(filepath.Ext(path))
+			for _, e := range extensions {
+				if ext == e {
+					data, err := os.ReadFile(path)
+					if err != nil {
+						return err
+					}
+					inputs = append(inputs, cliInput{Name: path, Data: data})
+					break
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("no input files found")
+	}
+	return inputs, nil
+}
+
+// writeCLIOutput writes a result to stdout, to the output file or, for
+// several inputs or an existing directory, into the output directory.
+func writeCLIOutput(output, inputName, ext string, inputCount int, data []byte) error {
+	if output == "" || output == "-" {
+		if inputCount > 1 && ext == "pdf" {
+			return fmt.Errorf("several PDF documents cannot be written to stdout, use -o")
+		}
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+
+	info, err := os.Stat(output)
+	isDir := err == nil && info.IsDir()
+	if inputCount > 1 && !isDir {
+		if err := os.MkdirAll(output, 0o755); err != nil {
+			return err
+		}
+		isDir = true
+	}
+	if !isDir {
+		return os.WriteFile(output, data, 0o644)
+	}
+
+	base := "stdin"
+	if inputName != "-" {
+		base = strings.TrimSuffix(filepath.Base(inputName), filepath.Ext(inputName))
+	}
+	return os.WriteFile(filepath.Join(output, base+"."+ext), data, 0o644)
+}
+
+func printJSON(value any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"eBill-Convert/model"
+	"eBill-Convert/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-openapi/spec"
+)
+
+// droppedFieldsHeader carries the number of source fields a syntax
+// conversion could not carry over.
+const droppedFieldsHeader = "X-Dropped-Fields"
+
+func handleXMLtoUBL(c *gin.Context) {
+	handleSyntaxConversion(c, model.SyntaxUBL)
+}
+
+func handleXMLtoCII(c *gin.Context) {
+	handleSyntaxConversion(c, model.SyntaxCII)
+}
+
+func handleXMLtoEDIFACT(c *gin.Context) {
+	handleSyntaxConversion(c, model.SyntaxEDIFACT)
+}
+
+// handleXMLtoPeppol converts to UBL following Peppol BIS Billing 3.0.
+func handleXMLtoPeppol(c *gin.Context) {
+	handleSyntaxConversion(c, model.SyntaxPeppol)
+}
+
+// handleSyntaxConversion converts the uploaded invoice to the target syntax.
+// With report=true the response is JSON with the document and the list of
+// dropped fields instead of the plain XML; sbdh=true wraps UBL output in an
+// SBDH envelope.
+func handleSyntaxConversion(c *gin.Context, syntax string) {
+	file, err := c.FormFile("xmlFile")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file missing"})
+		return
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file open error"})
+		return
+	}
+	defer src.Close()
+
+	data := make([]byte, file.Size)
+	_, err = src.Read(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file read error"})
+		return
+	}
+
+	xmlData, err := invoiceXML(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, report, err := convertInvoice(xmlData, syntax)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s conversion failed: %v", syntax, err)})
+		return
+	}
+
+	if wrap, _ := strconv.ParseBool(c.Query("sbdh")); wrap {
+		if !wrapsSBDH(syntax) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "SBDH wrapping requires UBL or PEPPOL output"})
+			return
+		}
+		result, err = utils.WrapSBDH(result, utils.SBDHOptions{Sender: c.Query("sender"), Receiver: c.Query("receiver")})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.Header(droppedFieldsHeader, strconv.Itoa(len(report.Dropped)))
+	duplicate := checkDuplicate(c, xmlData)
+	withReport, _ := strconv.ParseBool(c.Query("report"))
+	if syntax == model.SyntaxEDIFACT {
+		if withReport {
+			c.JSON(http.StatusOK, gin.H{"edifact": latin1String(result), "report": report, "duplicate": duplicate})
+			return
+		}
+		c.Data(http.StatusOK, edifactContentType, result)
+		return
+	}
+	if withReport {
+		c.JSON(http.StatusOK, gin.H{"xml": string(result), "report": report, "duplicate": duplicate})
+		return
+	}
+	c.Data(http.StatusOK, "application/xml; charset=utf-8", result)
+}
+
+// convertInvoice converts a CII, UBL or XR document to syntax. XR holds only
+// EN 16931 terms, so nothing is dropped when converting from it.
+func convertInvoice(xmlData []byte, syntax string) ([]byte, *model.ConversionReport, error) {
+	if !utils.IsXR(xmlData) {
+		return model.Convert(xmlData, syntax)
+	}
+	result, err := utils.TransformXR(bytes.NewReader(xmlData), syntax)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, &model.ConversionReport{From: model.SyntaxXR, To: syntax, Dropped: []model.DroppedField{}}, nil
+}
+
+// edifactContentType is the media type of the INVOIC interchanges written,
+// which use the UNOC character set (ISO 8859-1).
+const edifactContentType = "application/EDIFACT; charset=iso-8859-1"
+
+// latin1String decodes ISO 8859-1 text such as an EDIFACT interchange.
+func latin1String(data []byte) string {
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// syntaxConversionPath documents the conversion endpoint to syntax.
+func syntaxConversionPath(syntax string) spec.PathItem {
+	target := syntax
+	if syntax == model.SyntaxPeppol {
+		target = "UBL following Peppol BIS Billing 3.0, with its CustomizationID and ProfileID"
+	}
+	produces := []string{"application/xml", "application/json"}
+	if syntax == model.SyntaxEDIFACT {
+		target = "an EDIFACT INVOIC D.96A interchange encoded in ISO 8859-1 (UNOC)"
+		produces = []string{edifactContentType, "application/json"}
+	}
+	parameters := []spec.Parameter{
+		{
+			ParamProps: spec.ParamProps{
+				Name:        "xmlFile",
+				In:          "formData",
+				Description: "The invoice to be converted.",
+				Required:    true,
+				Schema: &spec.Schema{
+					SchemaProps: spec.SchemaProps{
+						Type: []string{"file"},
+					},
+				},
+			},
+		},
+		{
+			ParamProps: spec.ParamProps{
+				Name:        "report",
+				In:          "query",
+				Description: "Return JSON with the document (xml) and the conversion report (report) listing the dropped fields.",
+			},
+			SimpleSchema: spec.SimpleSchema{
+				Type: "boolean",
+			},
+		},
+	}
+	if wrapsSBDH(syntax) {
+		query := func(name, typ, description string) spec.Parameter {
+			return spec.Parameter{
+				ParamProps:   spec.ParamProps{Name: name, In: "query", Description: description},
+				SimpleSchema: spec.SimpleSchema{Type: typ},
+			}
+		}
+		parameters = append(parameters,
+			query("sbdh", "boolean", "Wrap the document in an SBDH envelope (StandardBusinessDocument)."),
+			query("sender", "string", "SBDH sender participant identifier, e.g. 0088:4012345000009. Default is the seller electronic address."),
+			query("receiver", "string", "SBDH receiver participant identifier. Default is the buyer electronic address."))
+	}
+	return spec.PathItem{
+		PathItemProps: spec.PathItemProps{
+			Post: &spec.Operation{
+				OperationProps: spec.OperationProps{
+					Description: fmt.Sprintf("Converts a CII, ZUGFeRD 1.0, UBL, XR or EDIFACT INVOIC invoice (or hybrid PDF) to %s. ZUGFeRD 1.0 documents are upgraded to CII D16B. Elements outside EN 16931, such as EXTENDED profile fields, cannot be carried over; their number is returned in the %s header.", target, droppedFieldsHeader),
+					Consumes:    []string{"multipart/form-data"},
+					Produces:    produces,
+					Parameters:  parameters,
+					Responses: &spec.Responses{
+						ResponsesProps: spec.ResponsesProps{
+							StatusCodeResponses: map[int]spec.Response{
+								200: {
+									ResponseProps: spec.ResponseProps{
+										Description: syntax + " document",
+										Schema: &spec.Schema{
+											SchemaProps: spec.SchemaProps{
+												Type:   []string{"string"},
+												Format: "binary",
+											},
+										},
+									},
+								},
+								400: errorResponse("File missing or unreadable, or SBDH participant missing."),
+								500: errorResponse("Conversion failed"),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
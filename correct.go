@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"eBill-Convert/model"
+	"eBill-Convert/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-openapi/spec"
+)
+
+// handleCorrect derives a credit note or corrective invoice from the
+// uploaded invoice.
+func handleCorrect(c *gin.Context) {
+	file, err := c.FormFile("xmlFile")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file missing"})
+		return
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file open error"})
+		return
+	}
+	defer src.Close()
+
+	data := make([]byte, file.Size)
+	_, err = src.Read(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file read error"})
+		return
+	}
+
+	xmlData, err := invoiceXML(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	original, err := parseInvoiceModel(xmlData)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	opts := model.CorrectionOptions{
+		TypeCode: model.DocumentTypeCode(c.PostForm("type")),
+		Number:   c.PostForm("number"),
+		Reason:   c.PostForm("reason"),
+	}
+	opts.IssueDate = model.NewDate(time.Now().Date())
+	if value := c.PostForm("issueDate"); value != "" {
+		if opts.IssueDate, err = model.ParseDate(value, ""); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if opts.Lines, err = parseLineSelections(c.PostForm("lines")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	syntax := strings.ToUpper(c.PostForm("syntax"))
+	if syntax == "" {
+		syntax = original.Syntax
+	}
+	if syntax != model.SyntaxCII && syntax != model.SyntaxUBL {
+		syntax = model.SyntaxCII
+	}
+
+	inv, err := model.Correct(original, opts)
+	if err != nil {
+		var inputErr *model.InputError
+		if errors.As(err, &inputErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid correction", "details": inputErr.Problems})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := model.Marshal(inv, syntax)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s conversion failed: %v", syntax, err)})
+		return
+	}
+	report, err := utils.Validate(bytes.NewReader(result))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("validation failed: %v", err)})
+		return
+	}
+	if !report.Valid {
+		var details []string
+		for _, issue := range report.Issues {
+			details = append(details, fmt.Sprintf("%s: %s (%s)", issue.Field, issue.Message, issue.Rule))
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid correction", "details": details})
+		return
+	}
+	c.Data(http.StatusOK, "application/xml; charset=utf-8", result)
+}
+
+// parseLineSelections parses a comma separated list of line identifiers,
+// each optionally followed by a colon and the quantity, e.g. "1,3:2.5".
+func parseLineSelections(value string) ([]model.LineSelection, error) {
+	var selections []model.LineSelection
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		id, quantity, partial := strings.Cut(item, ":")
+		selection := model.LineSelection{LineID: strings.TrimSpace(id)}
+		if partial {
+			var err error
+			if selection.Quantity, err = model.ParseDecimal(quantity); err != nil {
+				return nil, fmt.Errorf("line %s: %w", selection.LineID, err)
+			}
+		}
+		selections = append(selections, selection)
+	}
+	return selections, nil
+}
+
+func correctPath() spec.PathItem {
+	form := func(name, description string, required bool) spec.Parameter {
+		return spec.Parameter{
+			ParamProps:   spec.ParamProps{Name: name, In: "formData", Description: description, Required: required},
+			SimpleSchema: spec.SimpleSchema{Type: "string"},
+		}
+	}
+	return spec.PathItem{
+		PathItemProps: spec.PathItemProps{
+			Post: &spec.Operation{
+				OperationProps: spec.OperationProps{
+					Description: "Creates a credit note (381) or corrective invoice (384) for the uploaded invoice. The new document references the original (BG-3), copies its parties and the selected lines and recomputes all totals. A corrective invoice negates the quantities.",
+					Consumes:    []string{"multipart/form-data"},
+					Produces:    []string{"application/xml"},
+					Parameters: []spec.Parameter{
+						{
+							ParamProps: spec.ParamProps{
+								Name:        "xmlFile",
+								In:          "formData",
+								Description: "The original invoice.",
+								Required:    true,
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type: []string{"file"},
+									},
+								},
+							},
+						},
+						form("number", "Number of the new document (BT-1).", true),
+						form("type", "381 (credit note, default) or 384 (corrective invoice).", false),
+						form("issueDate", "Issue date (BT-2), default today.", false),
+						form("reason", "Reason, added as invoice note.", false),
+						form("lines", "Lines to credit, e.g. \"1,3:2.5\" for line 1 and 2.5 units of line 3. Default all lines.", false),
+						form("syntax", "CII or UBL, default the syntax of the original.", false),
+					},
+					Responses: &spec.Responses{
+						ResponsesProps: spec.ResponsesProps{
+							StatusCodeResponses: map[int]spec.Response{
+								200: {
+									ResponseProps: spec.ResponseProps{
+										Description: "Credit note or corrective invoice",
+										Schema: &spec.Schema{
+											SchemaProps: spec.SchemaProps{
+												Type:   []string{"string"},
+												Format: "binary",
+											},
+										},
+									},
+								},
+								400: errorResponse("File missing or unreadable, or invalid selection; details lists the problems."),
+								500: errorResponse("Conversion failed"),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
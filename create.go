@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"eBill-Convert/model"
+	"eBill-Convert/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-openapi/spec"
+	"github.com/jung-kurt/gofpdf"
+)
+
+// createParams are the request parameters of /create that are not part of
+// the invoice.
+var createParams = map[string]bool{"profile": true, "syntax": true, "pdf": true}
+
+// handleCreate creates a CII or UBL invoice from a structured invoice given
+// as JSON body or as form fields, optionally as hybrid PDF.
+func handleCreate(c *gin.Context) {
+	param := func(name string) string {
+		if value := c.Query(name); value != "" {
+			return value
+		}
+		return c.PostForm(name)
+	}
+
+	inv, err := createInput(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	profile, err := model.ParseProfile(param("profile"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	syntax := strings.ToUpper(param("syntax"))
+	if syntax == "" {
+		syntax = model.SyntaxCII
+	}
+	withPDF, _ := strconv.ParseBool(param("pdf"))
+	if withPDF && syntax != model.SyntaxCII {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "hybrid PDF requires syntax CII"})
+		return
+	}
+
+	result, err := model.Create(inv, profile, syntax)
+	if err != nil {
+		var inputErr *model.InputError
+		if errors.As(err, &inputErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid invoice", "details": inputErr.Problems})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := utils.Validate(bytes.NewReader(result))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("validation failed: %v", err)})
+		return
+	}
+	if !report.Valid {
+		var details []string
+		for _, issue := range report.Issues {
+			details = append(details, fmt.Sprintf("%s: %s (%s)", issue.Field, issue.Message, issue.Rule))
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid invoice", "details": details})
+		return
+	}
+
+	if !withPDF {
+		c.Data(http.StatusOK, "application/xml; charset=utf-8", result)
+		return
+	}
+	pdfData, err := hybridPDF(inv, result, profile)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("PDF transformation failed: %v", err)})
+		return
+	}
+	c.Data(http.StatusOK, "application/pdf", pdfData)
+}
+
+// createInput reads the structured invoice of a /create request: the JSON
+// body, or form fields named by the JSON paths of the model with dots, e.g.
+// seller.name or lines.0.price.net.
+func createInput(c *gin.Context) (*model.Invoice, error) {
+	inv := &model.Invoice{}
+	if strings.HasPrefix(c.ContentType(), "application/json") {
+		decoder := json.NewDecoder(c.Request.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(inv); err != nil {
+			return nil, fmt.Errorf("error decoding JSON: %w", err)
+		}
+		return inv, nil
+	}
+
+	if err := c.Request.ParseMultipartForm(32 << 20); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return nil, fmt.Errorf("error reading form: %w", err)
+	}
+	data, err := json.Marshal(nestForm(c.Request.PostForm))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, inv); err != nil {
+		return nil, fmt.Errorf("error reading form: %w", err)
+	}
+	return inv, nil
+}
+
+// nestForm turns dotted form field names into nested objects; numeric
+// segments become array indexes.
+func nestForm(values url.Values) any {
+	root := map[string]any{}
+	for key, value := range values {
+		if createParams[key] || len(value) == 0 {
+			continue
+		}
+		node := root
+		segments := strings.Split(key, ".")
+		for _, segment := range segments[:len(segments)-1] {
+			child, ok := node[segment].(map[string]any)
+			if !ok {
+				child = map[string]any{}
+				node[segment] = child
+			}
+			node = child
+		}
+		node[segments[len(segments)-1]] = value[len(value)-1]
+	}
+	return formArrays(root)
+}
+
+// formArrays replaces objects with only numeric keys by arrays ordered by
+// index.
+func formArrays(value any) any {
+	object, ok := value.(map[string]any)
+	if !ok {
+		return value
+	}
+	indexes := make([]int, 0, len(object))
+	for key, child := range object {
+		object[key] = formArrays(child)
+		if index, err := strconv.Atoi(key); err == nil && index >= 0 {
+			indexes = append(indexes, index)
+		}
+	}
+	if len(object) == 0 || len(indexes) != len(object) {
+		return object
+	}
+	sort.Ints(indexes)
+	array := make([]any, 0, len(indexes))
+	for _, index := range indexes {
+		array = append(array, object[strconv.Itoa(index)])
+	}
+	return array
+}
+
+// hybridPDF renders the invoice and embeds the CII document with the
+// attachment name and XMP metadata of ZUGFeRD 2 / Factur-X. The document
+// uses the PDF core fonts and is therefore not PDF/A-3 conformant.
+func hybridPDF(inv *model.Invoice, ciiData []byte, profile string) ([]byte, error) {
+	filename, version, level := "factur-x.xml", "1.0", "EN 16931"
+	switch profile {
+	case model.ProfileExtended:
+		level = "EXTENDED"
+	case model.ProfileXRechnung:
+		filename, version, level = "xrechnung.xml", "3.0", "XRECHNUNG"
+	}
+
+	pdf, err := invoicePDF(inv, nil)
+	if err != nil {
+		return nil, err
+	}
+	pdf.SetAttachments([]gofpdf.Attachment{{Content: ciiData, Filename: filename, Description: "Invoice"}})
+	pdf.SetXmpMetadata([]byte(fmt.Sprintf(facturXMetadata, filename, version, level)))
+	return outputPDF(pdf)
+}
+
+const facturXMetadata = `<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+  <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+    <rdf:Description rdf:about="" xmlns:fx="urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0#">
+      <fx:DocumentType>INVOICE</fx:DocumentType>
+      <fx:DocumentFileName>%s</fx:DocumentFileName>
+      <fx:Version>%s</fx:Version>
+      <fx:ConformanceLevel>%s</fx:ConformanceLevel>
+    </rdf:Description>
+  </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
+
+func createPath() spec.PathItem {
+	query := func(name, description, typ string) spec.Parameter {
+		return spec.Parameter{
+			ParamProps:   spec.ParamProps{Name: name, In: "query", Description: description},
+			SimpleSchema: spec.SimpleSchema{Type: typ},
+		}
+	}
+	return spec.PathItem{
+		PathItemProps: spec.PathItemProps{
+			Post: &spec.Operation{
+				OperationProps: spec.OperationProps{
+					Description: "Creates an invoice from structured input: the semantic model as JSON (seller, buyer, lines, allowances, charges, paymentTerms, ...) or form fields named by its JSON paths, e.g. seller.name or lines.0.price.net. Line net amounts, VAT breakdown and document totals are computed.",
+					Consumes:    []string{"application/json", "application/x-www-form-urlencoded", "multipart/form-data"},
+					Produces:    []string{"application/xml", "application/pdf"},
+					Parameters: []spec.Parameter{
+						{
+							ParamProps: spec.ParamProps{
+								Name:        "invoice",
+								In:          "body",
+								Description: "The invoice without computed amounts.",
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type: []string{"object"},
+									},
+								},
+							},
+						},
+						query("profile", "EN16931 (default), XRECHNUNG or EXTENDED (ZUGFeRD, CII only).", "string"),
+						query("syntax", "CII (default) or UBL.", "string"),
+						query("pdf", "Return a hybrid PDF with the embedded CII document.", "boolean"),
+					},
+					Responses: &spec.Responses{
+						ResponsesProps: spec.ResponsesProps{
+							StatusCodeResponses: map[int]spec.Response{
+								200: {
+									ResponseProps: spec.ResponseProps{
+										Description: "CII or UBL document, or hybrid PDF",
+										Schema: &spec.Schema{
+											SchemaProps: spec.SchemaProps{
+												Type:   []string{"string"},
+												Format: "binary",
+											},
+										},
+									},
+								},
+								400: errorResponse("Invalid input; details lists the missing fields."),
+								500: errorResponse("PDF transformation failed"),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
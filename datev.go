@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"eBill-Convert/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-openapi/spec"
+)
+
+// datevConfig returns the DATEV configuration of the file named by
+// DATEV_CONFIG, or the defaults.
+func datevConfig() (utils.DATEVConfig, error) {
+	path := os.Getenv("DATEV_CONFIG")
+	if path == "" {
+		return utils.DefaultDATEVConfig(), nil
+	}
+	return utils.LoadDATEVConfig(path)
+}
+
+// datevDocuments parses the inputs of a DATEV export.
+func datevDocuments(names []string, data [][]byte) ([]utils.DATEVDocument, error) {
+	docs := make([]utils.DATEVDocument, 0, len(names))
+	for i, name := range names {
+		inv, err := parseInvoiceFile(data[i])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		docs = append(docs, utils.DATEVDocument{Invoice: inv, Filename: filepath.Base(name), Data: data[i]})
+	}
+	return docs, nil
+}
+
+// handleDATEV exports the uploaded invoices as DATEV Buchungsstapel, or
+// with bundle=true as ZIP archive with the original files for DATEV
+// Unternehmen online. The form field config overrides the configuration.
+func handleDATEV(c *gin.Context) {
+	config, err := datevConfig()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if value := c.PostForm("config"); value != "" {
+		if err := json.Unmarshal([]byte(value), &config); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid config: %v", err)})
+			return
+		}
+	}
+	bundle, _ := strconv.ParseBool(c.PostForm("bundle"))
+
+	inputs, err := readBatchInputs(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var names []string
+	var data [][]byte
+	for _, input := range inputs {
+		if input.Err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %v", input.Name, input.Err)})
+			return
+		}
+		names = append(names, input.Name)
+		data = append(data, input.Data)
+	}
+	docs, err := datevDocuments(names, data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if bundle {
+		archive, err := utils.DATEVBundle(docs, config, time.Now())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("DATEV export failed: %v", err)})
+			return
+		}
+		c.Header("Content-Disposition", `attachment; filename="datev.zip"`)
+		c.Data(http.StatusOK, "application/zip", archive)
+		return
+	}
+	result, err := utils.DATEVExport(docs, config, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("DATEV export failed: %v", err)})
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="EXTF_Buchungsstapel.csv"`)
+	c.Data(http.StatusOK, "text/csv; charset=windows-1252", result)
+}
+
+func runDATEV(args []string) int {
+	flags := flag.NewFlagSet("datev", flag.ContinueOnError)
+	configPath := flags.String("config", os.Getenv("DATEV_CONFIG"), "account mapping (JSON)")
+	bundle := flags.Bool("bundle", false, "write a ZIP archive with the original files for DATEV Unternehmen online")
+	output := flags.String("o", "", "output file (default stdout)")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	config := utils.DefaultDATEVConfig()
+	if *configPath != "" {
+		var err error
+		if config, err = utils.LoadDATEVConfig(*configPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitUsage
+		}
+	}
+
+	inputs, err := readCLIInputs(flags.Args(), ".xml", ".pdf", ".xr", ".edi")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	var names []string
+	var data [][]byte
+	for _, input := range inputs {
+		names = append(names, input.Name)
+		data = append(data, input.Data)
+	}
+	docs, err := datevDocuments(names, data)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+
+	var result []byte
+	name, ext := "EXTF_Buchungsstapel", "csv"
+	if *bundle {
+		name, ext = "datev", "zip"
+		result, err = utils.DATEVBundle(docs, config, time.Now())
+	} else {
+		result, err = utils.DATEVExport(docs, config, time.Now())
+	}
+	if err == nil {
+		err = writeCLIOutput(*output, name, ext, 1, result)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+func datevPath() spec.PathItem {
+	form := func(name, description, typ string) spec.Parameter {
+		return spec.Parameter{
+			ParamProps:   spec.ParamProps{Name: name, In: "formData", Description: description},
+			SimpleSchema: spec.SimpleSchema{Type: typ},
+		}
+	}
+	return spec.PathItem{
+		PathItemProps: spec.PathItemProps{
+			Post: &spec.Operation{
+				OperationProps: spec.OperationProps{
+					Description: "Exports invoices as DATEV Buchungsstapel (EXTF format 13) with one booking per VAT category and rate. BU-Schlüssel and accounts follow the configuration of DATEV_CONFIG: accounts per supplier and per VAT category. Only EUR invoices of one fiscal year are exported; foreign currency invoices are rejected, as they need an exchange rate per booking.",
+					Consumes:    []string{"multipart/form-data"},
+					Produces:    []string{"text/csv", "application/zip"},
+					Parameters: []spec.Parameter{
+						{
+							ParamProps: spec.ParamProps{
+								Name:        "xmlFile",
+								In:          "formData",
+								Description: "Invoices (XML or hybrid PDF); repeat the field for several files.",
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type: []string{"file"},
+									},
+								},
+							},
+						},
+						{
+							ParamProps: spec.ParamProps{
+								Name:        "archive",
+								In:          "formData",
+								Description: "ZIP archive of invoices.",
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type: []string{"file"},
+									},
+								},
+							},
+						},
+						form("config", "JSON overriding the configuration, e.g. {\"consultantNumber\": 1001, \"partners\": {\"DE123456789\": {\"account\": \"3400\", \"contraAccount\": \"70001\"}}}.", "string"),
+						form("bundle", "Return a ZIP archive with the Buchungsstapel, the original files and document.xml for DATEV Unternehmen online.", "boolean"),
+					},
+					Responses: &spec.Responses{
+						ResponsesProps: spec.ResponsesProps{
+							StatusCodeResponses: map[int]spec.Response{
+								200: {
+									ResponseProps: spec.ResponseProps{
+										Description: "Buchungsstapel (Windows-1252) or ZIP archive",
+										Schema: &spec.Schema{
+											SchemaProps: spec.SchemaProps{
+												Type:   []string{"string"},
+												Format: "binary",
+											},
+										},
+									},
+								},
+								400: errorResponse("File missing, unreadable or not an invoice."),
+								500: errorResponse("Export failed"),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"eBill-Convert/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-openapi/spec"
+)
+
+// Headers flagging an invoice processed before
+const (
+	duplicateHeader   = "X-Duplicate"    // duplicate or near-duplicate
+	duplicateOfHeader = "X-Duplicate-Of" // ID of the latest matching fingerprint
+)
+
+// Sources of fingerprints
+const (
+	sourceBatch  = "batch"
+	sourceJob    = "job"
+	sourceWatch  = "watch"
+	sourceUpload = "upload" // Conversion and rendering endpoints
+)
+
+// Duplicate states
+const (
+	duplicateExact = "duplicate"
+	duplicateNear  = "near-duplicate"
+)
+
+const (
+	maxDuplicateMatches = 10  // Matches reported per invoice, latest first
+	defaultHistoryLimit = 100 // Fingerprints returned by /history
+)
+
+// fingerprint identifies a processed invoice. The store appends one JSON
+// line per fingerprint.
+type fingerprint struct {
+	ID          int       `json:"id,omitempty"` // Zero until stored
+	Seller      string    `json:"seller"`       // VAT ID, tax number, legal registration, identifier or name
+	Number      string    `json:"number"`       // BT-1
+	IssueDate   string    `json:"issueDate"`
+	GrandTotal  string    `json:"grandTotal"` // BT-112
+	Currency    string    `json:"currency,omitempty"`
+	CreditNote  bool      `json:"creditNote,omitempty"`
+	ContentHash string    `json:"contentHash"`   // SHA-256 of the invoice XML
+	Source      string    `json:"source"`        // batch, job, watch or upload
+	Job         string    `json:"job,omitempty"` // ID of the job the invoice was submitted with
+	File        string    `json:"file,omitempty"`
+	ProcessedAt time.Time `json:"processedAt"`
+}
+
+// duplicateCheck reports the fingerprints an invoice matches.
+type duplicateCheck struct {
+	Status  string           `json:"status"` // duplicate or near-duplicate
+	Matches []duplicateMatch `json:"matches"`
+}
+
+// duplicateMatch is a fingerprint matching an invoice and the reason.
+type duplicateMatch struct {
+	fingerprint
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+// fingerprintStore keeps the fingerprints of all processed invoices in a
+// JSON Lines file and in memory.
+type fingerprintStore struct {
+	mu      sync.Mutex
+	file    *os.File
+	records []fingerprint
+}
+
+var fingerprints *fingerprintStore
+
+// newFingerprintStore loads the fingerprints stored in path and opens it
+// for appending.
+func newFingerprintStore(path string) (*fingerprintStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("error creating fingerprint directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening fingerprint store: %w", err)
+	}
+
+	s := &fingerprintStore{file: file}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var record fingerprint
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			log.Printf("skipping fingerprint in line %d: %v", line, err)
+			continue
+		}
+		s.records = append(s.records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("error reading fingerprint store: %w", err)
+	}
+	return s, nil
+}
+
+// newFingerprint computes the fingerprint of the invoice. Documents that
+// are not invoices have none.
+func newFingerprint(source, file string, xmlData []byte) (fingerprint, bool) {
+	inv, err := parseInvoiceModel(xmlData)
+	if err != nil {
+		return fingerprint{}, false
+	}
+	hash := sha256.Sum256(fingerprintContent(xmlData))
+	record := fingerprint{
+		Seller:      sellerKey(inv.Seller),
+		Number:      inv.Number,
+		IssueDate:   inv.IssueDate.String(),
+		Currency:    inv.CurrencyCode,
+		CreditNote:  inv.TypeCode.IsCreditNote(),
+		ContentHash: hex.EncodeToString(hash[:]),
+		Source:      source,
+		File:        file,
+		ProcessedAt: time.Now().UTC(),
+	}
+	if inv.Totals.Grand.IsSet() {
+		record.GrandTotal = inv.Totals.Grand.Round(2).String()
+	}
+	return record, true
+}
+
+// check returns for each fingerprint the stored ones and those before it
+// in records that it matches, or nil, without storing anything. Nothing is
+// reported while no store is configured.
+func (s *fingerprintStore) check(records []fingerprint) []*duplicateCheck {
+	if s == nil {
+		return make([]*duplicateCheck, len(records))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	checks := make([]*duplicateCheck, len(records))
+	for i, record := range records {
+		checks[i] = matchFingerprints(record, s.records, records[:i])
+	}
+	return checks
+}
+
+// store appends the fingerprints to the store. Fingerprints of inputs
+// processed before (sameIngestion) are not stored again.
+func (s *fingerprintStore) store(records []fingerprint) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+next:
+	for _, record := range records {
+		for _, earlier := range s.records {
+			if sameIngestion(record, earlier) {
+				continue next
+			}
+		}
+		record.ID = 1
+		if n := len(s.records); n > 0 {
+			record.ID = s.records[n-1].ID + 1
+		}
+		s.records = append(s.records, record)
+		if data, err := json.Marshal(record); err != nil {
+			log.Printf("error encoding fingerprint: %v", err)
+		} else if _, err := s.file.Write(append(data, '\n')); err != nil {
+			log.Printf("error writing fingerprint: %v", err)
+		}
+	}
+}
+
+// record stores the fingerprint of a processed invoice and returns the
+// earlier fingerprints it matches, or nil if there are none.
+func (s *fingerprintStore) record(source, file string, xmlData []byte) *duplicateCheck {
+	if s == nil {
+		return nil
+	}
+	record, ok := newFingerprint(source, file, xmlData)
+	if !ok {
+		return nil
+	}
+	check := s.check([]fingerprint{record})[0]
+	s.store([]fingerprint{record})
+	return check
+}
+
+// matchFingerprints compares the fingerprint with the stored ones and the
+// pending ones of the same batch, latest first. Earlier processing of the
+// same input is not a duplicate, and the stored inputs of a resumed job
+// are left to the pending ones, so that it reports what its first run did.
+func matchFingerprints(record fingerprint, stored, pending []fingerprint) *duplicateCheck {
+	var check *duplicateCheck
+	match := func(earlier fingerprint) {
+		status, reason := compareFingerprints(record, earlier)
+		if status == "" {
+			return
+		}
+		if check == nil {
+			check = &duplicateCheck{Status: duplicateNear}
+		}
+		if status == duplicateExact {
+			check.Status = duplicateExact
+		}
+		if len(check.Matches) < maxDuplicateMatches {
+			check.Matches = append(check.Matches, duplicateMatch{fingerprint: earlier, Status: status, Reason: reason})
+		}
+	}
+	for i := len(pending) - 1; i >= 0; i-- {
+		if !sameIngestion(record, pending[i]) {
+			match(pending[i])
+		}
+	}
+	for i := len(stored) - 1; i >= 0; i-- {
+		if !sameIngestion(record, stored[i]) && !sameJob(record, stored[i]) {
+			match(stored[i])
+		}
+	}
+	return check
+}
+
+// sameJob reports whether both fingerprints stem from the same job.
+func sameJob(record, earlier fingerprint) bool {
+	return record.Source == sourceJob && earlier.Source == sourceJob && record.Job != "" && record.Job == earlier.Job
+}
+
+// sameIngestion reports whether both fingerprints stem from processing the
+// same input again: an upload of the same content, which is only viewed
+// again, or the same input of a job resumed after a restart.
+func sameIngestion(record, earlier fingerprint) bool {
+	if record.ContentHash != earlier.ContentHash || record.Source != earlier.Source {
+		return false
+	}
+	switch record.Source {
+	case sourceUpload:
+		return true
+	case sourceJob:
+		return record.Job != "" && record.Job == earlier.Job && record.File == earlier.File
+	}
+	return false
+}
+
+// history returns the fingerprints of the seller and invoice number, either
+// of which may be empty, latest first. The seller is an identifier as in
+// sellerKey or a name.
+func (s *fingerprintStore) history(seller, number string, limit int) []fingerprint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := []fingerprint{}
+	for i := len(s.records) - 1; i >= 0 && len(records) < limit; i-- {
+		record := s.records[i]
+		if seller != "" && record.Seller != upperAlphanumeric(seller) && !strings.EqualFold(record.Seller, strings.TrimSpace(seller)) {
+			continue
+		}
+		if number != "" && normalizeInvoiceNumber(record.Number) != normalizeInvoiceNumber(number) {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// compareFingerprints classifies an earlier fingerprint. Identical content
+// or the same seller, number, issue date and total make a duplicate. The
+// same seller and number written differently or with another date or
+// total, and the same seller, date and total under another number, make a
+// near-duplicate.
+func compareFingerprints(record, earlier fingerprint) (string, string) {
+	if record.ContentHash == earlier.ContentHash {
+		return duplicateExact, "same content"
+	}
+	if record.Seller == "" || record.Seller != earlier.Seller || record.CreditNote != earlier.CreditNote {
+		return "", ""
+	}
+	sameAmount := record.IssueDate == earlier.IssueDate && record.GrandTotal == earlier.GrandTotal && record.Currency == earlier.Currency
+	switch {
+	case record.Number == earlier.Number && sameAmount:
+		return duplicateExact, "same seller, number, issue date and total"
+	case normalizeInvoiceNumber(record.Number) == normalizeInvoiceNumber(earlier.Number):
+		return duplicateNear, "same seller and number"
+	case sameAmount && record.GrandTotal != "":
+		return duplicateNear, "same seller, issue date and total"
+	}
+	return "", ""
+}
+
+// sellerKey identifies the seller by the most specific identifier given:
+// VAT ID (BT-31), tax number (BT-32), legal registration (BT-30) or global
+// ID (BT-29), keeping only letters and digits. Like CheckVATID, it thereby
+// reads "DE 136.695.976" as DE136695976. Sellers without identifier are
+// known by name.
+func sellerKey(seller model.Party) string {
+	switch {
+	case seller.VATID != "":
+		return upperAlphanumeric(seller.VATID)
+	case seller.TaxRegistrationID != "":
+		return upperAlphanumeric(seller.TaxRegistrationID)
+	case seller.LegalRegistrationID.ID != "":
+		return upperAlphanumeric(seller.LegalRegistrationID.ID)
+	case len(seller.Identifiers) > 0 && seller.Identifiers[0].ID != "":
+		return upperAlphanumeric(seller.Identifiers[0].ID)
+	}
+	return strings.ToLower(strings.TrimSpace(seller.Name))
+}
+
+// normalizeInvoiceNumber reduces an invoice number to its upper case letters
+// and digits, so that "RE-2024/0815" and "re 2024 0815" compare equal.
+func normalizeInvoiceNumber(number string) string {
+	return upperAlphanumeric(number)
+}
+
+// upperAlphanumeric removes everything but letters and digits and
+// upper-cases the rest.
+func upperAlphanumeric(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return -1
+	}, s)
+}
+
+// fingerprintContent strips the byte order mark and the XML declaration, so
+// that an invoice unwrapped from an envelope or PDF hashes like the file.
+func fingerprintContent(xmlData []byte) []byte {
+	content := bytes.TrimSpace(bytes.TrimPrefix(xmlData, []byte("\xef\xbb\xbf")))
+	if bytes.HasPrefix(content, []byte("<?xml")) {
+		if end := bytes.Index(content, []byte("?>")); end >= 0 {
+			content = bytes.TrimSpace(content[end+2:])
+		}
+	}
+	return content
+}
+
+// checkDuplicate records an uploaded invoice and flags it with the
+// X-Duplicate and X-Duplicate-Of headers if it matches an earlier one.
+// Uploading the same content again is not reported.
+func checkDuplicate(c *gin.Context, xmlData []byte) *duplicateCheck {
+	check := fingerprints.record(sourceUpload, "", xmlData)
+	if check != nil {
+		c.Header(duplicateHeader, check.Status)
+		c.Header(duplicateOfHeader, strconv.Itoa(check.Matches[0].ID))
+	}
+	return check
+}
+
+// handleHistory lists the fingerprints of processed invoices, optionally
+// filtered by seller and invoice number.
+func handleHistory(c *gin.Context) {
+	if fingerprints == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "fingerprint store not configured"})
+		return
+	}
+	limit := defaultHistoryLimit
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid limit: %s", value)})
+			return
+		}
+		limit = n
+	}
+	c.JSON(http.StatusOK, fingerprints.history(c.Query("seller"), c.Query("number"), limit))
+}
+
+func historyPath() spec.PathItem {
+	query := func(name, typ, description string) spec.Parameter {
+		return spec.Parameter{
+			ParamProps:   spec.ParamProps{Name: name, In: "query", Description: description},
+			SimpleSchema: spec.SimpleSchema{Type: typ},
+		}
+	}
+	return spec.PathItem{
+		PathItemProps: spec.PathItemProps{
+			Get: &spec.Operation{
+				OperationProps: spec.OperationProps{
+					Description: "Lists the fingerprints (seller, invoice number, issue date, grand total and content hash) of the invoices processed by /batch, /jobs, the watch folders and the conversion and rendering endpoints, latest first. An invoice matching an earlier fingerprint is flagged in the batch manifest and the watch folder status; the conversion and rendering endpoints set the X-Duplicate header (duplicate or near-duplicate), X-Duplicate-Of naming the latest match, and a duplicate field in their JSON output. Uploading the same content again, or resuming a job after a restart, is not reported.",
+					Produces:    []string{"application/json"},
+					Parameters: []spec.Parameter{
+						query("seller", "string", "Seller VAT ID or other identifier as fingerprinted."),
+						query("number", "string", "Invoice number; punctuation and case are ignored."),
+						query("limit", "integer", "Maximum number of fingerprints, default 100."),
+					},
+					Responses: &spec.Responses{
+						ResponsesProps: spec.ResponsesProps{
+							StatusCodeResponses: map[int]spec.Response{
+								200: {
+									ResponseProps: spec.ResponseProps{
+										Description: "Fingerprints",
+										Schema: &spec.Schema{
+											SchemaProps: spec.SchemaProps{
+												Type: []string{"array"},
+											},
+										},
+									},
+								},
+								400: errorResponse("Invalid limit"),
+								404: errorResponse("Fingerprint store not configured"),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"eBill-Convert/model"
+)
+
+// useTestFingerprints replaces the fingerprint store for the test.
+func useTestFingerprints(t *testing.T) *fingerprintStore {
+	t.Helper()
+	store, err := newFingerprintStore(filepath.Join(t.TempDir(), "fingerprints.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := fingerprints
+	fingerprints = store
+	t.Cleanup(func() {
+		fingerprints = previous
+		store.file.Close()
+	})
+	return store
+}
+
+func TestCompareFingerprints(t *testing.T) {
+	earlier := fingerprint{Seller: "DE136695976", Number: "RE-2024/0815", IssueDate: "2024-01-31", GrandTotal: "119.00", Currency: "EUR", ContentHash: "a"}
+	tests := []struct {
+		name   string
+		change func(*fingerprint)
+		status string
+		reason string
+	}{
+		{"same content", func(f *fingerprint) { f.Seller, f.Number = "", "X" }, duplicateExact, "same content"},
+		{"same fields", func(f *fingerprint) {}, duplicateExact, "same seller, number, issue date and total"},
+		{"number written differently", func(f *fingerprint) { f.Number = "re 2024 0815" }, duplicateNear, "same seller and number"},
+		{"same number, other total", func(f *fingerprint) { f.GrandTotal = "120.00" }, duplicateNear, "same seller and number"},
+		{"same date and total", func(f *fingerprint) { f.Number = "RE-2024/0816" }, duplicateNear, "same seller, issue date and total"},
+		{"other currency", func(f *fingerprint) { f.Number, f.Currency = "RE-2024/0816", "CHF" }, "", ""},
+		{"no total", func(f *fingerprint) { f.Number, f.GrandTotal = "RE-2024/0816", "" }, "", ""},
+		{"other date", func(f *fingerprint) { f.Number, f.IssueDate = "RE-2024/0816", "2024-02-01" }, "", ""},
+		{"credit note", func(f *fingerprint) { f.CreditNote = true }, "", ""},
+		{"other seller", func(f *fingerprint) { f.Seller = "DE999999999" }, "", ""},
+		{"no seller", func(f *fingerprint) { f.Seller = "" }, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := earlier
+			record.ContentHash = "b"
+			if tt.reason == "same content" {
+				record.ContentHash = earlier.ContentHash
+			}
+			tt.change(&record)
+			if status, reason := compareFingerprints(record, earlier); status != tt.status || reason != tt.reason {
+				t.Errorf("compareFingerprints = %q, %q", status, reason)
+			}
+		})
+	}
+}
+
+func TestSellerKey(t *testing.T) {
+	tests := []struct {
+		seller model.Party
+		key    string
+	}{
+		{model.Party{VATID: "DE 136.695.976", TaxRegistrationID: "201/113/40209"}, "DE136695976"},
+		{model.Party{VATID: "de-136695976"}, "DE136695976"},
+		{model.Party{TaxRegistrationID: "201/113/40209"}, "20111340209"},
+		{model.Party{LegalRegistrationID: model.Identifier{ID: "HRB 12345"}}, "HRB12345"},
+		{model.Party{Identifiers: []model.Identifier{{ID: "4000001123452"}}}, "4000001123452"},
+		{model.Party{Name: " Muster GmbH "}, "muster gmbh"},
+	}
+	for _, tt := range tests {
+		if got := sellerKey(tt.seller); got != tt.key {
+			t.Errorf("sellerKey(%+v) = %q, want %q", tt.seller, got, tt.key)
+		}
+	}
+}
+
+func TestFingerprintStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fingerprints.jsonl")
+	s, err := newFingerprintStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	invoice := testInvoice("RE-1", "DE136695976", "20240131")
+	if check := s.record(sourceUpload, "", invoice); check != nil {
+		t.Errorf("first upload = %+v", check)
+	}
+	// Viewing the same upload again is no duplicate
+	if check := s.record(sourceUpload, "", invoice); check != nil {
+		t.Errorf("repeated upload = %+v", check)
+	}
+	if check := s.record(sourceWatch, "invoice.xml", invoice); check == nil || check.Status != duplicateExact || check.Matches[0].ID != 1 {
+		t.Errorf("same invoice from watch folder = %+v", check)
+	}
+	if check := s.record(sourceUpload, "", testInvoice("RE-1", "DE136695976", "20240131", "DE02120300000000202051")); check == nil || check.Matches[0].Reason != "same seller, number, issue date and total" {
+		t.Errorf("other content = %+v", check)
+	}
+	if check := s.record(sourceUpload, "", []byte("<html/>")); check != nil {
+		t.Errorf("no invoice = %+v", check)
+	}
+	s.file.Close()
+
+	s, err = newFingerprintStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.file.Close()
+	if len(s.records) != 3 {
+		t.Fatalf("reloaded %d fingerprints", len(s.records))
+	}
+	history := s.history("DE 136.695.976", "re 1", 10)
+	if len(history) != 3 || history[0].ID != 3 || history[2].Source != sourceUpload {
+		t.Errorf("history = %+v", history)
+	}
+	if history := s.history("DE999999999", "", 10); len(history) != 0 {
+		t.Errorf("other seller = %+v", history)
+	}
+}
+
+func TestCheckBatchDuplicates(t *testing.T) {
+	store := useTestFingerprints(t)
+	invoice := testInvoice("RE-1", "DE136695976", "20240131")
+	inputs := []batchInput{
+		{Name: "a.xml", Data: invoice},
+		{Name: "b.xml", Data: invoice},
+		{Name: "c.xml", Data: testInvoice("RE-2", "DE136695976", "20240201")},
+		{Name: "d.xml", Data: []byte("<Invoice")},
+	}
+
+	results := convertBatch(inputs, "html", 2, nil)
+	records := checkBatchDuplicates(results, sourceBatch, "")
+	if len(records) != 3 {
+		t.Fatalf("%d fingerprints", len(records))
+	}
+	if results[0].Duplicate != nil || results[2].Duplicate != nil || results[3].Duplicate != nil {
+		t.Errorf("unexpected duplicates: %+v", results)
+	}
+	if check := results[1].Duplicate; check == nil || check.Status != duplicateExact || check.Matches[0].File != "a.xml" {
+		t.Errorf("b.xml = %+v", check)
+	}
+	store.store(records)
+
+	// The same batch submitted again is flagged as a whole
+	results = convertBatch(inputs, "html", 2, nil)
+	store.store(checkBatchDuplicates(results, sourceBatch, ""))
+	for _, result := range results[:3] {
+		if result.Duplicate == nil || result.Duplicate.Status != duplicateExact {
+			t.Errorf("%s resubmitted = %+v", result.File, result.Duplicate)
+		}
+	}
+	if len(store.records) != 6 {
+		t.Errorf("%d fingerprints stored", len(store.records))
+	}
+}
+
+func TestResumedJobDuplicates(t *testing.T) {
+	store := useTestFingerprints(t)
+	invoice := testInvoice("RE-1", "DE136695976", "20240131")
+	inputs := []batchInput{{Name: "a.xml", Data: invoice}, {Name: "b.xml", Data: invoice}}
+
+	run := func(job string) []batchResult {
+		results := convertBatch(inputs, "html", 1, nil)
+		store.store(checkBatchDuplicates(results, sourceJob, job))
+		return results
+	}
+	for i := 0; i < 2; i++ {
+		// The resumed job reports what its first run did
+		results := run("job-1")
+		if results[0].Duplicate != nil {
+			t.Errorf("run %d: a.xml = %+v", i+1, results[0].Duplicate)
+		}
+		if check := results[1].Duplicate; check == nil || len(check.Matches) != 1 || check.Matches[0].File != "a.xml" {
+			t.Errorf("run %d: b.xml = %+v", i+1, check)
+		}
+	}
+	if len(store.records) != 2 {
+		t.Errorf("%d fingerprints stored", len(store.records))
+	}
+
+	results := run("job-2")
+	if check := results[0].Duplicate; check == nil || check.Status != duplicateExact || check.Matches[0].Job != "job-1" {
+		t.Errorf("other job = %+v", check)
+	}
+}
+
+func TestWatchDuplicates(t *testing.T) {
+	store := useTestFingerprints(t)
+	w := newTestWatcher(t)
+	dir := w.dirs[0]
+	then := time.Now().Add(-time.Minute)
+	invoice := testInvoice("RE-1", "DE136695976", "20240131")
+
+	// A file that could not be moved is not fingerprinted and not flagged
+	// once it is retried
+	originals := filepath.Join(dir.Success, "originals")
+	os.RemoveAll(originals)
+	os.RemoveAll(dir.Error)
+	path := filepath.Join(dir.Input, "invoice.xml")
+	writeTestFile(t, path, invoice, then)
+	if event := w.process(path); event.Status != "error" {
+		t.Fatalf("event = %+v", event)
+	}
+	if len(store.records) != 0 {
+		t.Errorf("failed file fingerprinted: %+v", store.records)
+	}
+	os.MkdirAll(originals, 0o755)
+	os.MkdirAll(dir.Error, 0o755)
+	if event := w.process(path); event.Status != "ok" || event.Duplicate != nil {
+		t.Errorf("retry = %+v", event)
+	}
+
+	copied := filepath.Join(dir.Input, "copy.xml")
+	writeTestFile(t, copied, invoice, then)
+	if event := w.process(copied); event.Duplicate == nil || event.Duplicate.Matches[0].File != "invoice.xml" {
+		t.Errorf("copy = %+v", event)
+	}
+}
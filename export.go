@@ -0,0 +1,240 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"eBill-Convert/model"
+	"eBill-Convert/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-openapi/spec"
+)
+
+// exportOptions are the parameters of a spreadsheet export.
+type exportOptions struct {
+	Format string // csv or xlsx
+	Table  string // Sheet of a CSV export: lines or invoices
+	CSV    utils.CSVOptions
+}
+
+// parseExportOptions checks the export parameters; empty values select the
+// defaults.
+func parseExportOptions(format, table, separator, decimal string) (exportOptions, error) {
+	opts := exportOptions{Format: strings.ToLower(format), Table: strings.ToLower(table), CSV: utils.DefaultCSVOptions()}
+	if opts.Format == "" {
+		opts.Format = "csv"
+	}
+	if opts.Format != "csv" && opts.Format != "xlsx" {
+		return opts, fmt.Errorf("invalid format %q, expected csv or xlsx", format)
+	}
+	if opts.Table == "" {
+		opts.Table = "lines"
+	}
+	if opts.Table != "lines" && opts.Table != "invoices" {
+		return opts, fmt.Errorf("invalid table %q, expected lines or invoices", table)
+	}
+	switch {
+	case separator == "":
+	case strings.EqualFold(separator, "tab"):
+		opts.CSV.Separator = '\t'
+	case utf8.RuneCountInString(separator) == 1:
+		opts.CSV.Separator, _ = utf8.DecodeRuneInString(separator)
+	default:
+		return opts, fmt.Errorf("invalid separator %q", separator)
+	}
+	switch strings.ToLower(decimal) {
+	case "":
+		opts.CSV.DecimalComma = opts.CSV.Separator != ','
+	case "comma":
+		opts.CSV.DecimalComma = true
+	case "point":
+		opts.CSV.DecimalComma = false
+	default:
+		return opts, fmt.Errorf("invalid decimal %q, expected comma or point", decimal)
+	}
+	return opts, nil
+}
+
+// exportInvoices writes the invoices as CSV or XLSX and returns the
+// document with its file extension and content type.
+func exportInvoices(invoices []*model.Invoice, opts exportOptions) ([]byte, string, string, error) {
+	sheets := utils.InvoiceSheets(invoices)
+	if opts.Format == "xlsx" {
+		data, err := utils.WriteXLSX(sheets)
+		return data, "xlsx", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", err
+	}
+	sheet := sheets[1]
+	if opts.Table == "invoices" {
+		sheet = sheets[0]
+	}
+	data, err := utils.WriteCSV(sheet, opts.CSV)
+	return data, "csv", "text/csv; charset=utf-8", err
+}
+
+// handleExport flattens the uploaded invoices into invoice and line rows
+// for spreadsheets.
+func handleExport(c *gin.Context) {
+	param := func(name string) string {
+		if value := c.Query(name); value != "" {
+			return value
+		}
+		return c.PostForm(name)
+	}
+	opts, err := parseExportOptions(param("format"), param("table"), param("separator"), param("decimal"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	inputs, err := readBatchInputs(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var invoices []*model.Invoice
+	for _, input := range inputs {
+		if input.Err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %v", input.Name, input.Err)})
+			return
+		}
+		inv, err := parseInvoiceFile(input.Data)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %v", input.Name, err)})
+			return
+		}
+		invoices = append(invoices, inv)
+	}
+
+	result, ext, contentType, err := exportInvoices(invoices, opts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="invoices.%s"`, ext))
+	c.Data(http.StatusOK, contentType, result)
+}
+
+// parseInvoiceFile parses an XML invoice, XR document, JSON invoice,
+// EDIFACT INVOIC message or hybrid PDF.
+func parseInvoiceFile(data []byte) (*model.Invoice, error) {
+	xmlData, err := invoiceXML(data)
+	if err != nil {
+		return nil, err
+	}
+	return parseInvoiceModel(xmlData)
+}
+
+func runExport(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", "csv", "output format: csv or xlsx")
+	table := flags.String("table", "lines", "rows of a CSV export: lines or invoices")
+	separator := flags.String("separator", ";", `CSV separator, "tab" for tabulator`)
+	decimal := flags.String("decimal", "", "CSV decimal separator: comma (default with separator \";\") or point")
+	output := flags.String("o", "", "output file (default stdout)")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	opts, err := parseExportOptions(*format, *table, *separator, *decimal)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	inputs, err := readCLIInputs(flags.Args(), ".xml", ".pdf", ".xr", ".json", ".edi")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	var invoices []*model.Invoice
+	for _, input := range inputs {
+		inv, err := parseInvoiceFile(input.Data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", input.Name, err)
+			return exitFailure
+		}
+		invoices = append(invoices, inv)
+	}
+
+	result, ext, _, err := exportInvoices(invoices, opts)
+	if err == nil {
+		err = writeCLIOutput(*output, "invoices", ext, 1, result)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+func exportPath() spec.PathItem {
+	query := func(name, description string) spec.Parameter {
+		return spec.Parameter{
+			ParamProps:   spec.ParamProps{Name: name, In: "query", Description: description},
+			SimpleSchema: spec.SimpleSchema{Type: "string"},
+		}
+	}
+	return spec.PathItem{
+		PathItemProps: spec.PathItemProps{
+			Post: &spec.Operation{
+				OperationProps: spec.OperationProps{
+					Description: "Flattens invoices into invoice rows and line rows for spreadsheets. Column titles carry the BT codes. XLSX contains both tables as sheets with numeric and date cells; CSV contains one table.",
+					Consumes:    []string{"multipart/form-data"},
+					Produces:    []string{"text/csv", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+					Parameters: []spec.Parameter{
+						{
+							ParamProps: spec.ParamProps{
+								Name:        "xmlFile",
+								In:          "formData",
+								Description: "Invoices (XML, JSON or hybrid PDF); repeat the field for several files.",
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type: []string{"file"},
+									},
+								},
+							},
+						},
+						{
+							ParamProps: spec.ParamProps{
+								Name:        "archive",
+								In:          "formData",
+								Description: "ZIP archive of invoices.",
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type: []string{"file"},
+									},
+								},
+							},
+						},
+						query("format", "csv (default) or xlsx."),
+						query("table", "Rows of a CSV export: lines (default) or invoices."),
+						query("separator", "CSV separator, default \";\"; \"tab\" for tabulator."),
+						query("decimal", "CSV decimal separator: comma (default unless the separator is \",\") or point."),
+					},
+					Responses: &spec.Responses{
+						ResponsesProps: spec.ResponsesProps{
+							StatusCodeResponses: map[int]spec.Response{
+								200: {
+									ResponseProps: spec.ResponseProps{
+										Description: "CSV or XLSX document",
+										Schema: &spec.Schema{
+											SchemaProps: spec.SchemaProps{
+												Type:   []string{"string"},
+												Format: "binary",
+											},
+										},
+									},
+								},
+								400: errorResponse("File missing, unreadable or not an invoice, or invalid parameter."),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
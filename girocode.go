@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"strings"
+
+	"eBill-Convert/model"
+	"eBill-Convert/utils"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+const giroCodeSize = 40.0 // mm, including quiet zone
+
+// addGiroCodePDF appends an EPC GiroCode for SEPA credit transfers.
+func addGiroCodePDF(pdf *gofpdf.Fpdf, inv *model.Invoice) error {
+	code, qr := buildGiroCode(inv)
+	if code == nil {
+		return nil
+	}
+
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	_, pageHeight := pdf.GetPageSize()
+	_, _, _, bottomMargin := pdf.GetMargins()
+	if pdf.GetY()+giroCodeSize+20 > pageHeight-bottomMargin {
+		pdf.AddPage()
+	}
+
+	pdf.Ln(10)
+	pdf.SetFont("Arial", "B", 12)
+	pdf.Cell(0, 10, tr("GiroCode"))
+	pdf.Ln(10)
+
+	left, _, _, _ := pdf.GetMargins()
+	top := pdf.GetY()
+	drawQRCode(pdf, qr, left, top, giroCodeSize)
+
+	pdf.SetFont("Arial", "", 10)
+	pdf.SetXY(left+giroCodeSize+5, top+4)
+	for _, line := range giroCodeSummary(code) {
+		pdf.SetX(left + giroCodeSize + 5)
+		pdf.Cell(0, 6, tr(line))
+		pdf.Ln(6)
+	}
+	pdf.SetFont("Arial", "", 12)
+	pdf.SetY(top + giroCodeSize)
+
+	return nil
+}
+
+// addGiroCodeHTML appends an EPC GiroCode as inline SVG.
+func addGiroCodeHTML(body *strings.Builder, inv *model.Invoice) error {
+	code, qr := buildGiroCode(inv)
+	if code == nil {
+		return nil
+	}
+
+	body.WriteString("<h3>GiroCode</h3>\n<div class=\"girocode\">\n")
+	body.WriteString(qrCodeSVG(qr, 160))
+	body.WriteString("\n")
+	for _, line := range giroCodeSummary(code) {
+		fmt.Fprintf(body, "<p>%s</p>\n", html.EscapeString(line))
+	}
+	body.WriteString("</div>\n")
+
+	return nil
+}
+
+// buildGiroCode returns the GiroCode of the invoice, or nil if it has no
+// SEPA credit transfer. A GiroCode that cannot be built, e.g. for a zero
+// amount or a payload beyond 331 bytes, is logged and skipped so that the
+// invoice still renders.
+func buildGiroCode(inv *model.Invoice) (*utils.GiroCode, *utils.QRCode) {
+	code, err := utils.GiroCodeFromInvoice(inv)
+	if err != nil {
+		log.Printf("Skipping GiroCode: %v", err)
+		return nil, nil
+	}
+	if code == nil {
+		return nil, nil
+	}
+	qr, err := code.QRCode()
+	if err != nil {
+		log.Printf("Skipping GiroCode: %v", err)
+		return nil, nil
+	}
+	return code, qr
+}
+
+func giroCodeSummary(code *utils.GiroCode) []string {
+	lines := []string{
+		"Empfänger: " + code.Name,
+		"IBAN: " + code.IBAN,
+	}
+	if code.BIC != "" {
+		lines = append(lines, "BIC: "+code.BIC)
+	}
+	if amount, err := model.ParseDecimal(code.Amount); err == nil {
+		lines = append(lines, "Betrag: "+model.NewMoney(amount, "EUR").Format(viewLocale))
+	}
+	if code.Reference != "" {
+		lines = append(lines, "Verwendungszweck: "+code.Reference)
+	} else if code.Remittance != "" {
+		lines = append(lines, "Verwendungszweck: "+code.Remittance)
+	}
+	return lines
+}
+
+// drawQRCode draws qr with a four module quiet zone into a square of the
+// given size in mm at x, y.
+func drawQRCode(pdf *gofpdf.Fpdf, qr *utils.QRCode, x, y, size float64) {
+	module := size / float64(qr.Size+8)
+	pdf.SetFillColor(255, 255, 255)
+	pdf.Rect(x, y, size, size, "F")
+	pdf.SetFillColor(0, 0, 0)
+	for row := 0; row < qr.Size; row++ {
+		// Merge horizontal runs of dark modules into one rectangle
+		for col := 0; col < qr.Size; {
+			if !qr.Modules[row][col] {
+				col++
+				continue
+			}
+			start := col
+			for col < qr.Size && qr.Modules[row][col] {
+				col++
+			}
+			pdf.Rect(x+float64(start+4)*module, y+float64(row+4)*module, float64(col-start)*module, module, "F")
+		}
+	}
+}
+
+// qrCodeSVG renders qr including quiet zone as an SVG element of the given
+// pixel size.
+func qrCodeSVG(qr *utils.QRCode, pixels int) string {
+	var path strings.Builder
+	for row := 0; row < qr.Size; row++ {
+		for col := 0; col < qr.Size; col++ {
+			if qr.Modules[row][col] {
+				fmt.Fprintf(&path, "M%d %dh1v1h-1z", col+4, row+4)
+			}
+		}
+	}
+	dim := qr.Size + 8
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges"><rect width="%d" height="%d" fill="#fff"/><path d="%s" fill="#000"/></svg>`,
+		pixels, pixels, dim, dim, dim, dim, path.String())
+}
@@ -0,0 +1,490 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Job states
+const (
+	jobQueued  = "queued"
+	jobRunning = "running"
+	jobDone    = "done"
+	jobFailed  = "failed"
+)
+
+const (
+	jobRunners      = 2  // Jobs processed at the same time
+	jobQueueSize    = 64 // Submissions beyond this block until a runner is free
+	callbackTimeout = 10 * time.Second
+
+	jobDefaultRetention = 7 * 24 * time.Hour // Finished jobs are removed after this
+	jobSweepInterval    = time.Hour
+)
+
+// job is an asynchronous conversion. Its state is kept in job.json inside
+// the job directory next to the uploaded inputs and the result.
+type job struct {
+	ID          string    `json:"id"`
+	State       string    `json:"state"`
+	Format      string    `json:"format"`
+	Workers     int       `json:"workers"`
+	Files       []string  `json:"files"`
+	Total       int       `json:"total"`
+	Completed   int       `json:"completed"`
+	Error       string    `json:"error,omitempty"`
+	Result      string    `json:"result,omitempty"` // File name offered for download
+	ContentType string    `json:"contentType,omitempty"`
+	CallbackURL string    `json:"callbackUrl,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// jobManager persists jobs below dir and runs them in the background.
+// Finished jobs are removed once they are older than retention.
+type jobManager struct {
+	dir           string
+	retention     time.Duration
+	callbackHosts []string // Callback hosts allowed; any public host if empty
+	mu            sync.Mutex
+	jobs          map[string]*job
+	queue         chan string
+}
+
+var jobs *jobManager
+
+// jobConfigFromEnv reads the job directory, the retention period and the
+// callback host allowlist.
+func jobConfigFromEnv() (string, time.Duration, []string, error) {
+	dir := os.Getenv("JOBS_DIR")
+	if dir == "" {
+		dir = "jobs"
+	}
+
+	retention := jobDefaultRetention
+	if value := os.Getenv("JOBS_RETENTION"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return "", 0, nil, fmt.Errorf("invalid JOBS_RETENTION: %s", value)
+		}
+		retention = d
+	}
+
+	var hosts []string
+	for _, host := range strings.Split(os.Getenv("JOB_CALLBACK_HOSTS"), ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return dir, retention, hosts, nil
+}
+
+// newJobManager loads the jobs stored in dir, resumes unfinished ones and
+// starts removing expired ones.
+func newJobManager(dir string, retention time.Duration, callbackHosts []string) (*jobManager, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating job directory: %w", err)
+	}
+
+	m := &jobManager{
+		dir:           dir,
+		retention:     retention,
+		callbackHosts: callbackHosts,
+		jobs:          make(map[string]*job),
+		queue:         make(chan string, jobQueueSize),
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading job directory: %w", err)
+	}
+	var pending []*job
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name(), "job.json"))
+		if err != nil {
+			log.Printf("Skipping job %s: %v", entry.Name(), err)
+			continue
+		}
+		var j job
+		if err := json.Unmarshal(data, &j); err != nil || j.ID != entry.Name() {
+			log.Printf("Skipping job %s: invalid job.json", entry.Name())
+			continue
+		}
+		m.jobs[j.ID] = &j
+		if j.State == jobQueued || j.State == jobRunning {
+			pending = append(pending, &j)
+		}
+	}
+
+	for i := 0; i < jobRunners; i++ {
+		go m.run()
+	}
+
+	// Resume interrupted jobs in submission order. A single goroutine keeps
+	// the order while the queue is full.
+	sort.Slice(pending, func(a, b int) bool { return pending[a].CreatedAt.Before(pending[b].CreatedAt) })
+	var resume []string
+	for _, j := range pending {
+		log.Printf("Resuming job %s", j.ID)
+		m.update(j.ID, func(j *job) { j.State, j.Completed = jobQueued, 0 })
+		resume = append(resume, j.ID)
+	}
+	go func() {
+		for _, id := range resume {
+			m.queue <- id
+		}
+	}()
+
+	m.sweep()
+	go func() {
+		for range time.Tick(min(retention, jobSweepInterval)) {
+			m.sweep()
+		}
+	}()
+
+	return m, nil
+}
+
+// sweep removes the finished jobs not updated within the retention period,
+// including their inputs and results.
+func (m *jobManager) sweep() {
+	cutoff := time.Now().Add(-m.retention)
+	var expired []string
+	m.mu.Lock()
+	for id, j := range m.jobs {
+		if (j.State == jobDone || j.State == jobFailed) && j.UpdatedAt.Before(cutoff) {
+			delete(m.jobs, id)
+			expired = append(expired, id)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, id := range expired {
+		if err := os.RemoveAll(m.jobDir(id)); err != nil {
+			log.Printf("Error removing job %s: %v", id, err)
+			continue
+		}
+		log.Printf("Removed expired job %s", id)
+	}
+}
+
+func (m *jobManager) jobDir(id string) string {
+	return filepath.Join(m.dir, id)
+}
+
+// submit stores the inputs of a new job and queues it.
+func (m *jobManager) submit(inputs []batchInput, format string, workers int, callbackURL string) (*job, error) {
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+
+	inputDir := filepath.Join(m.jobDir(id), "input")
+	if err := os.MkdirAll(inputDir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating job directory: %w", err)
+	}
+
+	now := time.Now().UTC()
+	j := &job{
+		ID:          id,
+		State:       jobQueued,
+		Format:      format,
+		Workers:     workers,
+		Total:       len(inputs),
+		CallbackURL: callbackURL,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	for i, input := range inputs {
+		j.Files = append(j.Files, input.Name)
+		if input.Err != nil {
+			continue // Reported as failed entry when the job runs
+		}
+		if err := os.WriteFile(filepath.Join(inputDir, fmt.Sprint(i)), input.Data, 0o644); err != nil {
+			os.RemoveAll(m.jobDir(id))
+			return nil, fmt.Errorf("error storing job input: %w", err)
+		}
+	}
+	if err := m.save(j); err != nil {
+		os.RemoveAll(m.jobDir(id))
+		return nil, err
+	}
+
+	m.mu.Lock()
+	m.jobs[id] = j
+	snapshot := *j
+	m.mu.Unlock()
+
+	m.queue <- id
+	return &snapshot, nil
+}
+
+// get returns a copy of the job with the given ID.
+func (m *jobManager) get(id string) (job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return job{}, false
+	}
+	return *j, true
+}
+
+// update modifies a job under the lock and persists it.
+func (m *jobManager) update(id string, fn func(*job)) job {
+	m.mu.Lock()
+	j := m.jobs[id]
+	fn(j)
+	j.UpdatedAt = time.Now().UTC()
+	snapshot := *j
+	m.mu.Unlock()
+
+	if err := m.save(&snapshot); err != nil {
+		log.Printf("Error saving job %s: %v", id, err)
+	}
+	return snapshot
+}
+
+// save writes job.json atomically.
+func (m *jobManager) save(j *job) error {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding job: %w", err)
+	}
+	tmp := filepath.Join(m.jobDir(j.ID), "job.json.tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("error writing job: %w", err)
+	}
+	return os.Rename(tmp, filepath.Join(m.jobDir(j.ID), "job.json"))
+}
+
+func (m *jobManager) run() {
+	for id := range m.queue {
+		m.process(id)
+	}
+}
+
+func (m *jobManager) process(id string) {
+	j := m.update(id, func(j *job) { j.State, j.Completed = jobRunning, 0 })
+
+	inputs := make([]batchInput, len(j.Files))
+	for i, name := range j.Files {
+		inputs[i].Name = name
+		inputs[i].Data, inputs[i].Err = os.ReadFile(filepath.Join(m.jobDir(id), "input", fmt.Sprint(i)))
+		if inputs[i].Err != nil {
+			inputs[i].Err = fmt.Errorf("file read error")
+		}
+	}
+
+	results := convertBatch(inputs, j.Format, max(j.Workers, 1), func() {
+		m.update(id, func(j *job) { j.Completed++ })
+	})
+	records := checkBatchDuplicates(results, sourceJob, id)
+
+	var data []byte
+	var name, contentType string
+	var err error
+	if len(results) == 1 {
+		// A single document is offered as is
+		if results[0].Status != "ok" {
+			err = fmt.Errorf("%s", results[0].Error)
+		}
+		data, name = results[0].data, results[0].Output
+		contentType = "application/pdf"
+		if j.Format == "html" {
+			contentType = "text/html; charset=utf-8"
+		}
+	} else {
+		data, err = writeBatchArchive(results)
+		name, contentType = "converted.zip", "application/zip"
+	}
+	if err == nil {
+		err = os.WriteFile(filepath.Join(m.jobDir(id), "result"), data, 0o644)
+	}
+	if err == nil {
+		// A resumed job finds the fingerprints of its inputs stored already
+		fingerprints.store(records)
+	}
+
+	j = m.update(id, func(j *job) {
+		if err != nil {
+			j.State, j.Error = jobFailed, err.Error()
+			return
+		}
+		j.State, j.Result, j.ContentType = jobDone, filepath.Base(name), contentType
+	})
+	log.Printf("Job %s %s", id, j.State)
+
+	if j.CallbackURL != "" {
+		m.notifyCallback(j)
+	}
+}
+
+// checkCallback accepts http(s) URLs whose host is allowlisted or, without
+// allowlist, resolves to public addresses only.
+func (m *jobManager) checkCallback(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.New("invalid callback URL")
+	}
+	host := strings.ToLower(u.Hostname())
+	if len(m.callbackHosts) > 0 {
+		for _, allowed := range m.callbackHosts {
+			if host == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("callback host %s is not allowed", host)
+	}
+
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return fmt.Errorf("callback host %s cannot be resolved", host)
+	}
+	for _, ip := range ips {
+		if !publicIP(ip) {
+			return fmt.Errorf("callback host %s resolves to internal address %s", host, ip)
+		}
+	}
+	return nil
+}
+
+// publicIP reports whether ip may be reached by callbacks, refusing
+// loopback, private, link-local, multicast and unspecified addresses.
+func publicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() && !ip.IsUnspecified()
+}
+
+// callbackClient returns the client posting callbacks. Without allowlist
+// every connection is checked again, as DNS may have changed since the
+// submission. Redirects are not followed.
+func (m *jobManager) callbackClient() *http.Client {
+	dialer := &net.Dialer{Timeout: callbackTimeout}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if len(m.callbackHosts) == 0 {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+				return fmt.Errorf("callback to internal address %s refused", host)
+			}
+			return nil
+		}
+		transport.Proxy = nil // A proxy would be dialed instead of the target
+	}
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   callbackTimeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// notifyCallback posts the final job status to the callback URL.
+func (m *jobManager) notifyCallback(j job) {
+	body, err := json.Marshal(j)
+	if err != nil {
+		log.Printf("Error encoding callback for job %s: %v", j.ID, err)
+		return
+	}
+	resp, err := m.callbackClient().Post(j.CallbackURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Callback for job %s failed: %v", j.ID, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Callback for job %s returned %s", j.ID, resp.Status)
+	}
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error creating job ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func handleJobSubmit(c *gin.Context) {
+	format, workers, err := parseBatchOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	callbackURL := c.PostForm("callbackUrl")
+	if callbackURL != "" {
+		if err := jobs.checkCallback(callbackURL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	inputs, err := readBatchInputs(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	j, err := jobs.submit(inputs, format, workers, callbackURL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("job creation failed: %v", err)})
+		return
+	}
+
+	c.Header("Location", "/jobs/"+j.ID)
+	c.JSON(http.StatusAccepted, j)
+}
+
+func handleJobStatus(c *gin.Context) {
+	j, ok := jobs.get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+	c.JSON(http.StatusOK, j)
+}
+
+func handleJobResult(c *gin.Context) {
+	j, ok := jobs.get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+	if j.State != jobDone {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("job is %s", j.State)})
+		return
+	}
+
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": j.Result}))
+	c.Header("Content-Type", j.ContentType)
+	c.File(filepath.Join(jobs.jobDir(j.ID), "result"))
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPublicIP(t *testing.T) {
+	tests := map[string]bool{
+		"93.184.216.34": true,
+		"2606:4700::1":  true,
+		"127.0.0.1":     false,
+		"::1":           false,
+		"10.1.2.3":      false,
+		"172.16.0.1":    false,
+		"192.168.1.1":   false,
+		"169.254.1.1":   false, // Cloud metadata services
+		"fe80::1":       false,
+		"fd00::1":       false,
+		"224.0.0.1":     false,
+		"0.0.0.0":       false,
+	}
+	for ip, public := range tests {
+		if got := publicIP(net.ParseIP(ip)); got != public {
+			t.Errorf("publicIP(%s) = %v", ip, got)
+		}
+	}
+}
+
+func TestCheckCallback(t *testing.T) {
+	open := &jobManager{}
+	tests := map[string]bool{
+		"https://93.184.216.34/done":  true,
+		"http://93.184.216.34:8080/x": true,
+		"http://127.0.0.1/done":       false,
+		"http://[::1]/done":           false,
+		"http://169.254.169.254/":     false,
+		"ftp://93.184.216.34/done":    false,
+		"/done":                       false,
+		"https://":                    false,
+	}
+	for url, allowed := range tests {
+		if err := open.checkCallback(url); (err == nil) != allowed {
+			t.Errorf("checkCallback(%s) = %v", url, err)
+		}
+	}
+
+	restricted := &jobManager{callbackHosts: []string{"erp.example.com"}}
+	if err := restricted.checkCallback("https://ERP.example.com/hook"); err != nil {
+		t.Errorf("allowlisted host: %v", err)
+	}
+	if err := restricted.checkCallback("https://93.184.216.34/hook"); err == nil {
+		t.Error("host not on allowlist: no error")
+	}
+}
+
+// writeTestJob stores a job as a previous run of the server left it.
+func writeTestJob(t *testing.T, dir string, j job, inputs ...[]byte) {
+	t.Helper()
+	inputDir := filepath.Join(dir, j.ID, "input")
+	if err := os.MkdirAll(inputDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for i, data := range inputs {
+		j.Files = append(j.Files, fmt.Sprintf("%c.xml", 'a'+i))
+		if err := os.WriteFile(filepath.Join(inputDir, fmt.Sprint(i)), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	j.Total = len(inputs)
+	data, _ := json.Marshal(j)
+	if err := os.WriteFile(filepath.Join(dir, j.ID, "job.json"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitJob waits until the job is done or failed.
+func waitJob(t *testing.T, m *jobManager, id string) job {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if j, ok := m.get(id); ok && (j.State == jobDone || j.State == jobFailed) {
+			return j
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s not finished", id)
+	return job{}
+}
+
+func TestJobResume(t *testing.T) {
+	dir := t.TempDir()
+	invoice := testInvoice("RE-1", "DE136695976", "20240131")
+	created := time.Now().UTC().Add(-time.Minute)
+	writeTestJob(t, dir, job{ID: "running", State: jobRunning, Format: "html", Completed: 1, CreatedAt: created}, invoice, invoice)
+	writeTestJob(t, dir, job{ID: "queued", State: jobQueued, Format: "html", CreatedAt: created.Add(time.Second)}, invoice)
+	writeTestJob(t, dir, job{ID: "expired", State: jobDone, Format: "html", CreatedAt: created, UpdatedAt: created.Add(-48 * time.Hour)}, invoice)
+	writeTestJob(t, dir, job{ID: "failed", State: jobFailed, Format: "html", CreatedAt: created, UpdatedAt: created})
+	os.MkdirAll(filepath.Join(dir, "broken"), 0o755)
+
+	m, err := newJobManager(dir, 24*time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j := waitJob(t, m, "running")
+	if j.State != jobDone || j.Completed != 2 || j.Result != "converted.zip" || j.ContentType != "application/zip" {
+		t.Errorf("resumed job = %+v", j)
+	}
+	j = waitJob(t, m, "queued")
+	if j.State != jobDone || j.Completed != 1 || j.Result != "a.html" {
+		t.Errorf("queued job = %+v", j)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "queued", "result")); err != nil {
+		t.Errorf("result: %v", err)
+	}
+
+	if _, ok := m.get("expired"); ok {
+		t.Error("expired job still listed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "expired")); !os.IsNotExist(err) {
+		t.Errorf("expired job directory: %v", err)
+	}
+	if j, ok := m.get("failed"); !ok || j.State != jobFailed {
+		t.Errorf("failed job within retention = %+v, %v", j, ok)
+	}
+}
+
+func TestJobSubmit(t *testing.T) {
+	dir := t.TempDir()
+	m, err := newJobManager(dir, time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	submitted, err := m.submit([]batchInput{{Name: "invoice.xml", Data: testInvoice("RE-1", "DE136695976", "20240131")}}, "html", 1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if submitted.State != jobQueued || submitted.Total != 1 {
+		t.Errorf("submitted = %+v", submitted)
+	}
+	waitJob(t, m, submitted.ID)
+
+	// The state survives a restart
+	reloaded, err := newJobManager(dir, time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j, ok := reloaded.get(submitted.ID); !ok || j.State != jobDone || j.Result != "invoice.html" || j.ContentType != "text/html; charset=utf-8" {
+		t.Errorf("reloaded = %+v, %v", j, ok)
+	}
+}
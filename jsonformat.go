@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"eBill-Convert/model"
+	"eBill-Convert/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-openapi/spec"
+)
+
+// parseInvoiceModel reads a CII, UBL or XR document into the semantic model.
+func parseInvoiceModel(xmlData []byte) (*model.Invoice, error) {
+	if !utils.IsXR(xmlData) {
+		return model.Parse(bytes.NewReader(xmlData))
+	}
+	xr, err := utils.ParseXR(bytes.NewReader(xmlData))
+	if err != nil {
+		return nil, err
+	}
+	return utils.ModelFromInvoice(xr)
+}
+
+// isJSON reports whether data looks like a JSON object rather than XML.
+func isJSON(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("{"))
+}
+
+func handleXMLtoJSON(c *gin.Context) {
+	file, err := c.FormFile("xmlFile")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file missing"})
+		return
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file open error"})
+		return
+	}
+	defer src.Close()
+
+	data := make([]byte, file.Size)
+	_, err = src.Read(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file read error"})
+		return
+	}
+
+	xmlData, err := invoiceXML(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := transformXMLToJSON(xmlData)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("JSON conversion failed: %v", err)})
+		return
+	}
+	checkDuplicate(c, xmlData)
+	c.Data(http.StatusOK, "application/json; charset=utf-8", result)
+}
+
+// handleJSONtoXML writes the posted BT-coded JSON invoice as CII (default) or
+// UBL. Payloads violating the schema are rejected with the list of
+// violations in "details".
+func handleJSONtoXML(c *gin.Context) {
+	data, err := c.GetRawData()
+	if err != nil || len(bytes.TrimSpace(data)) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "request body missing"})
+		return
+	}
+
+	syntax := strings.ToUpper(c.DefaultQuery("syntax", model.SyntaxCII))
+	if syntax != model.SyntaxCII && syntax != model.SyntaxUBL {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported syntax: %s", syntax)})
+		return
+	}
+
+	inv, err := model.DecodeJSON(data)
+	if err != nil {
+		var schemaErr *model.SchemaError
+		if errors.As(err, &schemaErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid invoice", "details": schemaErr.Violations})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := model.Marshal(inv, syntax)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s conversion failed: %v", syntax, err)})
+		return
+	}
+	c.Data(http.StatusOK, "application/xml; charset=utf-8", result)
+}
+
+func handleJSONSchema(c *gin.Context) {
+	c.Data(http.StatusOK, "application/schema+json", model.JSONSchema())
+}
+
+// jsonToCII converts a BT-coded JSON invoice to CII so that it can take the
+// place of an XML input.
+func jsonToCII(data []byte) ([]byte, error) {
+	inv, err := model.DecodeJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	return model.MarshalCII(inv), nil
+}
+
+func xmlToJSONPath() spec.PathItem {
+	return spec.PathItem{
+		PathItemProps: spec.PathItemProps{
+			Post: &spec.Operation{
+				OperationProps: spec.OperationProps{
+					Description: "Converts a CII, UBL or XR invoice (or hybrid PDF) to JSON with the EN 16931 business terms as property names, see /schema/invoice.json.",
+					Consumes:    []string{"multipart/form-data"},
+					Produces:    []string{"application/json"},
+					Parameters: []spec.Parameter{
+						{
+							ParamProps: spec.ParamProps{
+								Name:        "xmlFile",
+								In:          "formData",
+								Description: "The invoice to be converted.",
+								Required:    true,
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type: []string{"file"},
+									},
+								},
+							},
+						},
+					},
+					Responses: &spec.Responses{
+						ResponsesProps: spec.ResponsesProps{
+							StatusCodeResponses: map[int]spec.Response{
+								200: {
+									ResponseProps: spec.ResponseProps{
+										Description: "Invoice as JSON",
+										Schema: &spec.Schema{
+											SchemaProps: spec.SchemaProps{
+												Ref: spec.MustCreateRef("/schema/invoice.json"),
+											},
+										},
+									},
+								},
+								400: errorResponse("File missing or unreadable."),
+								500: errorResponse("Conversion failed"),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func jsonToXMLPath() spec.PathItem {
+	return spec.PathItem{
+		PathItemProps: spec.PathItemProps{
+			Post: &spec.Operation{
+				OperationProps: spec.OperationProps{
+					Description: "Creates a CII or UBL invoice from JSON with the EN 16931 business terms as property names. The payload is validated against /schema/invoice.json; violations are listed in details.",
+					Consumes:    []string{"application/json"},
+					Produces:    []string{"application/xml"},
+					Parameters: []spec.Parameter{
+						{
+							ParamProps: spec.ParamProps{
+								Name:        "invoice",
+								In:          "body",
+								Description: "The invoice as JSON.",
+								Required:    true,
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Ref: spec.MustCreateRef("/schema/invoice.json"),
+									},
+								},
+							},
+						},
+						{
+							ParamProps: spec.ParamProps{
+								Name:        "syntax",
+								In:          "query",
+								Description: "Target syntax, CII (default) or UBL.",
+							},
+							SimpleSchema: spec.SimpleSchema{
+								Type:    "string",
+								Default: model.SyntaxCII,
+							},
+						},
+					},
+					Responses: &spec.Responses{
+						ResponsesProps: spec.ResponsesProps{
+							StatusCodeResponses: map[int]spec.Response{
+								200: {
+									ResponseProps: spec.ResponseProps{
+										Description: "CII or UBL document",
+										Schema: &spec.Schema{
+											SchemaProps: spec.SchemaProps{
+												Type:   []string{"string"},
+												Format: "binary",
+											},
+										},
+									},
+								},
+								400: errorResponse("Body missing or invalid invoice; details lists the schema violations."),
+								500: errorResponse("Conversion failed"),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func jsonSchemaPath() spec.PathItem {
+	return spec.PathItem{
+		PathItemProps: spec.PathItemProps{
+			Get: &spec.Operation{
+				OperationProps: spec.OperationProps{
+					Description: "JSON schema (draft 2020-12) of the invoice JSON used by /xmltojson and /jsontoxml.",
+					Produces:    []string{"application/schema+json"},
+					Responses: &spec.Responses{
+						ResponsesProps: spec.ResponsesProps{
+							StatusCodeResponses: map[int]spec.Response{
+								200: {
+									ResponseProps: spec.ResponseProps{
+										Description: "JSON schema",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
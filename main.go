@@ -3,8 +3,8 @@ package main
 import (
 	"bytes"
 	"encoding/csv"
-	"encoding/xml"
 	"fmt"
+	"html"
 	"io"
 	"log"
 	"net/http"
@@ -12,6 +12,9 @@ import (
 	"strings"
 	"sync"
 
+	"eBill-Convert/model"
+	"eBill-Convert/utils"
+
 	"github.com/gin-gonic/gin"
 	"github.com/go-openapi/runtime/middleware"
 	"github.com/go-openapi/spec"
@@ -33,6 +36,11 @@ var (
 )
 
 func main() {
+	os.Exit(runCLI(os.Args[1:]))
+}
+
+// serve runs the HTTP API on addr.
+func serve(addr string) error {
 	r := gin.Default()
 
 	// Define Swagger document
@@ -52,7 +60,7 @@ func main() {
 						PathItemProps: spec.PathItemProps{
 							Post: &spec.Operation{
 								OperationProps: spec.OperationProps{
-									Description: "Transforms XML to HTML.",
+									Description: "Transforms an invoice, an Order-X order, order change or order response, or a UBL despatch advice to HTML. Invoices paid to an account not confirmed for the seller get a warning box, as do malformed values, which are left out. Other XML documents, such as XR, and documents that cannot be read are shown element by element with the labels of translations.csv.",
 									Consumes:    []string{"multipart/form-data"},
 									Produces:    []string{"text/html"},
 									Parameters: []spec.Parameter{
@@ -101,6 +109,23 @@ func main() {
 														},
 													},
 												},
+												500: {
+													ResponseProps: spec.ResponseProps{
+														Description: "Internal server error",
+														Schema: &spec.Schema{
+															SchemaProps: spec.SchemaProps{
+																Type: []string{"object"},
+																Properties: map[string]spec.Schema{
+																	"error": {
+																		SchemaProps: spec.SchemaProps{
+																			Type: []string{"string"},
+																		},
+																	},
+																},
+															},
+														},
+													},
+												},
 											},
 										},
 									},
@@ -112,7 +137,7 @@ func main() {
 						PathItemProps: spec.PathItemProps{
 							Post: &spec.Operation{
 								OperationProps: spec.OperationProps{
-									Description: "Transforms XML to PDF.",
+									Description: "Transforms an invoice, an Order-X order, order change or order response, or a UBL despatch advice to PDF. Invoices paid to an account not confirmed for the seller get a warning box, as do malformed values, which are left out. Other XML documents, such as XR, and documents that cannot be read are shown element by element with the labels of translations.csv.",
 									Consumes:    []string{"multipart/form-data"},
 									Produces:    []string{"application/pdf"},
 									Parameters: []spec.Parameter{
@@ -186,6 +211,258 @@ func main() {
 							},
 						},
 					},
+					"/batch": {
+						PathItemProps: spec.PathItemProps{
+							Post: &spec.Operation{
+								OperationProps: spec.OperationProps{
+									Description: "Converts many XML files at once and returns a ZIP with the rendered documents and a manifest (JSON and CSV).",
+									Consumes:    []string{"multipart/form-data"},
+									Produces:    []string{"application/zip"},
+									Parameters: []spec.Parameter{
+										{
+											ParamProps: spec.ParamProps{
+												Name:        "archive",
+												In:          "formData",
+												Description: "ZIP archive of XML files.",
+												Schema: &spec.Schema{
+													SchemaProps: spec.SchemaProps{
+														Type: []string{"file"},
+													},
+												},
+											},
+										},
+										{
+											ParamProps: spec.ParamProps{
+												Name:        "xmlFile",
+												In:          "formData",
+												Description: "XML file, may be repeated.",
+												Schema: &spec.Schema{
+													SchemaProps: spec.SchemaProps{
+														Type: []string{"file"},
+													},
+												},
+											},
+										},
+										{
+											ParamProps: spec.ParamProps{
+												Name:        "format",
+												In:          "formData",
+												Description: "Output format, pdf (default) or html.",
+											},
+											SimpleSchema: spec.SimpleSchema{
+												Type: "string",
+											},
+										},
+										{
+											ParamProps: spec.ParamProps{
+												Name:        "workers",
+												In:          "formData",
+												Description: "Number of concurrent conversions.",
+											},
+											SimpleSchema: spec.SimpleSchema{
+												Type: "integer",
+											},
+										},
+									},
+									Responses: &spec.Responses{
+										ResponsesProps: spec.ResponsesProps{
+											StatusCodeResponses: map[int]spec.Response{
+												200: {
+													ResponseProps: spec.ResponseProps{
+														Description: "ZIP archive with converted documents, manifest.json and manifest.csv",
+														Schema: &spec.Schema{
+															SchemaProps: spec.SchemaProps{
+																Type:   []string{"string"},
+																Format: "binary",
+															},
+														},
+													},
+												},
+												400: errorResponse("Invalid request or archive."),
+												500: errorResponse("Internal server error"),
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+					"/jobs": {
+						PathItemProps: spec.PathItemProps{
+							Post: &spec.Operation{
+								OperationProps: spec.OperationProps{
+									Description: "Submits an asynchronous conversion job. Accepts the same fields as /batch plus an optional callback URL.",
+									Consumes:    []string{"multipart/form-data"},
+									Produces:    []string{"application/json"},
+									Parameters: []spec.Parameter{
+										{
+											ParamProps: spec.ParamProps{
+												Name:        "archive",
+												In:          "formData",
+												Description: "ZIP archive of XML files.",
+												Schema: &spec.Schema{
+													SchemaProps: spec.SchemaProps{
+														Type: []string{"file"},
+													},
+												},
+											},
+										},
+										{
+											ParamProps: spec.ParamProps{
+												Name:        "xmlFile",
+												In:          "formData",
+												Description: "XML file, may be repeated. A single file yields the rendered document instead of a ZIP.",
+												Schema: &spec.Schema{
+													SchemaProps: spec.SchemaProps{
+														Type: []string{"file"},
+													},
+												},
+											},
+										},
+										{
+											ParamProps: spec.ParamProps{
+												Name:        "format",
+												In:          "formData",
+												Description: "Output format, pdf (default) or html.",
+											},
+											SimpleSchema: spec.SimpleSchema{
+												Type: "string",
+											},
+										},
+										{
+											ParamProps: spec.ParamProps{
+												Name:        "callbackUrl",
+												In:          "formData",
+												Description: "http(s) URL receiving a POST with the job status on completion. It must resolve to a public address, or name a host of JOB_CALLBACK_HOSTS if set; redirects are not followed.",
+											},
+											SimpleSchema: spec.SimpleSchema{
+												Type: "string",
+											},
+										},
+									},
+									Responses: &spec.Responses{
+										ResponsesProps: spec.ResponsesProps{
+											StatusCodeResponses: map[int]spec.Response{
+												202: {
+													ResponseProps: spec.ResponseProps{
+														Description: "Job accepted, see the Location header",
+													},
+												},
+												400: errorResponse("Invalid request or archive."),
+												500: errorResponse("Internal server error"),
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+					"/jobs/{id}": {
+						PathItemProps: spec.PathItemProps{
+							Get: &spec.Operation{
+								OperationProps: spec.OperationProps{
+									Description: "Reports state (queued, running, done, failed) and progress of a job.",
+									Produces:    []string{"application/json"},
+									Parameters: []spec.Parameter{
+										{
+											ParamProps: spec.ParamProps{
+												Name:     "id",
+												In:       "path",
+												Required: true,
+											},
+											SimpleSchema: spec.SimpleSchema{
+												Type: "string",
+											},
+										},
+									},
+									Responses: &spec.Responses{
+										ResponsesProps: spec.ResponsesProps{
+											StatusCodeResponses: map[int]spec.Response{
+												200: {
+													ResponseProps: spec.ResponseProps{
+														Description: "Job status",
+													},
+												},
+												404: errorResponse("Job not found"),
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+					"/jobs/{id}/result": {
+						PathItemProps: spec.PathItemProps{
+							Get: &spec.Operation{
+								OperationProps: spec.OperationProps{
+									Description: "Downloads the result of a completed job.",
+									Produces:    []string{"application/pdf", "text/html", "application/zip"},
+									Parameters: []spec.Parameter{
+										{
+											ParamProps: spec.ParamProps{
+												Name:     "id",
+												In:       "path",
+												Required: true,
+											},
+											SimpleSchema: spec.SimpleSchema{
+												Type: "string",
+											},
+										},
+									},
+									Responses: &spec.Responses{
+										ResponsesProps: spec.ResponsesProps{
+											StatusCodeResponses: map[int]spec.Response{
+												200: {
+													ResponseProps: spec.ResponseProps{
+														Description: "Rendered document or ZIP archive",
+													},
+												},
+												404: errorResponse("Job not found"),
+												409: errorResponse("Job not finished"),
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+					"/watch": {
+						PathItemProps: spec.PathItemProps{
+							Get: &spec.Operation{
+								OperationProps: spec.OperationProps{
+									Description: "Reports the watch folders (WATCH_DIRS) with waiting, queued and processing files and the latest results.",
+									Produces:    []string{"application/json"},
+									Responses: &spec.Responses{
+										ResponsesProps: spec.ResponsesProps{
+											StatusCodeResponses: map[int]spec.Response{
+												200: {
+													ResponseProps: spec.ResponseProps{
+														Description: "Watch folder status",
+													},
+												},
+												404: errorResponse("Watch folders not configured"),
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+					"/xmltoubl":             syntaxConversionPath(model.SyntaxUBL),
+					"/xmltocii":             syntaxConversionPath(model.SyntaxCII),
+					"/xmltoedifact":         syntaxConversionPath(model.SyntaxEDIFACT),
+					"/xmltopeppol":          syntaxConversionPath(model.SyntaxPeppol),
+					"/xmltojson":            xmlToJSONPath(),
+					"/jsontoxml":            jsonToXMLPath(),
+					"/schema/invoice.json":  jsonSchemaPath(),
+					"/create":               createPath(),
+					"/correct":              correctPath(),
+					"/match":                matchPath(),
+					"/validate":             validatePath(),
+					"/history":              historyPath(),
+					"/bankaccounts/confirm": confirmAccountsPath(),
+					"/datev":                datevPath(),
+					"/export":               exportPath(),
 				},
 			},
 		},
@@ -207,9 +484,88 @@ func main() {
 
 	r.POST("/xmltohtml", handleXMLtoHTML)
 	r.POST("/xmltopdf", handleXMLtoPDF)
+	r.POST("/xmltoubl", handleXMLtoUBL)
+	r.POST("/xmltocii", handleXMLtoCII)
+	r.POST("/xmltoedifact", handleXMLtoEDIFACT)
+	r.POST("/xmltopeppol", handleXMLtoPeppol)
+	r.POST("/xmltojson", handleXMLtoJSON)
+	r.POST("/jsontoxml", handleJSONtoXML)
+	r.GET("/schema/invoice.json", handleJSONSchema)
+	r.POST("/create", handleCreate)
+	r.POST("/correct", handleCorrect)
+	r.POST("/match", handleMatch)
+	r.POST("/validate", handleValidate)
+	r.POST("/datev", limitBatchRequest, handleDATEV)
+	r.POST("/export", limitBatchRequest, handleExport)
+	r.POST("/batch", limitBatchRequest, handleBatch)
+
+	// Opened first, so that resumed jobs and watch folders use the stores
+	fingerprintPath := os.Getenv("FINGERPRINT_STORE")
+	if fingerprintPath == "" {
+		fingerprintPath = "fingerprints.jsonl"
+	}
+	var err error
+	fingerprints, err = newFingerprintStore(fingerprintPath)
+	if err != nil {
+		return fmt.Errorf("failed to open fingerprint store: %w", err)
+	}
+	r.GET("/history", handleHistory)
 
-	if err := r.Run(":8080"); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	accountPath := os.Getenv("BANK_ACCOUNTS_STORE")
+	if accountPath == "" {
+		accountPath = "bankaccounts.json"
+	}
+	bankAccounts, err = newBankAccountStore(accountPath)
+	if err != nil {
+		return fmt.Errorf("failed to open bank account store: %w", err)
+	}
+	r.POST("/bankaccounts/confirm", handleConfirmAccounts)
+
+	jobDir, jobRetention, callbackHosts, err := jobConfigFromEnv()
+	if err != nil {
+		return err
+	}
+	jobs, err = newJobManager(jobDir, jobRetention, callbackHosts)
+	if err != nil {
+		return fmt.Errorf("failed to start job manager: %w", err)
+	}
+	r.POST("/jobs", limitBatchRequest, handleJobSubmit)
+	r.GET("/jobs/:id", handleJobStatus)
+	r.GET("/jobs/:id/result", handleJobResult)
+
+	watchDirs, watchFormat, watchInterval, err := watchConfigFromEnv()
+	if err != nil {
+		return err
+	}
+	if len(watchDirs) > 0 {
+		folders, err = newWatcher(watchDirs, watchFormat, watchInterval)
+		if err != nil {
+			return fmt.Errorf("failed to start watch folders: %w", err)
+		}
+	}
+	r.GET("/watch", handleWatchStatus)
+
+	return r.Run(addr)
+}
+
+// errorResponse describes an error response with a JSON "error" field.
+func errorResponse(description string) spec.Response {
+	return spec.Response{
+		ResponseProps: spec.ResponseProps{
+			Description: description,
+			Schema: &spec.Schema{
+				SchemaProps: spec.SchemaProps{
+					Type: []string{"object"},
+					Properties: map[string]spec.Schema{
+						"error": {
+							SchemaProps: spec.SchemaProps{
+								Type: []string{"string"},
+							},
+						},
+					},
+				},
+			},
+		},
 	}
 }
 
@@ -227,13 +583,22 @@ func handleXMLtoHTML(c *gin.Context) {
 	}
 	defer src.Close()
 
-	htmlData := make([]byte, file.Size)
-	_, err = src.Read(htmlData)
+	xmlData := make([]byte, file.Size)
+	_, err = src.Read(xmlData)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "file read error"})
 		return
 	}
 
+	htmlData, err := transformXMLToHTML(xmlData)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("HTML transformation failed: %v", err)})
+		return
+	}
+	if invoice, err := invoiceXML(xmlData); err == nil {
+		checkDuplicate(c, invoice)
+	}
+
 	c.Data(http.StatusOK, "text/html; charset=utf-8", htmlData)
 }
 
@@ -263,64 +628,188 @@ func handleXMLtoPDF(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("PDF transformation failed: %v", err)})
 		return
 	}
+	if invoice, err := invoiceXML(xmlData); err == nil {
+		checkDuplicate(c, invoice)
+	}
 
 	c.Data(http.StatusOK, "application/pdf", pdfData)
 }
 
 func transformXMLToPDF(xmlData []byte) ([]byte, error) {
-	pdf := gofpdf.New("P", "mm", "A4", "")
-	pdf.AddPage()
-	pdf.SetFont("Arial", "", 12)
+	view, err := parseDocumentView(xmlData)
+	if err != nil {
+		return nil, err
+	}
+
+	pdf, err := documentPDF(view)
+	if err != nil {
+		return nil, err
+	}
+	return outputPDF(pdf)
+}
 
-	// Load CSV if not already loaded
-	loadCSV()
+// documentView is an invoice, order or despatch advice laid out for the PDF
+// and HTML renderers.
+type documentView struct {
+	Title    string
+	Sections []viewSection
+	Invoice  *model.Invoice // Set for invoices, which get payment codes
+	Alerts   []string       // Shown in a warning box above the sections
+}
 
-	xmlReader := bytes.NewReader(xmlData)
-	decoder := xml.NewDecoder(xmlReader)
-	var currentPath string
-	var groupStack []string
-	elementCounts := make(map[string]int)
+// parseDocumentView reads an invoice, order or despatch advice,
+// possibly wrapped in an SBDH envelope, and lays it out. Malformed values
+// of an invoice are left out with an alert; other documents, and those
+// that cannot be read, are shown element by element.
+func parseDocumentView(xmlData []byte) (*documentView, error) {
+	envelope, xmlData, err := unwrapEnvelope(xmlData)
+	if err != nil {
+		return nil, err
+	}
+	kind, err := model.DocumentKind(xmlData)
+	if err != nil {
+		return xmlDocumentView(xmlData, envelope)
+	}
 
-	for {
-		token, err := decoder.Token()
-		if err == io.EOF {
-			break
+	switch kind {
+	case model.KindOrder:
+		order, err := model.ParseOrder(bytes.NewReader(xmlData))
+		if err != nil {
+			log.Printf("Showing order as XML: %v", err)
+			return xmlDocumentView(xmlData, envelope)
 		}
+		return &documentView{Title: orderTitle(order), Sections: append(orderView(order), envelopeView(envelope)...)}, nil
+	case model.KindDespatchAdvice:
+		advice, err := model.ParseDespatchAdvice(bytes.NewReader(xmlData))
 		if err != nil {
-			return nil, fmt.Errorf("error decoding XML: %w", err)
+			log.Printf("Showing despatch advice as XML: %v", err)
+			return xmlDocumentView(xmlData, envelope)
 		}
+		return &documentView{Title: "Lieferavis", Sections: append(despatchView(advice), envelopeView(envelope)...)}, nil
+	}
+	inv, skipped, err := model.ParseLenient(bytes.NewReader(xmlData))
+	if err != nil {
+		log.Printf("Showing invoice as XML: %v", err)
+		return xmlDocumentView(xmlData, envelope)
+	}
+	view := invoiceDocument(inv, envelope)
+	view.Alerts = append(skippedAlerts(skipped), accountAlerts(bankAccounts.record(inv))...)
+	return view, nil
+}
 
-		switch t := token.(type) {
-		case xml.StartElement:
-			name := t.Name.Local
-			if currentPath == "" {
-				currentPath = "/" + name
-			} else {
-				currentPath += "/" + name
-			}
-			groupStack = append(groupStack, name)
+// skippedAlerts words the values left out of a leniently read invoice.
+func skippedAlerts(skipped []error) []string {
+	var alerts []string
+	for _, err := range skipped {
+		alerts = append(alerts, fmt.Sprintf("Ungültiger Wert nicht angezeigt: %v", err))
+	}
+	return alerts
+}
 
-		case xml.CharData:
-			text := strings.TrimSpace(string(t))
-			if text != "" {
-				printElement(pdf, currentPath, text, groupStack, elementCounts)
-			}
-		case xml.EndElement:
-			if len(groupStack) > 0 {
-				groupStack = groupStack[:len(groupStack)-1]
-			}
+// invoiceDocument lays out the invoice, followed by the header of its SBDH
+// envelope if there is one. Identifiers failing their check are marked.
+func invoiceDocument(inv *model.Invoice, envelope *utils.SBDH) *documentView {
+	sections := invoiceView(inv)
+	markIdentifiers(sections, utils.IdentifierIssues(inv))
+	return &documentView{Title: "Rechnung", Sections: append(sections, envelopeView(envelope)...), Invoice: inv}
+}
+
+// invoicePDF lays out the invoice as PDF document, followed by the header
+// of its SBDH envelope if there is one.
+func invoicePDF(inv *model.Invoice, envelope *utils.SBDH) (*gofpdf.Fpdf, error) {
+	return documentPDF(invoiceDocument(inv, envelope))
+}
 
-			parts := strings.Split(currentPath, "/")
-			if len(parts) > 0 {
-				currentPath = strings.Join(parts[:len(parts)-1], "/")
+// documentPDF writes the sections of the document; invoices get their
+// payment codes.
+func documentPDF(view *documentView) (*gofpdf.Fpdf, error) {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.AddPage()
+	pdf.SetFont("Arial", "", 12)
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	addAlertsPDF(pdf, tr, view.Alerts)
+	for _, section := range view.Sections {
+		if section.Title != "" {
+			pdf.Ln(5)
+			pdf.SetFont("Arial", "B", 12)
+			pdf.Cell(0, 10, tr(section.Title))
+			pdf.Ln(5)
+			pdf.SetFont("Arial", "", 12)
+		}
+		for _, field := range section.Fields {
+			if field.Problem != "" {
+				pdf.SetTextColor(200, 0, 0)
+				pdf.SetFont("Arial", "B", 12)
+				pdf.Cell(0, 10, tr(fmt.Sprintf("%s: %s (%s)", field.Label, field.Value, field.Problem)))
+				pdf.SetTextColor(0, 0, 0)
+				pdf.SetFont("Arial", "", 12)
 			} else {
-				currentPath = ""
+				pdf.Cell(0, 10, tr(fmt.Sprintf("%s: %s", field.Label, field.Value)))
 			}
+			pdf.Ln(5)
+		}
+	}
 
+	if view.Invoice == nil {
+		return pdf, nil
+	}
+	if err := addGiroCodePDF(pdf, view.Invoice); err != nil {
+		return nil, err
+	}
+	if err := addSwissQRBillPDF(pdf, view.Invoice); err != nil {
+		return nil, err
+	}
+	return pdf, nil
+}
+
+// addAlertsPDF writes the alerts in a red framed box.
+func addAlertsPDF(pdf *gofpdf.Fpdf, tr func(string) string, alerts []string) {
+	if len(alerts) == 0 {
+		return
+	}
+	pdf.SetDrawColor(200, 0, 0)
+	pdf.SetFillColor(255, 235, 235)
+	pdf.SetTextColor(160, 0, 0)
+	pdf.SetLineWidth(0.8)
+	pdf.SetFont("Arial", "B", 12)
+	pdf.CellFormat(0, 8, tr("Achtung"), "LTR", 1, "L", true, 0, "")
+	pdf.SetFont("Arial", "", 10)
+	for i, alert := range alerts {
+		border := "LR"
+		if i == len(alerts)-1 {
+			border = "LRB"
 		}
+		pdf.MultiCell(0, 5, tr(alert), border, "L", true)
+	}
+	pdf.SetDrawColor(0, 0, 0)
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetLineWidth(0.2)
+	pdf.SetFont("Arial", "", 12)
+}
 
+// addAlertsHTML writes the alerts in a red framed box.
+func addAlertsHTML(body *strings.Builder, alerts []string) {
+	if len(alerts) == 0 {
+		return
+	}
+	body.WriteString("<div class=\"alert\" style=\"border: 3px solid #c00; background: #fee; color: #900; padding: 0.5em 1em; margin-bottom: 1em\">\n<h3>Achtung</h3>\n")
+	for _, alert := range alerts {
+		fmt.Fprintf(body, "<p>%s</p>\n", html.EscapeString(alert))
+	}
+	body.WriteString("</div>\n")
+}
+
+// unwrapEnvelope separates the SBDH header from a wrapped document. Other
+// documents are returned unchanged without header.
+func unwrapEnvelope(xmlData []byte) (*utils.SBDH, []byte, error) {
+	if !utils.IsSBDH(xmlData) {
+		return nil, xmlData, nil
 	}
+	return utils.UnwrapSBDH(xmlData)
+}
 
+func outputPDF(pdf *gofpdf.Fpdf) ([]byte, error) {
 	var buffer bytes.Buffer
 	err := pdf.Output(&buffer)
 
@@ -331,54 +820,48 @@ func transformXMLToPDF(xmlData []byte) ([]byte, error) {
 	return buffer.Bytes(), nil
 }
 
-func printElement(pdf *gofpdf.Fpdf, currentPath, text string, groupStack []string, elementCounts map[string]int) {
-
-	germanLabel := lookupLabel(currentPath)
-
-	parts := strings.Split(currentPath, "/")
-	elementName := parts[len(parts)-1]
-	elementName = strings.TrimSpace(elementName)
-
-	header := ""
-
-	if len(groupStack) > 1 {
-		header = lookupHeader(currentPath)
-
-		if header != "" {
-			// Print header if changed
-
-			if len(groupStack) > 0 {
-				lastHeader := groupStack[len(groupStack)-2]
-				lastHeader = strings.TrimSpace(lastHeader)
-				if header != lastHeader {
-					pdf.Ln(5)
-					pdf.SetFont("Arial", "B", 12)
-					pdf.Cell(0, 10, header)
-					pdf.Ln(5)
-					pdf.SetFont("Arial", "", 12)
-					//groupStack = groupStack[:len(groupStack)-1] // removing last group as its printed now
-				}
+func transformXMLToHTML(xmlData []byte) ([]byte, error) {
+	view, err := parseDocumentView(xmlData)
+	if err != nil {
+		return nil, err
+	}
 
+	var body strings.Builder
+	addAlertsHTML(&body, view.Alerts)
+	for _, section := range view.Sections {
+		if section.Title != "" {
+			fmt.Fprintf(&body, "<h3>%s</h3>\n", html.EscapeString(section.Title))
+		}
+		for _, field := range section.Fields {
+			if field.Problem != "" {
+				fmt.Fprintf(&body, "<p class=\"invalid\" style=\"color: #c00\"><strong>%s:</strong> <mark>%s</mark> (%s)</p>\n", html.EscapeString(field.Label), html.EscapeString(field.Value), html.EscapeString(field.Problem))
+				continue
 			}
+			fmt.Fprintf(&body, "<p><strong>%s:</strong> %s</p>\n", html.EscapeString(field.Label), html.EscapeString(field.Value))
 		}
-
 	}
 
-	label := elementName
-
-	if germanLabel != "" {
-		label = germanLabel
+	if view.Invoice != nil {
+		if err := addGiroCodeHTML(&body, view.Invoice); err != nil {
+			return nil, err
+		}
 	}
 
-	elementCountKey := currentPath
-	elementCounts[elementCountKey]++
-	if elementCounts[elementCountKey] > 1 {
-		label = fmt.Sprintf("%s %d", label, elementCounts[elementCountKey])
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n</head>\n<body>\n", html.EscapeString(view.Title))
+	buffer.WriteString(body.String())
+	buffer.WriteString("</body>\n</html>\n")
 
-	}
+	return buffer.Bytes(), nil
+}
 
-	pdf.Cell(0, 10, fmt.Sprintf("%s: %s", label, text))
-	pdf.Ln(5)
+// transformXMLToJSON returns the invoice in the BT-coded JSON representation.
+func transformXMLToJSON(xmlData []byte) ([]byte, error) {
+	inv, err := parseInvoiceModel(xmlData)
+	if err != nil {
+		return nil, err
+	}
+	return model.EncodeJSON(inv)
 }
 
 func loadCSV() {
@@ -422,10 +905,10 @@ func loadCSV() {
 		}
 		if len(row) == 3 {
 			csvData = append(csvData, csvMapping{
-				XMLPath:     row[1],
-				GermanPath:  row[1],
-				Field:       row[0],
-				GermanLabel: row[2],
+				XMLPath:     strings.TrimSpace(row[1]),
+				GermanPath:  strings.TrimSpace(row[1]),
+				Field:       strings.TrimSpace(row[0]),
+				GermanLabel: strings.TrimSpace(row[2]),
 			})
 		} else {
 			log.Printf("Skipping invalid CSV row: %v", row)
@@ -433,44 +916,3 @@ func loadCSV() {
 	}
 	csvLoaded = true
 }
-
-func lookupLabel(xmlPath string) string {
-	csvMutex.RLock()
-	defer csvMutex.RUnlock()
-	for _, mapping := range csvData {
-		if comparePaths(mapping.GermanPath, xmlPath) {
-			return mapping.GermanLabel
-		}
-	}
-	return ""
-}
-
-func lookupHeader(xmlPath string) string {
-	csvMutex.RLock()
-	defer csvMutex.RUnlock()
-	for _, mapping := range csvData {
-		if comparePaths(mapping.GermanPath, xmlPath) {
-			parts := strings.Split(mapping.GermanPath, "/")
-			if len(parts) > 1 {
-				return parts[len(parts)-2]
-			}
-		}
-	}
-	return ""
-}
-
-func comparePaths(path1, path2 string) bool {
-	parts1 := strings.Split(path1, "/")
-	parts2 := strings.Split(path2, "/")
-	if len(parts1) != len(parts2) {
-		return false
-	}
-	for i := range parts1 {
-		part1 := strings.Split(parts1[i], ":")
-		part2 := strings.Split(parts2[i], ":")
-		if part1[len(part1)-1] != part2[len(part2)-1] {
-			return false
-		}
-	}
-	return true
-}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"eBill-Convert/model"
+	"eBill-Convert/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-openapi/spec"
+)
+
+// handleMatch matches the uploaded invoice against its order and despatch
+// advice (three-way match) and returns the match report.
+func handleMatch(c *gin.Context) {
+	data, err := formFileData(c, "xmlFile")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	xmlData, err := invoiceXML(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	inv, err := parseInvoiceModel(xmlData)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var order *model.Order
+	if data, err := formFileData(c, "orderFile"); !errors.Is(err, errFileMissing) {
+		if err == nil {
+			data, err = matchDocumentXML(data, model.KindOrder)
+		}
+		if err == nil {
+			order, err = model.ParseOrder(bytes.NewReader(data))
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("order: %v", err)})
+			return
+		}
+	}
+	var advice *model.DespatchAdvice
+	if data, err := formFileData(c, "despatchFile"); !errors.Is(err, errFileMissing) {
+		if err == nil {
+			data, err = matchDocumentXML(data, model.KindDespatchAdvice)
+		}
+		if err == nil {
+			advice, err = model.ParseDespatchAdvice(bytes.NewReader(data))
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("despatch advice: %v", err)})
+			return
+		}
+	}
+	if order == nil && advice == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "order or despatch advice missing"})
+		return
+	}
+
+	tolerances := utils.MatchTolerances{QuantityPercent: model.NewDecimal(0, 0), PricePercent: model.NewDecimal(0, 0)}
+	for name, tolerance := range map[string]*model.Decimal{"quantityTolerance": &tolerances.QuantityPercent, "priceTolerance": &tolerances.PricePercent} {
+		value := c.PostForm(name)
+		if value == "" {
+			continue
+		}
+		if *tolerance, err = model.ParseDecimal(value); err != nil || tolerance.Sign() < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid %s: %s", name, value)})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, utils.Match(inv, order, advice, tolerances))
+}
+
+// matchDocumentXML unwraps an order or despatch advice from its SBDH
+// envelope and checks that it is of the expected kind.
+func matchDocumentXML(data []byte, kind string) ([]byte, error) {
+	_, xmlData, err := unwrapEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+	found, err := model.DocumentKind(xmlData)
+	if err != nil {
+		return nil, err
+	}
+	if found != kind {
+		return nil, fmt.Errorf("expected %s, got %s", kind, found)
+	}
+	return xmlData, nil
+}
+
+// errFileMissing is returned by formFileData if the form has no such file.
+var errFileMissing = errors.New("file missing")
+
+// formFileData reads the uploaded file of the form field.
+func formFileData(c *gin.Context, name string) ([]byte, error) {
+	file, err := c.FormFile(name)
+	if err != nil {
+		return nil, errFileMissing
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("file open error")
+	}
+	defer src.Close()
+
+	data := make([]byte, file.Size)
+	if _, err := src.Read(data); err != nil {
+		return nil, fmt.Errorf("file read error")
+	}
+	return data, nil
+}
+
+func matchPath() spec.PathItem {
+	file := func(name, description string, required bool) spec.Parameter {
+		return spec.Parameter{
+			ParamProps: spec.ParamProps{
+				Name:        name,
+				In:          "formData",
+				Description: description,
+				Required:    required,
+				Schema:      &spec.Schema{SchemaProps: spec.SchemaProps{Type: []string{"file"}}},
+			},
+		}
+	}
+	form := func(name, description string) spec.Parameter {
+		return spec.Parameter{
+			ParamProps:   spec.ParamProps{Name: name, In: "formData", Description: description},
+			SimpleSchema: spec.SimpleSchema{Type: "number"},
+		}
+	}
+	return spec.PathItem{
+		PathItemProps: spec.PathItemProps{
+			Post: &spec.Operation{
+				OperationProps: spec.OperationProps{
+					Description: "Matches an invoice against its order and despatch advice (three-way match). Lines are related by the order line reference (BT-132) or by seller, buyer or standard article ID. Quantity and unit price deviations beyond the tolerances, unmatched invoice lines and references to other documents are errors; ordered or delivered lines not invoiced are warnings.",
+					Consumes:    []string{"multipart/form-data"},
+					Produces:    []string{"application/json"},
+					Parameters: []spec.Parameter{
+						file("xmlFile", "The invoice.", true),
+						file("orderFile", "The order: Order-X or UBL Order.", false),
+						file("despatchFile", "The UBL despatch advice.", false),
+						form("quantityTolerance", "Accepted quantity deviation in percent, default 0."),
+						form("priceTolerance", "Accepted unit price deviation in percent, default 0."),
+					},
+					Responses: &spec.Responses{
+						ResponsesProps: spec.ResponsesProps{
+							StatusCodeResponses: map[int]spec.Response{
+								200: {
+									ResponseProps: spec.ResponseProps{
+										Description: "Match report; matched is false if any error was found.",
+										Schema: &spec.Schema{
+											SchemaProps: spec.SchemaProps{
+												Type: []string{"object"},
+											},
+										},
+									},
+								},
+								400: errorResponse("Invoice missing or unreadable, neither order nor despatch advice given, or invalid tolerance."),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,221 @@
+package model
+
+import "fmt"
+
+// InputError lists what is missing or inconsistent in an invoice that is to
+// be completed or created.
+type InputError struct {
+	Problems []string
+}
+
+func (e *InputError) Error() string {
+	msg := "incomplete invoice: " + e.Problems[0]
+	if len(e.Problems) > 1 {
+		msg += fmt.Sprintf(" (and %d more)", len(e.Problems)-1)
+	}
+	return msg
+}
+
+// calculator collects the problems found while calculating an invoice.
+type calculator struct {
+	problems []string
+}
+
+func (c *calculator) fail(format string, args ...any) {
+	c.problems = append(c.problems, fmt.Sprintf(format, args...))
+}
+
+// zeroAmount is 0.00, the start of all amount sums.
+var zeroAmount = NewDecimal(0, AmountDecimals)
+
+var hundred = NewDecimal(100, 0)
+
+// vatRateless are the VAT categories whose rate is 0 (BR-E-5, BR-AE-5,
+// BR-IC-5, BR-G-5). Not subject to VAT (O) has no rate at all (BR-O-5).
+var vatRateless = map[VATCategory]bool{
+	VATExempt:        true,
+	VATReverseCharge: true,
+	VATIntraEU:       true,
+	VATExport:        true,
+}
+
+// Calculate computes the derived amounts of the invoice following the
+// calculation rules of EN 16931: line net amounts (BT-131), percentage
+// allowances and charges, the VAT breakdown (BG-23) and the document totals
+// (BG-22). Computed values replace given ones; exemption reasons of the VAT
+// breakdown, the paid amount (BT-113) and the rounding amount (BT-114) are
+// kept. Missing input is reported as *InputError.
+func Calculate(inv *Invoice) error {
+	c := &calculator{}
+
+	lineNet := zeroAmount
+	for i := range inv.Lines {
+		c.line(&inv.Lines[i])
+		lineNet = lineNet.Add(inv.Lines[i].NetAmount)
+	}
+	if len(inv.Lines) == 0 {
+		c.fail("BG-25: at least one invoice line is required")
+	}
+
+	allowances, charges := zeroAmount, zeroAmount
+	for i := range inv.Allowances {
+		c.documentAllowanceCharge("BG-20", i, &inv.Allowances[i], lineNet)
+		allowances = allowances.Add(inv.Allowances[i].Amount)
+	}
+	for i := range inv.Charges {
+		c.documentAllowanceCharge("BG-21", i, &inv.Charges[i], lineNet)
+		charges = charges.Add(inv.Charges[i].Amount)
+	}
+	if len(c.problems) > 0 {
+		return &InputError{Problems: c.problems}
+	}
+
+	inv.VATBreakdown = vatBreakdown(inv)
+	tax := zeroAmount
+	for _, vat := range inv.VATBreakdown {
+		tax = tax.Add(vat.TaxAmount)
+	}
+
+	totals := &inv.Totals
+	totals.LineNet = lineNet
+	totals.Allowances, totals.Charges = Decimal{}, Decimal{}
+	if len(inv.Allowances) > 0 {
+		totals.Allowances = allowances
+	}
+	if len(inv.Charges) > 0 {
+		totals.Charges = charges
+	}
+	totals.TaxBasis = lineNet.Sub(allowances).Add(charges)
+	totals.Tax = tax
+	totals.Grand = totals.TaxBasis.Add(tax)
+	totals.DuePayable = totals.Grand.Sub(totals.Prepaid).Add(totals.Rounding).RoundAmount()
+	return nil
+}
+
+// line computes the net amount of an invoice line: quantity times net price
+// per base quantity, plus line charges, minus line allowances.
+func (c *calculator) line(line *Line) {
+	at := fmt.Sprintf("BG-25[%s]", line.ID)
+	if line.ID == "" {
+		c.fail("BG-25: BT-126 line identifier missing")
+	}
+	if !line.Quantity.IsSet() {
+		c.fail("%s: BT-129 invoiced quantity missing", at)
+	}
+	if line.UnitCode == "" {
+		c.fail("%s: BT-130 unit of measure missing", at)
+	}
+	if line.Item.Name == "" {
+		c.fail("%s: BT-153 item name missing", at)
+	}
+	c.vatCategory(at, "BT-151", line.VATCategory, &line.VATRate)
+
+	price := &line.Price
+	if !price.Net.IsSet() {
+		if !price.Gross.IsSet() {
+			c.fail("%s: BT-146 item net price missing", at)
+			return
+		}
+		price.Net = price.Gross.Sub(price.Discount)
+	}
+
+	amount := line.Quantity.Mul(price.Net)
+	if price.BaseQuantity.IsSet() {
+		if price.BaseQuantity.Sign() == 0 {
+			c.fail("%s: BT-149 base quantity must not be 0", at)
+			return
+		}
+		amount = amount.Div(price.BaseQuantity, AmountDecimals)
+	}
+	amount = amount.RoundAmount()
+
+	net := amount
+	for i := range line.Allowances {
+		c.amount(fmt.Sprintf("%s.BG-27[%d]", at, i), &line.Allowances[i], amount)
+		net = net.Sub(line.Allowances[i].Amount)
+	}
+	for i := range line.Charges {
+		c.amount(fmt.Sprintf("%s.BG-28[%d]", at, i), &line.Charges[i], amount)
+		net = net.Add(line.Charges[i].Amount)
+	}
+	line.NetAmount = net
+}
+
+func (c *calculator) documentAllowanceCharge(group string, i int, ac *AllowanceCharge, lineNet Decimal) {
+	at := fmt.Sprintf("%s[%d]", group, i)
+	c.amount(at, ac, lineNet)
+	term := "BT-95"
+	if group == "BG-21" {
+		term = "BT-102"
+	}
+	c.vatCategory(at, term, ac.VATCategory, &ac.VATRate)
+}
+
+// amount computes an allowance or charge given as percentage of its base
+// amount, which defaults to base.
+func (c *calculator) amount(at string, ac *AllowanceCharge, base Decimal) {
+	if !ac.Percentage.IsSet() {
+		if !ac.Amount.IsSet() {
+			c.fail("%s: amount or percentage missing", at)
+			return
+		}
+		ac.Amount = ac.Amount.RoundAmount()
+		return
+	}
+	if !ac.BaseAmount.IsSet() {
+		ac.BaseAmount = base
+	}
+	ac.Amount = ac.BaseAmount.Mul(ac.Percentage).Div(hundred, AmountDecimals)
+}
+
+// vatCategory checks the VAT category and sets the rate of the categories
+// without VAT.
+func (c *calculator) vatCategory(at, term string, category VATCategory, rate *Decimal) {
+	switch {
+	case category == "":
+		c.fail("%s: %s VAT category code missing", at, term)
+	case vatRateless[category]:
+		*rate = NewDecimal(0, 0)
+	case category == VATNotSubject:
+		*rate = Decimal{}
+	case !rate.IsSet():
+		c.fail("%s: VAT rate missing for category %s", at, category)
+	}
+}
+
+// vatBreakdown groups the line net amounts, allowances and charges by VAT
+// category and rate in order of appearance.
+func vatBreakdown(inv *Invoice) []VATBreakdown {
+	var groups []VATBreakdown
+	add := func(category VATCategory, rate, amount Decimal) {
+		for i := range groups {
+			if groups[i].Category == category && groups[i].Rate.Cmp(rate) == 0 {
+				groups[i].TaxableAmount = groups[i].TaxableAmount.Add(amount)
+				return
+			}
+		}
+		groups = append(groups, VATBreakdown{Category: category, Rate: rate, TaxableAmount: zeroAmount.Add(amount)})
+	}
+	for _, line := range inv.Lines {
+		add(line.VATCategory, line.VATRate, line.NetAmount)
+	}
+	for _, ac := range inv.Allowances {
+		add(ac.VATCategory, ac.VATRate, ac.Amount.Neg())
+	}
+	for _, ac := range inv.Charges {
+		add(ac.VATCategory, ac.VATRate, ac.Amount)
+	}
+
+	for i := range groups {
+		group := &groups[i]
+		group.TaxAmount = group.TaxableAmount.Mul(group.Rate).Div(hundred, AmountDecimals)
+		for _, given := range inv.VATBreakdown {
+			if given.Category == group.Category && (given.ExemptionReason != "" || given.ExemptionReasonCode != "") {
+				group.ExemptionReason = given.ExemptionReason
+				group.ExemptionReasonCode = given.ExemptionReasonCode
+				break
+			}
+		}
+	}
+	return groups
+}
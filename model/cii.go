@@ -0,0 +1,638 @@
+package model
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// CII D16B structures as read by ParseCII. Only local names are matched,
+// so the namespace prefixes of the document do not matter.
+
+type ciiID struct {
+	Value    string `xml:",chardata"`
+	SchemeID string `xml:"schemeID,attr"`
+}
+
+type ciiDateTime struct {
+	DateTimeString struct {
+		Value  string `xml:",chardata"`
+		Format string `xml:"format,attr"`
+	} `xml:"DateTimeString"`
+}
+
+type ciiAmount struct {
+	Value      string `xml:",chardata"`
+	CurrencyID string `xml:"currencyID,attr"`
+}
+
+type ciiQuantity struct {
+	Value    string `xml:",chardata"`
+	UnitCode string `xml:"unitCode,attr"`
+}
+
+type ciiAddress struct {
+	PostcodeCode           string `xml:"PostcodeCode"`
+	LineOne                string `xml:"LineOne"`
+	LineTwo                string `xml:"LineTwo"`
+	LineThree              string `xml:"LineThree"`
+	CityName               string `xml:"CityName"`
+	CountryID              string `xml:"CountryID"`
+	CountrySubDivisionName string `xml:"CountrySubDivisionName"`
+}
+
+type ciiParty struct {
+	ID                         []string `xml:"ID"`
+	GlobalID                   []ciiID  `xml:"GlobalID"`
+	Name                       string   `xml:"Name"`
+	Description                string   `xml:"Description"`
+	SpecifiedLegalOrganization struct {
+		ID                  ciiID  `xml:"ID"`
+		TradingBusinessName string `xml:"TradingBusinessName"`
+	} `xml:"SpecifiedLegalOrganization"`
+	DefinedTradeContact struct {
+		PersonName                      string `xml:"PersonName"`
+		DepartmentName                  string `xml:"DepartmentName"`
+		TelephoneUniversalCommunication struct {
+			CompleteNumber string `xml:"CompleteNumber"`
+		} `xml:"TelephoneUniversalCommunication"`
+		EmailURIUniversalCommunication struct {
+			URIID string `xml:"URIID"`
+		} `xml:"EmailURIUniversalCommunication"`
+	} `xml:"DefinedTradeContact"`
+	PostalTradeAddress        ciiAddress `xml:"PostalTradeAddress"`
+	URIUniversalCommunication struct {
+		URIID ciiID `xml:"URIID"`
+	} `xml:"URIUniversalCommunication"`
+	SpecifiedTaxRegistration []struct {
+		ID ciiID `xml:"ID"`
+	} `xml:"SpecifiedTaxRegistration"`
+}
+
+type ciiAllowanceCharge struct {
+	ChargeIndicator struct {
+		Indicator string `xml:"Indicator"`
+	} `xml:"ChargeIndicator"`
+	CalculationPercent string    `xml:"CalculationPercent"`
+	BasisAmount        string    `xml:"BasisAmount"`
+	ActualAmount       ciiAmount `xml:"ActualAmount"`
+	ReasonCode         string    `xml:"ReasonCode"`
+	Reason             string    `xml:"Reason"`
+	CategoryTradeTax   struct {
+		TypeCode              string `xml:"TypeCode"`
+		CategoryCode          string `xml:"CategoryCode"`
+		RateApplicablePercent string `xml:"RateApplicablePercent"`
+	} `xml:"CategoryTradeTax"`
+}
+
+type ciiPeriod struct {
+	StartDateTime ciiDateTime `xml:"StartDateTime"`
+	EndDateTime   ciiDateTime `xml:"EndDateTime"`
+}
+
+type ciiReferencedDocument struct {
+	IssuerAssignedID       string `xml:"IssuerAssignedID"`
+	URIID                  string `xml:"URIID"`
+	LineID                 string `xml:"LineID"`
+	TypeCode               string `xml:"TypeCode"`
+	Name                   string `xml:"Name"`
+	AttachmentBinaryObject struct {
+		Value    string `xml:",chardata"`
+		MimeCode string `xml:"mimeCode,attr"`
+		Filename string `xml:"filename,attr"`
+	} `xml:"AttachmentBinaryObject"`
+	ReferenceTypeCode      string      `xml:"ReferenceTypeCode"`
+	FormattedIssueDateTime ciiDateTime `xml:"FormattedIssueDateTime"`
+}
+
+type ciiInvoice struct {
+	ExchangedDocumentContext struct {
+		BusinessProcessSpecifiedDocumentContextParameter struct {
+			ID string `xml:"ID"`
+		} `xml:"BusinessProcessSpecifiedDocumentContextParameter"`
+		GuidelineSpecifiedDocumentContextParameter struct {
+			ID string `xml:"ID"`
+		} `xml:"GuidelineSpecifiedDocumentContextParameter"`
+	} `xml:"ExchangedDocumentContext"`
+	ExchangedDocument struct {
+		ID            string      `xml:"ID"`
+		TypeCode      string      `xml:"TypeCode"`
+		IssueDateTime ciiDateTime `xml:"IssueDateTime"`
+		IncludedNote  []struct {
+			Content     string `xml:"Content"`
+			SubjectCode string `xml:"SubjectCode"`
+		} `xml:"IncludedNote"`
+	} `xml:"ExchangedDocument"`
+	SupplyChainTradeTransaction struct {
+		IncludedSupplyChainTradeLineItem []ciiLine `xml:"IncludedSupplyChainTradeLineItem"`
+		ApplicableHeaderTradeAgreement   struct {
+			BuyerReference                    string                  `xml:"BuyerReference"`
+			SellerTradeParty                  ciiParty                `xml:"SellerTradeParty"`
+			BuyerTradeParty                   ciiParty                `xml:"BuyerTradeParty"`
+			SellerTaxRepresentativeTradeParty *ciiParty               `xml:"SellerTaxRepresentativeTradeParty"`
+			SellerOrderReferencedDocument     ciiReferencedDocument   `xml:"SellerOrderReferencedDocument"`
+			BuyerOrderReferencedDocument      ciiReferencedDocument   `xml:"BuyerOrderReferencedDocument"`
+			ContractReferencedDocument        ciiReferencedDocument   `xml:"ContractReferencedDocument"`
+			AdditionalReferencedDocument      []ciiReferencedDocument `xml:"AdditionalReferencedDocument"`
+			SpecifiedProcuringProject         struct {
+				ID   string `xml:"ID"`
+				Name string `xml:"Name"`
+			} `xml:"SpecifiedProcuringProject"`
+		} `xml:"ApplicableHeaderTradeAgreement"`
+		ApplicableHeaderTradeDelivery struct {
+			ShipToTradeParty               *ciiParty `xml:"ShipToTradeParty"`
+			ActualDeliverySupplyChainEvent struct {
+				OccurrenceDateTime ciiDateTime `xml:"OccurrenceDateTime"`
+			} `xml:"ActualDeliverySupplyChainEvent"`
+			DespatchAdviceReferencedDocument  ciiReferencedDocument `xml:"DespatchAdviceReferencedDocument"`
+			ReceivingAdviceReferencedDocument ciiReferencedDocument `xml:"ReceivingAdviceReferencedDocument"`
+		} `xml:"ApplicableHeaderTradeDelivery"`
+		ApplicableHeaderTradeSettlement struct {
+			CreditorReferenceID                  string    `xml:"CreditorReferenceID"`
+			PaymentReference                     string    `xml:"PaymentReference"`
+			TaxCurrencyCode                      string    `xml:"TaxCurrencyCode"`
+			InvoiceCurrencyCode                  string    `xml:"InvoiceCurrencyCode"`
+			PayeeTradeParty                      *ciiParty `xml:"PayeeTradeParty"`
+			SpecifiedTradeSettlementPaymentMeans []struct {
+				TypeCode                               string `xml:"TypeCode"`
+				Information                            string `xml:"Information"`
+				ApplicableTradeSettlementFinancialCard struct {
+					ID             string `xml:"ID"`
+					CardholderName string `xml:"CardholderName"`
+				} `xml:"ApplicableTradeSettlementFinancialCard"`
+				PayerPartyDebtorFinancialAccount struct {
+					IBANID string `xml:"IBANID"`
+				} `xml:"PayerPartyDebtorFinancialAccount"`
+				PayeePartyCreditorFinancialAccount struct {
+					IBANID        string `xml:"IBANID"`
+					AccountName   string `xml:"AccountName"`
+					ProprietaryID string `xml:"ProprietaryID"`
+				} `xml:"PayeePartyCreditorFinancialAccount"`
+				PayeeSpecifiedCreditorFinancialInstitution struct {
+					BICID string `xml:"BICID"`
+				} `xml:"PayeeSpecifiedCreditorFinancialInstitution"`
+			} `xml:"SpecifiedTradeSettlementPaymentMeans"`
+			ApplicableTradeTax []struct {
+				CalculatedAmount    string `xml:"CalculatedAmount"`
+				TypeCode            string `xml:"TypeCode"`
+				ExemptionReason     string `xml:"ExemptionReason"`
+				BasisAmount         string `xml:"BasisAmount"`
+				CategoryCode        string `xml:"CategoryCode"`
+				ExemptionReasonCode string `xml:"ExemptionReasonCode"`
+				TaxPointDate        struct {
+					DateString struct {
+						Value  string `xml:",chardata"`
+						Format string `xml:"format,attr"`
+					} `xml:"DateString"`
+				} `xml:"TaxPointDate"`
+				DueDateTypeCode       string `xml:"DueDateTypeCode"`
+				RateApplicablePercent string `xml:"RateApplicablePercent"`
+			} `xml:"ApplicableTradeTax"`
+			BillingSpecifiedPeriod        ciiPeriod            `xml:"BillingSpecifiedPeriod"`
+			SpecifiedTradeAllowanceCharge []ciiAllowanceCharge `xml:"SpecifiedTradeAllowanceCharge"`
+			SpecifiedTradePaymentTerms    []struct {
+				Description          string      `xml:"Description"`
+				DueDateDateTime      ciiDateTime `xml:"DueDateDateTime"`
+				DirectDebitMandateID string      `xml:"DirectDebitMandateID"`
+			} `xml:"SpecifiedTradePaymentTerms"`
+			SpecifiedTradeSettlementHeaderMonetarySummation struct {
+				LineTotalAmount      string      `xml:"LineTotalAmount"`
+				ChargeTotalAmount    string      `xml:"ChargeTotalAmount"`
+				AllowanceTotalAmount string      `xml:"AllowanceTotalAmount"`
+				TaxBasisTotalAmount  string      `xml:"TaxBasisTotalAmount"`
+				TaxTotalAmount       []ciiAmount `xml:"TaxTotalAmount"`
+				RoundingAmount       string      `xml:"RoundingAmount"`
+				GrandTotalAmount     string      `xml:"GrandTotalAmount"`
+				TotalPrepaidAmount   string      `xml:"TotalPrepaidAmount"`
+				DuePayableAmount     string      `xml:"DuePayableAmount"`
+			} `xml:"SpecifiedTradeSettlementHeaderMonetarySummation"`
+			InvoiceReferencedDocument                 []ciiReferencedDocument `xml:"InvoiceReferencedDocument"`
+			ReceivableSpecifiedTradeAccountingAccount struct {
+				ID string `xml:"ID"`
+			} `xml:"ReceivableSpecifiedTradeAccountingAccount"`
+		} `xml:"ApplicableHeaderTradeSettlement"`
+	} `xml:"SupplyChainTradeTransaction"`
+}
+
+type ciiLine struct {
+	AssociatedDocumentLineDocument struct {
+		LineID       string `xml:"LineID"`
+		IncludedNote []struct {
+			Content string `xml:"Content"`
+		} `xml:"IncludedNote"`
+	} `xml:"AssociatedDocumentLineDocument"`
+	SpecifiedTradeProduct struct {
+		GlobalID                        ciiID  `xml:"GlobalID"`
+		SellerAssignedID                string `xml:"SellerAssignedID"`
+		BuyerAssignedID                 string `xml:"BuyerAssignedID"`
+		Name                            string `xml:"Name"`
+		Description                     string `xml:"Description"`
+		ApplicableProductCharacteristic []struct {
+			Description string `xml:"Description"`
+			Value       string `xml:"Value"`
+		} `xml:"ApplicableProductCharacteristic"`
+		DesignatedProductClassification []struct {
+			ClassCode struct {
+				Value         string `xml:",chardata"`
+				ListID        string `xml:"listID,attr"`
+				ListVersionID string `xml:"listVersionID,attr"`
+			} `xml:"ClassCode"`
+		} `xml:"DesignatedProductClassification"`
+		OriginTradeCountry struct {
+			ID string `xml:"ID"`
+		} `xml:"OriginTradeCountry"`
+	} `xml:"SpecifiedTradeProduct"`
+	SpecifiedLineTradeAgreement struct {
+		BuyerOrderReferencedDocument ciiReferencedDocument `xml:"BuyerOrderReferencedDocument"`
+		GrossPriceProductTradePrice  struct {
+			ChargeAmount                string      `xml:"ChargeAmount"`
+			BasisQuantity               ciiQuantity `xml:"BasisQuantity"`
+			AppliedTradeAllowanceCharge struct {
+				ChargeIndicator struct {
+					Indicator string `xml:"Indicator"`
+				} `xml:"ChargeIndicator"`
+				ActualAmount string `xml:"ActualAmount"`
+			} `xml:"AppliedTradeAllowanceCharge"`
+		} `xml:"GrossPriceProductTradePrice"`
+		NetPriceProductTradePrice struct {
+			ChargeAmount  string      `xml:"ChargeAmount"`
+			BasisQuantity ciiQuantity `xml:"BasisQuantity"`
+		} `xml:"NetPriceProductTradePrice"`
+	} `xml:"SpecifiedLineTradeAgreement"`
+	SpecifiedLineTradeDelivery struct {
+		BilledQuantity ciiQuantity `xml:"BilledQuantity"`
+	} `xml:"SpecifiedLineTradeDelivery"`
+	SpecifiedLineTradeSettlement struct {
+		ApplicableTradeTax struct {
+			TypeCode              string `xml:"TypeCode"`
+			CategoryCode          string `xml:"CategoryCode"`
+			RateApplicablePercent string `xml:"RateApplicablePercent"`
+		} `xml:"ApplicableTradeTax"`
+		BillingSpecifiedPeriod                        ciiPeriod            `xml:"BillingSpecifiedPeriod"`
+		SpecifiedTradeAllowanceCharge                 []ciiAllowanceCharge `xml:"SpecifiedTradeAllowanceCharge"`
+		SpecifiedTradeSettlementLineMonetarySummation struct {
+			LineTotalAmount string `xml:"LineTotalAmount"`
+		} `xml:"SpecifiedTradeSettlementLineMonetarySummation"`
+		AdditionalReferencedDocument              ciiReferencedDocument `xml:"AdditionalReferencedDocument"`
+		ReceivableSpecifiedTradeAccountingAccount struct {
+			ID string `xml:"ID"`
+		} `xml:"ReceivableSpecifiedTradeAccountingAccount"`
+	} `xml:"SpecifiedLineTradeSettlement"`
+}
+
+// ParseCII reads a CII D16B CrossIndustryInvoice.
+func ParseCII(r io.Reader) (*Invoice, error) {
+	return parseCII(r, &parser{})
+}
+
+func parseCII(r io.Reader, p *parser) (*Invoice, error) {
+	var doc ciiInvoice
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("error decoding XML: %w", err)
+	}
+
+	inv := &Invoice{Syntax: SyntaxCII}
+
+	inv.BusinessProcess = trim(doc.ExchangedDocumentContext.BusinessProcessSpecifiedDocumentContextParameter.ID)
+	inv.SpecificationID = trim(doc.ExchangedDocumentContext.GuidelineSpecifiedDocumentContextParameter.ID)
+
+	document := doc.ExchangedDocument
+	inv.Number = trim(document.ID)
+	inv.TypeCode = DocumentTypeCode(trim(document.TypeCode))
+	inv.IssueDate = p.ciiDate("BT-2", document.IssueDateTime)
+	for _, note := range document.IncludedNote {
+		inv.Notes = append(inv.Notes, Note{SubjectCode: trim(note.SubjectCode), Text: trim(note.Content)})
+	}
+
+	transaction := doc.SupplyChainTradeTransaction
+
+	agreement := transaction.ApplicableHeaderTradeAgreement
+	inv.BuyerReference = trim(agreement.BuyerReference)
+	inv.Seller = p.ciiParty(agreement.SellerTradeParty)
+	inv.Buyer = p.ciiParty(agreement.BuyerTradeParty)
+	if agreement.SellerTaxRepresentativeTradeParty != nil {
+		party := p.ciiParty(*agreement.SellerTaxRepresentativeTradeParty)
+		inv.TaxRepresentative = &party
+	}
+	inv.SalesOrderReference = trim(agreement.SellerOrderReferencedDocument.IssuerAssignedID)
+	inv.PurchaseOrderReference = trim(agreement.BuyerOrderReferencedDocument.IssuerAssignedID)
+	inv.ContractReference = trim(agreement.ContractReferencedDocument.IssuerAssignedID)
+	inv.ProjectReference = trim(agreement.SpecifiedProcuringProject.ID)
+	for _, ref := range agreement.AdditionalReferencedDocument {
+		switch trim(ref.TypeCode) {
+		case "50":
+			inv.TenderReference = trim(ref.IssuerAssignedID)
+		case "130":
+			inv.InvoicedObject = Identifier{ID: trim(ref.IssuerAssignedID), Scheme: trim(ref.ReferenceTypeCode)}
+		default:
+			inv.SupportingDocuments = append(inv.SupportingDocuments, p.ciiSupportingDocument(ref))
+		}
+	}
+
+	delivery := transaction.ApplicableHeaderTradeDelivery
+	inv.DespatchAdviceReference = trim(delivery.DespatchAdviceReferencedDocument.IssuerAssignedID)
+	inv.ReceivingAdviceReference = trim(delivery.ReceivingAdviceReferencedDocument.IssuerAssignedID)
+	deliveryDate := p.ciiDate("BT-72", delivery.ActualDeliverySupplyChainEvent.OccurrenceDateTime)
+	if delivery.ShipToTradeParty != nil || deliveryDate.IsSet() {
+		inv.Delivery = &Delivery{Date: deliveryDate}
+		if party := delivery.ShipToTradeParty; party != nil {
+			inv.Delivery.PartyName = trim(party.Name)
+			inv.Delivery.Address = ciiAddressOf(party.PostalTradeAddress)
+			if len(party.GlobalID) > 0 {
+				inv.Delivery.LocationID = Identifier{ID: trim(party.GlobalID[0].Value), Scheme: trim(party.GlobalID[0].SchemeID)}
+			} else if len(party.ID) > 0 {
+				inv.Delivery.LocationID = Identifier{ID: trim(party.ID[0])}
+			}
+		}
+	}
+
+	settlement := transaction.ApplicableHeaderTradeSettlement
+	inv.CurrencyCode = trim(settlement.InvoiceCurrencyCode)
+	inv.TaxCurrencyCode = trim(settlement.TaxCurrencyCode)
+	inv.BuyerAccountingReference = trim(settlement.ReceivableSpecifiedTradeAccountingAccount.ID)
+	if settlement.PayeeTradeParty != nil {
+		party := p.ciiParty(*settlement.PayeeTradeParty)
+		inv.Payee = &party
+	}
+	inv.InvoicingPeriod = p.ciiPeriod("BG-14", settlement.BillingSpecifiedPeriod)
+
+	payment := &inv.PaymentInstructions
+	payment.RemittanceInfo = trim(settlement.PaymentReference)
+	for _, means := range settlement.SpecifiedTradeSettlementPaymentMeans {
+		if payment.MeansCode == "" {
+			payment.MeansCode = trim(means.TypeCode)
+			payment.MeansText = trim(means.Information)
+		}
+		account := means.PayeePartyCreditorFinancialAccount
+		if id := firstNonEmpty(account.IBANID, account.ProprietaryID); id != "" {
+			payment.CreditTransfers = append(payment.CreditTransfers, CreditTransfer{
+				AccountID:   id,
+				AccountName: trim(account.AccountName),
+				ProviderID:  trim(means.PayeeSpecifiedCreditorFinancialInstitution.BICID),
+			})
+		}
+		if card := means.ApplicableTradeSettlementFinancialCard; trim(card.ID) != "" {
+			payment.Card = &PaymentCard{AccountNumber: trim(card.ID), HolderName: trim(card.CardholderName)}
+		}
+		if iban := trim(means.PayerPartyDebtorFinancialAccount.IBANID); iban != "" {
+			if payment.DirectDebit == nil {
+				payment.DirectDebit = &DirectDebit{}
+			}
+			payment.DirectDebit.DebitedAccount = iban
+		}
+	}
+	if creditor := trim(settlement.CreditorReferenceID); creditor != "" {
+		if payment.DirectDebit == nil {
+			payment.DirectDebit = &DirectDebit{}
+		}
+		payment.DirectDebit.CreditorID = creditor
+	}
+
+	var terms []string
+	for _, term := range settlement.SpecifiedTradePaymentTerms {
+		if description := trim(term.Description); description != "" {
+			terms = append(terms, description)
+		}
+		if due := p.ciiDate("BT-9", term.DueDateDateTime); due.IsSet() && !inv.DueDate.IsSet() {
+			inv.DueDate = due
+		}
+		if mandate := trim(term.DirectDebitMandateID); mandate != "" {
+			if payment.DirectDebit == nil {
+				payment.DirectDebit = &DirectDebit{}
+			}
+			payment.DirectDebit.MandateID = mandate
+		}
+	}
+	inv.PaymentTerms = strings.Join(terms, "\n")
+
+	for _, tax := range settlement.ApplicableTradeTax {
+		inv.VATBreakdown = append(inv.VATBreakdown, VATBreakdown{
+			TaxableAmount:       p.decimal("BT-116", tax.BasisAmount),
+			TaxAmount:           p.decimal("BT-117", tax.CalculatedAmount),
+			Category:            VATCategory(trim(tax.CategoryCode)),
+			Rate:                p.decimal("BT-119", tax.RateApplicablePercent),
+			ExemptionReason:     trim(tax.ExemptionReason),
+			ExemptionReasonCode: trim(tax.ExemptionReasonCode),
+		})
+		if value := trim(tax.TaxPointDate.DateString.Value); value != "" && !inv.TaxPointDate.IsSet() {
+			inv.TaxPointDate = p.date("BT-7", value, tax.TaxPointDate.DateString.Format)
+		}
+		if code := trim(tax.DueDateTypeCode); code != "" {
+			inv.TaxPointDateCode = ciiTaxPointCodeOf(code)
+		}
+	}
+
+	for _, ac := range settlement.SpecifiedTradeAllowanceCharge {
+		if ciiIsCharge(ac) {
+			inv.Charges = append(inv.Charges, p.ciiAllowanceCharge("BG-21", ac))
+		} else {
+			inv.Allowances = append(inv.Allowances, p.ciiAllowanceCharge("BG-20", ac))
+		}
+	}
+
+	sums := settlement.SpecifiedTradeSettlementHeaderMonetarySummation
+	inv.Totals = Totals{
+		LineNet:    p.decimal("BT-106", sums.LineTotalAmount),
+		Allowances: p.decimal("BT-107", sums.AllowanceTotalAmount),
+		Charges:    p.decimal("BT-108", sums.ChargeTotalAmount),
+		TaxBasis:   p.decimal("BT-109", sums.TaxBasisTotalAmount),
+		Grand:      p.decimal("BT-112", sums.GrandTotalAmount),
+		Prepaid:    p.decimal("BT-113", sums.TotalPrepaidAmount),
+		Rounding:   p.decimal("BT-114", sums.RoundingAmount),
+		DuePayable: p.decimal("BT-115", sums.DuePayableAmount),
+	}
+	for _, amount := range sums.TaxTotalAmount {
+		// The amount in accounting currency is told apart by its currency
+		currency := trim(amount.CurrencyID)
+		if currency != "" && currency != inv.CurrencyCode && currency == inv.TaxCurrencyCode {
+			inv.Totals.TaxAccounting = p.decimal("BT-111", amount.Value)
+		} else {
+			inv.Totals.Tax = p.decimal("BT-110", amount.Value)
+		}
+	}
+
+	for _, ref := range settlement.InvoiceReferencedDocument {
+		inv.PrecedingInvoices = append(inv.PrecedingInvoices, PrecedingInvoice{
+			Number:    trim(ref.IssuerAssignedID),
+			IssueDate: p.ciiDate("BT-26", ref.FormattedIssueDateTime),
+		})
+	}
+
+	for _, line := range transaction.IncludedSupplyChainTradeLineItem {
+		inv.Lines = append(inv.Lines, p.ciiLine(line))
+	}
+
+	if p.err != nil {
+		return nil, p.err
+	}
+	return inv, nil
+}
+
+func (p *parser) ciiLine(l ciiLine) Line {
+	line := Line{ID: trim(l.AssociatedDocumentLineDocument.LineID)}
+	var notes []string
+	for _, note := range l.AssociatedDocumentLineDocument.IncludedNote {
+		if content := trim(note.Content); content != "" {
+			notes = append(notes, content)
+		}
+	}
+	line.Note = strings.Join(notes, "\n")
+
+	product := l.SpecifiedTradeProduct
+	line.Item = Item{
+		Name:          trim(product.Name),
+		Description:   trim(product.Description),
+		SellerID:      trim(product.SellerAssignedID),
+		BuyerID:       trim(product.BuyerAssignedID),
+		StandardID:    Identifier{ID: trim(product.GlobalID.Value), Scheme: trim(product.GlobalID.SchemeID)},
+		OriginCountry: trim(product.OriginTradeCountry.ID),
+	}
+	for _, class := range product.DesignatedProductClassification {
+		line.Item.Classifications = append(line.Item.Classifications, Identifier{
+			ID:            trim(class.ClassCode.Value),
+			Scheme:        trim(class.ClassCode.ListID),
+			SchemeVersion: trim(class.ClassCode.ListVersionID),
+		})
+	}
+	for _, attribute := range product.ApplicableProductCharacteristic {
+		line.Item.Attributes = append(line.Item.Attributes, ItemAttribute{Name: trim(attribute.Description), Value: trim(attribute.Value)})
+	}
+
+	agreement := l.SpecifiedLineTradeAgreement
+	line.OrderLineReference = trim(agreement.BuyerOrderReferencedDocument.LineID)
+	line.Price = Price{
+		Net:              p.decimal("BT-146", agreement.NetPriceProductTradePrice.ChargeAmount),
+		Discount:         p.decimal("BT-147", agreement.GrossPriceProductTradePrice.AppliedTradeAllowanceCharge.ActualAmount),
+		Gross:            p.decimal("BT-148", agreement.GrossPriceProductTradePrice.ChargeAmount),
+		BaseQuantity:     p.decimal("BT-149", agreement.NetPriceProductTradePrice.BasisQuantity.Value),
+		BaseQuantityUnit: trim(agreement.NetPriceProductTradePrice.BasisQuantity.UnitCode),
+	}
+	if !line.Price.BaseQuantity.IsSet() {
+		line.Price.BaseQuantity = p.decimal("BT-149", agreement.GrossPriceProductTradePrice.BasisQuantity.Value)
+		line.Price.BaseQuantityUnit = trim(agreement.GrossPriceProductTradePrice.BasisQuantity.UnitCode)
+	}
+
+	quantity := l.SpecifiedLineTradeDelivery.BilledQuantity
+	line.Quantity = p.decimal("BT-129", quantity.Value)
+	line.UnitCode = trim(quantity.UnitCode)
+
+	settlement := l.SpecifiedLineTradeSettlement
+	line.VATCategory = VATCategory(trim(settlement.ApplicableTradeTax.CategoryCode))
+	line.VATRate = p.decimal("BT-152", settlement.ApplicableTradeTax.RateApplicablePercent)
+	line.Period = p.ciiPeriod("BG-26", settlement.BillingSpecifiedPeriod)
+	for _, ac := range settlement.SpecifiedTradeAllowanceCharge {
+		if ciiIsCharge(ac) {
+			line.Charges = append(line.Charges, p.ciiAllowanceCharge("BG-28", ac))
+		} else {
+			line.Allowances = append(line.Allowances, p.ciiAllowanceCharge("BG-27", ac))
+		}
+	}
+	line.NetAmount = p.decimal("BT-131", settlement.SpecifiedTradeSettlementLineMonetarySummation.LineTotalAmount)
+	if ref := settlement.AdditionalReferencedDocument; trim(ref.IssuerAssignedID) != "" {
+		line.ObjectID = Identifier{ID: trim(ref.IssuerAssignedID), Scheme: trim(ref.ReferenceTypeCode)}
+	}
+	line.AccountingReference = trim(settlement.ReceivableSpecifiedTradeAccountingAccount.ID)
+	return line
+}
+
+func (p *parser) ciiParty(party ciiParty) Party {
+	result := Party{
+		Name:                trim(party.Name),
+		TradingName:         trim(party.SpecifiedLegalOrganization.TradingBusinessName),
+		LegalRegistrationID: Identifier{ID: trim(party.SpecifiedLegalOrganization.ID.Value), Scheme: trim(party.SpecifiedLegalOrganization.ID.SchemeID)},
+		AdditionalLegalInfo: trim(party.Description),
+		ElectronicAddress:   Identifier{ID: trim(party.URIUniversalCommunication.URIID.Value), Scheme: trim(party.URIUniversalCommunication.URIID.SchemeID)},
+		Address:             ciiAddressOf(party.PostalTradeAddress),
+		Contact: Contact{
+			Name:  firstNonEmpty(party.DefinedTradeContact.PersonName, party.DefinedTradeContact.DepartmentName),
+			Phone: trim(party.DefinedTradeContact.TelephoneUniversalCommunication.CompleteNumber),
+			Email: trim(party.DefinedTradeContact.EmailURIUniversalCommunication.URIID),
+		},
+	}
+	for _, id := range party.ID {
+		if id = trim(id); id != "" {
+			result.Identifiers = append(result.Identifiers, Identifier{ID: id})
+		}
+	}
+	for _, id := range party.GlobalID {
+		if value := trim(id.Value); value != "" {
+			result.Identifiers = append(result.Identifiers, Identifier{ID: value, Scheme: trim(id.SchemeID)})
+		}
+	}
+	for _, registration := range party.SpecifiedTaxRegistration {
+		switch trim(registration.ID.SchemeID) {
+		case "VA":
+			result.VATID = trim(registration.ID.Value)
+		case "FC":
+			result.TaxRegistrationID = trim(registration.ID.Value)
+		}
+	}
+	return result
+}
+
+// ciiTaxPointCodeOf returns the EN 16931 code of a CII VAT point date code.
+func ciiTaxPointCodeOf(code string) string {
+	for en, cii := range ciiTaxPointCodes {
+		if cii == code {
+			return en
+		}
+	}
+	return code
+}
+
+func ciiAddressOf(address ciiAddress) Address {
+	return Address{
+		Line1:       trim(address.LineOne),
+		Line2:       trim(address.LineTwo),
+		Line3:       trim(address.LineThree),
+		City:        trim(address.CityName),
+		PostCode:    trim(address.PostcodeCode),
+		Subdivision: trim(address.CountrySubDivisionName),
+		CountryCode: trim(address.CountryID),
+	}
+}
+
+func (p *parser) ciiSupportingDocument(ref ciiReferencedDocument) SupportingDocument {
+	doc := SupportingDocument{
+		ID:          trim(ref.IssuerAssignedID),
+		Description: trim(ref.Name),
+		URI:         trim(ref.URIID),
+	}
+	object := ref.AttachmentBinaryObject
+	if value := trim(object.Value); value != "" {
+		doc.Attachment = &Attachment{
+			MimeCode: trim(object.MimeCode),
+			Filename: trim(object.Filename),
+			Data:     p.base64("BT-125", value),
+		}
+	}
+	return doc
+}
+
+func ciiIsCharge(ac ciiAllowanceCharge) bool {
+	return isTrue(ac.ChargeIndicator.Indicator)
+}
+
+func (p *parser) ciiAllowanceCharge(group string, ac ciiAllowanceCharge) AllowanceCharge {
+	return AllowanceCharge{
+		Amount:      p.decimal(group+" amount", ac.ActualAmount.Value),
+		BaseAmount:  p.decimal(group+" base amount", ac.BasisAmount),
+		Percentage:  p.decimal(group+" percentage", ac.CalculationPercent),
+		VATCategory: VATCategory(trim(ac.CategoryTradeTax.CategoryCode)),
+		VATRate:     p.decimal(group+" VAT rate", ac.CategoryTradeTax.RateApplicablePercent),
+		Reason:      trim(ac.Reason),
+		ReasonCode:  trim(ac.ReasonCode),
+	}
+}
+
+func (p *parser) ciiDate(field string, dt ciiDateTime) Date {
+	return p.date(field, dt.DateTimeString.Value, dt.DateTimeString.Format)
+}
+
+func (p *parser) ciiPeriod(group string, period ciiPeriod) Period {
+	return Period{
+		Start: p.ciiDate(group+" start date", period.StartDateTime),
+		End:   p.ciiDate(group+" end date", period.EndDateTime),
+	}
+}
@@ -0,0 +1,367 @@
+package model
+
+import "encoding/base64"
+
+// CII D16B namespaces
+const (
+	NamespaceCIIRSM = "urn:un:unece:uncefact:data:standard:CrossIndustryInvoice:100"
+	NamespaceCIIRAM = "urn:un:unece:uncefact:data:standard:ReusableAggregateBusinessInformationEntity:100"
+	NamespaceCIIUDT = "urn:un:unece:uncefact:data:standard:UnqualifiedDataType:100"
+	NamespaceCIIQDT = "urn:un:unece:uncefact:data:standard:QualifiedDataType:100"
+)
+
+// ciiTaxPointCodes maps the VAT point date codes of EN 16931 (UNTDID 2005,
+// used by UBL) to the UNTDID 2475 codes CII uses instead.
+var ciiTaxPointCodes = map[string]string{
+	"3":   "5",
+	"35":  "29",
+	"432": "72",
+}
+
+// MarshalCII writes the invoice as CII D16B CrossIndustryInvoice, with the
+// elements in schema order.
+func MarshalCII(inv *Invoice) []byte {
+	root := newXMLNode("rsm:CrossIndustryInvoice",
+		"xmlns:rsm", NamespaceCIIRSM,
+		"xmlns:ram", NamespaceCIIRAM,
+		"xmlns:udt", NamespaceCIIUDT,
+		"xmlns:qdt", NamespaceCIIQDT)
+
+	context := root.elem("rsm:ExchangedDocumentContext")
+	context.elem("ram:BusinessProcessSpecifiedDocumentContextParameter").leaf("ram:ID", inv.BusinessProcess)
+	context.elem("ram:GuidelineSpecifiedDocumentContextParameter").leaf("ram:ID", inv.SpecificationID)
+
+	document := root.elem("rsm:ExchangedDocument")
+	document.leaf("ram:ID", inv.Number)
+	document.leaf("ram:TypeCode", string(inv.TypeCode))
+	ciiWriteDate(document, "ram:IssueDateTime", "udt:DateTimeString", inv.IssueDate)
+	for _, note := range inv.Notes {
+		included := document.elem("ram:IncludedNote")
+		included.leaf("ram:Content", note.Text)
+		included.leaf("ram:SubjectCode", note.SubjectCode)
+	}
+
+	transaction := root.elem("rsm:SupplyChainTradeTransaction")
+	for _, line := range inv.Lines {
+		ciiWriteLine(transaction.elem("ram:IncludedSupplyChainTradeLineItem"), line)
+	}
+
+	agreement := transaction.elem("ram:ApplicableHeaderTradeAgreement")
+	agreement.leaf("ram:BuyerReference", inv.BuyerReference)
+	ciiWriteParty(agreement.elem("ram:SellerTradeParty"), inv.Seller)
+	ciiWriteParty(agreement.elem("ram:BuyerTradeParty"), inv.Buyer)
+	if inv.TaxRepresentative != nil {
+		ciiWriteParty(agreement.elem("ram:SellerTaxRepresentativeTradeParty"), *inv.TaxRepresentative)
+	}
+	agreement.elem("ram:SellerOrderReferencedDocument").leaf("ram:IssuerAssignedID", inv.SalesOrderReference)
+	agreement.elem("ram:BuyerOrderReferencedDocument").leaf("ram:IssuerAssignedID", inv.PurchaseOrderReference)
+	agreement.elem("ram:ContractReferencedDocument").leaf("ram:IssuerAssignedID", inv.ContractReference)
+	for _, doc := range inv.SupportingDocuments {
+		ref := agreement.elem("ram:AdditionalReferencedDocument")
+		ref.leaf("ram:IssuerAssignedID", doc.ID)
+		ref.leaf("ram:URIID", doc.URI)
+		ref.leaf("ram:TypeCode", "916")
+		ref.leaf("ram:Name", doc.Description)
+		if attachment := doc.Attachment; attachment != nil {
+			ref.leaf("ram:AttachmentBinaryObject", base64.StdEncoding.EncodeToString(attachment.Data),
+				"mimeCode", attachment.MimeCode, "filename", attachment.Filename)
+		}
+	}
+	if inv.TenderReference != "" {
+		ref := agreement.elem("ram:AdditionalReferencedDocument")
+		ref.leaf("ram:IssuerAssignedID", inv.TenderReference)
+		ref.leaf("ram:TypeCode", "50")
+	}
+	if inv.InvoicedObject.IsSet() {
+		ref := agreement.elem("ram:AdditionalReferencedDocument")
+		ref.leaf("ram:IssuerAssignedID", inv.InvoicedObject.ID)
+		ref.leaf("ram:TypeCode", "130")
+		ref.leaf("ram:ReferenceTypeCode", inv.InvoicedObject.Scheme)
+	}
+	if inv.ProjectReference != "" {
+		project := agreement.elem("ram:SpecifiedProcuringProject")
+		project.leaf("ram:ID", inv.ProjectReference)
+		project.leaf("ram:Name", "Project reference")
+	}
+
+	delivery := transaction.elem("ram:ApplicableHeaderTradeDelivery")
+	if d := inv.Delivery; d != nil {
+		party := delivery.elem("ram:ShipToTradeParty")
+		if d.LocationID.Scheme != "" {
+			party.leaf("ram:GlobalID", d.LocationID.ID, "schemeID", d.LocationID.Scheme)
+		} else {
+			party.leaf("ram:ID", d.LocationID.ID)
+		}
+		party.leaf("ram:Name", d.PartyName)
+		ciiWriteAddress(party, d.Address)
+		ciiWriteDate(delivery.elem("ram:ActualDeliverySupplyChainEvent"), "ram:OccurrenceDateTime", "udt:DateTimeString", d.Date)
+	}
+	delivery.elem("ram:DespatchAdviceReferencedDocument").leaf("ram:IssuerAssignedID", inv.DespatchAdviceReference)
+	delivery.elem("ram:ReceivingAdviceReferencedDocument").leaf("ram:IssuerAssignedID", inv.ReceivingAdviceReference)
+
+	settlement := transaction.elem("ram:ApplicableHeaderTradeSettlement")
+	payment := inv.PaymentInstructions
+	if payment.DirectDebit != nil {
+		settlement.leaf("ram:CreditorReferenceID", payment.DirectDebit.CreditorID)
+	}
+	settlement.leaf("ram:PaymentReference", payment.RemittanceInfo)
+	settlement.leaf("ram:TaxCurrencyCode", inv.TaxCurrencyCode)
+	settlement.leaf("ram:InvoiceCurrencyCode", inv.CurrencyCode)
+	if inv.Payee != nil {
+		ciiWriteParty(settlement.elem("ram:PayeeTradeParty"), *inv.Payee)
+	}
+	ciiWritePaymentMeans(settlement, payment)
+
+	for i, vat := range inv.VATBreakdown {
+		tax := settlement.elem("ram:ApplicableTradeTax")
+		tax.leaf("ram:CalculatedAmount", vat.TaxAmount.String())
+		tax.leaf("ram:TypeCode", "VAT")
+		tax.leaf("ram:ExemptionReason", vat.ExemptionReason)
+		tax.leaf("ram:BasisAmount", vat.TaxableAmount.String())
+		tax.leaf("ram:CategoryCode", string(vat.Category))
+		tax.leaf("ram:ExemptionReasonCode", vat.ExemptionReasonCode)
+		if i == 0 {
+			// The VAT point date applies to the whole invoice
+			if inv.TaxPointDate.IsSet() {
+				value, _ := inv.TaxPointDate.CII(DateFormatDay)
+				tax.elem("ram:TaxPointDate").leaf("udt:DateString", value, "format", DateFormatDay)
+			}
+			tax.leaf("ram:DueDateTypeCode", ciiTaxPointCodes[inv.TaxPointDateCode])
+		}
+		tax.leaf("ram:RateApplicablePercent", vat.Rate.String())
+	}
+
+	ciiWritePeriod(settlement.elem("ram:BillingSpecifiedPeriod"), inv.InvoicingPeriod)
+	for _, allowance := range inv.Allowances {
+		ciiWriteAllowanceCharge(settlement, allowance, false, true)
+	}
+	for _, charge := range inv.Charges {
+		ciiWriteAllowanceCharge(settlement, charge, true, true)
+	}
+
+	terms := settlement.elem("ram:SpecifiedTradePaymentTerms")
+	terms.leaf("ram:Description", inv.PaymentTerms)
+	ciiWriteDate(terms, "ram:DueDateDateTime", "udt:DateTimeString", inv.DueDate)
+	if payment.DirectDebit != nil {
+		terms.leaf("ram:DirectDebitMandateID", payment.DirectDebit.MandateID)
+	}
+
+	totals := inv.Totals
+	sums := settlement.elem("ram:SpecifiedTradeSettlementHeaderMonetarySummation")
+	sums.leaf("ram:LineTotalAmount", totals.LineNet.String())
+	sums.leaf("ram:ChargeTotalAmount", totals.Charges.String())
+	sums.leaf("ram:AllowanceTotalAmount", totals.Allowances.String())
+	sums.leaf("ram:TaxBasisTotalAmount", totals.TaxBasis.String())
+	sums.leaf("ram:TaxTotalAmount", totals.Tax.String(), "currencyID", inv.CurrencyCode)
+	sums.leaf("ram:TaxTotalAmount", totals.TaxAccounting.String(), "currencyID", inv.TaxCurrencyCode)
+	sums.leaf("ram:RoundingAmount", totals.Rounding.String())
+	sums.leaf("ram:GrandTotalAmount", totals.Grand.String())
+	sums.leaf("ram:TotalPrepaidAmount", totals.Prepaid.String())
+	sums.leaf("ram:DuePayableAmount", totals.DuePayable.String())
+
+	for _, preceding := range inv.PrecedingInvoices {
+		ref := settlement.elem("ram:InvoiceReferencedDocument")
+		ref.leaf("ram:IssuerAssignedID", preceding.Number)
+		ciiWriteDate(ref, "ram:FormattedIssueDateTime", "qdt:DateTimeString", preceding.IssueDate)
+	}
+	settlement.elem("ram:ReceivableSpecifiedTradeAccountingAccount").leaf("ram:ID", inv.BuyerAccountingReference)
+
+	return marshalXML(root)
+}
+
+func ciiWriteLine(item *xmlNode, line Line) {
+	document := item.elem("ram:AssociatedDocumentLineDocument")
+	document.leaf("ram:LineID", line.ID)
+	document.elem("ram:IncludedNote").leaf("ram:Content", line.Note)
+
+	product := item.elem("ram:SpecifiedTradeProduct")
+	product.leaf("ram:GlobalID", line.Item.StandardID.ID, "schemeID", line.Item.StandardID.Scheme)
+	product.leaf("ram:SellerAssignedID", line.Item.SellerID)
+	product.leaf("ram:BuyerAssignedID", line.Item.BuyerID)
+	product.leaf("ram:Name", line.Item.Name)
+	product.leaf("ram:Description", line.Item.Description)
+	for _, attribute := range line.Item.Attributes {
+		characteristic := product.elem("ram:ApplicableProductCharacteristic")
+		characteristic.leaf("ram:Description", attribute.Name)
+		characteristic.leaf("ram:Value", attribute.Value)
+	}
+	for _, class := range line.Item.Classifications {
+		product.elem("ram:DesignatedProductClassification").leaf("ram:ClassCode", class.ID,
+			"listID", class.Scheme, "listVersionID", class.SchemeVersion)
+	}
+	product.elem("ram:OriginTradeCountry").leaf("ram:ID", line.Item.OriginCountry)
+
+	agreement := item.elem("ram:SpecifiedLineTradeAgreement")
+	agreement.elem("ram:BuyerOrderReferencedDocument").leaf("ram:LineID", line.OrderLineReference)
+	price := line.Price
+	if price.Gross.IsSet() {
+		gross := agreement.elem("ram:GrossPriceProductTradePrice")
+		gross.leaf("ram:ChargeAmount", price.Gross.String())
+		gross.leaf("ram:BasisQuantity", price.BaseQuantity.String(), "unitCode", price.BaseQuantityUnit)
+		if price.Discount.IsSet() {
+			discount := gross.elem("ram:AppliedTradeAllowanceCharge")
+			discount.elem("ram:ChargeIndicator").leaf("udt:Indicator", "false")
+			discount.leaf("ram:ActualAmount", price.Discount.String())
+		}
+	}
+	net := agreement.elem("ram:NetPriceProductTradePrice")
+	net.leaf("ram:ChargeAmount", price.Net.String())
+	net.leaf("ram:BasisQuantity", price.BaseQuantity.String(), "unitCode", price.BaseQuantityUnit)
+
+	item.elem("ram:SpecifiedLineTradeDelivery").leaf("ram:BilledQuantity", line.Quantity.String(), "unitCode", line.UnitCode)
+
+	settlement := item.elem("ram:SpecifiedLineTradeSettlement")
+	tax := settlement.elem("ram:ApplicableTradeTax")
+	if line.VATCategory != "" {
+		tax.leaf("ram:TypeCode", "VAT")
+	}
+	tax.leaf("ram:CategoryCode", string(line.VATCategory))
+	tax.leaf("ram:RateApplicablePercent", line.VATRate.String())
+	ciiWritePeriod(settlement.elem("ram:BillingSpecifiedPeriod"), line.Period)
+	for _, allowance := range line.Allowances {
+		ciiWriteAllowanceCharge(settlement, allowance, false, false)
+	}
+	for _, charge := range line.Charges {
+		ciiWriteAllowanceCharge(settlement, charge, true, false)
+	}
+	settlement.elem("ram:SpecifiedTradeSettlementLineMonetarySummation").leaf("ram:LineTotalAmount", line.NetAmount.String())
+	if line.ObjectID.IsSet() {
+		ref := settlement.elem("ram:AdditionalReferencedDocument")
+		ref.leaf("ram:IssuerAssignedID", line.ObjectID.ID)
+		ref.leaf("ram:TypeCode", "130")
+		ref.leaf("ram:ReferenceTypeCode", line.ObjectID.Scheme)
+	}
+	settlement.elem("ram:ReceivableSpecifiedTradeAccountingAccount").leaf("ram:ID", line.AccountingReference)
+}
+
+func ciiWriteParty(node *xmlNode, party Party) {
+	for _, id := range party.Identifiers {
+		if id.Scheme == "" {
+			node.leaf("ram:ID", id.ID)
+		}
+	}
+	for _, id := range party.Identifiers {
+		if id.Scheme != "" {
+			node.leaf("ram:GlobalID", id.ID, "schemeID", id.Scheme)
+		}
+	}
+	node.leaf("ram:Name", party.Name)
+	node.leaf("ram:Description", party.AdditionalLegalInfo)
+
+	organization := node.elem("ram:SpecifiedLegalOrganization")
+	organization.leaf("ram:ID", party.LegalRegistrationID.ID, "schemeID", party.LegalRegistrationID.Scheme)
+	organization.leaf("ram:TradingBusinessName", party.TradingName)
+
+	contact := node.elem("ram:DefinedTradeContact")
+	contact.leaf("ram:PersonName", party.Contact.Name)
+	contact.elem("ram:TelephoneUniversalCommunication").leaf("ram:CompleteNumber", party.Contact.Phone)
+	contact.elem("ram:EmailURIUniversalCommunication").leaf("ram:URIID", party.Contact.Email)
+
+	ciiWriteAddress(node, party.Address)
+	node.elem("ram:URIUniversalCommunication").leaf("ram:URIID", party.ElectronicAddress.ID, "schemeID", party.ElectronicAddress.Scheme)
+	node.elem("ram:SpecifiedTaxRegistration").leaf("ram:ID", party.VATID, "schemeID", "VA")
+	node.elem("ram:SpecifiedTaxRegistration").leaf("ram:ID", party.TaxRegistrationID, "schemeID", "FC")
+}
+
+func ciiWriteAddress(node *xmlNode, address Address) {
+	postal := node.elem("ram:PostalTradeAddress")
+	postal.leaf("ram:PostcodeCode", address.PostCode)
+	postal.leaf("ram:LineOne", address.Line1)
+	postal.leaf("ram:LineTwo", address.Line2)
+	postal.leaf("ram:LineThree", address.Line3)
+	postal.leaf("ram:CityName", address.City)
+	postal.leaf("ram:CountryID", address.CountryCode)
+	postal.leaf("ram:CountrySubDivisionName", address.Subdivision)
+}
+
+func ciiWritePaymentMeans(settlement *xmlNode, payment PaymentInstructions) {
+	if payment.MeansCode == "" {
+		return
+	}
+	newMeans := func() *xmlNode {
+		means := settlement.elem("ram:SpecifiedTradeSettlementPaymentMeans")
+		means.leaf("ram:TypeCode", payment.MeansCode)
+		means.leaf("ram:Information", payment.MeansText)
+		return means
+	}
+
+	means := newMeans()
+	if card := payment.Card; card != nil {
+		financialCard := means.elem("ram:ApplicableTradeSettlementFinancialCard")
+		financialCard.leaf("ram:ID", card.AccountNumber)
+		financialCard.leaf("ram:CardholderName", card.HolderName)
+	}
+	if debit := payment.DirectDebit; debit != nil {
+		means.elem("ram:PayerPartyDebtorFinancialAccount").leaf("ram:IBANID", debit.DebitedAccount)
+	}
+	for i, transfer := range payment.CreditTransfers {
+		if i > 0 {
+			means = newMeans() // One account per payment means
+		}
+		account := means.elem("ram:PayeePartyCreditorFinancialAccount")
+		if isIBAN(transfer.AccountID) {
+			account.leaf("ram:IBANID", transfer.AccountID)
+			account.leaf("ram:AccountName", transfer.AccountName)
+		} else {
+			account.leaf("ram:AccountName", transfer.AccountName)
+			account.leaf("ram:ProprietaryID", transfer.AccountID)
+		}
+		means.elem("ram:PayeeSpecifiedCreditorFinancialInstitution").leaf("ram:BICID", transfer.ProviderID)
+	}
+}
+
+// isIBAN reports whether id looks like an IBAN: country code, two check
+// digits and up to 30 alphanumeric characters.
+func isIBAN(id string) bool {
+	id = trim(id)
+	if len(id) < 15 || len(id) > 34 {
+		return false
+	}
+	for i, r := range id {
+		switch {
+		case i < 2 && r >= 'A' && r <= 'Z':
+		case i >= 2 && i < 4 && r >= '0' && r <= '9':
+		case i >= 4 && (r >= '0' && r <= '9' || r >= 'A' && r <= 'Z'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func ciiWriteAllowanceCharge(parent *xmlNode, ac AllowanceCharge, charge, header bool) {
+	node := parent.elem("ram:SpecifiedTradeAllowanceCharge")
+	indicator := "false"
+	if charge {
+		indicator = "true"
+	}
+	node.elem("ram:ChargeIndicator").leaf("udt:Indicator", indicator)
+	node.leaf("ram:CalculationPercent", ac.Percentage.String())
+	node.leaf("ram:BasisAmount", ac.BaseAmount.String())
+	node.leaf("ram:ActualAmount", ac.Amount.String())
+	node.leaf("ram:ReasonCode", ac.ReasonCode)
+	node.leaf("ram:Reason", ac.Reason)
+	if header {
+		tax := node.elem("ram:CategoryTradeTax")
+		if ac.VATCategory != "" {
+			tax.leaf("ram:TypeCode", "VAT")
+		}
+		tax.leaf("ram:CategoryCode", string(ac.VATCategory))
+		tax.leaf("ram:RateApplicablePercent", ac.VATRate.String())
+	}
+}
+
+func ciiWritePeriod(node *xmlNode, period Period) {
+	ciiWriteDate(node, "ram:StartDateTime", "udt:DateTimeString", period.Start)
+	ciiWriteDate(node, "ram:EndDateTime", "udt:DateTimeString", period.End)
+}
+
+// ciiWriteDate appends a date element holding a DateTimeString with format
+// attribute, keeping the precision of the date.
+func ciiWriteDate(parent *xmlNode, name, stringName string, date Date) {
+	if !date.IsSet() {
+		return
+	}
+	value, _ := date.CII("")
+	parent.elem(name).leaf(stringName, value, "format", date.FormatCode())
+}
@@ -0,0 +1,204 @@
+package model
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// ConversionReport lists what a conversion could not carry over to the
+// target syntax.
+type ConversionReport struct {
+	From    string         `json:"from"`
+	To      string         `json:"to"`
+	Dropped []DroppedField `json:"dropped"`
+}
+
+// DroppedField is a value of the source document missing in the result.
+type DroppedField struct {
+	Path   string `json:"path"`
+	Value  string `json:"value,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// Marshal writes the invoice in the given syntax (SyntaxCII, SyntaxUBL,
+// SyntaxPeppol or SyntaxEDIFACT).
+func Marshal(inv *Invoice, syntax string) ([]byte, error) {
+	switch strings.ToUpper(syntax) {
+	case SyntaxCII:
+		return MarshalCII(inv), nil
+	case SyntaxUBL:
+		return MarshalUBL(inv), nil
+	case SyntaxPeppol:
+		return MarshalPeppol(inv), nil
+	case SyntaxEDIFACT:
+		return MarshalEDIFACT(inv), nil
+	}
+	return nil, fmt.Errorf("unsupported syntax: %s", syntax)
+}
+
+// Convert reads a CII or UBL invoice and writes it in the syntax to. All
+// EN 16931 business terms are carried over; elements outside the semantic
+// model, such as the extensions of the ZUGFeRD EXTENDED profile, are listed
+// in the report. ZUGFeRD 1.0 documents are upgraded to CII D16B first; the
+// report names their elements by the D16B path.
+func Convert(data []byte, to string) ([]byte, *ConversionReport, error) {
+	from := ""
+	if root, err := rootElement(data); err == nil && root == "CrossIndustryDocument" {
+		if data, err = upgradeZUGFeRD1(data); err != nil {
+			return nil, nil, err
+		}
+		from = SourceZUGFeRD1
+	}
+	inv, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	result, err := Marshal(inv, to)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	report := &ConversionReport{From: firstNonEmpty(from, inv.Syntax), To: strings.ToUpper(to), Dropped: []DroppedField{}}
+	dropped, err := unmappedElements(data, inv)
+	if err != nil {
+		return nil, nil, err
+	}
+	report.Dropped = append(report.Dropped, dropped...)
+	report.Dropped = append(report.Dropped, targetLosses(inv, report.To)...)
+	return result, report, nil
+}
+
+var (
+	knownPathsOnce sync.Once
+	knownPaths     map[string]map[string]bool
+)
+
+// knownElementPaths returns the element paths below the root that the
+// parser of the syntax reads, derived from the xml tags of its structures.
+func knownElementPaths(syntax string) map[string]bool {
+	knownPathsOnce.Do(func() {
+		knownPaths = map[string]map[string]bool{
+			SyntaxCII: {},
+			SyntaxUBL: {},
+		}
+		collectPaths(reflect.TypeOf(ciiInvoice{}), "", knownPaths[SyntaxCII])
+		collectPaths(reflect.TypeOf(ublInvoice{}), "", knownPaths[SyntaxUBL])
+	})
+	return knownPaths[syntax]
+}
+
+func collectPaths(t reflect.Type, prefix string, paths map[string]bool) {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("xml"), ",")
+		if name == "" || field.Type == reflect.TypeOf(xml.Name{}) || strings.Contains(field.Tag.Get("xml"), ",attr") {
+			continue
+		}
+		path := name
+		if prefix != "" {
+			path = prefix + "/" + name
+		}
+		paths[path] = true
+		collectPaths(field.Type, path, paths)
+	}
+}
+
+// unmappedElements returns the elements with content that the parser of the
+// invoice's syntax does not read.
+func unmappedElements(data []byte, inv *Invoice) ([]DroppedField, error) {
+	known := knownElementPaths(inv.Syntax)
+	reason := "not part of the EN 16931 semantic model"
+	if strings.Contains(strings.ToLower(inv.SpecificationID), "extended") {
+		reason = "EXTENDED profile element, not part of EN 16931"
+	}
+
+	var dropped []DroppedField
+	var stack []string
+	var text strings.Builder
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			if err == io.EOF {
+				return dropped, nil
+			}
+			return nil, fmt.Errorf("error decoding XML: %w", err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name.Local)
+			text.Reset()
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			value := strings.TrimSpace(text.String())
+			text.Reset()
+			if len(stack) > 1 && value != "" {
+				path := strings.Join(stack[1:], "/")
+				if !known[path] {
+					dropped = append(dropped, DroppedField{Path: "/" + strings.Join(stack, "/"), Value: value, Reason: reason})
+				}
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+}
+
+// targetLosses lists the values the target syntax cannot hold.
+func targetLosses(inv *Invoice, to string) []DroppedField {
+	switch to {
+	case SyntaxEDIFACT:
+		return edifactLosses(inv)
+	case SyntaxPeppol:
+		return peppolLosses(inv)
+	}
+	var losses []DroppedField
+	if to != SyntaxUBL {
+		return losses
+	}
+	type termDate struct {
+		field string
+		date  Date
+	}
+	dates := []termDate{
+		{"BT-2", inv.IssueDate},
+		{"BT-7", inv.TaxPointDate},
+		{"BT-9", inv.DueDate},
+		{"BT-73", inv.InvoicingPeriod.Start},
+		{"BT-74", inv.InvoicingPeriod.End},
+	}
+	if inv.Delivery != nil {
+		dates = append(dates, termDate{"BT-72", inv.Delivery.Date})
+	}
+	for _, line := range inv.Lines {
+		dates = append(dates, termDate{"BT-134", line.Period.Start}, termDate{"BT-135", line.Period.End})
+	}
+	for _, d := range dates {
+		if d.date.IsSet() && d.date.FormatCode() != DateFormatDay {
+			losses = append(losses, DroppedField{
+				Path:   d.field,
+				Value:  d.date.String(),
+				Reason: "UBL dates are days; written as " + d.date.XSDate(),
+			})
+		}
+	}
+	if inv.TypeCode.IsCreditNote() && inv.DueDate.IsSet() && inv.PaymentInstructions.MeansCode == "" {
+		losses = append(losses, DroppedField{
+			Path:   "BT-9",
+			Value:  inv.DueDate.String(),
+			Reason: "a UBL CreditNote carries the due date in the payment means, which are missing",
+		})
+	}
+	return losses
+}
@@ -0,0 +1,73 @@
+package model
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// The fixture is an XRechnung CII invoice using most of the EN 16931
+// business terms: allowances and charges on document and line level, two
+// VAT rates, a payee, a delivery party and a preceding invoice.
+const ciiFixture = "testdata/cii_xrechnung.xml"
+
+func parseFixture(t *testing.T, name string) (*Invoice, []byte) {
+	t.Helper()
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inv, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return inv, data
+}
+
+// sameInvoice reports whether a and b carry the same business terms,
+// ignoring the syntax they were read from.
+func sameInvoice(a, b *Invoice) bool {
+	x, y := *a, *b
+	x.Syntax, y.Syntax = "", ""
+	return reflect.DeepEqual(x, y)
+}
+
+func TestConvertCIIToUBL(t *testing.T) {
+	original, data := parseFixture(t, ciiFixture)
+	if len(original.Lines) != 3 || len(original.Allowances) != 1 || len(original.Charges) != 1 || len(original.VATBreakdown) != 2 ||
+		len(original.PrecedingInvoices) != 1 || len(original.SupportingDocuments) != 1 || original.Payee == nil || original.Delivery == nil ||
+		original.ProjectReference == "" || !original.InvoicingPeriod.Start.IsSet() || len(original.Lines[1].Allowances) != 1 {
+		t.Fatalf("fixture parsed incompletely: %+v", original)
+	}
+
+	ubl, report, err := Convert(data, SyntaxUBL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.From != SyntaxCII || report.To != SyntaxUBL {
+		t.Errorf("report = %s to %s", report.From, report.To)
+	}
+	if len(report.Dropped) != 0 {
+		t.Errorf("dropped fields: %+v", report.Dropped)
+	}
+
+	fromUBL, err := Parse(bytes.NewReader(ubl))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fromUBL.Syntax != SyntaxUBL {
+		t.Errorf("Syntax = %q", fromUBL.Syntax)
+	}
+	if !sameInvoice(original, fromUBL) {
+		t.Errorf("CII to UBL changed the invoice:\n%+v\nwant\n%+v", fromUBL, original)
+	}
+
+	back, err := Parse(bytes.NewReader(MarshalCII(fromUBL)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameInvoice(original, back) {
+		t.Errorf("UBL to CII changed the invoice:\n%+v\nwant\n%+v", back, original)
+	}
+}
@@ -0,0 +1,178 @@
+package model
+
+import "fmt"
+
+// CorrectionOptions describe a credit note or corrective invoice derived
+// from an existing invoice.
+type CorrectionOptions struct {
+	TypeCode  DocumentTypeCode // TypeCreditNote (default) or TypeCorrectedInvoice
+	Number    string           // BT-1 of the new document
+	IssueDate Date             // BT-2 of the new document
+	Reason    string           // Added as invoice note (BT-22)
+	Lines     []LineSelection  // Lines to credit, all lines if empty
+}
+
+// LineSelection selects an invoice line by its identifier (BT-126), with
+// the quantity to credit or, if absent, the full quantity.
+type LineSelection struct {
+	LineID   string
+	Quantity Decimal
+}
+
+// ratioDecimals is the precision of the share of a partially credited line.
+const ratioDecimals = 10
+
+// Correct derives a credit note (381) or a corrective invoice (384) from the
+// original invoice. It references the original in BG-3, copies parties,
+// references and payment instructions and the selected lines. A credit note
+// keeps the amounts positive, its type code reverses them; a corrective
+// invoice cancels the lines with negated quantities. Fixed allowances and
+// charges are reduced in proportion to the credited share and all totals are
+// recomputed with Calculate.
+func Correct(original *Invoice, opts CorrectionOptions) (*Invoice, error) {
+	if opts.TypeCode == "" {
+		opts.TypeCode = TypeCreditNote
+	}
+	var problems []string
+	if opts.TypeCode != TypeCreditNote && opts.TypeCode != TypeCorrectedInvoice {
+		problems = append(problems, fmt.Sprintf("BT-3: type code %s is neither %s nor %s", opts.TypeCode, TypeCreditNote, TypeCorrectedInvoice))
+	}
+	if opts.Number == "" {
+		problems = append(problems, "BT-1: number of the new document missing")
+	}
+	if !opts.IssueDate.IsSet() {
+		problems = append(problems, "BT-2: issue date of the new document missing")
+	}
+
+	sign := NewDecimal(1, 0)
+	if opts.TypeCode == TypeCorrectedInvoice {
+		sign = NewDecimal(-1, 0)
+	}
+
+	inv := *original
+	inv.Syntax = ""
+	inv.TypeCode = opts.TypeCode
+	inv.Number = opts.Number
+	inv.IssueDate = opts.IssueDate
+	inv.TaxPointDate, inv.TaxPointDateCode, inv.DueDate = Date{}, "", Date{}
+	inv.PaymentTerms = ""
+	inv.Notes = nil
+	if opts.Reason != "" {
+		inv.Notes = []Note{{Text: opts.Reason}}
+	}
+	inv.PrecedingInvoices = []PrecedingInvoice{{Number: original.Number, IssueDate: original.IssueDate}}
+	inv.SupportingDocuments = nil
+	inv.Totals = Totals{}
+
+	selected, ratios, lineProblems := selectLines(original, opts.Lines)
+	problems = append(problems, lineProblems...)
+	if len(problems) > 0 {
+		return nil, &InputError{Problems: problems}
+	}
+
+	// Share of the credited line amounts in the original line total
+	credited, total := zeroAmount, zeroAmount
+	inv.Lines = nil
+	for i, line := range selected {
+		credited = credited.Add(line.NetAmount.Mul(ratios[i]))
+		inv.Lines = append(inv.Lines, correctLine(line, ratios[i], sign))
+	}
+	for _, line := range original.Lines {
+		total = total.Add(line.NetAmount)
+	}
+	share := NewDecimal(1, 0)
+	if total.Sign() != 0 {
+		share = credited.Div(total, ratioDecimals)
+	}
+
+	inv.Allowances = correctAllowanceCharges(original.Allowances, share, sign)
+	inv.Charges = correctAllowanceCharges(original.Charges, share, sign)
+	inv.VATBreakdown = original.VATBreakdown // Keeps the exemption reasons
+	if err := Calculate(&inv); err != nil {
+		return nil, err
+	}
+	if original.Totals.TaxAccounting.IsSet() && original.Totals.Tax.Sign() != 0 {
+		inv.Totals.TaxAccounting = original.Totals.TaxAccounting.Mul(inv.Totals.Tax).Div(original.Totals.Tax, AmountDecimals)
+	}
+	return &inv, nil
+}
+
+// selectLines returns the selected lines of the invoice with the credited
+// quantity and its share of the invoiced quantity.
+func selectLines(inv *Invoice, selections []LineSelection) ([]Line, []Decimal, []string) {
+	one := NewDecimal(1, 0)
+	if len(selections) == 0 {
+		ratios := make([]Decimal, len(inv.Lines))
+		for i := range ratios {
+			ratios[i] = one
+		}
+		return inv.Lines, ratios, nil
+	}
+
+	var lines []Line
+	var ratios []Decimal
+	var problems []string
+	for _, selection := range selections {
+		var line *Line
+		for i := range inv.Lines {
+			if inv.Lines[i].ID == selection.LineID {
+				line = &inv.Lines[i]
+				break
+			}
+		}
+		switch {
+		case line == nil:
+			problems = append(problems, fmt.Sprintf("BG-25[%s]: no such invoice line", selection.LineID))
+		case containsLine(lines, selection.LineID):
+			problems = append(problems, fmt.Sprintf("BG-25[%s]: line selected twice", selection.LineID))
+		case !selection.Quantity.IsSet():
+			lines = append(lines, *line)
+			ratios = append(ratios, one)
+		case selection.Quantity.Sign() <= 0 || selection.Quantity.Cmp(line.Quantity) > 0:
+			problems = append(problems, fmt.Sprintf("BG-25[%s]: quantity %s not between 0 and the invoiced quantity %s", selection.LineID, selection.Quantity, line.Quantity))
+		default:
+			ratios = append(ratios, selection.Quantity.Div(line.Quantity, ratioDecimals))
+			partial := *line
+			partial.Quantity = selection.Quantity
+			lines = append(lines, partial)
+		}
+	}
+	return lines, ratios, problems
+}
+
+func containsLine(lines []Line, id string) bool {
+	for _, line := range lines {
+		if line.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// correctLine copies the line with the credited quantity. Fixed allowance
+// and charge amounts follow the quantity, percentages are recomputed.
+func correctLine(line Line, ratio, sign Decimal) Line {
+	line.Quantity = line.Quantity.Mul(sign)
+	line.NetAmount = Decimal{}
+	line.Allowances = correctAllowanceCharges(line.Allowances, ratio, sign)
+	line.Charges = correctAllowanceCharges(line.Charges, ratio, sign)
+	return line
+}
+
+// correctAllowanceCharges scales the amounts by ratio and sign; amounts
+// given as percentage are left to Calculate.
+func correctAllowanceCharges(acs []AllowanceCharge, ratio, sign Decimal) []AllowanceCharge {
+	var result []AllowanceCharge
+	for _, ac := range acs {
+		if ac.BaseAmount.IsSet() {
+			ac.BaseAmount = ac.BaseAmount.Mul(ratio).Mul(sign).RoundAmount()
+		}
+		if ac.Percentage.IsSet() {
+			ac.Amount = Decimal{}
+		} else {
+			ac.Amount = ac.Amount.Mul(ratio).Mul(sign).RoundAmount()
+		}
+		result = append(result, ac)
+	}
+	return result
+}
@@ -0,0 +1,110 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Profiles an invoice can be created for.
+const (
+	ProfileEN16931   = "EN16931"
+	ProfileXRechnung = "XRECHNUNG"
+	ProfileExtended  = "EXTENDED" // ZUGFeRD / Factur-X EXTENDED, CII only
+)
+
+// profileSpecifications are the specification identifiers (BT-24) and the
+// default business process (BT-23) of the profiles.
+var profileSpecifications = map[string]struct {
+	specificationID string
+	businessProcess string
+}{
+	ProfileEN16931:   {specificationID: "urn:cen.eu:en16931:2017"},
+	ProfileXRechnung: {specificationID: "urn:cen.eu:en16931:2017#compliant#urn:xeinkauf.de:kosit:xrechnung_3.0", businessProcess: "urn:fdc:peppol.eu:2017:poacc:billing:01:1.0"},
+	ProfileExtended:  {specificationID: "urn:cen.eu:en16931:2017#conformant#urn:factur-x.eu:1p0:extended"},
+}
+
+// ParseProfile returns the profile constant for names such as "en16931",
+// "XRechnung" or "zugferd-extended".
+func ParseProfile(name string) (string, error) {
+	profile := strings.ToUpper(strings.NewReplacer(" ", "", "-", "", "_", "").Replace(name))
+	switch profile {
+	case "", "EN16931", "COMFORT":
+		return ProfileEN16931, nil
+	case "XRECHNUNG":
+		return ProfileXRechnung, nil
+	case "EXTENDED", "ZUGFERDEXTENDED", "FACTURXEXTENDED":
+		return ProfileExtended, nil
+	}
+	return "", fmt.Errorf("unsupported profile: %s", name)
+}
+
+// Create completes a structured invoice and writes it in syntax for the
+// profile: the specification identifier is set, type code 380 is the
+// default, and all totals are computed by Calculate, which modifies inv.
+// Input that the profile requires but lacks is reported as *InputError.
+func Create(inv *Invoice, profile, syntax string) ([]byte, error) {
+	profile, err := ParseProfile(profile)
+	if err != nil {
+		return nil, err
+	}
+	syntax = strings.ToUpper(syntax)
+	if profile == ProfileExtended && syntax != SyntaxCII {
+		return nil, fmt.Errorf("profile %s is only available in %s", profile, SyntaxCII)
+	}
+
+	spec := profileSpecifications[profile]
+	inv.SpecificationID = spec.specificationID
+	if inv.BusinessProcess == "" {
+		inv.BusinessProcess = spec.businessProcess
+	}
+	if inv.TypeCode == "" {
+		inv.TypeCode = TypeCommercialInvoice
+	}
+
+	problems := requiredInput(inv, profile)
+	if err := Calculate(inv); err != nil {
+		var inputErr *InputError
+		if !errors.As(err, &inputErr) {
+			return nil, err
+		}
+		problems = append(problems, inputErr.Problems...)
+	}
+	if len(problems) > 0 {
+		return nil, &InputError{Problems: problems}
+	}
+	return Marshal(inv, syntax)
+}
+
+// requiredInput lists the mandatory header fields missing for the profile.
+// Lines and amounts are checked by Calculate.
+func requiredInput(inv *Invoice, profile string) []string {
+	var problems []string
+	require := func(present bool, field, message string) {
+		if !present {
+			problems = append(problems, field+": "+message+" missing")
+		}
+	}
+	require(inv.Number != "", "BT-1", "invoice number")
+	require(inv.IssueDate.IsSet(), "BT-2", "issue date")
+	require(inv.CurrencyCode != "", "BT-5", "currency code")
+	require(inv.Seller.Name != "", "BT-27", "seller name")
+	require(inv.Seller.Address.CountryCode != "", "BT-40", "seller country code")
+	require(inv.Buyer.Name != "", "BT-44", "buyer name")
+	require(inv.Buyer.Address.CountryCode != "", "BT-55", "buyer country code")
+
+	if profile == ProfileXRechnung {
+		require(inv.BuyerReference != "", "BT-10", "buyer reference (BR-DE-15)")
+		require(inv.Seller.Address.City != "", "BT-37", "seller city (BR-DE-3)")
+		require(inv.Seller.Address.PostCode != "", "BT-38", "seller post code (BR-DE-4)")
+		require(inv.Seller.Contact.Name != "", "BT-41", "seller contact point (BR-DE-5)")
+		require(inv.Seller.Contact.Phone != "", "BT-42", "seller contact telephone number (BR-DE-6)")
+		require(inv.Seller.Contact.Email != "", "BT-43", "seller contact email address (BR-DE-7)")
+		require(inv.Buyer.Address.City != "", "BT-52", "buyer city (BR-DE-8)")
+		require(inv.Buyer.Address.PostCode != "", "BT-53", "buyer post code (BR-DE-9)")
+		require(inv.Seller.ElectronicAddress.IsSet(), "BT-34", "seller electronic address")
+		require(inv.Buyer.ElectronicAddress.IsSet(), "BT-49", "buyer electronic address")
+		require(inv.PaymentInstructions.MeansCode != "", "BT-81", "payment means type code (BR-DE-1)")
+	}
+	return problems
+}
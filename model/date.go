@@ -0,0 +1,237 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Date format codes of UN/CEFACT UNTDID 2379 used by CII.
+const (
+	DateFormatDay   = "102" // CCYYMMDD
+	DateFormatMonth = "610" // CCYYMM
+	DateFormatWeek  = "616" // CCYYWW, ISO 8601 week
+)
+
+// Date is a calendar date without time zone, optionally with the reduced
+// precision of a month or a week. The zero value is an absent date.
+type Date struct {
+	t      time.Time // First day of the month or week for reduced precision
+	format string    // One of the DateFormat codes, "" meaning a day
+}
+
+// NewDate returns the given calendar date.
+func NewDate(year int, month time.Month, day int) Date {
+	return Date{t: time.Date(year, month, day, 0, 0, 0, 0, time.UTC)}
+}
+
+// ParseDate parses a date in the given UNTDID 2379 format (102, 610 or 616)
+// as used by CII. An empty format accepts ISO 8601 dates as used by UBL
+// ("2024-01-31", optionally with time zone) and the reduced forms
+// "2024-01" and "2024-W05"; eight digits are read as format 102.
+func ParseDate(value, format string) (Date, error) {
+	value = strings.TrimSpace(value)
+	switch format {
+	case DateFormatDay:
+		return parseDateLayout(value, "20060102", "CCYYMMDD")
+	case DateFormatMonth:
+		if !isDigits(value, 6) {
+			return Date{}, fmt.Errorf("invalid date %q: format 610 expects CCYYMM", value)
+		}
+		return monthDate(value[:4], value[4:])
+	case DateFormatWeek:
+		if !isDigits(value, 6) {
+			return Date{}, fmt.Errorf("invalid date %q: format 616 expects CCYYWW", value)
+		}
+		return weekDate(value, value[:4], value[4:])
+	case "":
+	default:
+		return Date{}, fmt.Errorf("unsupported date format %q", format)
+	}
+
+	switch {
+	case isDigits(value, 8):
+		return parseDateLayout(value, "20060102", "CCYYMMDD")
+	case len(value) == 7 && value[4] == '-' && isDigits(value[:4], 4) && isDigits(value[5:], 2):
+		return monthDate(value[:4], value[5:])
+	case len(value) == 8 && value[4:6] == "-W" && isDigits(value[:4], 4) && isDigits(value[6:], 2):
+		return weekDate(value, value[:4], value[6:])
+	}
+	if len(value) > 10 {
+		// xs:date allows a time zone suffix such as "Z" or "+01:00"
+		zone := value[10:]
+		if _, err := time.Parse("Z07:00", zone); err != nil {
+			return Date{}, fmt.Errorf("invalid date %q: expected CCYY-MM-DD", value)
+		}
+		value = value[:10]
+	}
+	return parseDateLayout(value, "2006-01-02", "CCYY-MM-DD")
+}
+
+func parseDateLayout(value, layout, pattern string) (Date, error) {
+	t, err := time.Parse(layout, value)
+	if pe, ok := err.(*time.ParseError); ok && pe.Message != "" {
+		return Date{}, fmt.Errorf("invalid date %q: %s", value, strings.TrimPrefix(pe.Message, ": "))
+	}
+	if err != nil {
+		return Date{}, fmt.Errorf("invalid date %q: expected %s", value, pattern)
+	}
+	return Date{t: t}, nil
+}
+
+func monthDate(year, month string) (Date, error) {
+	m, _ := strconv.Atoi(month)
+	if m < 1 || m > 12 {
+		return Date{}, fmt.Errorf("invalid date %q: month %s out of range", year+month, month)
+	}
+	y, _ := strconv.Atoi(year)
+	return Date{t: time.Date(y, time.Month(m), 1, 0, 0, 0, 0, time.UTC), format: DateFormatMonth}, nil
+}
+
+// weekDate returns the Monday of an ISO 8601 week.
+func weekDate(value, year, week string) (Date, error) {
+	y, _ := strconv.Atoi(year)
+	w, _ := strconv.Atoi(week)
+
+	// January 4th always lies in week 1
+	jan4 := time.Date(y, time.January, 4, 0, 0, 0, 0, time.UTC)
+	monday := jan4.AddDate(0, 0, -((int(jan4.Weekday())+6)%7)+(w-1)*7)
+	if isoYear, isoWeek := monday.ISOWeek(); w < 1 || isoYear != y || isoWeek != w {
+		return Date{}, fmt.Errorf("invalid date %q: year %d has no week %s", value, y, week)
+	}
+	return Date{t: monday, format: DateFormatWeek}, nil
+}
+
+func isDigits(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// IsSet reports whether the date is present.
+func (d Date) IsSet() bool {
+	return !d.t.IsZero()
+}
+
+// Time returns the date, or the first day of its month or week, as
+// midnight UTC.
+func (d Date) Time() time.Time {
+	return d.t
+}
+
+// FormatCode returns the UNTDID 2379 code matching the precision of the
+// date: 102, 610 or 616.
+func (d Date) FormatCode() string {
+	if d.format == "" {
+		return DateFormatDay
+	}
+	return d.format
+}
+
+// String returns the ISO 8601 representation at the precision of the date
+// ("2024-01-31", "2024-01" or "2024-W05"), or "" for an absent date.
+func (d Date) String() string {
+	if !d.IsSet() {
+		return ""
+	}
+	switch d.format {
+	case DateFormatMonth:
+		return d.t.Format("2006-01")
+	case DateFormatWeek:
+		year, week := d.t.ISOWeek()
+		return fmt.Sprintf("%04d-W%02d", year, week)
+	}
+	return d.t.Format("2006-01-02")
+}
+
+// XSDate returns the date as xs:date (CCYY-MM-DD) for UBL and XR, using the
+// first day of a month or week.
+func (d Date) XSDate() string {
+	if !d.IsSet() {
+		return ""
+	}
+	return d.t.Format("2006-01-02")
+}
+
+// CII returns the value of a CII DateTimeString in the given format. An
+// empty format keeps the precision of the date.
+func (d Date) CII(format string) (string, error) {
+	if !d.IsSet() {
+		return "", nil
+	}
+	if format == "" {
+		format = d.FormatCode()
+	}
+	switch format {
+	case DateFormatDay:
+		return d.t.Format("20060102"), nil
+	case DateFormatMonth:
+		return d.t.Format("200601"), nil
+	case DateFormatWeek:
+		year, week := d.t.ISOWeek()
+		return fmt.Sprintf("%04d%02d", year, week), nil
+	}
+	return "", fmt.Errorf("unsupported date format %q", format)
+}
+
+// dateLayouts are the locale specific layouts for days and months.
+var dateLayouts = map[string][2]string{
+	"de-DE": {"02.01.2006", "01.2006"},
+	"de-AT": {"02.01.2006", "01.2006"},
+	"de-CH": {"02.01.2006", "01.2006"},
+	"en-US": {"01/02/2006", "01/2006"},
+	"en-GB": {"02/01/2006", "01/2006"},
+	"fr-FR": {"02/01/2006", "01/2006"},
+}
+
+// Format writes the date as usual in the locale, for example "31.01.2024"
+// for de-DE and "01/31/2024" for en-US. Weeks are written as ISO 8601 week
+// ("KW 5/2024" in German, "W5 2024" otherwise).
+func (d Date) Format(locale string) string {
+	if !d.IsSet() {
+		return ""
+	}
+	tag := resolveLocale(locale)
+	layouts := dateLayouts[tag]
+	switch d.format {
+	case DateFormatMonth:
+		return d.t.Format(layouts[1])
+	case DateFormatWeek:
+		year, week := d.t.ISOWeek()
+		if strings.HasPrefix(tag, "de-") {
+			return fmt.Sprintf("KW %d/%d", week, year)
+		}
+		return fmt.Sprintf("W%d %d", week, year)
+	}
+	return d.t.Format(layouts[0])
+}
+
+// MarshalJSON encodes the date as ISO 8601 string, absent dates as null.
+func (d Date) MarshalJSON() ([]byte, error) {
+	if !d.IsSet() {
+		return []byte("null"), nil
+	}
+	return []byte(`"` + d.String() + `"`), nil
+}
+
+// UnmarshalJSON accepts ISO 8601 dates and null.
+func (d *Date) UnmarshalJSON(data []byte) error {
+	value := strings.Trim(string(data), `"`)
+	if value == "null" || value == "" {
+		*d = Date{}
+		return nil
+	}
+	parsed, err := ParseDate(value, "")
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
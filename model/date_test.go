@@ -0,0 +1,139 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		value, format string
+		want          string // String()
+		code          string // FormatCode()
+		xsDate        string
+	}{
+		{"20240131", DateFormatDay, "2024-01-31", "102", "2024-01-31"},
+		{" 20240229 ", "102", "2024-02-29", "102", "2024-02-29"},
+		{"202401", DateFormatMonth, "2024-01", "610", "2024-01-01"},
+		{"202405", DateFormatWeek, "2024-W05", "616", "2024-01-29"},
+		{"202601", DateFormatWeek, "2026-W01", "616", "2025-12-29"},
+		{"202053", DateFormatWeek, "2020-W53", "616", "2020-12-28"},
+		{"2024-01-31", "", "2024-01-31", "102", "2024-01-31"},
+		{"2024-01-31Z", "", "2024-01-31", "102", "2024-01-31"},
+		{"2024-01-31+01:00", "", "2024-01-31", "102", "2024-01-31"},
+		{"20240131", "", "2024-01-31", "102", "2024-01-31"},
+		{"2024-01", "", "2024-01", "610", "2024-01-01"},
+		{"2024-W05", "", "2024-W05", "616", "2024-01-29"},
+	}
+	for _, test := range tests {
+		d, err := ParseDate(test.value, test.format)
+		if err != nil {
+			t.Errorf("ParseDate(%q, %q): %v", test.value, test.format, err)
+			continue
+		}
+		if d.String() != test.want || d.FormatCode() != test.code || d.XSDate() != test.xsDate {
+			t.Errorf("ParseDate(%q, %q) = %s/%s/%s, want %s/%s/%s", test.value, test.format, d, d.FormatCode(), d.XSDate(), test.want, test.code, test.xsDate)
+		}
+	}
+}
+
+func TestParseDateErrors(t *testing.T) {
+	tests := []struct{ value, format string }{
+		{"20230229", DateFormatDay}, // No leap year
+		{"20241301", DateFormatDay},
+		{"2024-01-31", DateFormatDay},
+		{"202413", DateFormatMonth},
+		{"2024011", DateFormatMonth},
+		{"202153", DateFormatWeek}, // 2021 has 52 weeks
+		{"202400", DateFormatWeek},
+		{"20240131", "203"},
+		{"31.01.2024", ""},
+		{"2024-01-31T10:00:00", ""},
+		{"2024-W60", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if d, err := ParseDate(test.value, test.format); err == nil {
+			t.Errorf("ParseDate(%q, %q) = %s, want error", test.value, test.format, d)
+		}
+	}
+}
+
+func TestDateCII(t *testing.T) {
+	day := NewDate(2024, time.December, 30)
+	month, _ := ParseDate("202402", DateFormatMonth)
+	week, _ := ParseDate("202501", DateFormatWeek)
+	tests := []struct {
+		date   Date
+		format string
+		want   string
+	}{
+		{day, "", "20241230"},
+		{day, DateFormatMonth, "202412"},
+		{day, DateFormatWeek, "202501"}, // Monday of ISO week 1 of 2025
+		{month, "", "202402"},
+		{month, DateFormatDay, "20240201"},
+		{week, "", "202501"},
+		{week, DateFormatDay, "20241230"},
+		{Date{}, "", ""},
+	}
+	for _, test := range tests {
+		got, err := test.date.CII(test.format)
+		if err != nil || got != test.want {
+			t.Errorf("%s.CII(%q) = %q, %v, want %q", test.date, test.format, got, err, test.want)
+		}
+	}
+	if _, err := day.CII("203"); err == nil {
+		t.Error("CII(203): no error")
+	}
+}
+
+func TestDateFormat(t *testing.T) {
+	day := NewDate(2024, time.January, 31)
+	month, _ := ParseDate("2024-01", "")
+	week, _ := ParseDate("2024-W05", "")
+	tests := []struct {
+		date         Date
+		locale, want string
+	}{
+		{day, "de-DE", "31.01.2024"},
+		{day, "en-US", "01/31/2024"},
+		{day, "en-GB", "31/01/2024"},
+		{day, "de", "31.01.2024"},
+		{day, "xx", "31.01.2024"},
+		{month, "de-DE", "01.2024"},
+		{month, "en-US", "01/2024"},
+		{week, "de-CH", "KW 5/2024"},
+		{week, "en-GB", "W5 2024"},
+		{Date{}, "de-DE", ""},
+	}
+	for _, test := range tests {
+		if got := test.date.Format(test.locale); got != test.want {
+			t.Errorf("%s.Format(%s) = %q, want %q", test.date, test.locale, got, test.want)
+		}
+	}
+}
+
+func TestDateJSON(t *testing.T) {
+	type wrapper struct {
+		Day   Date `json:"day"`
+		Week  Date `json:"week"`
+		Empty Date `json:"empty"`
+	}
+	week, _ := ParseDate("2024-W05", "")
+	data, err := json.Marshal(wrapper{Day: NewDate(2024, time.January, 31), Week: week})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"day":"2024-01-31","week":"2024-W05","empty":null}`; string(data) != want {
+		t.Errorf("Marshal = %s, want %s", data, want)
+	}
+	var decoded wrapper
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Day != NewDate(2024, time.January, 31) || decoded.Week != week || decoded.Empty.IsSet() {
+		t.Errorf("Unmarshal = %+v", decoded)
+	}
+}
@@ -0,0 +1,200 @@
+package model
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Decimal is an exact decimal number. The zero value is an absent value;
+// arithmetic treats it as 0.
+type Decimal struct {
+	coef  *big.Int // Never modified once set
+	scale int      // Number of decimal places
+}
+
+// NewDecimal returns unscaled * 10^-scale.
+func NewDecimal(unscaled int64, scale int) Decimal {
+	return Decimal{coef: big.NewInt(unscaled), scale: scale}
+}
+
+// ParseDecimal parses a plain decimal number such as "-1234.50". Grouping
+// separators, exponents and decimal commas are rejected; the error names the
+// offending character and its position (counting from 1).
+func ParseDecimal(s string) (Decimal, error) {
+	value := strings.TrimSpace(s)
+	if value == "" {
+		return Decimal{}, fmt.Errorf("invalid decimal %q: empty value", s)
+	}
+
+	offset := strings.Index(s, value) + 1 // Positions refer to s
+	var digits strings.Builder
+	negative := false
+	point := -1 // Index of the decimal point in digits
+	for i, r := range value {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case (r == '-' || r == '+') && i == 0:
+			negative = r == '-'
+		case r == '.' && point < 0:
+			point = digits.Len()
+		case r == '.':
+			return Decimal{}, fmt.Errorf("invalid decimal %q: second decimal point at position %d", s, offset+i)
+		default:
+			return Decimal{}, fmt.Errorf("invalid decimal %q: unexpected character %q at position %d", s, r, offset+i)
+		}
+	}
+	if digits.Len() == 0 {
+		return Decimal{}, fmt.Errorf("invalid decimal %q: no digits", s)
+	}
+
+	coef, _ := new(big.Int).SetString(digits.String(), 10)
+	if negative {
+		coef.Neg(coef)
+	}
+	scale := 0
+	if point >= 0 {
+		scale = digits.Len() - point
+	}
+	return Decimal{coef: coef, scale: scale}, nil
+}
+
+// IsSet reports whether the value is present.
+func (d Decimal) IsSet() bool {
+	return d.coef != nil
+}
+
+func (d Decimal) int() *big.Int {
+	if d.coef == nil {
+		return new(big.Int)
+	}
+	return d.coef
+}
+
+// Scale returns the number of decimal places.
+func (d Decimal) Scale() int {
+	return d.scale
+}
+
+// rescale returns the coefficient for a larger scale.
+func (d Decimal) rescale(scale int) *big.Int {
+	factor := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale-d.scale)), nil)
+	return factor.Mul(factor, d.int())
+}
+
+// String returns the plain representation keeping all decimal places, or ""
+// for an absent value.
+func (d Decimal) String() string {
+	if d.coef == nil {
+		return ""
+	}
+	digits := new(big.Int).Abs(d.coef).String()
+	sign := ""
+	if d.coef.Sign() < 0 {
+		sign = "-"
+	}
+	if d.scale <= 0 {
+		if d.coef.Sign() != 0 {
+			digits += strings.Repeat("0", -d.scale)
+		}
+		return sign + digits
+	}
+	if len(digits) <= d.scale {
+		digits = strings.Repeat("0", d.scale-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-d.scale] + "." + digits[len(digits)-d.scale:]
+}
+
+// Add returns d + e.
+func (d Decimal) Add(e Decimal) Decimal {
+	scale := max(d.scale, e.scale)
+	return Decimal{coef: new(big.Int).Add(d.rescale(scale), e.rescale(scale)), scale: scale}
+}
+
+// Sub returns d - e.
+func (d Decimal) Sub(e Decimal) Decimal {
+	return d.Add(e.Neg())
+}
+
+// Mul returns d * e.
+func (d Decimal) Mul(e Decimal) Decimal {
+	return Decimal{coef: new(big.Int).Mul(d.int(), e.int()), scale: d.scale + e.scale}
+}
+
+// Div returns d / e rounded half away from zero to the given number of
+// decimal places. It panics if e is zero.
+func (d Decimal) Div(e Decimal, places int) Decimal {
+	num := new(big.Int).Mul(d.int(), pow10(e.scale+places))
+	den := new(big.Int).Mul(e.int(), pow10(d.scale))
+	negative := num.Sign()*den.Sign() < 0
+	num.Abs(num)
+	den.Abs(den)
+	quo, rem := num.QuoRem(num, den, new(big.Int))
+	if rem.Mul(rem, big.NewInt(2)).Cmp(den) >= 0 {
+		quo.Add(quo, big.NewInt(1))
+	}
+	if negative {
+		quo.Neg(quo)
+	}
+	return Decimal{coef: quo, scale: places}
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// Neg returns -d.
+func (d Decimal) Neg() Decimal {
+	return Decimal{coef: new(big.Int).Neg(d.int()), scale: d.scale}
+}
+
+// Sign returns -1, 0 or +1.
+func (d Decimal) Sign() int {
+	return d.int().Sign()
+}
+
+// Cmp compares d and e numerically.
+func (d Decimal) Cmp(e Decimal) int {
+	scale := max(d.scale, e.scale)
+	return d.rescale(scale).Cmp(e.rescale(scale))
+}
+
+// Round rounds half away from zero to the given number of decimal places.
+func (d Decimal) Round(places int) Decimal {
+	if d.scale <= places {
+		return Decimal{coef: d.rescale(places), scale: places}
+	}
+	factor := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(d.scale-places)), nil)
+	quo, rem := new(big.Int).QuoRem(new(big.Int).Abs(d.int()), factor, new(big.Int))
+	if rem.Mul(rem, big.NewInt(2)).Cmp(factor) >= 0 {
+		quo.Add(quo, big.NewInt(1))
+	}
+	if d.Sign() < 0 {
+		quo.Neg(quo)
+	}
+	return Decimal{coef: quo, scale: places}
+}
+
+// MarshalJSON encodes the value as JSON number, absent values as null.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	if d.coef == nil {
+		return []byte("null"), nil
+	}
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON accepts JSON numbers and numeric strings.
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	value := strings.Trim(string(data), `"`)
+	if value == "null" {
+		*d = Decimal{}
+		return nil
+	}
+	parsed, err := ParseDecimal(value)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
@@ -0,0 +1,214 @@
+package model
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DespatchAdvice is a despatch advice (delivery note) announcing the goods
+// of a shipment.
+type DespatchAdvice struct {
+	Syntax string `json:"syntax,omitempty"` // Syntax the despatch advice was read from
+
+	Number          string `json:"number"`
+	IssueDate       Date   `json:"issueDate"`
+	OrderReference  string `json:"orderReference,omitempty"`
+	Notes           []Note `json:"notes,omitempty"`
+	BusinessProcess string `json:"businessProcess,omitempty"`
+	SpecificationID string `json:"specificationId,omitempty"`
+
+	Supplier Party          `json:"supplier"` // Despatching party
+	Customer Party          `json:"customer"` // Receiving party
+	Buyer    *Party         `json:"buyer,omitempty"`
+	Seller   *Party         `json:"seller,omitempty"`
+	Shipment Shipment       `json:"shipment"`
+	Lines    []DespatchLine `json:"lines"`
+}
+
+// Shipment describes the transport of the despatched goods.
+type Shipment struct {
+	ID              string  `json:"id,omitempty"`
+	GrossWeight     Decimal `json:"grossWeight"`
+	WeightUnit      string  `json:"weightUnit,omitempty"`
+	DespatchDate    Date    `json:"despatchDate"`
+	DeliveryPeriod  Period  `json:"deliveryPeriod"` // Estimated or requested delivery
+	DeliveryAddress Address `json:"deliveryAddress"`
+	Carrier         string  `json:"carrier,omitempty"`
+}
+
+// DespatchLine is one despatched item.
+type DespatchLine struct {
+	ID                  string  `json:"id"`
+	Note                string  `json:"note,omitempty"`
+	Quantity            Decimal `json:"quantity"` // Delivered quantity
+	UnitCode            string  `json:"unitCode"`
+	OutstandingQuantity Decimal `json:"outstandingQuantity"`
+	OutstandingReason   string  `json:"outstandingReason,omitempty"`
+	OrderReference      string  `json:"orderReference,omitempty"`
+	OrderLineReference  string  `json:"orderLineReference,omitempty"`
+	Item                Item    `json:"item"`
+	LotNumber           string  `json:"lotNumber,omitempty"`
+	ExpiryDate          Date    `json:"expiryDate"`
+}
+
+// UBL 2.1 DespatchAdvice structures as read by ParseDespatchAdvice.
+
+type ublDespatchLine struct {
+	ID                  string      `xml:"ID"`
+	Note                []string    `xml:"Note"`
+	DeliveredQuantity   ublQuantity `xml:"DeliveredQuantity"`
+	OutstandingQuantity ublQuantity `xml:"OutstandingQuantity"`
+	OutstandingReason   string      `xml:"OutstandingReason"`
+	OrderLineReference  struct {
+		LineID         string `xml:"LineID"`
+		OrderReference struct {
+			ID string `xml:"ID"`
+		} `xml:"OrderReference"`
+	} `xml:"OrderLineReference"`
+	Item struct {
+		Description              string `xml:"Description"`
+		Name                     string `xml:"Name"`
+		BuyersItemIdentification struct {
+			ID string `xml:"ID"`
+		} `xml:"BuyersItemIdentification"`
+		SellersItemIdentification struct {
+			ID string `xml:"ID"`
+		} `xml:"SellersItemIdentification"`
+		StandardItemIdentification struct {
+			ID ublID `xml:"ID"`
+		} `xml:"StandardItemIdentification"`
+		OriginCountry struct {
+			IdentificationCode string `xml:"IdentificationCode"`
+		} `xml:"OriginCountry"`
+		ItemInstance struct {
+			LotIdentification struct {
+				LotNumberID string `xml:"LotNumberID"`
+				ExpiryDate  string `xml:"ExpiryDate"`
+			} `xml:"LotIdentification"`
+		} `xml:"ItemInstance"`
+	} `xml:"Item"`
+}
+
+type ublDespatchAdvice struct {
+	CustomizationID string   `xml:"CustomizationID"`
+	ProfileID       string   `xml:"ProfileID"`
+	ID              string   `xml:"ID"`
+	IssueDate       string   `xml:"IssueDate"`
+	Note            []string `xml:"Note"`
+	OrderReference  struct {
+		ID string `xml:"ID"`
+	} `xml:"OrderReference"`
+	DespatchSupplierParty struct {
+		Party ublParty `xml:"Party"`
+	} `xml:"DespatchSupplierParty"`
+	DeliveryCustomerParty struct {
+		Party ublParty `xml:"Party"`
+	} `xml:"DeliveryCustomerParty"`
+	BuyerCustomerParty *struct {
+		Party ublParty `xml:"Party"`
+	} `xml:"BuyerCustomerParty"`
+	SellerSupplierParty *struct {
+		Party ublParty `xml:"Party"`
+	} `xml:"SellerSupplierParty"`
+	Shipment struct {
+		ID                 string      `xml:"ID"`
+		GrossWeightMeasure ublQuantity `xml:"GrossWeightMeasure"`
+		Consignment        struct {
+			CarrierParty ublParty `xml:"CarrierParty"`
+		} `xml:"Consignment"`
+		Delivery struct {
+			DeliveryAddress         ublAddress `xml:"DeliveryAddress"`
+			EstimatedDeliveryPeriod ublPeriod  `xml:"EstimatedDeliveryPeriod"`
+			RequestedDeliveryPeriod ublPeriod  `xml:"RequestedDeliveryPeriod"`
+			Despatch                struct {
+				ActualDespatchDate string `xml:"ActualDespatchDate"`
+			} `xml:"Despatch"`
+		} `xml:"Delivery"`
+	} `xml:"Shipment"`
+	DespatchLine []ublDespatchLine `xml:"DespatchLine"`
+}
+
+// ParseDespatchAdvice reads a UBL 2.1 DespatchAdvice.
+func ParseDespatchAdvice(r io.Reader) (*DespatchAdvice, error) {
+	var doc ublDespatchAdvice
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("error decoding XML: %w", err)
+	}
+
+	p := &parser{}
+	advice := &DespatchAdvice{
+		Syntax:          SyntaxUBL,
+		Number:          trim(doc.ID),
+		IssueDate:       p.date("issue date", doc.IssueDate, ""),
+		OrderReference:  trim(doc.OrderReference.ID),
+		BusinessProcess: trim(doc.ProfileID),
+		SpecificationID: trim(doc.CustomizationID),
+		Supplier:        ublPartyOf(doc.DespatchSupplierParty.Party),
+		Customer:        ublPartyOf(doc.DeliveryCustomerParty.Party),
+	}
+	for _, note := range doc.Note {
+		if note = trim(note); note != "" {
+			advice.Notes = append(advice.Notes, Note{Text: note})
+		}
+	}
+	if doc.BuyerCustomerParty != nil {
+		party := ublPartyOf(doc.BuyerCustomerParty.Party)
+		advice.Buyer = &party
+	}
+	if doc.SellerSupplierParty != nil {
+		party := ublPartyOf(doc.SellerSupplierParty.Party)
+		advice.Seller = &party
+	}
+
+	shipment := doc.Shipment
+	delivery := shipment.Delivery
+	period := delivery.EstimatedDeliveryPeriod
+	if trim(period.StartDate) == "" && trim(period.EndDate) == "" {
+		period = delivery.RequestedDeliveryPeriod
+	}
+	carrier := shipment.Consignment.CarrierParty
+	advice.Shipment = Shipment{
+		ID:           trim(shipment.ID),
+		GrossWeight:  p.decimal("gross weight", shipment.GrossWeightMeasure.Value),
+		WeightUnit:   trim(shipment.GrossWeightMeasure.UnitCode),
+		DespatchDate: p.date("despatch date", delivery.Despatch.ActualDespatchDate, ""),
+		DeliveryPeriod: Period{
+			Start: p.date("delivery period start date", period.StartDate, ""),
+			End:   p.date("delivery period end date", period.EndDate, ""),
+		},
+		DeliveryAddress: ublAddressOf(delivery.DeliveryAddress),
+		Carrier:         firstNonEmpty(carrier.PartyLegalEntity.RegistrationName, carrier.PartyName.Name),
+	}
+
+	for _, l := range doc.DespatchLine {
+		item := l.Item
+		line := DespatchLine{
+			ID:                  trim(l.ID),
+			Note:                trim(strings.Join(l.Note, "\n")),
+			Quantity:            p.decimal("delivered quantity", l.DeliveredQuantity.Value),
+			UnitCode:            trim(l.DeliveredQuantity.UnitCode),
+			OutstandingQuantity: p.decimal("outstanding quantity", l.OutstandingQuantity.Value),
+			OutstandingReason:   trim(l.OutstandingReason),
+			OrderReference:      trim(l.OrderLineReference.OrderReference.ID),
+			OrderLineReference:  trim(l.OrderLineReference.LineID),
+			Item: Item{
+				Name:          trim(item.Name),
+				Description:   trim(item.Description),
+				SellerID:      trim(item.SellersItemIdentification.ID),
+				BuyerID:       trim(item.BuyersItemIdentification.ID),
+				StandardID:    Identifier{ID: trim(item.StandardItemIdentification.ID.Value), Scheme: trim(item.StandardItemIdentification.ID.SchemeID)},
+				OriginCountry: trim(item.OriginCountry.IdentificationCode),
+			},
+			LotNumber:  trim(item.ItemInstance.LotIdentification.LotNumberID),
+			ExpiryDate: p.date("expiry date", item.ItemInstance.LotIdentification.ExpiryDate, ""),
+		}
+		advice.Lines = append(advice.Lines, line)
+	}
+
+	if p.err != nil {
+		return nil, p.err
+	}
+	return advice, nil
+}
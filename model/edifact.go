@@ -0,0 +1,569 @@
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ediSyntax holds the service characters of an interchange, announced by
+// the UNA segment.
+type ediSyntax struct {
+	component, element, decimal, release, segment byte
+}
+
+var ediDefaultSyntax = ediSyntax{':', '+', '.', '?', '\''}
+
+// ediSegment is a segment split into data elements and their components.
+type ediSegment struct {
+	tag      string
+	elements [][]string
+}
+
+// value returns component c of data element e (the tag not counted), or ""
+// if absent.
+func (s ediSegment) value(e, c int) string {
+	if e < 1 || e > len(s.elements) || c >= len(s.elements[e-1]) {
+		return ""
+	}
+	return s.elements[e-1][c]
+}
+
+// text joins the non-empty components of data element e.
+func (s ediSegment) text(e int) string {
+	if e < 1 || e > len(s.elements) {
+		return ""
+	}
+	var parts []string
+	for _, c := range s.elements[e-1] {
+		if c != "" {
+			parts = append(parts, c)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// IsEDIFACT reports whether data looks like an EDIFACT interchange or
+// message.
+func IsEDIFACT(data []byte) bool {
+	data = bytes.TrimLeft(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), " \t\r\n")
+	for _, tag := range []string{"UNA", "UNB+", "UNH+"} {
+		if bytes.HasPrefix(data, []byte(tag)) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitEDIFACT splits an interchange into segments. Line breaks between
+// segments are ignored; Latin-1 interchanges (UNOA to UNOC) are decoded.
+func splitEDIFACT(data []byte) ([]ediSegment, ediSyntax, error) {
+	data = bytes.TrimLeft(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), " \t\r\n")
+	syntax := ediDefaultSyntax
+	if bytes.HasPrefix(data, []byte("UNA")) {
+		if len(data) < 9 {
+			return nil, syntax, fmt.Errorf("truncated UNA segment")
+		}
+		syntax = ediSyntax{data[3], data[4], data[5], data[6], data[8]}
+		if syntax.release == ' ' {
+			syntax.release = 0 // No release character
+		}
+		data = data[9:]
+	}
+	if !utf8.Valid(data) {
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		data = []byte(string(runes))
+	}
+
+	var segments []ediSegment
+	var component strings.Builder
+	var elements [][]string
+	var components []string
+	released := false
+	for _, r := range string(data) {
+		switch {
+		case released:
+			component.WriteRune(r)
+			released = false
+		case syntax.release != 0 && r == rune(syntax.release):
+			released = true
+		case r == rune(syntax.component):
+			components = append(components, component.String())
+			component.Reset()
+		case r == rune(syntax.element):
+			elements = append(elements, append(components, component.String()))
+			components = nil
+			component.Reset()
+		case r == rune(syntax.segment):
+			elements = append(elements, append(components, component.String()))
+			segments = append(segments, ediSegment{tag: strings.TrimSpace(elements[0][0]), elements: elements[1:]})
+			elements, components = nil, nil
+			component.Reset()
+		case (r == '\r' || r == '\n') && len(elements) == 0 && len(components) == 0 && component.Len() == 0:
+			// Line break between segments
+		default:
+			component.WriteRune(r)
+		}
+	}
+	if len(elements) > 0 {
+		return nil, syntax, fmt.Errorf("segment %s not terminated", elements[0][0])
+	}
+	if rest := trim(component.String()); rest != "" {
+		return nil, syntax, fmt.Errorf("segment %q not terminated", rest)
+	}
+	return segments, syntax, nil
+}
+
+// ediMessage returns the segments of the INVOIC message, UNH to UNT.
+func ediMessage(segments []ediSegment) ([]ediSegment, error) {
+	var message []ediSegment
+	count := 0
+	for i, segment := range segments {
+		if segment.tag != "UNH" || segment.value(2, 0) != "INVOIC" {
+			continue
+		}
+		count++
+		if version := segment.value(2, 1) + "." + segment.value(2, 2); version != "D.96A" && version != "D.01B" {
+			return nil, fmt.Errorf("unsupported INVOIC version %s, expected D.96A or D.01B", version)
+		}
+		end := i
+		for end < len(segments) && segments[end].tag != "UNT" {
+			end++
+		}
+		if end == len(segments) {
+			return nil, fmt.Errorf("INVOIC message %s has no UNT segment", segment.value(1, 0))
+		}
+		message = segments[i : end+1]
+	}
+	switch {
+	case count == 0:
+		return nil, fmt.Errorf("no INVOIC message found")
+	case count > 1:
+		return nil, fmt.Errorf("interchange holds %d INVOIC messages, only one per document is supported", count)
+	}
+	return message, nil
+}
+
+// ediParser tracks the segment group of an INVOIC message while mapping it.
+type ediParser struct {
+	parser
+	syntax  ediSyntax
+	inv     *Invoice
+	party   *Party            // SG2 NAD
+	line    *Line             // SG25 LIN
+	ac      *AllowanceCharge  // SG15 or SG38 ALC
+	tax     *VATBreakdown     // SG50 TAX
+	summary bool              // After UNS
+	refDate *PrecedingInvoice // SG1 RFF+IV, dated by DTM+171
+	reasons []VATBreakdown    // FTX+TXD exemption reasons
+}
+
+// ParseEDIFACT reads an EANCOM/EDIFACT INVOIC message of directory D.96A or
+// D.01B. The interchange must hold a single INVOIC message. Segments without
+// a counterpart in EN 16931 are ignored.
+func ParseEDIFACT(data []byte) (*Invoice, error) {
+	segments, syntax, err := splitEDIFACT(data)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding EDIFACT: %w", err)
+	}
+	message, err := ediMessage(segments)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &ediParser{syntax: syntax, inv: &Invoice{Syntax: SyntaxEDIFACT, SpecificationID: profileSpecifications[ProfileEN16931].specificationID}}
+	for _, segment := range message {
+		p.segment(segment)
+	}
+	p.assignExemptionReasons()
+
+	if p.err != nil {
+		return nil, p.err
+	}
+	return p.inv, nil
+}
+
+func (p *ediParser) segment(s ediSegment) {
+	inv := p.inv
+	switch s.tag {
+	case "BGM":
+		inv.TypeCode = DocumentTypeCode(trim(s.value(1, 0)))
+		inv.Number = trim(s.value(2, 0))
+	case "DTM":
+		p.dtm(s)
+	case "FTX":
+		p.ftx(s)
+	case "RFF":
+		p.rff(s)
+	case "NAD":
+		p.nad(s)
+	case "FII":
+		if s.value(1, 0) == "RB" || s.value(1, 0) == "BF" {
+			inv.PaymentInstructions.CreditTransfers = append(inv.PaymentInstructions.CreditTransfers, CreditTransfer{
+				AccountID:   trim(s.value(2, 0)),
+				AccountName: trim(s.value(2, 1)),
+				ProviderID:  trim(s.value(3, 0)),
+			})
+		}
+	case "CTA":
+		if p.party != nil {
+			p.party.Contact.Name = firstNonEmpty(s.value(2, 1), s.value(2, 0))
+		}
+	case "COM":
+		p.com(s)
+	case "CUX":
+		if inv.CurrencyCode == "" {
+			inv.CurrencyCode = trim(s.value(1, 1))
+		}
+	case "PAI":
+		inv.PaymentInstructions.MeansCode = trim(s.value(1, 2))
+	case "ALC":
+		p.alc(s)
+	case "PCD":
+		if p.ac != nil && (s.value(1, 0) == "1" || s.value(1, 0) == "2" || s.value(1, 0) == "3") {
+			p.ac.Percentage = p.ediDecimal("PCD", s.value(1, 1))
+		}
+	case "LIN":
+		inv.Lines = append(inv.Lines, Line{ID: trim(s.value(1, 0))})
+		p.line, p.ac, p.party = &inv.Lines[len(inv.Lines)-1], nil, nil
+		if id := trim(s.value(3, 0)); id != "" && (s.value(3, 1) == "EN" || s.value(3, 1) == "SRV") {
+			p.line.Item.StandardID = Identifier{ID: id, Scheme: "0160"}
+		}
+	case "PIA":
+		if p.line != nil {
+			for e := 2; e <= len(s.elements); e++ {
+				switch s.value(e, 1) {
+				case "SA":
+					p.line.Item.SellerID = trim(s.value(e, 0))
+				case "BP", "IN":
+					p.line.Item.BuyerID = trim(s.value(e, 0))
+				}
+			}
+		}
+	case "IMD":
+		if p.line != nil {
+			description := trim(firstNonEmpty(s.value(3, 3)+" "+s.value(3, 4), s.value(3, 0)))
+			if p.line.Item.Name == "" {
+				p.line.Item.Name = description
+			} else {
+				p.line.Item.Description = description
+			}
+		}
+	case "QTY":
+		if p.line != nil && s.value(1, 0) == "47" {
+			p.line.Quantity = p.ediDecimal("BT-129", s.value(1, 1))
+			p.line.UnitCode = trim(s.value(1, 2))
+		}
+	case "PRI":
+		p.pri(s)
+	case "MOA":
+		p.moa(s)
+	case "TAX":
+		p.taxSegment(s)
+	case "UNS":
+		p.summary, p.line, p.ac, p.party = true, nil, nil, nil
+	}
+}
+
+func (p *ediParser) dtm(s ediSegment) {
+	qualifier, value, format := s.value(1, 0), s.value(1, 1), s.value(1, 2)
+	if format == "203" && len(value) >= 8 {
+		value, format = value[:8], DateFormatDay // CCYYMMDDHHMM
+	}
+	period := &p.inv.InvoicingPeriod
+	if p.line != nil {
+		period = &p.line.Period
+	}
+	switch qualifier {
+	case "263":
+		if format == "718" {
+			start, end, _ := strings.Cut(value, "-")
+			period.Start = p.date("DTM+263", start, DateFormatDay)
+			period.End = p.date("DTM+263", end, DateFormatDay)
+			return
+		}
+		period.Start = p.date("DTM+263", value, format)
+	case "194":
+		period.Start = p.date("DTM+194", value, format)
+	case "206":
+		period.End = p.date("DTM+206", value, format)
+	case "137", "3":
+		if p.line == nil {
+			p.inv.IssueDate = p.date("BT-2", value, format)
+		}
+	case "131":
+		p.inv.TaxPointDate = p.date("BT-7", value, format)
+	case "13":
+		p.inv.DueDate = p.date("BT-9", value, format)
+	case "35":
+		p.delivery().Date = p.date("BT-72", value, format)
+	case "171":
+		if p.refDate != nil {
+			p.refDate.IssueDate = p.date("BT-26", value, format)
+		}
+	}
+}
+
+func (p *ediParser) ftx(s ediSegment) {
+	qualifier, text := s.value(1, 0), trim(s.text(4))
+	if p.line != nil {
+		p.line.Note = strings.TrimSpace(p.line.Note + " " + text)
+		return
+	}
+	switch qualifier {
+	case "AAB":
+		p.inv.PaymentTerms = text
+	case "PMD":
+		p.inv.PaymentInstructions.RemittanceInfo = text
+	case "REG":
+		p.inv.Seller.AdditionalLegalInfo = text
+	case "TXD":
+		p.reasons = append(p.reasons, VATBreakdown{ExemptionReasonCode: trim(s.value(3, 0)), ExemptionReason: text})
+	case "AAI", "":
+		p.inv.Notes = append(p.inv.Notes, Note{Text: text})
+	default:
+		p.inv.Notes = append(p.inv.Notes, Note{SubjectCode: qualifier, Text: text})
+	}
+}
+
+func (p *ediParser) rff(s ediSegment) {
+	qualifier, value := s.value(1, 0), trim(s.value(1, 1))
+	if p.party != nil {
+		switch qualifier {
+		case "VA":
+			p.party.VATID = value
+		case "FC":
+			p.party.TaxRegistrationID = value
+		case "XA", "GN":
+			p.party.LegalRegistrationID = Identifier{ID: value}
+		}
+		return
+	}
+	if p.line != nil {
+		if qualifier == "LI" || qualifier == "ON" {
+			p.line.OrderLineReference = firstNonEmpty(s.value(1, 2), value)
+		}
+		return
+	}
+	p.refDate = nil
+	switch qualifier {
+	case "ON":
+		p.inv.PurchaseOrderReference = value
+	case "VN":
+		p.inv.SalesOrderReference = value
+	case "CT":
+		p.inv.ContractReference = value
+	case "AAK", "DQ":
+		p.inv.DespatchAdviceReference = value
+	case "ALO":
+		p.inv.ReceivingAdviceReference = value
+	case "AEP":
+		p.inv.ProjectReference = value
+	case "IV", "OI":
+		p.inv.PrecedingInvoices = append(p.inv.PrecedingInvoices, PrecedingInvoice{Number: value})
+		p.refDate = &p.inv.PrecedingInvoices[len(p.inv.PrecedingInvoices)-1]
+	}
+}
+
+func (p *ediParser) nad(s ediSegment) {
+	p.party = nil
+	name := firstNonEmpty(s.text(4), s.value(3, 0))
+	address := Address{
+		Line1:       trim(s.value(5, 0)),
+		Line2:       trim(s.value(5, 1)),
+		Line3:       trim(strings.Join([]string{s.value(5, 2), s.value(5, 3)}, " ")),
+		City:        trim(s.value(6, 0)),
+		Subdivision: trim(s.value(7, 0)),
+		PostCode:    trim(s.value(8, 0)),
+		CountryCode: trim(s.value(9, 0)),
+	}
+	id := Identifier{ID: trim(s.value(2, 0))}
+	if id.IsSet() && s.value(2, 2) == "9" {
+		id.Scheme = "0088" // GLN
+	}
+
+	switch s.value(1, 0) {
+	case "SU", "SE":
+		p.party = &p.inv.Seller
+	case "BY":
+		p.party = &p.inv.Buyer
+	case "IV":
+		if p.inv.Buyer.Name != "" {
+			return // The buyer was given by NAD+BY
+		}
+		p.party = &p.inv.Buyer
+	case "PE":
+		p.inv.Payee = &Party{}
+		p.party = p.inv.Payee
+	case "DP", "ST":
+		delivery := p.delivery()
+		delivery.PartyName, delivery.LocationID, delivery.Address = name, id, address
+		return
+	default:
+		return
+	}
+	p.party.Name = name
+	p.party.Address = address
+	if id.IsSet() {
+		p.party.Identifiers = append(p.party.Identifiers, id)
+	}
+}
+
+func (p *ediParser) com(s ediSegment) {
+	if p.party == nil {
+		return
+	}
+	value := trim(s.value(1, 0))
+	switch s.value(1, 1) {
+	case "TE":
+		p.party.Contact.Phone = value
+	case "EM":
+		p.party.Contact.Email = value
+	case "EI":
+		p.party.ElectronicAddress = Identifier{ID: value}
+		if strings.Contains(value, "@") {
+			p.party.ElectronicAddress.Scheme = "EM"
+		} else if isDigits(value, 13) {
+			p.party.ElectronicAddress.Scheme = "0088"
+		}
+	}
+}
+
+func (p *ediParser) alc(s ediSegment) {
+	ac := AllowanceCharge{ReasonCode: trim(s.value(5, 0)), Reason: trim(s.value(5, 3))}
+	charge := s.value(1, 0) == "C"
+	target := &p.inv.Allowances
+	switch {
+	case p.line != nil && charge:
+		target = &p.line.Charges
+	case p.line != nil:
+		target = &p.line.Allowances
+	case charge:
+		target = &p.inv.Charges
+	}
+	*target = append(*target, ac)
+	p.ac = &(*target)[len(*target)-1]
+}
+
+func (p *ediParser) pri(s ediSegment) {
+	if p.line == nil {
+		return
+	}
+	price := &p.line.Price
+	switch s.value(1, 0) {
+	case "AAA":
+		price.Net = p.ediDecimal("BT-146", s.value(1, 1))
+	case "AAB":
+		price.Gross = p.ediDecimal("BT-148", s.value(1, 1))
+	default:
+		return
+	}
+	if base := s.value(1, 4); base != "" {
+		price.BaseQuantity = p.ediDecimal("BT-149", base)
+		price.BaseQuantityUnit = trim(s.value(1, 5))
+	}
+	if price.Net.IsSet() && price.Gross.IsSet() && price.Gross.Cmp(price.Net) > 0 {
+		price.Discount = price.Gross.Sub(price.Net)
+	}
+}
+
+func (p *ediParser) moa(s ediSegment) {
+	qualifier, value := s.value(1, 0), s.value(1, 1)
+	field := "MOA+" + qualifier
+	switch {
+	case p.ac != nil && (qualifier == "8" || qualifier == "23" || qualifier == "204"):
+		p.ac.Amount = p.ediDecimal(field, value)
+		return
+	case p.ac != nil && qualifier == "25":
+		p.ac.BaseAmount = p.ediDecimal(field, value)
+		return
+	case p.line != nil:
+		if qualifier == "203" {
+			p.line.NetAmount = p.ediDecimal("BT-131", value)
+		}
+		return
+	case !p.summary:
+		return
+	case p.tax != nil && qualifier == "125":
+		p.tax.TaxableAmount = p.ediDecimal("BT-116", value)
+		return
+	case p.tax != nil && (qualifier == "124" || qualifier == "150"):
+		p.tax.TaxAmount = p.ediDecimal("BT-117", value)
+		return
+	}
+
+	totals := &p.inv.Totals
+	switch qualifier {
+	case "79":
+		totals.LineNet = p.ediDecimal("BT-106", value)
+	case "204", "260":
+		totals.Allowances = p.ediDecimal("BT-107", value)
+	case "23", "259":
+		totals.Charges = p.ediDecimal("BT-108", value)
+	case "125":
+		totals.TaxBasis = p.ediDecimal("BT-109", value)
+	case "176", "124", "150":
+		totals.Tax = p.ediDecimal("BT-110", value)
+	case "77", "86":
+		totals.Grand = p.ediDecimal("BT-112", value)
+	case "113":
+		totals.Prepaid = p.ediDecimal("BT-113", value)
+	case "165":
+		totals.Rounding = p.ediDecimal("BT-114", value)
+	case "9":
+		totals.DuePayable = p.ediDecimal("BT-115", value)
+	}
+}
+
+func (p *ediParser) taxSegment(s ediSegment) {
+	if s.value(1, 0) != "7" || (s.value(2, 0) != "" && s.value(2, 0) != "VAT") {
+		return
+	}
+	category := VATCategory(trim(s.value(6, 0)))
+	rate := p.ediDecimal("TAX", s.value(5, 3))
+	switch {
+	case p.ac != nil:
+		p.ac.VATCategory, p.ac.VATRate = category, rate
+	case p.line != nil:
+		p.line.VATCategory, p.line.VATRate = category, rate
+	case p.summary:
+		p.inv.VATBreakdown = append(p.inv.VATBreakdown, VATBreakdown{Category: category, Rate: rate})
+		p.tax = &p.inv.VATBreakdown[len(p.inv.VATBreakdown)-1]
+	}
+}
+
+// assignExemptionReasons gives the FTX+TXD reasons, in order, to the VAT
+// breakdowns of categories other than standard rate, as MarshalEDIFACT
+// writes them.
+func (p *ediParser) assignExemptionReasons() {
+	i := 0
+	for j := range p.inv.VATBreakdown {
+		if i == len(p.reasons) {
+			return
+		}
+		if p.inv.VATBreakdown[j].Category != VATStandard {
+			p.inv.VATBreakdown[j].ExemptionReason = p.reasons[i].ExemptionReason
+			p.inv.VATBreakdown[j].ExemptionReasonCode = p.reasons[i].ExemptionReasonCode
+			i++
+		}
+	}
+}
+
+func (p *ediParser) delivery() *Delivery {
+	if p.inv.Delivery == nil {
+		p.inv.Delivery = &Delivery{}
+	}
+	return p.inv.Delivery
+}
+
+// ediDecimal parses a number with the decimal mark of the interchange.
+func (p *ediParser) ediDecimal(field, value string) Decimal {
+	if p.syntax.decimal != '.' {
+		value = strings.Replace(value, string(p.syntax.decimal), ".", 1)
+	}
+	return p.decimal(field, value)
+}
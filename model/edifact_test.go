@@ -0,0 +1,72 @@
+package model
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestConvertCIIToEDIFACT(t *testing.T) {
+	original, data := parseFixture(t, ciiFixture)
+
+	edifact, report, err := Convert(data, SyntaxEDIFACT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEDIFACT(edifact) {
+		t.Fatalf("not an interchange: %.60q", edifact)
+	}
+	var dropped []string
+	for _, field := range report.Dropped {
+		dropped = append(dropped, field.Path+"="+field.Value)
+	}
+	want := []string{
+		"BT-10=04011000-12345-03",
+		"BT-19=4711",
+		"BT-23=urn:fdc:peppol.eu:2017:poacc:billing:01:1.0",
+		"BT-24=urn:cen.eu:en16931:2017#compliant#urn:xeinkauf.de:kosit:xrechnung_3.0",
+		"BG-4/BT-29=S-4711",
+		"BT-61-1=0204",
+		"BG-24=ZB-1",
+		"BT-82=SEPA-Überweisung",
+		"BG-25[1]/BT-159=DE",
+		"BG-25[1]/BT-158=23110101",
+		"BG-25[1]/BG-32=Länge: 40 mm",
+		"BG-25[3]/BT-133=4711-07",
+	}
+	if !reflect.DeepEqual(dropped, want) {
+		t.Errorf("dropped = %q\nwant %q", dropped, want)
+	}
+
+	back, err := ParseEDIFACT(edifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Everything but the reported fields survives. Notes without a subject
+	// are written as FTX+AAI, so AAI reads back as no subject.
+	original.BuyerReference = ""
+	original.BuyerAccountingReference = ""
+	original.BusinessProcess = ""
+	original.SpecificationID = back.SpecificationID
+	original.Seller.Identifiers = original.Seller.Identifiers[1:]
+	original.Payee.LegalRegistrationID.Scheme = ""
+	original.SupportingDocuments = nil
+	original.PaymentInstructions.MeansText = ""
+	original.Lines[0].Item.OriginCountry = ""
+	original.Lines[0].Item.Classifications = nil
+	original.Lines[0].Item.Attributes = nil
+	original.Lines[2].AccountingReference = ""
+	original.Notes[0].SubjectCode = ""
+	if !sameInvoice(original, back) {
+		t.Errorf("CII to EDIFACT changed the invoice:\n%+v\nwant\n%+v", back, original)
+	}
+
+	again, err := Parse(bytes.NewReader(MarshalCII(back)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameInvoice(original, again) {
+		t.Errorf("EDIFACT to CII changed the invoice:\n%+v\nwant\n%+v", again, original)
+	}
+}
@@ -0,0 +1,456 @@
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// ediWriter collects the segments of an INVOIC message.
+type ediWriter struct {
+	b     bytes.Buffer
+	count int // Segments since UNH
+}
+
+// segment writes a segment of data elements, each a list of components.
+// Trailing empty components and elements are omitted.
+func (w *ediWriter) segment(tag string, elements ...[]string) {
+	last := -1
+	for i, components := range elements {
+		if ediJoin(components) != "" {
+			last = i
+		}
+	}
+	w.b.WriteString(tag)
+	for _, components := range elements[:last+1] {
+		w.b.WriteByte('+')
+		w.b.WriteString(ediJoin(components))
+	}
+	w.b.WriteString("'\n")
+	w.count++
+}
+
+// ediJoin escapes the components and joins them without trailing empty
+// components.
+func ediJoin(components []string) string {
+	escaped := make([]string, len(components))
+	for i, c := range components {
+		escaped[i] = ediEscape(c)
+	}
+	for len(escaped) > 0 && escaped[len(escaped)-1] == "" {
+		escaped = escaped[:len(escaped)-1]
+	}
+	return strings.Join(escaped, ":")
+}
+
+var ediEscaper = strings.NewReplacer("?", "??", ":", "?:", "+", "?+", "'", "?'", "\r\n", " ", "\n", " ", "\r", " ")
+
+// ediEscape releases the service characters of a value; line breaks, which
+// UNOC does not allow, become spaces.
+func ediEscape(value string) string {
+	return ediEscaper.Replace(value)
+}
+
+// el is shorthand for a data element with the given components.
+func el(components ...string) []string {
+	return components
+}
+
+// ediNumber writes a number, or "" if absent.
+func ediNumber(d Decimal) string {
+	if !d.IsSet() {
+		return ""
+	}
+	return d.String()
+}
+
+// dtm writes a DTM segment for a set date.
+func (w *ediWriter) dtm(qualifier string, d Date) {
+	if !d.IsSet() {
+		return
+	}
+	value, _ := d.CII("")
+	w.segment("DTM", el(qualifier, value, d.FormatCode()))
+}
+
+// period writes DTM+263 with format 718 if both dates are days, otherwise
+// DTM+194 and DTM+206.
+func (w *ediWriter) period(period Period) {
+	start, end := period.Start, period.End
+	if start.IsSet() && end.IsSet() && start.FormatCode() == DateFormatDay && end.FormatCode() == DateFormatDay {
+		s, _ := start.CII("")
+		t, _ := end.CII("")
+		w.segment("DTM", el("263", s+"-"+t, "718"))
+		return
+	}
+	w.dtm("194", start)
+	w.dtm("206", end)
+}
+
+// ftx writes free text in chunks of 512 characters, five per segment.
+func (w *ediWriter) ftx(qualifier, code, text string) {
+	runes := []rune(strings.TrimSpace(text))
+	for len(runes) > 0 {
+		var chunks []string
+		for len(chunks) < 5 && len(runes) > 0 {
+			n := min(len(runes), 512)
+			chunks = append(chunks, string(runes[:n]))
+			runes = runes[n:]
+		}
+		w.segment("FTX", el(qualifier), el(), el(code), chunks)
+	}
+}
+
+// MarshalEDIFACT writes the invoice as EANCOM INVOIC D.96A interchange in
+// the UNOC character set (ISO 8859-1); characters outside it are replaced by
+// "?". Business terms that INVOIC cannot carry are listed by the conversion
+// report, see targetLosses.
+func MarshalEDIFACT(inv *Invoice) []byte {
+	w := &ediWriter{}
+	w.segment("UNH", el("1"), el("INVOIC", "D", "96A", "UN", "EAN008"))
+
+	w.segment("BGM", el(string(inv.TypeCode)), el(inv.Number), el("9"))
+	w.dtm("137", inv.IssueDate)
+	w.dtm("131", inv.TaxPointDate)
+	if inv.Delivery != nil {
+		w.dtm("35", inv.Delivery.Date)
+	}
+	w.period(inv.InvoicingPeriod)
+	if inv.PaymentInstructions.MeansCode != "" {
+		w.segment("PAI", el("", "", inv.PaymentInstructions.MeansCode))
+	}
+	for _, note := range inv.Notes {
+		w.ftx(firstNonEmpty(note.SubjectCode, "AAI"), "", note.Text)
+	}
+	w.ftx("AAB", "", inv.PaymentTerms)
+	w.ftx("PMD", "", inv.PaymentInstructions.RemittanceInfo)
+	w.ftx("REG", "", inv.Seller.AdditionalLegalInfo)
+	// INVOIC has no exemption reason per tax group: one FTX+TXD per VAT
+	// breakdown other than standard rate, in order, empty if without reason
+	reasons := false
+	for _, vat := range inv.VATBreakdown {
+		reasons = reasons || vat.ExemptionReason != "" || vat.ExemptionReasonCode != ""
+	}
+	for _, vat := range inv.VATBreakdown {
+		if reasons && vat.Category != VATStandard {
+			w.segment("FTX", el("TXD"), el(), el(vat.ExemptionReasonCode), el(vat.ExemptionReason))
+		}
+	}
+
+	// SG1 references
+	for _, ref := range []struct{ qualifier, value string }{
+		{"ON", inv.PurchaseOrderReference},
+		{"VN", inv.SalesOrderReference},
+		{"CT", inv.ContractReference},
+		{"AAK", inv.DespatchAdviceReference},
+		{"ALO", inv.ReceivingAdviceReference},
+		{"AEP", inv.ProjectReference},
+	} {
+		if ref.value != "" {
+			w.segment("RFF", el(ref.qualifier, ref.value))
+		}
+	}
+	for _, preceding := range inv.PrecedingInvoices {
+		w.segment("RFF", el("IV", preceding.Number))
+		w.dtm("171", preceding.IssueDate)
+	}
+
+	// SG2 parties; the bank accounts follow the payee, or else the seller
+	accountParty := "SU"
+	if inv.Payee != nil {
+		accountParty = "PE"
+	}
+	w.party("SU", &inv.Seller, inv, accountParty == "SU")
+	w.party("BY", &inv.Buyer, inv, false)
+	if inv.Payee != nil {
+		w.party("PE", inv.Payee, inv, true)
+	}
+	if d := inv.Delivery; d != nil && (d.PartyName != "" || d.LocationID.IsSet() || d.Address.IsSet()) {
+		w.nad("DP", d.LocationID, d.PartyName, d.Address)
+	}
+
+	// SG7 currency, SG8 payment terms
+	w.segment("CUX", el("2", inv.CurrencyCode, "4"))
+	if inv.DueDate.IsSet() {
+		w.segment("PAT", el("1"))
+		w.dtm("13", inv.DueDate)
+	}
+
+	// SG15 document level allowances and charges
+	for _, ac := range inv.Allowances {
+		w.allowanceCharge("A", ac, true)
+	}
+	for _, ac := range inv.Charges {
+		w.allowanceCharge("C", ac, true)
+	}
+
+	// SG25 lines
+	for _, line := range inv.Lines {
+		w.line(line)
+	}
+
+	// Summary section
+	w.segment("UNS", el("S"))
+	w.segment("CNT", el("2", fmt.Sprint(len(inv.Lines))))
+	t := inv.Totals
+	for _, total := range []struct {
+		qualifier string
+		amount    Decimal
+	}{
+		{"79", t.LineNet}, {"204", t.Allowances}, {"23", t.Charges}, {"125", t.TaxBasis},
+		{"176", t.Tax}, {"77", t.Grand}, {"113", t.Prepaid}, {"165", t.Rounding}, {"9", t.DuePayable},
+	} {
+		if total.amount.IsSet() {
+			w.segment("MOA", el(total.qualifier, total.amount.String()))
+		}
+	}
+	for _, vat := range inv.VATBreakdown {
+		w.segment("TAX", el("7"), el("VAT"), el(), el(), el("", "", "", ediNumber(vat.Rate)), el(string(vat.Category)))
+		w.segment("MOA", el("125", ediNumber(vat.TaxableAmount)))
+		w.segment("MOA", el("124", ediNumber(vat.TaxAmount)))
+	}
+	w.count++
+	w.b.WriteString(fmt.Sprintf("UNT+%d+1'\n", w.count))
+	message := w.b.String()
+
+	// Interchange envelope; the sender and receiver are the GLNs of seller
+	// and buyer where known
+	var b strings.Builder
+	b.WriteString("UNA:+.? '\n")
+	date, _ := inv.IssueDate.CII(DateFormatDay)
+	if len(date) == 8 {
+		date = date[2:]
+	}
+	reference := ediReference(inv.Number)
+	fmt.Fprintf(&b, "UNB+UNOC:3+%s+%s+%s:0000+%s'\n", ediPartyID(&inv.Seller), ediPartyID(&inv.Buyer), date, reference)
+	b.WriteString(message)
+	fmt.Fprintf(&b, "UNZ+1+%s'\n", reference)
+	return ediLatin1(b.String())
+}
+
+// party writes the NAD group of a party with its references, contact and,
+// if accounts is set, the bank accounts of the payment instructions.
+func (w *ediWriter) party(qualifier string, party *Party, inv *Invoice, accounts bool) {
+	w.nad(qualifier, ediPartyIdentifier(party), party.Name, party.Address)
+	if accounts {
+		for _, account := range inv.PaymentInstructions.CreditTransfers {
+			institution := el()
+			if account.ProviderID != "" {
+				institution = el(account.ProviderID, "25", "17") // BIC, S.W.I.F.T.
+			}
+			w.segment("FII", el("RB"), el(account.AccountID, account.AccountName), institution)
+		}
+	}
+	if party.VATID != "" {
+		w.segment("RFF", el("VA", party.VATID))
+	}
+	if party.TaxRegistrationID != "" {
+		w.segment("RFF", el("FC", party.TaxRegistrationID))
+	}
+	if party.LegalRegistrationID.IsSet() {
+		w.segment("RFF", el("XA", party.LegalRegistrationID.ID))
+	}
+	if party.Contact.IsSet() || party.ElectronicAddress.IsSet() {
+		w.segment("CTA", el("IC"), el("", party.Contact.Name))
+		if party.Contact.Phone != "" {
+			w.segment("COM", el(party.Contact.Phone, "TE"))
+		}
+		if party.Contact.Email != "" {
+			w.segment("COM", el(party.Contact.Email, "EM"))
+		}
+		if party.ElectronicAddress.IsSet() {
+			w.segment("COM", el(party.ElectronicAddress.ID, "EI"))
+		}
+	}
+}
+
+// ediPartyIdentifier returns the identifier written to NAD: the GLN, or
+// else the first identifier.
+func ediPartyIdentifier(party *Party) Identifier {
+	id := Identifier{}
+	for _, candidate := range party.Identifiers {
+		if candidate.Scheme == "0088" && id.Scheme != "0088" || !id.IsSet() {
+			id = candidate
+		}
+	}
+	return id
+}
+
+func (w *ediWriter) nad(qualifier string, id Identifier, name string, address Address) {
+	agency := ""
+	if id.Scheme == "0088" {
+		agency = "9"
+	}
+	w.segment("NAD", el(qualifier), el(id.ID, "", agency), el(), el(name),
+		el(address.Line1, address.Line2, address.Line3), el(address.City), el(address.Subdivision),
+		el(address.PostCode), el(address.CountryCode))
+}
+
+// allowanceCharge writes an ALC group (SG15 or SG38) with percentage,
+// amounts and, at document level, the VAT category.
+func (w *ediWriter) allowanceCharge(indicator string, ac AllowanceCharge, document bool) {
+	w.segment("ALC", el(indicator), el(), el(), el(), el(ac.ReasonCode, "", "", ac.Reason))
+	if ac.Percentage.IsSet() {
+		w.segment("PCD", el("3", ac.Percentage.String()))
+	}
+	w.segment("MOA", el("8", ediNumber(ac.Amount)))
+	if ac.BaseAmount.IsSet() {
+		w.segment("MOA", el("25", ac.BaseAmount.String()))
+	}
+	if document && ac.VATCategory != "" {
+		w.segment("TAX", el("7"), el("VAT"), el(), el(), el("", "", "", ediNumber(ac.VATRate)), el(string(ac.VATCategory)))
+	}
+}
+
+func (w *ediWriter) line(line Line) {
+	item := line.Item
+	gtin := el()
+	if item.StandardID.Scheme == "0160" {
+		gtin = el(item.StandardID.ID, "EN")
+	}
+	w.segment("LIN", el(line.ID), el(), gtin)
+	if item.SellerID != "" || item.BuyerID != "" {
+		ids := [][]string{el("5")}
+		if item.SellerID != "" {
+			ids = append(ids, el(item.SellerID, "SA"))
+		}
+		if item.BuyerID != "" {
+			ids = append(ids, el(item.BuyerID, "BP"))
+		}
+		w.segment("PIA", ids...)
+	}
+	w.segment("IMD", el("F"), el(), el("", "", "", item.Name))
+	if item.Description != "" {
+		w.segment("IMD", el("F"), el(), el("", "", "", item.Description))
+	}
+	w.segment("QTY", el("47", ediNumber(line.Quantity), line.UnitCode))
+	w.period(line.Period)
+	w.ftx("AAI", "", line.Note)
+	w.segment("MOA", el("203", ediNumber(line.NetAmount)))
+
+	// C509: price qualifier, price, type, type qualifier, base quantity, unit
+	price := line.Price
+	w.segment("PRI", el("AAA", ediNumber(price.Net), "", "", ediNumber(price.BaseQuantity), price.BaseQuantityUnit))
+	if price.Gross.IsSet() {
+		w.segment("PRI", el("AAB", price.Gross.String(), "", "", ediNumber(price.BaseQuantity), price.BaseQuantityUnit))
+	}
+	if line.OrderLineReference != "" {
+		w.segment("RFF", el("LI", line.OrderLineReference))
+	}
+	w.segment("TAX", el("7"), el("VAT"), el(), el(), el("", "", "", ediNumber(line.VATRate)), el(string(line.VATCategory)))
+	for _, ac := range line.Allowances {
+		w.allowanceCharge("A", ac, false)
+	}
+	for _, ac := range line.Charges {
+		w.allowanceCharge("C", ac, false)
+	}
+}
+
+// ediPartyID returns the UNB identification of a party: its GLN with code
+// qualifier 14, else its VAT identifier or name with ZZZ.
+func ediPartyID(party *Party) string {
+	for _, id := range party.Identifiers {
+		if id.Scheme == "0088" {
+			return ediEscape(id.ID) + ":14"
+		}
+	}
+	id := []rune(firstNonEmpty(party.VATID, party.Name, "UNKNOWN"))
+	return ediEscape(string(id[:min(len(id), 35)])) + ":ZZZ"
+}
+
+// ediReference derives the interchange control reference (an..14) from the
+// invoice number.
+func ediReference(number string) string {
+	var b strings.Builder
+	for _, r := range number {
+		if b.Len() < 14 && (r >= '0' && r <= '9' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z') {
+			b.WriteRune(r)
+		}
+	}
+	if b.Len() == 0 {
+		return "1"
+	}
+	return b.String()
+}
+
+// ediLatin1 encodes s as ISO 8859-1.
+func ediLatin1(s string) []byte {
+	result := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xff {
+			r = '?'
+		}
+		result = append(result, byte(r))
+	}
+	return result
+}
+
+// edifactLosses lists the business terms INVOIC D.96A as written by
+// MarshalEDIFACT cannot carry.
+func edifactLosses(inv *Invoice) []DroppedField {
+	var losses []DroppedField
+	drop := func(path, value string) {
+		if value != "" {
+			losses = append(losses, DroppedField{Path: path, Value: value, Reason: "no counterpart in EANCOM INVOIC"})
+		}
+	}
+	drop("BT-6", inv.TaxCurrencyCode)
+	drop("BT-8", inv.TaxPointDateCode)
+	drop("BT-10", inv.BuyerReference)
+	drop("BT-17", inv.TenderReference)
+	drop("BT-18", inv.InvoicedObject.ID)
+	drop("BT-19", inv.BuyerAccountingReference)
+	drop("BT-23", inv.BusinessProcess)
+	drop("BT-24", inv.SpecificationID)
+	for _, party := range []struct {
+		path  string
+		party *Party
+	}{{"BG-4", &inv.Seller}, {"BG-7", &inv.Buyer}, {"BG-10", inv.Payee}} {
+		if party.party != nil && len(party.party.Identifiers) > 1 {
+			written := ediPartyIdentifier(party.party)
+			for _, id := range party.party.Identifiers {
+				if id != written {
+					drop(party.path+"/BT-29", id.ID)
+				}
+			}
+		}
+	}
+	for _, party := range []struct {
+		path  string
+		party *Party
+	}{{"BT-30-1", &inv.Seller}, {"BT-47-1", &inv.Buyer}, {"BT-61-1", inv.Payee}} {
+		if party.party != nil && party.party.LegalRegistrationID.IsSet() {
+			drop(party.path, party.party.LegalRegistrationID.Scheme)
+		}
+	}
+	drop("BT-28", inv.Seller.TradingName)
+	drop("BT-45", inv.Buyer.TradingName)
+	if inv.Totals.TaxAccounting.IsSet() {
+		drop("BT-111", inv.Totals.TaxAccounting.String())
+	}
+	for _, doc := range inv.SupportingDocuments {
+		drop("BG-24", doc.ID)
+	}
+	if card := inv.PaymentInstructions.Card; card != nil {
+		drop("BG-18", card.AccountNumber)
+	}
+	if debit := inv.PaymentInstructions.DirectDebit; debit != nil {
+		drop("BG-19", firstNonEmpty(debit.MandateID, debit.CreditorID, debit.DebitedAccount))
+	}
+	drop("BT-82", inv.PaymentInstructions.MeansText)
+	for _, line := range inv.Lines {
+		drop(fmt.Sprintf("BG-25[%s]/BT-128", line.ID), line.ObjectID.ID)
+		drop(fmt.Sprintf("BG-25[%s]/BT-133", line.ID), line.AccountingReference)
+		drop(fmt.Sprintf("BG-25[%s]/BT-159", line.ID), line.Item.OriginCountry)
+		for _, class := range line.Item.Classifications {
+			drop(fmt.Sprintf("BG-25[%s]/BT-158", line.ID), class.ID)
+		}
+		for _, attribute := range line.Item.Attributes {
+			drop(fmt.Sprintf("BG-25[%s]/BG-32", line.ID), attribute.Name+": "+attribute.Value)
+		}
+		if line.Item.StandardID.IsSet() && line.Item.StandardID.Scheme != "0160" {
+			drop(fmt.Sprintf("BG-25[%s]/BT-157", line.ID), line.Item.StandardID.ID)
+		}
+	}
+	return losses
+}
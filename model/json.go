@@ -0,0 +1,811 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// The JSON representation names every field by its EN 16931 business term
+// (BT) or group (BG), e.g. {"BT-1": "RE-1", "BG-4": {"BT-27": "..."}}.
+// Amounts, quantities and rates are JSON numbers, dates ISO 8601 strings.
+// The struct tags double as source of the JSON schema (see JSONSchema):
+// title documents the term, required and minItems mark the cardinality.
+
+type jsonInvoice struct {
+	Number                   string              `json:"BT-1" title:"Invoice number" required:"true"`
+	IssueDate                *Date               `json:"BT-2" title:"Invoice issue date" required:"true"`
+	TypeCode                 DocumentTypeCode    `json:"BT-3" title:"Invoice type code (UNTDID 1001)" required:"true"`
+	CurrencyCode             string              `json:"BT-5" title:"Invoice currency code (ISO 4217)" required:"true"`
+	TaxCurrencyCode          string              `json:"BT-6,omitempty" title:"VAT accounting currency code"`
+	TaxPointDate             *Date               `json:"BT-7,omitempty" title:"Value added tax point date"`
+	TaxPointDateCode         string              `json:"BT-8,omitempty" title:"Value added tax point date code (UNTDID 2005)"`
+	DueDate                  *Date               `json:"BT-9,omitempty" title:"Payment due date"`
+	BuyerReference           string              `json:"BT-10,omitempty" title:"Buyer reference"`
+	ProjectReference         string              `json:"BT-11,omitempty" title:"Project reference"`
+	ContractReference        string              `json:"BT-12,omitempty" title:"Contract reference"`
+	PurchaseOrderReference   string              `json:"BT-13,omitempty" title:"Purchase order reference"`
+	SalesOrderReference      string              `json:"BT-14,omitempty" title:"Sales order reference"`
+	ReceivingAdviceReference string              `json:"BT-15,omitempty" title:"Receiving advice reference"`
+	DespatchAdviceReference  string              `json:"BT-16,omitempty" title:"Despatch advice reference"`
+	TenderReference          string              `json:"BT-17,omitempty" title:"Tender or lot reference"`
+	InvoicedObject           *Identifier         `json:"BT-18,omitempty" title:"Invoiced object identifier"`
+	BuyerAccountingReference string              `json:"BT-19,omitempty" title:"Buyer accounting reference"`
+	PaymentTerms             string              `json:"BT-20,omitempty" title:"Payment terms"`
+	Notes                    []jsonNote          `json:"BG-1,omitempty" title:"Invoice note"`
+	ProcessControl           jsonProcessControl  `json:"BG-2" title:"Process control" required:"true"`
+	PrecedingInvoices        []jsonPreceding     `json:"BG-3,omitempty" title:"Preceding invoice reference"`
+	Seller                   jsonSeller          `json:"BG-4" title:"Seller" required:"true"`
+	Buyer                    jsonBuyer           `json:"BG-7" title:"Buyer" required:"true"`
+	Payee                    *jsonPayee          `json:"BG-10,omitempty" title:"Payee"`
+	TaxRepresentative        *jsonTaxRep         `json:"BG-11,omitempty" title:"Seller tax representative party"`
+	Delivery                 *jsonDelivery       `json:"BG-13,omitempty" title:"Delivery information"`
+	InvoicingPeriod          *jsonPeriod         `json:"BG-14,omitempty" title:"Invoicing period"`
+	PaymentInstructions      *jsonPayment        `json:"BG-16,omitempty" title:"Payment instructions"`
+	Allowances               []jsonAllowance     `json:"BG-20,omitempty" title:"Document level allowances"`
+	Charges                  []jsonCharge        `json:"BG-21,omitempty" title:"Document level charges"`
+	Totals                   jsonTotals          `json:"BG-22" title:"Document totals" required:"true"`
+	VATBreakdown             []jsonVATBreakdown  `json:"BG-23" title:"VAT breakdown" required:"true" minItems:"1"`
+	SupportingDocuments      []jsonSupportingDoc `json:"BG-24,omitempty" title:"Additional supporting documents"`
+	Lines                    []jsonLine          `json:"BG-25" title:"Invoice line" required:"true" minItems:"1"`
+}
+
+type jsonNote struct {
+	SubjectCode string `json:"BT-21,omitempty" title:"Invoice note subject code (UNTDID 4451)"`
+	Text        string `json:"BT-22" title:"Invoice note" required:"true"`
+}
+
+type jsonProcessControl struct {
+	BusinessProcess string `json:"BT-23,omitempty" title:"Business process type"`
+	SpecificationID string `json:"BT-24" title:"Specification identifier" required:"true"`
+}
+
+type jsonPreceding struct {
+	Number    string `json:"BT-25" title:"Preceding invoice reference" required:"true"`
+	IssueDate *Date  `json:"BT-26,omitempty" title:"Preceding invoice issue date"`
+}
+
+type jsonSeller struct {
+	Name                string          `json:"BT-27" title:"Seller name" required:"true"`
+	TradingName         string          `json:"BT-28,omitempty" title:"Seller trading name"`
+	Identifiers         []Identifier    `json:"BT-29,omitempty" title:"Seller identifier"`
+	LegalRegistrationID *Identifier     `json:"BT-30,omitempty" title:"Seller legal registration identifier"`
+	VATID               string          `json:"BT-31,omitempty" title:"Seller VAT identifier"`
+	TaxRegistrationID   string          `json:"BT-32,omitempty" title:"Seller tax registration identifier"`
+	AdditionalLegalInfo string          `json:"BT-33,omitempty" title:"Seller additional legal information"`
+	ElectronicAddress   *Identifier     `json:"BT-34,omitempty" title:"Seller electronic address"`
+	Address             jsonSellerAddr  `json:"BG-5" title:"Seller postal address" required:"true"`
+	Contact             *jsonSellerCont `json:"BG-6,omitempty" title:"Seller contact"`
+}
+
+type jsonSellerAddr struct {
+	Line1       string `json:"BT-35,omitempty" title:"Seller address line 1"`
+	Line2       string `json:"BT-36,omitempty" title:"Seller address line 2"`
+	Line3       string `json:"BT-162,omitempty" title:"Seller address line 3"`
+	City        string `json:"BT-37,omitempty" title:"Seller city"`
+	PostCode    string `json:"BT-38,omitempty" title:"Seller post code"`
+	Subdivision string `json:"BT-39,omitempty" title:"Seller country subdivision"`
+	CountryCode string `json:"BT-40" title:"Seller country code" required:"true"`
+}
+
+type jsonSellerCont struct {
+	Name  string `json:"BT-41,omitempty" title:"Seller contact point"`
+	Phone string `json:"BT-42,omitempty" title:"Seller contact telephone number"`
+	Email string `json:"BT-43,omitempty" title:"Seller contact email address"`
+}
+
+type jsonBuyer struct {
+	Name                string         `json:"BT-44" title:"Buyer name" required:"true"`
+	TradingName         string         `json:"BT-45,omitempty" title:"Buyer trading name"`
+	Identifiers         []Identifier   `json:"BT-46,omitempty" title:"Buyer identifier"`
+	LegalRegistrationID *Identifier    `json:"BT-47,omitempty" title:"Buyer legal registration identifier"`
+	VATID               string         `json:"BT-48,omitempty" title:"Buyer VAT identifier"`
+	ElectronicAddress   *Identifier    `json:"BT-49,omitempty" title:"Buyer electronic address"`
+	Address             jsonBuyerAddr  `json:"BG-8" title:"Buyer postal address" required:"true"`
+	Contact             *jsonBuyerCont `json:"BG-9,omitempty" title:"Buyer contact"`
+}
+
+type jsonBuyerAddr struct {
+	Line1       string `json:"BT-50,omitempty" title:"Buyer address line 1"`
+	Line2       string `json:"BT-51,omitempty" title:"Buyer address line 2"`
+	Line3       string `json:"BT-163,omitempty" title:"Buyer address line 3"`
+	City        string `json:"BT-52,omitempty" title:"Buyer city"`
+	PostCode    string `json:"BT-53,omitempty" title:"Buyer post code"`
+	Subdivision string `json:"BT-54,omitempty" title:"Buyer country subdivision"`
+	CountryCode string `json:"BT-55" title:"Buyer country code" required:"true"`
+}
+
+type jsonBuyerCont struct {
+	Name  string `json:"BT-56,omitempty" title:"Buyer contact point"`
+	Phone string `json:"BT-57,omitempty" title:"Buyer contact telephone number"`
+	Email string `json:"BT-58,omitempty" title:"Buyer contact email address"`
+}
+
+type jsonPayee struct {
+	Name                string       `json:"BT-59" title:"Payee name" required:"true"`
+	Identifiers         []Identifier `json:"BT-60,omitempty" title:"Payee identifier"`
+	LegalRegistrationID *Identifier  `json:"BT-61,omitempty" title:"Payee legal registration identifier"`
+}
+
+type jsonTaxRep struct {
+	Name    string        `json:"BT-62" title:"Seller tax representative name" required:"true"`
+	VATID   string        `json:"BT-63" title:"Seller tax representative VAT identifier" required:"true"`
+	Address jsonTaxRepAdr `json:"BG-12" title:"Seller tax representative postal address" required:"true"`
+}
+
+type jsonTaxRepAdr struct {
+	Line1       string `json:"BT-64,omitempty" title:"Tax representative address line 1"`
+	Line2       string `json:"BT-65,omitempty" title:"Tax representative address line 2"`
+	Line3       string `json:"BT-164,omitempty" title:"Tax representative address line 3"`
+	City        string `json:"BT-66,omitempty" title:"Tax representative city"`
+	PostCode    string `json:"BT-67,omitempty" title:"Tax representative post code"`
+	Subdivision string `json:"BT-68,omitempty" title:"Tax representative country subdivision"`
+	CountryCode string `json:"BT-69" title:"Tax representative country code" required:"true"`
+}
+
+type jsonDelivery struct {
+	PartyName  string           `json:"BT-70,omitempty" title:"Deliver to party name"`
+	LocationID *Identifier      `json:"BT-71,omitempty" title:"Deliver to location identifier"`
+	Date       *Date            `json:"BT-72,omitempty" title:"Actual delivery date"`
+	Address    *jsonDeliveryAdr `json:"BG-15,omitempty" title:"Deliver to address"`
+}
+
+type jsonDeliveryAdr struct {
+	Line1       string `json:"BT-75,omitempty" title:"Deliver to address line 1"`
+	Line2       string `json:"BT-76,omitempty" title:"Deliver to address line 2"`
+	Line3       string `json:"BT-165,omitempty" title:"Deliver to address line 3"`
+	City        string `json:"BT-77,omitempty" title:"Deliver to city"`
+	PostCode    string `json:"BT-78,omitempty" title:"Deliver to post code"`
+	Subdivision string `json:"BT-79,omitempty" title:"Deliver to country subdivision"`
+	CountryCode string `json:"BT-80" title:"Deliver to country code" required:"true"`
+}
+
+type jsonPeriod struct {
+	Start *Date `json:"BT-73,omitempty" title:"Invoicing period start date"`
+	End   *Date `json:"BT-74,omitempty" title:"Invoicing period end date"`
+}
+
+type jsonPayment struct {
+	MeansCode       string               `json:"BT-81" title:"Payment means type code (UNTDID 4461)" required:"true"`
+	MeansText       string               `json:"BT-82,omitempty" title:"Payment means text"`
+	RemittanceInfo  string               `json:"BT-83,omitempty" title:"Remittance information"`
+	CreditTransfers []jsonCreditTransfer `json:"BG-17,omitempty" title:"Credit transfer"`
+	Card            *jsonCard            `json:"BG-18,omitempty" title:"Payment card information"`
+	DirectDebit     *jsonDirectDebit     `json:"BG-19,omitempty" title:"Direct debit"`
+}
+
+type jsonCreditTransfer struct {
+	AccountID   string `json:"BT-84" title:"Payment account identifier" required:"true"`
+	AccountName string `json:"BT-85,omitempty" title:"Payment account name"`
+	ProviderID  string `json:"BT-86,omitempty" title:"Payment service provider identifier"`
+}
+
+type jsonCard struct {
+	AccountNumber string `json:"BT-87" title:"Payment card primary account number" required:"true"`
+	HolderName    string `json:"BT-88,omitempty" title:"Payment card holder name"`
+}
+
+type jsonDirectDebit struct {
+	MandateID      string `json:"BT-89,omitempty" title:"Mandate reference identifier"`
+	CreditorID     string `json:"BT-90,omitempty" title:"Bank assigned creditor identifier"`
+	DebitedAccount string `json:"BT-91,omitempty" title:"Debited account identifier"`
+}
+
+type jsonAllowance struct {
+	Amount      *Decimal    `json:"BT-92" title:"Document level allowance amount" required:"true"`
+	BaseAmount  *Decimal    `json:"BT-93,omitempty" title:"Document level allowance base amount"`
+	Percentage  *Decimal    `json:"BT-94,omitempty" title:"Document level allowance percentage"`
+	VATCategory VATCategory `json:"BT-95" title:"Document level allowance VAT category code" required:"true"`
+	VATRate     *Decimal    `json:"BT-96,omitempty" title:"Document level allowance VAT rate"`
+	Reason      string      `json:"BT-97,omitempty" title:"Document level allowance reason"`
+	ReasonCode  string      `json:"BT-98,omitempty" title:"Document level allowance reason code (UNTDID 5189)"`
+}
+
+type jsonCharge struct {
+	Amount      *Decimal    `json:"BT-99" title:"Document level charge amount" required:"true"`
+	BaseAmount  *Decimal    `json:"BT-100,omitempty" title:"Document level charge base amount"`
+	Percentage  *Decimal    `json:"BT-101,omitempty" title:"Document level charge percentage"`
+	VATCategory VATCategory `json:"BT-102" title:"Document level charge VAT category code" required:"true"`
+	VATRate     *Decimal    `json:"BT-103,omitempty" title:"Document level charge VAT rate"`
+	Reason      string      `json:"BT-104,omitempty" title:"Document level charge reason"`
+	ReasonCode  string      `json:"BT-105,omitempty" title:"Document level charge reason code (UNTDID 7161)"`
+}
+
+type jsonTotals struct {
+	LineNet       *Decimal `json:"BT-106" title:"Sum of invoice line net amount" required:"true"`
+	Allowances    *Decimal `json:"BT-107,omitempty" title:"Sum of allowances on document level"`
+	Charges       *Decimal `json:"BT-108,omitempty" title:"Sum of charges on document level"`
+	TaxBasis      *Decimal `json:"BT-109" title:"Invoice total amount without VAT" required:"true"`
+	Tax           *Decimal `json:"BT-110,omitempty" title:"Invoice total VAT amount"`
+	TaxAccounting *Decimal `json:"BT-111,omitempty" title:"Invoice total VAT amount in accounting currency"`
+	Grand         *Decimal `json:"BT-112" title:"Invoice total amount with VAT" required:"true"`
+	Prepaid       *Decimal `json:"BT-113,omitempty" title:"Paid amount"`
+	Rounding      *Decimal `json:"BT-114,omitempty" title:"Rounding amount"`
+	DuePayable    *Decimal `json:"BT-115" title:"Amount due for payment" required:"true"`
+}
+
+type jsonVATBreakdown struct {
+	TaxableAmount       *Decimal    `json:"BT-116" title:"VAT category taxable amount" required:"true"`
+	TaxAmount           *Decimal    `json:"BT-117" title:"VAT category tax amount" required:"true"`
+	Category            VATCategory `json:"BT-118" title:"VAT category code" required:"true"`
+	Rate                *Decimal    `json:"BT-119,omitempty" title:"VAT category rate"`
+	ExemptionReason     string      `json:"BT-120,omitempty" title:"VAT exemption reason text"`
+	ExemptionReasonCode string      `json:"BT-121,omitempty" title:"VAT exemption reason code"`
+}
+
+type jsonSupportingDoc struct {
+	ID          string          `json:"BT-122" title:"Supporting document reference" required:"true"`
+	Description string          `json:"BT-123,omitempty" title:"Supporting document description"`
+	URI         string          `json:"BT-124,omitempty" title:"External document location"`
+	Attachment  *jsonAttachment `json:"BT-125,omitempty" title:"Attached document"`
+}
+
+type jsonAttachment struct {
+	MimeCode string `json:"mimeCode" title:"Attached document mime code" required:"true"`
+	Filename string `json:"filename" title:"Attached document filename" required:"true"`
+	Data     []byte `json:"content" title:"Attached document content (base64)" required:"true"`
+}
+
+type jsonLine struct {
+	ID                  string           `json:"BT-126" title:"Invoice line identifier" required:"true"`
+	Note                string           `json:"BT-127,omitempty" title:"Invoice line note"`
+	ObjectID            *Identifier      `json:"BT-128,omitempty" title:"Invoice line object identifier"`
+	Quantity            *Decimal         `json:"BT-129" title:"Invoiced quantity" required:"true"`
+	UnitCode            string           `json:"BT-130" title:"Invoiced quantity unit of measure code" required:"true"`
+	NetAmount           *Decimal         `json:"BT-131" title:"Invoice line net amount" required:"true"`
+	OrderLineReference  string           `json:"BT-132,omitempty" title:"Referenced purchase order line reference"`
+	AccountingReference string           `json:"BT-133,omitempty" title:"Invoice line buyer accounting reference"`
+	Period              *jsonLinePeriod  `json:"BG-26,omitempty" title:"Invoice line period"`
+	Allowances          []jsonLineAllow  `json:"BG-27,omitempty" title:"Invoice line allowances"`
+	Charges             []jsonLineCharge `json:"BG-28,omitempty" title:"Invoice line charges"`
+	Price               jsonPrice        `json:"BG-29" title:"Price details" required:"true"`
+	VAT                 jsonLineVAT      `json:"BG-30" title:"Line VAT information" required:"true"`
+	Item                jsonItem         `json:"BG-31" title:"Item information" required:"true"`
+}
+
+type jsonLinePeriod struct {
+	Start *Date `json:"BT-134,omitempty" title:"Invoice line period start date"`
+	End   *Date `json:"BT-135,omitempty" title:"Invoice line period end date"`
+}
+
+type jsonLineAllow struct {
+	Amount     *Decimal `json:"BT-136" title:"Invoice line allowance amount" required:"true"`
+	BaseAmount *Decimal `json:"BT-137,omitempty" title:"Invoice line allowance base amount"`
+	Percentage *Decimal `json:"BT-138,omitempty" title:"Invoice line allowance percentage"`
+	Reason     string   `json:"BT-139,omitempty" title:"Invoice line allowance reason"`
+	ReasonCode string   `json:"BT-140,omitempty" title:"Invoice line allowance reason code"`
+}
+
+type jsonLineCharge struct {
+	Amount     *Decimal `json:"BT-141" title:"Invoice line charge amount" required:"true"`
+	BaseAmount *Decimal `json:"BT-142,omitempty" title:"Invoice line charge base amount"`
+	Percentage *Decimal `json:"BT-143,omitempty" title:"Invoice line charge percentage"`
+	Reason     string   `json:"BT-144,omitempty" title:"Invoice line charge reason"`
+	ReasonCode string   `json:"BT-145,omitempty" title:"Invoice line charge reason code"`
+}
+
+type jsonPrice struct {
+	Net              *Decimal `json:"BT-146" title:"Item net price" required:"true"`
+	Discount         *Decimal `json:"BT-147,omitempty" title:"Item price discount"`
+	Gross            *Decimal `json:"BT-148,omitempty" title:"Item gross price"`
+	BaseQuantity     *Decimal `json:"BT-149,omitempty" title:"Item price base quantity"`
+	BaseQuantityUnit string   `json:"BT-150,omitempty" title:"Item price base quantity unit of measure code"`
+}
+
+type jsonLineVAT struct {
+	Category VATCategory `json:"BT-151" title:"Invoiced item VAT category code" required:"true"`
+	Rate     *Decimal    `json:"BT-152,omitempty" title:"Invoiced item VAT rate"`
+}
+
+type jsonItem struct {
+	Name            string           `json:"BT-153" title:"Item name" required:"true"`
+	Description     string           `json:"BT-154,omitempty" title:"Item description"`
+	SellerID        string           `json:"BT-155,omitempty" title:"Item Seller's identifier"`
+	BuyerID         string           `json:"BT-156,omitempty" title:"Item Buyer's identifier"`
+	StandardID      *Identifier      `json:"BT-157,omitempty" title:"Item standard identifier"`
+	Classifications []Identifier     `json:"BT-158,omitempty" title:"Item classification identifier"`
+	OriginCountry   string           `json:"BT-159,omitempty" title:"Item country of origin"`
+	Attributes      []jsonItemAttrib `json:"BG-32,omitempty" title:"Item attributes"`
+}
+
+type jsonItemAttrib struct {
+	Name  string `json:"BT-160" title:"Item attribute name" required:"true"`
+	Value string `json:"BT-161" title:"Item attribute value" required:"true"`
+}
+
+// EncodeJSON writes the invoice in the BT-coded JSON representation.
+func EncodeJSON(inv *Invoice) ([]byte, error) {
+	return json.MarshalIndent(toJSON(inv), "", "  ")
+}
+
+// DecodeJSON reads an invoice in the BT-coded JSON representation. The
+// payload is validated against JSONSchema first; all violations are
+// returned together as *SchemaError.
+func DecodeJSON(data []byte) (*Invoice, error) {
+	if err := ValidateJSON(data); err != nil {
+		return nil, err
+	}
+	var doc jsonInvoice
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("error decoding JSON: %w", err)
+	}
+	return fromJSON(&doc), nil
+}
+
+func optDecimal(d Decimal) *Decimal {
+	if !d.IsSet() {
+		return nil
+	}
+	return &d
+}
+
+func optDate(d Date) *Date {
+	if !d.IsSet() {
+		return nil
+	}
+	return &d
+}
+
+func optIdentifier(id Identifier) *Identifier {
+	if !id.IsSet() {
+		return nil
+	}
+	return &id
+}
+
+func decimalOf(d *Decimal) Decimal {
+	if d == nil {
+		return Decimal{}
+	}
+	return *d
+}
+
+func dateOf(d *Date) Date {
+	if d == nil {
+		return Date{}
+	}
+	return *d
+}
+
+func identifierOf(id *Identifier) Identifier {
+	if id == nil {
+		return Identifier{}
+	}
+	return *id
+}
+
+func toJSON(inv *Invoice) *jsonInvoice {
+	doc := &jsonInvoice{
+		Number:                   inv.Number,
+		IssueDate:                optDate(inv.IssueDate),
+		TypeCode:                 inv.TypeCode,
+		CurrencyCode:             inv.CurrencyCode,
+		TaxCurrencyCode:          inv.TaxCurrencyCode,
+		TaxPointDate:             optDate(inv.TaxPointDate),
+		TaxPointDateCode:         inv.TaxPointDateCode,
+		DueDate:                  optDate(inv.DueDate),
+		BuyerReference:           inv.BuyerReference,
+		ProjectReference:         inv.ProjectReference,
+		ContractReference:        inv.ContractReference,
+		PurchaseOrderReference:   inv.PurchaseOrderReference,
+		SalesOrderReference:      inv.SalesOrderReference,
+		ReceivingAdviceReference: inv.ReceivingAdviceReference,
+		DespatchAdviceReference:  inv.DespatchAdviceReference,
+		TenderReference:          inv.TenderReference,
+		InvoicedObject:           optIdentifier(inv.InvoicedObject),
+		BuyerAccountingReference: inv.BuyerAccountingReference,
+		PaymentTerms:             inv.PaymentTerms,
+		ProcessControl:           jsonProcessControl{BusinessProcess: inv.BusinessProcess, SpecificationID: inv.SpecificationID},
+		Seller: jsonSeller{
+			Name:                inv.Seller.Name,
+			TradingName:         inv.Seller.TradingName,
+			Identifiers:         inv.Seller.Identifiers,
+			LegalRegistrationID: optIdentifier(inv.Seller.LegalRegistrationID),
+			VATID:               inv.Seller.VATID,
+			TaxRegistrationID:   inv.Seller.TaxRegistrationID,
+			AdditionalLegalInfo: inv.Seller.AdditionalLegalInfo,
+			ElectronicAddress:   optIdentifier(inv.Seller.ElectronicAddress),
+			Address:             jsonSellerAddr(inv.Seller.Address),
+		},
+		Buyer: jsonBuyer{
+			Name:                inv.Buyer.Name,
+			TradingName:         inv.Buyer.TradingName,
+			Identifiers:         inv.Buyer.Identifiers,
+			LegalRegistrationID: optIdentifier(inv.Buyer.LegalRegistrationID),
+			VATID:               inv.Buyer.VATID,
+			ElectronicAddress:   optIdentifier(inv.Buyer.ElectronicAddress),
+			Address:             jsonBuyerAddr(inv.Buyer.Address),
+		},
+		Totals: jsonTotals{
+			LineNet:       optDecimal(inv.Totals.LineNet),
+			Allowances:    optDecimal(inv.Totals.Allowances),
+			Charges:       optDecimal(inv.Totals.Charges),
+			TaxBasis:      optDecimal(inv.Totals.TaxBasis),
+			Tax:           optDecimal(inv.Totals.Tax),
+			TaxAccounting: optDecimal(inv.Totals.TaxAccounting),
+			Grand:         optDecimal(inv.Totals.Grand),
+			Prepaid:       optDecimal(inv.Totals.Prepaid),
+			Rounding:      optDecimal(inv.Totals.Rounding),
+			DuePayable:    optDecimal(inv.Totals.DuePayable),
+		},
+		VATBreakdown: []jsonVATBreakdown{},
+		Lines:        []jsonLine{},
+	}
+	for _, note := range inv.Notes {
+		doc.Notes = append(doc.Notes, jsonNote(note))
+	}
+	for _, preceding := range inv.PrecedingInvoices {
+		doc.PrecedingInvoices = append(doc.PrecedingInvoices, jsonPreceding{Number: preceding.Number, IssueDate: optDate(preceding.IssueDate)})
+	}
+	if inv.Seller.Contact.IsSet() {
+		contact := jsonSellerCont(inv.Seller.Contact)
+		doc.Seller.Contact = &contact
+	}
+	if inv.Buyer.Contact.IsSet() {
+		contact := jsonBuyerCont(inv.Buyer.Contact)
+		doc.Buyer.Contact = &contact
+	}
+	if inv.Payee != nil {
+		doc.Payee = &jsonPayee{
+			Name:                inv.Payee.Name,
+			Identifiers:         inv.Payee.Identifiers,
+			LegalRegistrationID: optIdentifier(inv.Payee.LegalRegistrationID),
+		}
+	}
+	if inv.TaxRepresentative != nil {
+		doc.TaxRepresentative = &jsonTaxRep{
+			Name:    inv.TaxRepresentative.Name,
+			VATID:   inv.TaxRepresentative.VATID,
+			Address: jsonTaxRepAdr(inv.TaxRepresentative.Address),
+		}
+	}
+	if inv.Delivery != nil {
+		doc.Delivery = &jsonDelivery{
+			PartyName:  inv.Delivery.PartyName,
+			LocationID: optIdentifier(inv.Delivery.LocationID),
+			Date:       optDate(inv.Delivery.Date),
+		}
+		if inv.Delivery.Address.IsSet() {
+			address := jsonDeliveryAdr(inv.Delivery.Address)
+			doc.Delivery.Address = &address
+		}
+	}
+	if inv.InvoicingPeriod.IsSet() {
+		doc.InvoicingPeriod = &jsonPeriod{Start: optDate(inv.InvoicingPeriod.Start), End: optDate(inv.InvoicingPeriod.End)}
+	}
+	if payment := inv.PaymentInstructions; payment.MeansCode != "" || payment.MeansText != "" || payment.RemittanceInfo != "" ||
+		len(payment.CreditTransfers) > 0 || payment.Card != nil || payment.DirectDebit != nil {
+		doc.PaymentInstructions = &jsonPayment{
+			MeansCode:      payment.MeansCode,
+			MeansText:      payment.MeansText,
+			RemittanceInfo: payment.RemittanceInfo,
+		}
+		for _, transfer := range payment.CreditTransfers {
+			doc.PaymentInstructions.CreditTransfers = append(doc.PaymentInstructions.CreditTransfers, jsonCreditTransfer(transfer))
+		}
+		if payment.Card != nil {
+			card := jsonCard(*payment.Card)
+			doc.PaymentInstructions.Card = &card
+		}
+		if payment.DirectDebit != nil {
+			debit := jsonDirectDebit(*payment.DirectDebit)
+			doc.PaymentInstructions.DirectDebit = &debit
+		}
+	}
+	for _, ac := range inv.Allowances {
+		doc.Allowances = append(doc.Allowances, jsonAllowance{
+			Amount:      optDecimal(ac.Amount),
+			BaseAmount:  optDecimal(ac.BaseAmount),
+			Percentage:  optDecimal(ac.Percentage),
+			VATCategory: ac.VATCategory,
+			VATRate:     optDecimal(ac.VATRate),
+			Reason:      ac.Reason,
+			ReasonCode:  ac.ReasonCode,
+		})
+	}
+	for _, ac := range inv.Charges {
+		doc.Charges = append(doc.Charges, jsonCharge{
+			Amount:      optDecimal(ac.Amount),
+			BaseAmount:  optDecimal(ac.BaseAmount),
+			Percentage:  optDecimal(ac.Percentage),
+			VATCategory: ac.VATCategory,
+			VATRate:     optDecimal(ac.VATRate),
+			Reason:      ac.Reason,
+			ReasonCode:  ac.ReasonCode,
+		})
+	}
+	for _, vat := range inv.VATBreakdown {
+		doc.VATBreakdown = append(doc.VATBreakdown, jsonVATBreakdown{
+			TaxableAmount:       optDecimal(vat.TaxableAmount),
+			TaxAmount:           optDecimal(vat.TaxAmount),
+			Category:            vat.Category,
+			Rate:                optDecimal(vat.Rate),
+			ExemptionReason:     vat.ExemptionReason,
+			ExemptionReasonCode: vat.ExemptionReasonCode,
+		})
+	}
+	for _, sd := range inv.SupportingDocuments {
+		document := jsonSupportingDoc{ID: sd.ID, Description: sd.Description, URI: sd.URI}
+		if sd.Attachment != nil {
+			attachment := jsonAttachment(*sd.Attachment)
+			document.Attachment = &attachment
+		}
+		doc.SupportingDocuments = append(doc.SupportingDocuments, document)
+	}
+	for _, line := range inv.Lines {
+		doc.Lines = append(doc.Lines, lineToJSON(line))
+	}
+	return doc
+}
+
+func lineToJSON(line Line) jsonLine {
+	l := jsonLine{
+		ID:                  line.ID,
+		Note:                line.Note,
+		ObjectID:            optIdentifier(line.ObjectID),
+		Quantity:            optDecimal(line.Quantity),
+		UnitCode:            line.UnitCode,
+		NetAmount:           optDecimal(line.NetAmount),
+		OrderLineReference:  line.OrderLineReference,
+		AccountingReference: line.AccountingReference,
+		Price: jsonPrice{
+			Net:              optDecimal(line.Price.Net),
+			Discount:         optDecimal(line.Price.Discount),
+			Gross:            optDecimal(line.Price.Gross),
+			BaseQuantity:     optDecimal(line.Price.BaseQuantity),
+			BaseQuantityUnit: line.Price.BaseQuantityUnit,
+		},
+		VAT: jsonLineVAT{Category: line.VATCategory, Rate: optDecimal(line.VATRate)},
+		Item: jsonItem{
+			Name:            line.Item.Name,
+			Description:     line.Item.Description,
+			SellerID:        line.Item.SellerID,
+			BuyerID:         line.Item.BuyerID,
+			StandardID:      optIdentifier(line.Item.StandardID),
+			Classifications: line.Item.Classifications,
+			OriginCountry:   line.Item.OriginCountry,
+		},
+	}
+	if line.Period.IsSet() {
+		l.Period = &jsonLinePeriod{Start: optDate(line.Period.Start), End: optDate(line.Period.End)}
+	}
+	for _, ac := range line.Allowances {
+		l.Allowances = append(l.Allowances, jsonLineAllow{
+			Amount:     optDecimal(ac.Amount),
+			BaseAmount: optDecimal(ac.BaseAmount),
+			Percentage: optDecimal(ac.Percentage),
+			Reason:     ac.Reason,
+			ReasonCode: ac.ReasonCode,
+		})
+	}
+	for _, ac := range line.Charges {
+		l.Charges = append(l.Charges, jsonLineCharge{
+			Amount:     optDecimal(ac.Amount),
+			BaseAmount: optDecimal(ac.BaseAmount),
+			Percentage: optDecimal(ac.Percentage),
+			Reason:     ac.Reason,
+			ReasonCode: ac.ReasonCode,
+		})
+	}
+	for _, attribute := range line.Item.Attributes {
+		l.Item.Attributes = append(l.Item.Attributes, jsonItemAttrib(attribute))
+	}
+	return l
+}
+
+func fromJSON(doc *jsonInvoice) *Invoice {
+	inv := &Invoice{
+		Number:                   doc.Number,
+		IssueDate:                dateOf(doc.IssueDate),
+		TypeCode:                 doc.TypeCode,
+		CurrencyCode:             doc.CurrencyCode,
+		TaxCurrencyCode:          doc.TaxCurrencyCode,
+		TaxPointDate:             dateOf(doc.TaxPointDate),
+		TaxPointDateCode:         doc.TaxPointDateCode,
+		DueDate:                  dateOf(doc.DueDate),
+		BuyerReference:           doc.BuyerReference,
+		ProjectReference:         doc.ProjectReference,
+		ContractReference:        doc.ContractReference,
+		PurchaseOrderReference:   doc.PurchaseOrderReference,
+		SalesOrderReference:      doc.SalesOrderReference,
+		ReceivingAdviceReference: doc.ReceivingAdviceReference,
+		DespatchAdviceReference:  doc.DespatchAdviceReference,
+		TenderReference:          doc.TenderReference,
+		InvoicedObject:           identifierOf(doc.InvoicedObject),
+		BuyerAccountingReference: doc.BuyerAccountingReference,
+		PaymentTerms:             doc.PaymentTerms,
+		BusinessProcess:          doc.ProcessControl.BusinessProcess,
+		SpecificationID:          doc.ProcessControl.SpecificationID,
+		Seller: Party{
+			Name:                doc.Seller.Name,
+			TradingName:         doc.Seller.TradingName,
+			Identifiers:         doc.Seller.Identifiers,
+			LegalRegistrationID: identifierOf(doc.Seller.LegalRegistrationID),
+			VATID:               doc.Seller.VATID,
+			TaxRegistrationID:   doc.Seller.TaxRegistrationID,
+			AdditionalLegalInfo: doc.Seller.AdditionalLegalInfo,
+			ElectronicAddress:   identifierOf(doc.Seller.ElectronicAddress),
+			Address:             Address(doc.Seller.Address),
+		},
+		Buyer: Party{
+			Name:                doc.Buyer.Name,
+			TradingName:         doc.Buyer.TradingName,
+			Identifiers:         doc.Buyer.Identifiers,
+			LegalRegistrationID: identifierOf(doc.Buyer.LegalRegistrationID),
+			VATID:               doc.Buyer.VATID,
+			ElectronicAddress:   identifierOf(doc.Buyer.ElectronicAddress),
+			Address:             Address(doc.Buyer.Address),
+		},
+		Totals: Totals{
+			LineNet:       decimalOf(doc.Totals.LineNet),
+			Allowances:    decimalOf(doc.Totals.Allowances),
+			Charges:       decimalOf(doc.Totals.Charges),
+			TaxBasis:      decimalOf(doc.Totals.TaxBasis),
+			Tax:           decimalOf(doc.Totals.Tax),
+			TaxAccounting: decimalOf(doc.Totals.TaxAccounting),
+			Grand:         decimalOf(doc.Totals.Grand),
+			Prepaid:       decimalOf(doc.Totals.Prepaid),
+			Rounding:      decimalOf(doc.Totals.Rounding),
+			DuePayable:    decimalOf(doc.Totals.DuePayable),
+		},
+	}
+	for _, note := range doc.Notes {
+		inv.Notes = append(inv.Notes, Note(note))
+	}
+	for _, preceding := range doc.PrecedingInvoices {
+		inv.PrecedingInvoices = append(inv.PrecedingInvoices, PrecedingInvoice{Number: preceding.Number, IssueDate: dateOf(preceding.IssueDate)})
+	}
+	if doc.Seller.Contact != nil {
+		inv.Seller.Contact = Contact(*doc.Seller.Contact)
+	}
+	if doc.Buyer.Contact != nil {
+		inv.Buyer.Contact = Contact(*doc.Buyer.Contact)
+	}
+	if doc.Payee != nil {
+		inv.Payee = &Party{
+			Name:                doc.Payee.Name,
+			Identifiers:         doc.Payee.Identifiers,
+			LegalRegistrationID: identifierOf(doc.Payee.LegalRegistrationID),
+		}
+	}
+	if doc.TaxRepresentative != nil {
+		inv.TaxRepresentative = &Party{
+			Name:    doc.TaxRepresentative.Name,
+			VATID:   doc.TaxRepresentative.VATID,
+			Address: Address(doc.TaxRepresentative.Address),
+		}
+	}
+	if doc.Delivery != nil {
+		inv.Delivery = &Delivery{
+			PartyName:  doc.Delivery.PartyName,
+			LocationID: identifierOf(doc.Delivery.LocationID),
+			Date:       dateOf(doc.Delivery.Date),
+		}
+		if doc.Delivery.Address != nil {
+			inv.Delivery.Address = Address(*doc.Delivery.Address)
+		}
+	}
+	if doc.InvoicingPeriod != nil {
+		inv.InvoicingPeriod = Period{Start: dateOf(doc.InvoicingPeriod.Start), End: dateOf(doc.InvoicingPeriod.End)}
+	}
+	if payment := doc.PaymentInstructions; payment != nil {
+		inv.PaymentInstructions = PaymentInstructions{
+			MeansCode:      payment.MeansCode,
+			MeansText:      payment.MeansText,
+			RemittanceInfo: payment.RemittanceInfo,
+		}
+		for _, transfer := range payment.CreditTransfers {
+			inv.PaymentInstructions.CreditTransfers = append(inv.PaymentInstructions.CreditTransfers, CreditTransfer(transfer))
+		}
+		if payment.Card != nil {
+			card := PaymentCard(*payment.Card)
+			inv.PaymentInstructions.Card = &card
+		}
+		if payment.DirectDebit != nil {
+			debit := DirectDebit(*payment.DirectDebit)
+			inv.PaymentInstructions.DirectDebit = &debit
+		}
+	}
+	for _, ac := range doc.Allowances {
+		inv.Allowances = append(inv.Allowances, AllowanceCharge{
+			Amount:      decimalOf(ac.Amount),
+			BaseAmount:  decimalOf(ac.BaseAmount),
+			Percentage:  decimalOf(ac.Percentage),
+			VATCategory: ac.VATCategory,
+			VATRate:     decimalOf(ac.VATRate),
+			Reason:      ac.Reason,
+			ReasonCode:  ac.ReasonCode,
+		})
+	}
+	for _, ac := range doc.Charges {
+		inv.Charges = append(inv.Charges, AllowanceCharge{
+			Amount:      decimalOf(ac.Amount),
+			BaseAmount:  decimalOf(ac.BaseAmount),
+			Percentage:  decimalOf(ac.Percentage),
+			VATCategory: ac.VATCategory,
+			VATRate:     decimalOf(ac.VATRate),
+			Reason:      ac.Reason,
+			ReasonCode:  ac.ReasonCode,
+		})
+	}
+	for _, vat := range doc.VATBreakdown {
+		inv.VATBreakdown = append(inv.VATBreakdown, VATBreakdown{
+			TaxableAmount:       decimalOf(vat.TaxableAmount),
+			TaxAmount:           decimalOf(vat.TaxAmount),
+			Category:            vat.Category,
+			Rate:                decimalOf(vat.Rate),
+			ExemptionReason:     vat.ExemptionReason,
+			ExemptionReasonCode: vat.ExemptionReasonCode,
+		})
+	}
+	for _, sd := range doc.SupportingDocuments {
+		document := SupportingDocument{ID: sd.ID, Description: sd.Description, URI: sd.URI}
+		if sd.Attachment != nil {
+			attachment := Attachment(*sd.Attachment)
+			document.Attachment = &attachment
+		}
+		inv.SupportingDocuments = append(inv.SupportingDocuments, document)
+	}
+	for _, line := range doc.Lines {
+		inv.Lines = append(inv.Lines, lineFromJSON(line))
+	}
+	return inv
+}
+
+func lineFromJSON(l jsonLine) Line {
+	line := Line{
+		ID:                  l.ID,
+		Note:                l.Note,
+		ObjectID:            identifierOf(l.ObjectID),
+		Quantity:            decimalOf(l.Quantity),
+		UnitCode:            l.UnitCode,
+		NetAmount:           decimalOf(l.NetAmount),
+		OrderLineReference:  l.OrderLineReference,
+		AccountingReference: l.AccountingReference,
+		Price: Price{
+			Net:              decimalOf(l.Price.Net),
+			Discount:         decimalOf(l.Price.Discount),
+			Gross:            decimalOf(l.Price.Gross),
+			BaseQuantity:     decimalOf(l.Price.BaseQuantity),
+			BaseQuantityUnit: l.Price.BaseQuantityUnit,
+		},
+		VATCategory: l.VAT.Category,
+		VATRate:     decimalOf(l.VAT.Rate),
+		Item: Item{
+			Name:            l.Item.Name,
+			Description:     l.Item.Description,
+			SellerID:        l.Item.SellerID,
+			BuyerID:         l.Item.BuyerID,
+			StandardID:      identifierOf(l.Item.StandardID),
+			Classifications: l.Item.Classifications,
+			OriginCountry:   l.Item.OriginCountry,
+		},
+	}
+	if l.Period != nil {
+		line.Period = Period{Start: dateOf(l.Period.Start), End: dateOf(l.Period.End)}
+	}
+	for _, ac := range l.Allowances {
+		line.Allowances = append(line.Allowances, AllowanceCharge{
+			Amount:     decimalOf(ac.Amount),
+			BaseAmount: decimalOf(ac.BaseAmount),
+			Percentage: decimalOf(ac.Percentage),
+			Reason:     ac.Reason,
+			ReasonCode: ac.ReasonCode,
+		})
+	}
+	for _, ac := range l.Charges {
+		line.Charges = append(line.Charges, AllowanceCharge{
+			Amount:     decimalOf(ac.Amount),
+			BaseAmount: decimalOf(ac.BaseAmount),
+			Percentage: decimalOf(ac.Percentage),
+			Reason:     ac.Reason,
+			ReasonCode: ac.ReasonCode,
+		})
+	}
+	for _, attribute := range l.Item.Attributes {
+		line.Item.Attributes = append(line.Item.Attributes, ItemAttribute(attribute))
+	}
+	return line
+}
@@ -0,0 +1,215 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// jsonSchema is the subset of JSON Schema (draft 2020-12) used to describe
+// and validate the BT-coded invoice JSON.
+type jsonSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Type                 string                 `json:"type"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	MinLength            int                    `json:"minLength,omitempty"`
+	ContentEncoding      string                 `json:"contentEncoding,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *bool                  `json:"additionalProperties,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	MinItems             int                    `json:"minItems,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// datePattern accepts the ISO 8601 dates of Date: days, months and weeks.
+const datePattern = `^[0-9]{4}-([0-9]{2}(-[0-9]{2})?|W[0-9]{2})$`
+
+var (
+	invoiceSchemaOnce sync.Once
+	invoiceSchema     *jsonSchema
+)
+
+func schemaOfInvoice() *jsonSchema {
+	invoiceSchemaOnce.Do(func() {
+		invoiceSchema = schemaOf(reflect.TypeOf(jsonInvoice{}))
+		invoiceSchema.Schema = "https://json-schema.org/draft/2020-12/schema"
+		invoiceSchema.Title = "EN 16931 invoice"
+		invoiceSchema.Description = "Invoice semantic model of EN 16931-1 with the business terms (BT) and groups (BG) as property names."
+	})
+	return invoiceSchema
+}
+
+// schemaOf derives the schema of a JSON structure from its struct tags.
+func schemaOf(t reflect.Type) *jsonSchema {
+	switch t {
+	case reflect.TypeOf(Decimal{}), reflect.TypeOf(&Decimal{}):
+		return &jsonSchema{Type: "number"}
+	case reflect.TypeOf(Date{}), reflect.TypeOf(&Date{}):
+		return &jsonSchema{Type: "string", Pattern: datePattern, pattern: regexp.MustCompile(datePattern)}
+	case reflect.TypeOf([]byte{}):
+		return &jsonSchema{Type: "string", ContentEncoding: "base64"}
+	case reflect.TypeOf(Identifier{}), reflect.TypeOf(&Identifier{}):
+		closed := false
+		return &jsonSchema{
+			Type: "object",
+			Properties: map[string]*jsonSchema{
+				"id":            {Type: "string", MinLength: 1, Title: "Identifier"},
+				"scheme":        {Type: "string", Title: "Scheme identifier"},
+				"schemeVersion": {Type: "string", Title: "Scheme version identifier"},
+			},
+			Required:             []string{"id"},
+			AdditionalProperties: &closed,
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaOf(t.Elem())
+	case reflect.Slice:
+		return &jsonSchema{Type: "array", Items: schemaOf(t.Elem())}
+	case reflect.String:
+		return &jsonSchema{Type: "string"}
+	case reflect.Struct:
+		closed := false
+		schema := &jsonSchema{Type: "object", Properties: map[string]*jsonSchema{}, AdditionalProperties: &closed}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			property := schemaOf(field.Type)
+			property.Title = field.Tag.Get("title")
+			if field.Tag.Get("required") == "true" {
+				schema.Required = append(schema.Required, name)
+				if property.Type == "string" {
+					property.MinLength = 1
+				}
+			}
+			if minItems, err := strconv.Atoi(field.Tag.Get("minItems")); err == nil {
+				property.MinItems = minItems
+			}
+			schema.Properties[name] = property
+		}
+		return schema
+	}
+	panic("model: no JSON schema for " + t.String())
+}
+
+// JSONSchema returns the JSON schema of the BT-coded invoice JSON.
+func JSONSchema() []byte {
+	data, err := json.MarshalIndent(schemaOfInvoice(), "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// SchemaError lists the violations of the invoice JSON schema.
+type SchemaError struct {
+	Violations []string
+}
+
+func (e *SchemaError) Error() string {
+	msg := "invalid invoice JSON: " + e.Violations[0]
+	if len(e.Violations) > 1 {
+		msg += fmt.Sprintf(" (and %d more)", len(e.Violations)-1)
+	}
+	return msg
+}
+
+// ValidateJSON checks data against JSONSchema. Violations are reported as
+// *SchemaError with the path of each offending field, e.g.
+// "BG-25[0].BT-129: expected number".
+func ValidateJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return &SchemaError{Violations: []string{"malformed JSON: " + err.Error()}}
+	}
+	var violations []string
+	validateValue(value, schemaOfInvoice(), "", &violations)
+	if len(violations) > 0 {
+		return &SchemaError{Violations: violations}
+	}
+	return nil
+}
+
+func validateValue(value any, schema *jsonSchema, path string, violations *[]string) {
+	fail := func(format string, args ...any) {
+		at := path
+		if at == "" {
+			at = "(root)"
+		}
+		*violations = append(*violations, at+": "+fmt.Sprintf(format, args...))
+	}
+	member := func(name string) string {
+		if path == "" {
+			return name
+		}
+		return path + "." + name
+	}
+
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			fail("expected object")
+			return
+		}
+		for _, name := range schema.Required {
+			if _, ok := object[name]; !ok {
+				*violations = append(*violations, fmt.Sprintf("%s: missing (%s)", member(name), schema.Properties[name].Title))
+			}
+		}
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, ok := schema.Properties[name]
+			if !ok {
+				fail("unknown property %s", name)
+				continue
+			}
+			validateValue(object[name], property, member(name), violations)
+		}
+	case "array":
+		array, ok := value.([]any)
+		if !ok {
+			fail("expected array")
+			return
+		}
+		if len(array) < schema.MinItems {
+			fail("expected at least %d item(s)", schema.MinItems)
+		}
+		for i, item := range array {
+			validateValue(item, schema.Items, fmt.Sprintf("%s[%d]", path, i), violations)
+		}
+	case "number":
+		if _, ok := value.(json.Number); !ok {
+			fail("expected number")
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			fail("expected string")
+			return
+		}
+		if len(s) < schema.MinLength {
+			fail("must not be empty")
+		}
+		if schema.pattern != nil && !schema.pattern.MatchString(s) {
+			fail("%q does not match %s", s, schema.Pattern)
+		}
+	}
+}
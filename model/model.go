@@ -0,0 +1,312 @@
+// Package model is the syntax independent semantic model of an invoice
+// according to EN 16931. Field comments name the business terms (BT) and
+// business groups (BG) of the standard.
+package model
+
+// DocumentTypeCode is an invoice type code of UNTDID 1001 (BT-3).
+type DocumentTypeCode string
+
+// Common invoice type codes
+const (
+	TypeCommercialInvoice DocumentTypeCode = "380"
+	TypeCreditNote        DocumentTypeCode = "381"
+	TypeCorrectedInvoice  DocumentTypeCode = "384"
+	TypeSelfBilledInvoice DocumentTypeCode = "389"
+	TypePartialInvoice    DocumentTypeCode = "326"
+	TypePrepaymentInvoice DocumentTypeCode = "386"
+	TypeInvoiceInfo       DocumentTypeCode = "751"
+)
+
+// IsCreditNote reports whether the type code denotes a credit note, which
+// UBL represents with the CreditNote document.
+func (c DocumentTypeCode) IsCreditNote() bool {
+	switch c {
+	case "81", "83", "261", "262", "296", "308", "381", "396", "420", "458", "532":
+		return true
+	}
+	return false
+}
+
+// VATCategory is a VAT category code of UNTDID 5305 (BT-95, BT-102,
+// BT-118, BT-151).
+type VATCategory string
+
+// VAT categories allowed by EN 16931
+const (
+	VATStandard      VATCategory = "S"
+	VATZero          VATCategory = "Z"
+	VATExempt        VATCategory = "E"
+	VATReverseCharge VATCategory = "AE"
+	VATIntraEU       VATCategory = "K"
+	VATExport        VATCategory = "G"
+	VATNotSubject    VATCategory = "O"
+	VATCanaryIslands VATCategory = "L"
+	VATCeutaMelilla  VATCategory = "M"
+)
+
+// Syntaxes the model is read from
+const (
+	SyntaxCII     = "CII"
+	SyntaxUBL     = "UBL"
+	SyntaxXR      = "XR" // XRechnung intermediate format, see utils.ParseXR
+	SyntaxEDIFACT = "EDIFACT"
+	SyntaxPeppol  = "PEPPOL"  // UBL following Peppol BIS Billing 3.0, written only
+	SyntaxOrderX  = "ORDER-X" // Order-X orders, read only
+)
+
+// Identifier is an identifier with an optional scheme, e.g. a GLN with
+// scheme 0088 or an electronic address with scheme EM.
+type Identifier struct {
+	ID            string `json:"id"`
+	Scheme        string `json:"scheme,omitempty"`
+	SchemeVersion string `json:"schemeVersion,omitempty"`
+}
+
+// IsSet reports whether the identifier is present.
+func (i Identifier) IsSet() bool {
+	return i.ID != ""
+}
+
+// Invoice is an EN 16931 invoice or credit note.
+type Invoice struct {
+	Syntax string `json:"syntax,omitempty"` // Syntax the invoice was read from
+
+	Number                   string           `json:"number"`                             // BT-1
+	IssueDate                Date             `json:"issueDate"`                          // BT-2
+	TypeCode                 DocumentTypeCode `json:"typeCode"`                           // BT-3
+	CurrencyCode             string           `json:"currencyCode"`                       // BT-5
+	TaxCurrencyCode          string           `json:"taxCurrencyCode,omitempty"`          // BT-6
+	TaxPointDate             Date             `json:"taxPointDate"`                       // BT-7
+	TaxPointDateCode         string           `json:"taxPointDateCode,omitempty"`         // BT-8
+	DueDate                  Date             `json:"dueDate"`                            // BT-9
+	BuyerReference           string           `json:"buyerReference,omitempty"`           // BT-10
+	ProjectReference         string           `json:"projectReference,omitempty"`         // BT-11
+	ContractReference        string           `json:"contractReference,omitempty"`        // BT-12
+	PurchaseOrderReference   string           `json:"purchaseOrderReference,omitempty"`   // BT-13
+	SalesOrderReference      string           `json:"salesOrderReference,omitempty"`      // BT-14
+	ReceivingAdviceReference string           `json:"receivingAdviceReference,omitempty"` // BT-15
+	DespatchAdviceReference  string           `json:"despatchAdviceReference,omitempty"`  // BT-16
+	TenderReference          string           `json:"tenderReference,omitempty"`          // BT-17
+	InvoicedObject           Identifier       `json:"invoicedObject"`                     // BT-18
+	BuyerAccountingReference string           `json:"buyerAccountingReference,omitempty"` // BT-19
+	PaymentTerms             string           `json:"paymentTerms,omitempty"`             // BT-20
+
+	Notes               []Note               `json:"notes,omitempty"`               // BG-1
+	BusinessProcess     string               `json:"businessProcess,omitempty"`     // BT-23
+	SpecificationID     string               `json:"specificationId"`               // BT-24
+	PrecedingInvoices   []PrecedingInvoice   `json:"precedingInvoices,omitempty"`   // BG-3
+	Seller              Party                `json:"seller"`                        // BG-4
+	Buyer               Party                `json:"buyer"`                         // BG-7
+	Payee               *Party               `json:"payee,omitempty"`               // BG-10
+	TaxRepresentative   *Party               `json:"taxRepresentative,omitempty"`   // BG-11
+	Delivery            *Delivery            `json:"delivery,omitempty"`            // BG-13
+	InvoicingPeriod     Period               `json:"invoicingPeriod"`               // BG-14
+	PaymentInstructions PaymentInstructions  `json:"paymentInstructions"`           // BG-16
+	Allowances          []AllowanceCharge    `json:"allowances,omitempty"`          // BG-20
+	Charges             []AllowanceCharge    `json:"charges,omitempty"`             // BG-21
+	Totals              Totals               `json:"totals"`                        // BG-22
+	VATBreakdown        []VATBreakdown       `json:"vatBreakdown,omitempty"`        // BG-23
+	SupportingDocuments []SupportingDocument `json:"supportingDocuments,omitempty"` // BG-24
+	Lines               []Line               `json:"lines"`                         // BG-25
+}
+
+// Note is an invoice note (BG-1).
+type Note struct {
+	SubjectCode string `json:"subjectCode,omitempty"` // BT-21
+	Text        string `json:"text"`                  // BT-22
+}
+
+// PrecedingInvoice references a previous invoice (BG-3).
+type PrecedingInvoice struct {
+	Number    string `json:"number"`    // BT-25
+	IssueDate Date   `json:"issueDate"` // BT-26
+}
+
+// Party is the seller (BG-4), buyer (BG-7), payee (BG-10) or seller tax
+// representative (BG-11). Not every term applies to every role.
+type Party struct {
+	Name                string       `json:"name"`                          // BT-27, BT-44, BT-59, BT-62
+	TradingName         string       `json:"tradingName,omitempty"`         // BT-28, BT-45
+	Identifiers         []Identifier `json:"identifiers,omitempty"`         // BT-29, BT-46, BT-60
+	LegalRegistrationID Identifier   `json:"legalRegistrationId"`           // BT-30, BT-47, BT-61
+	VATID               string       `json:"vatId,omitempty"`               // BT-31, BT-48, BT-63
+	TaxRegistrationID   string       `json:"taxRegistrationId,omitempty"`   // BT-32
+	AdditionalLegalInfo string       `json:"additionalLegalInfo,omitempty"` // BT-33
+	ElectronicAddress   Identifier   `json:"electronicAddress"`             // BT-34, BT-49
+	Address             Address      `json:"address"`                       // BG-5, BG-8, BG-12
+	Contact             Contact      `json:"contact"`                       // BG-6, BG-9
+}
+
+// Address is a postal address (BG-5, BG-8, BG-12, BG-15).
+type Address struct {
+	Line1       string `json:"line1,omitempty"`
+	Line2       string `json:"line2,omitempty"`
+	Line3       string `json:"line3,omitempty"`
+	City        string `json:"city,omitempty"`
+	PostCode    string `json:"postCode,omitempty"`
+	Subdivision string `json:"subdivision,omitempty"`
+	CountryCode string `json:"countryCode,omitempty"`
+}
+
+// IsSet reports whether any part of the address is present.
+func (a Address) IsSet() bool {
+	return a != Address{}
+}
+
+// Contact is a contact point (BG-6, BG-9).
+type Contact struct {
+	Name  string `json:"name,omitempty"`  // BT-41, BT-56
+	Phone string `json:"phone,omitempty"` // BT-42, BT-57
+	Email string `json:"email,omitempty"` // BT-43, BT-58
+}
+
+// IsSet reports whether any part of the contact is present.
+func (c Contact) IsSet() bool {
+	return c != Contact{}
+}
+
+// Delivery holds the delivery information (BG-13).
+type Delivery struct {
+	PartyName  string     `json:"partyName,omitempty"` // BT-70
+	LocationID Identifier `json:"locationId"`          // BT-71
+	Date       Date       `json:"date"`                // BT-72
+	Address    Address    `json:"address"`             // BG-15
+}
+
+// Period is an invoicing period (BG-14) or invoice line period (BG-26).
+type Period struct {
+	Start Date `json:"start"` // BT-73, BT-134
+	End   Date `json:"end"`   // BT-74, BT-135
+}
+
+// IsSet reports whether a start or end date is present.
+func (p Period) IsSet() bool {
+	return p.Start.IsSet() || p.End.IsSet()
+}
+
+// PaymentInstructions holds the payment means (BG-16).
+type PaymentInstructions struct {
+	MeansCode       string           `json:"meansCode,omitempty"`       // BT-81
+	MeansText       string           `json:"meansText,omitempty"`       // BT-82
+	RemittanceInfo  string           `json:"remittanceInfo,omitempty"`  // BT-83
+	CreditTransfers []CreditTransfer `json:"creditTransfers,omitempty"` // BG-17
+	Card            *PaymentCard     `json:"card,omitempty"`            // BG-18
+	DirectDebit     *DirectDebit     `json:"directDebit,omitempty"`     // BG-19
+}
+
+// CreditTransfer is a payee account (BG-17).
+type CreditTransfer struct {
+	AccountID   string `json:"accountId"`             // BT-84, usually an IBAN
+	AccountName string `json:"accountName,omitempty"` // BT-85
+	ProviderID  string `json:"providerId,omitempty"`  // BT-86, usually a BIC
+}
+
+// PaymentCard identifies the card used for payment (BG-18).
+type PaymentCard struct {
+	AccountNumber string `json:"accountNumber"`        // BT-87
+	HolderName    string `json:"holderName,omitempty"` // BT-88
+}
+
+// DirectDebit holds the SEPA direct debit data (BG-19).
+type DirectDebit struct {
+	MandateID      string `json:"mandateId,omitempty"`      // BT-89
+	CreditorID     string `json:"creditorId,omitempty"`     // BT-90
+	DebitedAccount string `json:"debitedAccount,omitempty"` // BT-91
+}
+
+// AllowanceCharge is a document level allowance (BG-20) or charge (BG-21),
+// or an invoice line allowance (BG-27) or charge (BG-28).
+type AllowanceCharge struct {
+	Amount      Decimal     `json:"amount"`                // BT-92, BT-99, BT-136, BT-141
+	BaseAmount  Decimal     `json:"baseAmount"`            // BT-93, BT-100, BT-137, BT-142
+	Percentage  Decimal     `json:"percentage"`            // BT-94, BT-101, BT-138, BT-143
+	VATCategory VATCategory `json:"vatCategory,omitempty"` // BT-95, BT-102
+	VATRate     Decimal     `json:"vatRate"`               // BT-96, BT-103
+	Reason      string      `json:"reason,omitempty"`      // BT-97, BT-104, BT-139, BT-144
+	ReasonCode  string      `json:"reasonCode,omitempty"`  // BT-98, BT-105, BT-140, BT-145
+}
+
+// Totals are the document totals (BG-22).
+type Totals struct {
+	LineNet       Decimal `json:"lineNet"`       // BT-106
+	Allowances    Decimal `json:"allowances"`    // BT-107
+	Charges       Decimal `json:"charges"`       // BT-108
+	TaxBasis      Decimal `json:"taxBasis"`      // BT-109
+	Tax           Decimal `json:"tax"`           // BT-110
+	TaxAccounting Decimal `json:"taxAccounting"` // BT-111
+	Grand         Decimal `json:"grand"`         // BT-112
+	Prepaid       Decimal `json:"prepaid"`       // BT-113
+	Rounding      Decimal `json:"rounding"`      // BT-114
+	DuePayable    Decimal `json:"duePayable"`    // BT-115
+}
+
+// VATBreakdown is the VAT breakdown of one category and rate (BG-23).
+type VATBreakdown struct {
+	TaxableAmount       Decimal     `json:"taxableAmount"`                 // BT-116
+	TaxAmount           Decimal     `json:"taxAmount"`                     // BT-117
+	Category            VATCategory `json:"category"`                      // BT-118
+	Rate                Decimal     `json:"rate"`                          // BT-119
+	ExemptionReason     string      `json:"exemptionReason,omitempty"`     // BT-120
+	ExemptionReasonCode string      `json:"exemptionReasonCode,omitempty"` // BT-121
+}
+
+// SupportingDocument is an additional supporting document (BG-24).
+type SupportingDocument struct {
+	ID          string      `json:"id"`                    // BT-122
+	Description string      `json:"description,omitempty"` // BT-123
+	URI         string      `json:"uri,omitempty"`         // BT-124
+	Attachment  *Attachment `json:"attachment,omitempty"`  // BT-125
+}
+
+// Attachment is an embedded binary object (BT-125).
+type Attachment struct {
+	MimeCode string `json:"mimeCode"`
+	Filename string `json:"filename"`
+	Data     []byte `json:"data"`
+}
+
+// Line is an invoice line (BG-25).
+type Line struct {
+	ID                  string            `json:"id"`                            // BT-126
+	Note                string            `json:"note,omitempty"`                // BT-127
+	ObjectID            Identifier        `json:"objectId"`                      // BT-128
+	Quantity            Decimal           `json:"quantity"`                      // BT-129
+	UnitCode            string            `json:"unitCode"`                      // BT-130
+	NetAmount           Decimal           `json:"netAmount"`                     // BT-131
+	OrderLineReference  string            `json:"orderLineReference,omitempty"`  // BT-132
+	AccountingReference string            `json:"accountingReference,omitempty"` // BT-133
+	Period              Period            `json:"period"`                        // BG-26
+	Allowances          []AllowanceCharge `json:"allowances,omitempty"`          // BG-27
+	Charges             []AllowanceCharge `json:"charges,omitempty"`             // BG-28
+	Price               Price             `json:"price"`                         // BG-29
+	VATCategory         VATCategory       `json:"vatCategory"`                   // BT-151
+	VATRate             Decimal           `json:"vatRate"`                       // BT-152
+	Item                Item              `json:"item"`                          // BG-31
+}
+
+// Price holds the price details of a line (BG-29).
+type Price struct {
+	Net              Decimal `json:"net"`                        // BT-146
+	Discount         Decimal `json:"discount"`                   // BT-147
+	Gross            Decimal `json:"gross"`                      // BT-148
+	BaseQuantity     Decimal `json:"baseQuantity"`               // BT-149
+	BaseQuantityUnit string  `json:"baseQuantityUnit,omitempty"` // BT-150
+}
+
+// Item describes the invoiced item (BG-31).
+type Item struct {
+	Name            string          `json:"name"`                      // BT-153
+	Description     string          `json:"description,omitempty"`     // BT-154
+	SellerID        string          `json:"sellerId,omitempty"`        // BT-155
+	BuyerID         string          `json:"buyerId,omitempty"`         // BT-156
+	StandardID      Identifier      `json:"standardId"`                // BT-157
+	Classifications []Identifier    `json:"classifications,omitempty"` // BT-158
+	OriginCountry   string          `json:"originCountry,omitempty"`   // BT-159
+	Attributes      []ItemAttribute `json:"attributes,omitempty"`      // BG-32
+}
+
+// ItemAttribute is an item attribute (BG-32).
+type ItemAttribute struct {
+	Name  string `json:"name"`  // BT-160
+	Value string `json:"value"` // BT-161
+}
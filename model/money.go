@@ -0,0 +1,159 @@
+package model
+
+import "strings"
+
+// Precision of EN 16931: document level amounts carry two decimals, item
+// prices up to four.
+const (
+	AmountDecimals = 2
+	PriceDecimals  = 4
+)
+
+// RoundAmount rounds an amount to two decimals.
+func (d Decimal) RoundAmount() Decimal {
+	if !d.IsSet() {
+		return d
+	}
+	return d.Round(AmountDecimals)
+}
+
+// RoundPrice rounds a price to at most four decimals, keeping at least two.
+func (d Decimal) RoundPrice() Decimal {
+	switch {
+	case !d.IsSet():
+		return d
+	case d.scale > PriceDecimals:
+		return d.Round(PriceDecimals)
+	case d.scale < AmountDecimals:
+		return d.Round(AmountDecimals)
+	}
+	return d
+}
+
+// numberFormat describes how numbers and currency amounts are written in a
+// locale.
+type numberFormat struct {
+	group       string
+	decimal     string
+	symbolAfter bool // "1.234,56 €" rather than "€1,234.56"
+}
+
+var numberFormats = map[string]numberFormat{
+	"de-DE": {group: ".", decimal: ",", symbolAfter: true},
+	"de-AT": {group: ".", decimal: ",", symbolAfter: true},
+	"de-CH": {group: "’", decimal: "."},
+	"en-US": {group: ",", decimal: "."},
+	"en-GB": {group: ",", decimal: "."},
+	"fr-FR": {group: " ", decimal: ",", symbolAfter: true},
+}
+
+// DefaultLocale is used for unknown locales.
+const DefaultLocale = "de-DE"
+
+// languageLocales maps a bare language to its default locale.
+var languageLocales = map[string]string{
+	"de": "de-DE",
+	"en": "en-US",
+	"fr": "fr-FR",
+}
+
+// resolveLocale returns the supported locale for a tag such as "de-DE",
+// "de_DE" or "de", falling back to DefaultLocale.
+func resolveLocale(locale string) string {
+	locale = strings.ReplaceAll(locale, "_", "-")
+	if _, ok := numberFormats[locale]; ok {
+		return locale
+	}
+	language, _, _ := strings.Cut(locale, "-")
+	if tag, ok := languageLocales[strings.ToLower(language)]; ok {
+		return tag
+	}
+	return DefaultLocale
+}
+
+func lookupNumberFormat(locale string) numberFormat {
+	return numberFormats[resolveLocale(locale)]
+}
+
+// Format writes the number with the grouping and decimal separators of the
+// locale, keeping all decimal places. Absent values yield "".
+func (d Decimal) Format(locale string) string {
+	if !d.IsSet() {
+		return ""
+	}
+	format := lookupNumberFormat(locale)
+	sign, digits := splitSign(d.String())
+	intPart, fracPart, _ := strings.Cut(digits, ".")
+
+	var grouped strings.Builder
+	for i, r := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			grouped.WriteString(format.group)
+		}
+		grouped.WriteRune(r)
+	}
+	if fracPart != "" {
+		return sign + grouped.String() + format.decimal + fracPart
+	}
+	return sign + grouped.String()
+}
+
+func splitSign(s string) (string, string) {
+	if strings.HasPrefix(s, "-") {
+		return "-", s[1:]
+	}
+	return "", s
+}
+
+// Money is an amount in a currency (ISO 4217 code).
+type Money struct {
+	Amount   Decimal
+	Currency string
+}
+
+// NewMoney returns amount in currency.
+func NewMoney(amount Decimal, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// String returns the plain amount followed by the currency code.
+func (m Money) String() string {
+	if !m.Amount.IsSet() {
+		return ""
+	}
+	if m.Currency == "" {
+		return m.Amount.String()
+	}
+	return m.Amount.String() + " " + m.Currency
+}
+
+// currencySymbols are written instead of the ISO code.
+var currencySymbols = map[string]string{
+	"EUR": "€",
+	"USD": "$",
+	"GBP": "£",
+	"JPY": "¥",
+}
+
+// Format writes the amount with the separators and currency placement of
+// the locale, for example "1.234,56 €" for de-DE and "€1,234.56" for en-US.
+// The amount is not rounded; use RoundAmount or RoundPrice first.
+func (m Money) Format(locale string) string {
+	if !m.Amount.IsSet() {
+		return ""
+	}
+	sign, number := splitSign(m.Amount.Format(locale))
+	symbol, ok := currencySymbols[m.Currency]
+	if !ok {
+		symbol = m.Currency
+	}
+	switch {
+	case symbol == "":
+		return sign + number
+	case lookupNumberFormat(locale).symbolAfter:
+		return sign + number + " " + symbol
+	case ok:
+		return sign + symbol + number
+	}
+	return sign + symbol + " " + number
+}
@@ -0,0 +1,140 @@
+package model
+
+import "testing"
+
+func mustDecimal(t *testing.T, s string) Decimal {
+	t.Helper()
+	d, err := ParseDecimal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestParseDecimal(t *testing.T) {
+	tests := map[string]string{
+		"1234.50":  "1234.50",
+		" -0.005 ": "-0.005",
+		"+7":       "7",
+		".5":       "0.5",
+		"10.":      "10",
+		"007.10":   "7.10",
+	}
+	for s, want := range tests {
+		if got := mustDecimal(t, s).String(); got != want {
+			t.Errorf("ParseDecimal(%q) = %s, want %s", s, got, want)
+		}
+	}
+
+	for _, s := range []string{"", " ", "-", "1,5", "1.234.5", "1e3", "1 000", "--1", "12-"} {
+		if d, err := ParseDecimal(s); err == nil {
+			t.Errorf("ParseDecimal(%q) = %s, want error", s, d)
+		}
+	}
+	if _, err := ParseDecimal(" 386,75"); err == nil || err.Error() != `invalid decimal " 386,75": unexpected character ',' at position 5` {
+		t.Errorf("error = %v", err)
+	}
+}
+
+func TestDecimalArithmetic(t *testing.T) {
+	a, b := mustDecimal(t, "19.99"), mustDecimal(t, "0.005")
+	if got := a.Add(b).String(); got != "19.995" {
+		t.Errorf("Add = %s", got)
+	}
+	if got := a.Sub(b).String(); got != "19.985" {
+		t.Errorf("Sub = %s", got)
+	}
+	if got := a.Mul(mustDecimal(t, "3")).String(); got != "59.97" {
+		t.Errorf("Mul = %s", got)
+	}
+	if got := mustDecimal(t, "10").Div(mustDecimal(t, "3"), 4).String(); got != "3.3333" {
+		t.Errorf("Div = %s", got)
+	}
+	if got := mustDecimal(t, "-2").Div(mustDecimal(t, "3"), 2).String(); got != "-0.67" {
+		t.Errorf("Div = %s", got)
+	}
+	// 0.1 + 0.2 is exact, unlike with floating point numbers
+	if got := mustDecimal(t, "0.1").Add(mustDecimal(t, "0.2")); got.Cmp(mustDecimal(t, "0.30")) != 0 {
+		t.Errorf("0.1 + 0.2 = %s", got)
+	}
+	var absent Decimal
+	if absent.IsSet() || absent.String() != "" || absent.Add(a).String() != "19.99" {
+		t.Errorf("absent value not treated as 0")
+	}
+}
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		value  string
+		places int
+		want   string
+	}{
+		{"2.345", 2, "2.35"}, // Half away from zero, not to even
+		{"2.335", 2, "2.34"},
+		{"-2.345", 2, "-2.35"},
+		{"2.3449", 2, "2.34"},
+		{"0.005", 2, "0.01"},
+		{"-0.004", 2, "0.00"},
+		{"1.5", 0, "2"},
+		{"7", 2, "7.00"},
+		{"123.456789", 4, "123.4568"},
+	}
+	for _, test := range tests {
+		if got := mustDecimal(t, test.value).Round(test.places).String(); got != test.want {
+			t.Errorf("Round(%s, %d) = %s, want %s", test.value, test.places, got, test.want)
+		}
+	}
+}
+
+func TestRoundAmountAndPrice(t *testing.T) {
+	tests := []struct {
+		value, amount, price string
+	}{
+		{"1.005", "1.01", "1.005"},
+		{"9.87654", "9.88", "9.8765"},
+		{"9.87655", "9.88", "9.8766"},
+		{"3", "3.00", "3.00"},
+		{"3.1", "3.10", "3.10"},
+		{"-0.125", "-0.13", "-0.125"},
+	}
+	for _, test := range tests {
+		d := mustDecimal(t, test.value)
+		if got := d.RoundAmount().String(); got != test.amount {
+			t.Errorf("RoundAmount(%s) = %s, want %s", test.value, got, test.amount)
+		}
+		if got := d.RoundPrice().String(); got != test.price {
+			t.Errorf("RoundPrice(%s) = %s, want %s", test.value, got, test.price)
+		}
+	}
+	var absent Decimal
+	if absent.RoundAmount().IsSet() || absent.RoundPrice().IsSet() {
+		t.Error("rounding set an absent value")
+	}
+}
+
+func TestMoneyFormat(t *testing.T) {
+	tests := []struct {
+		amount, currency, locale, want string
+	}{
+		{"1234.56", "EUR", "de-DE", "1.234,56 €"},
+		{"1234.56", "EUR", "en-US", "€1,234.56"},
+		{"-1234567.5", "EUR", "de", "-1.234.567,5 €"},
+		{"1234.56", "CHF", "de-CH", "CHF 1’234.56"},
+		{"1234.56", "CHF", "de_DE", "1.234,56 CHF"},
+		{"999.99", "USD", "xx-YY", "999,99 $"},
+		{"0.1", "", "fr-FR", "0,1"},
+		{"123456.7890", "EUR", "fr", "123\u202f456,7890 €"},
+	}
+	for _, test := range tests {
+		m := NewMoney(mustDecimal(t, test.amount), test.currency)
+		if got := m.Format(test.locale); got != test.want {
+			t.Errorf("Format(%s %s, %s) = %q, want %q", test.amount, test.currency, test.locale, got, test.want)
+		}
+	}
+	if got := NewMoney(mustDecimal(t, "12.50"), "EUR").String(); got != "12.50 EUR" {
+		t.Errorf("String = %q", got)
+	}
+	if got := (Money{}).Format("de-DE"); got != "" {
+		t.Errorf("absent amount = %q", got)
+	}
+}
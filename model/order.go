@@ -0,0 +1,250 @@
+package model
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Order type codes of UNTDID 1001 used by Order-X
+const (
+	OrderTypeOrder    = "220"
+	OrderTypeChange   = "230"
+	OrderTypeResponse = "231"
+)
+
+// Order is a purchase order, order change or order response. Line
+// quantities are the ordered quantities; an order response carries the
+// quantities agreed by the seller as well.
+type Order struct {
+	Syntax string `json:"syntax,omitempty"` // Syntax the order was read from
+
+	Number              string `json:"number"`
+	IssueDate           Date   `json:"issueDate"`
+	TypeCode            string `json:"typeCode"`
+	CurrencyCode        string `json:"currencyCode,omitempty"`
+	BuyerReference      string `json:"buyerReference,omitempty"`
+	OrderReference      string `json:"orderReference,omitempty"` // Order an order change or response refers to
+	SalesOrderReference string `json:"salesOrderReference,omitempty"`
+	ContractReference   string `json:"contractReference,omitempty"`
+	QuotationReference  string `json:"quotationReference,omitempty"`
+	PaymentTerms        string `json:"paymentTerms,omitempty"`
+	DeliveryDate        Date   `json:"deliveryDate"` // Requested delivery date
+
+	Notes           []Note            `json:"notes,omitempty"`
+	BusinessProcess string            `json:"businessProcess,omitempty"`
+	SpecificationID string            `json:"specificationId,omitempty"`
+	Seller          Party             `json:"seller"`
+	Buyer           Party             `json:"buyer"`
+	ShipTo          *Party            `json:"shipTo,omitempty"`
+	Allowances      []AllowanceCharge `json:"allowances,omitempty"`
+	Charges         []AllowanceCharge `json:"charges,omitempty"`
+	Totals          Totals            `json:"totals"`
+	Lines           []OrderLine       `json:"lines"`
+}
+
+// OrderLine is an order line. Quantity is the ordered quantity.
+type OrderLine struct {
+	Line
+	AgreedQuantity Decimal `json:"agreedQuantity"`       // Quantity confirmed in an order response
+	StatusCode     string  `json:"statusCode,omitempty"` // UNTDID 1229 action code of an order change or response
+	DeliveryDate   Date    `json:"deliveryDate"`         // Requested delivery date of the line
+}
+
+// IsResponse reports whether the order is an order response.
+func (o *Order) IsResponse() bool {
+	return o.TypeCode == OrderTypeResponse
+}
+
+// ParseOrder reads an Order-X order, order change or order response, or a
+// UBL Order.
+func ParseOrder(r io.Reader) (*Order, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading document: %w", err)
+	}
+
+	root, err := rootElement(data)
+	if err != nil {
+		return nil, err
+	}
+	switch root {
+	case rootOrderX:
+		return ParseOrderX(bytes.NewReader(data))
+	case "Order":
+		return ParseUBLOrder(bytes.NewReader(data))
+	}
+	return nil, fmt.Errorf("unsupported order type: %s", root)
+}
+
+// rootOrderX is the root element of Order-X documents.
+const rootOrderX = "SCRDMCCBDACIOMessageStructure"
+
+// Order-X structures as read by ParseOrderX. Order-X is based on the same
+// CII D16B library as Factur-X, so lines and parties share the invoice
+// structures; only the elements specific to orders are added.
+
+type orderXLine struct {
+	ciiLine
+	AssociatedDocumentLineDocument struct {
+		LineID         string `xml:"LineID"`
+		LineStatusCode string `xml:"LineStatusCode"`
+		IncludedNote   []struct {
+			Content string `xml:"Content"`
+		} `xml:"IncludedNote"`
+	} `xml:"AssociatedDocumentLineDocument"`
+	SpecifiedLineTradeDelivery struct {
+		RequestedQuantity                 ciiQuantity `xml:"RequestedQuantity"`
+		AgreedQuantity                    ciiQuantity `xml:"AgreedQuantity"`
+		RequestedDeliverySupplyChainEvent struct {
+			OccurrenceDateTime ciiDateTime `xml:"OccurrenceDateTime"`
+		} `xml:"RequestedDeliverySupplyChainEvent"`
+	} `xml:"SpecifiedLineTradeDelivery"`
+}
+
+type orderXDocument struct {
+	ExchangedDocumentContext struct {
+		BusinessProcessSpecifiedDocumentContextParameter struct {
+			ID string `xml:"ID"`
+		} `xml:"BusinessProcessSpecifiedDocumentContextParameter"`
+		GuidelineSpecifiedDocumentContextParameter struct {
+			ID string `xml:"ID"`
+		} `xml:"GuidelineSpecifiedDocumentContextParameter"`
+	} `xml:"ExchangedDocumentContext"`
+	ExchangedDocument struct {
+		ID            string      `xml:"ID"`
+		TypeCode      string      `xml:"TypeCode"`
+		IssueDateTime ciiDateTime `xml:"IssueDateTime"`
+		IncludedNote  []struct {
+			Content     string `xml:"Content"`
+			SubjectCode string `xml:"SubjectCode"`
+		} `xml:"IncludedNote"`
+	} `xml:"ExchangedDocument"`
+	SupplyChainTradeTransaction struct {
+		IncludedSupplyChainTradeLineItem []orderXLine `xml:"IncludedSupplyChainTradeLineItem"`
+		ApplicableHeaderTradeAgreement   struct {
+			BuyerReference                string                `xml:"BuyerReference"`
+			SellerTradeParty              ciiParty              `xml:"SellerTradeParty"`
+			BuyerTradeParty               ciiParty              `xml:"BuyerTradeParty"`
+			SellerOrderReferencedDocument ciiReferencedDocument `xml:"SellerOrderReferencedDocument"`
+			BuyerOrderReferencedDocument  ciiReferencedDocument `xml:"BuyerOrderReferencedDocument"`
+			QuotationReferencedDocument   ciiReferencedDocument `xml:"QuotationReferencedDocument"`
+			ContractReferencedDocument    ciiReferencedDocument `xml:"ContractReferencedDocument"`
+		} `xml:"ApplicableHeaderTradeAgreement"`
+		ApplicableHeaderTradeDelivery struct {
+			ShipToTradeParty                  *ciiParty `xml:"ShipToTradeParty"`
+			RequestedDeliverySupplyChainEvent struct {
+				OccurrenceDateTime ciiDateTime `xml:"OccurrenceDateTime"`
+			} `xml:"RequestedDeliverySupplyChainEvent"`
+		} `xml:"ApplicableHeaderTradeDelivery"`
+		ApplicableHeaderTradeSettlement struct {
+			OrderCurrencyCode             string               `xml:"OrderCurrencyCode"`
+			SpecifiedTradeAllowanceCharge []ciiAllowanceCharge `xml:"SpecifiedTradeAllowanceCharge"`
+			SpecifiedTradePaymentTerms    []struct {
+				Description string `xml:"Description"`
+			} `xml:"SpecifiedTradePaymentTerms"`
+			SpecifiedTradeSettlementHeaderMonetarySummation struct {
+				LineTotalAmount      string `xml:"LineTotalAmount"`
+				ChargeTotalAmount    string `xml:"ChargeTotalAmount"`
+				AllowanceTotalAmount string `xml:"AllowanceTotalAmount"`
+				TaxBasisTotalAmount  string `xml:"TaxBasisTotalAmount"`
+				TaxTotalAmount       string `xml:"TaxTotalAmount"`
+				GrandTotalAmount     string `xml:"GrandTotalAmount"`
+			} `xml:"SpecifiedTradeSettlementHeaderMonetarySummation"`
+		} `xml:"ApplicableHeaderTradeSettlement"`
+	} `xml:"SupplyChainTradeTransaction"`
+}
+
+// ParseOrderX reads an Order-X SCRDMCCBDACIOMessageStructure.
+func ParseOrderX(r io.Reader) (*Order, error) {
+	var doc orderXDocument
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("error decoding XML: %w", err)
+	}
+
+	p := &parser{}
+	order := &Order{Syntax: SyntaxOrderX}
+
+	order.BusinessProcess = trim(doc.ExchangedDocumentContext.BusinessProcessSpecifiedDocumentContextParameter.ID)
+	order.SpecificationID = trim(doc.ExchangedDocumentContext.GuidelineSpecifiedDocumentContextParameter.ID)
+
+	document := doc.ExchangedDocument
+	order.Number = trim(document.ID)
+	order.TypeCode = trim(document.TypeCode)
+	order.IssueDate = p.ciiDate("issue date", document.IssueDateTime)
+	for _, note := range document.IncludedNote {
+		order.Notes = append(order.Notes, Note{SubjectCode: trim(note.SubjectCode), Text: trim(note.Content)})
+	}
+
+	transaction := doc.SupplyChainTradeTransaction
+
+	agreement := transaction.ApplicableHeaderTradeAgreement
+	order.BuyerReference = trim(agreement.BuyerReference)
+	order.Seller = p.ciiParty(agreement.SellerTradeParty)
+	order.Buyer = p.ciiParty(agreement.BuyerTradeParty)
+	order.OrderReference = trim(agreement.BuyerOrderReferencedDocument.IssuerAssignedID)
+	order.SalesOrderReference = trim(agreement.SellerOrderReferencedDocument.IssuerAssignedID)
+	order.QuotationReference = trim(agreement.QuotationReferencedDocument.IssuerAssignedID)
+	order.ContractReference = trim(agreement.ContractReferencedDocument.IssuerAssignedID)
+
+	delivery := transaction.ApplicableHeaderTradeDelivery
+	if delivery.ShipToTradeParty != nil {
+		party := p.ciiParty(*delivery.ShipToTradeParty)
+		order.ShipTo = &party
+	}
+	order.DeliveryDate = p.ciiDate("requested delivery date", delivery.RequestedDeliverySupplyChainEvent.OccurrenceDateTime)
+
+	settlement := transaction.ApplicableHeaderTradeSettlement
+	order.CurrencyCode = trim(settlement.OrderCurrencyCode)
+	var terms []string
+	for _, term := range settlement.SpecifiedTradePaymentTerms {
+		if description := trim(term.Description); description != "" {
+			terms = append(terms, description)
+		}
+	}
+	order.PaymentTerms = strings.Join(terms, "\n")
+	for _, ac := range settlement.SpecifiedTradeAllowanceCharge {
+		if ciiIsCharge(ac) {
+			order.Charges = append(order.Charges, p.ciiAllowanceCharge("charge", ac))
+		} else {
+			order.Allowances = append(order.Allowances, p.ciiAllowanceCharge("allowance", ac))
+		}
+	}
+	sums := settlement.SpecifiedTradeSettlementHeaderMonetarySummation
+	order.Totals = Totals{
+		LineNet:    p.decimal("line total amount", sums.LineTotalAmount),
+		Allowances: p.decimal("allowance total amount", sums.AllowanceTotalAmount),
+		Charges:    p.decimal("charge total amount", sums.ChargeTotalAmount),
+		TaxBasis:   p.decimal("tax basis total amount", sums.TaxBasisTotalAmount),
+		Tax:        p.decimal("tax total amount", sums.TaxTotalAmount),
+		Grand:      p.decimal("grand total amount", sums.GrandTotalAmount),
+	}
+
+	for _, line := range transaction.IncludedSupplyChainTradeLineItem {
+		order.Lines = append(order.Lines, p.orderXLine(line))
+	}
+
+	if p.err != nil {
+		return nil, p.err
+	}
+	return order, nil
+}
+
+func (p *parser) orderXLine(l orderXLine) OrderLine {
+	// The shadowing line document and delivery are not decoded into the
+	// embedded invoice line
+	l.ciiLine.AssociatedDocumentLineDocument.LineID = l.AssociatedDocumentLineDocument.LineID
+	l.ciiLine.AssociatedDocumentLineDocument.IncludedNote = l.AssociatedDocumentLineDocument.IncludedNote
+	line := OrderLine{
+		Line:           p.ciiLine(l.ciiLine),
+		AgreedQuantity: p.decimal("agreed quantity", l.SpecifiedLineTradeDelivery.AgreedQuantity.Value),
+		StatusCode:     trim(l.AssociatedDocumentLineDocument.LineStatusCode),
+		DeliveryDate:   p.ciiDate("line delivery date", l.SpecifiedLineTradeDelivery.RequestedDeliverySupplyChainEvent.OccurrenceDateTime),
+	}
+	quantity := l.SpecifiedLineTradeDelivery.RequestedQuantity
+	line.Quantity = p.decimal("requested quantity", quantity.Value)
+	line.UnitCode = firstNonEmpty(quantity.UnitCode, l.SpecifiedLineTradeDelivery.AgreedQuantity.UnitCode)
+	return line
+}
@@ -0,0 +1,159 @@
+package model
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Parse reads a CII CrossIndustryInvoice, a ZUGFeRD 1.0
+// CrossIndustryDocument or a UBL Invoice or CreditNote.
+func Parse(r io.Reader) (*Invoice, error) {
+	return parse(r, &parser{})
+}
+
+// ParseLenient reads the documents of Parse, but leaves malformed values,
+// such as an amount with a decimal comma, unset instead of failing. The
+// errors of the values left out are returned with the invoice.
+func ParseLenient(r io.Reader) (*Invoice, []error, error) {
+	p := &parser{lenient: true}
+	inv, err := parse(r, p)
+	if err != nil {
+		return nil, nil, err
+	}
+	return inv, p.skipped, nil
+}
+
+func parse(r io.Reader, p *parser) (*Invoice, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading document: %w", err)
+	}
+
+	root, err := rootElement(data)
+	if err != nil {
+		return nil, err
+	}
+	switch root {
+	case "CrossIndustryInvoice":
+		return parseCII(bytes.NewReader(data), p)
+	case "CrossIndustryDocument":
+		return parseZUGFeRD1(bytes.NewReader(data), p)
+	case "Invoice", "CreditNote":
+		return parseUBL(bytes.NewReader(data), p)
+	}
+	return nil, fmt.Errorf("unsupported document type: %s", root)
+}
+
+// Kinds of business documents told apart by DocumentKind
+const (
+	KindInvoice        = "invoice"
+	KindOrder          = "order"
+	KindDespatchAdvice = "despatchAdvice"
+)
+
+// DocumentKind tells invoices and credit notes, Order-X and UBL orders and
+// UBL despatch advices apart by their root element.
+func DocumentKind(data []byte) (string, error) {
+	root, err := rootElement(data)
+	if err != nil {
+		return "", err
+	}
+	switch root {
+	case "CrossIndustryInvoice", "CrossIndustryDocument", "Invoice", "CreditNote":
+		return KindInvoice, nil
+	case rootOrderX, "Order":
+		return KindOrder, nil
+	case "DespatchAdvice":
+		return KindDespatchAdvice, nil
+	}
+	return "", fmt.Errorf("unsupported document type: %s", root)
+}
+
+// rootElement returns the local name of the root element.
+func rootElement(data []byte) (string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", fmt.Errorf("error decoding XML: %w", err)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local, nil
+		}
+	}
+}
+
+// parser keeps the first conversion error while a document is mapped, so
+// that the mapping code does not need to check every single value. A
+// lenient parser collects all of them instead.
+type parser struct {
+	err     error
+	lenient bool
+	skipped []error
+}
+
+func (p *parser) fail(field string, err error) {
+	err = fmt.Errorf("%s: %w", field, err)
+	if p.lenient {
+		p.skipped = append(p.skipped, err)
+		return
+	}
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+// decimal parses an optional decimal value of the given business term.
+func (p *parser) decimal(field, value string) Decimal {
+	if value = trim(value); value == "" {
+		return Decimal{}
+	}
+	d, err := ParseDecimal(value)
+	if err != nil {
+		p.fail(field, err)
+	}
+	return d
+}
+
+// date parses an optional date value of the given business term.
+func (p *parser) date(field, value, format string) Date {
+	if value = trim(value); value == "" {
+		return Date{}
+	}
+	d, err := ParseDate(value, trim(format))
+	if err != nil {
+		p.fail(field, err)
+	}
+	return d
+}
+
+func (p *parser) base64(field, value string) []byte {
+	data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), ""))
+	if err != nil {
+		p.fail(field, fmt.Errorf("invalid base64 content"))
+	}
+	return data
+}
+
+// isTrue reads an xs:boolean, which allows "1" as well as "true".
+func isTrue(value string) bool {
+	value = trim(value)
+	return value == "true" || value == "1"
+}
+
+func trim(s string) string {
+	return strings.TrimSpace(s)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value = trim(value); value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,73 @@
+package model
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Identifiers of Peppol BIS Billing 3.0
+const (
+	PeppolSpecificationID = "urn:cen.eu:en16931:2017#compliant#urn:fdc:peppol.eu:2017:poacc:billing:3.0" // BT-24
+	PeppolBusinessProcess = "urn:fdc:peppol.eu:2017:poacc:billing:01:1.0"                                // BT-23, billing only
+)
+
+// PeppolBusinessProcessPattern is the format of BT-23 required by
+// PEPPOL-EN16931-R007; NN is the process number.
+var PeppolBusinessProcessPattern = regexp.MustCompile(`^urn:fdc:peppol\.eu:2017:poacc:billing:\d{2}:1\.0$`)
+
+// IsPeppol reports whether the invoice claims to follow Peppol BIS Billing
+// 3.0.
+func IsPeppol(inv *Invoice) bool {
+	return strings.HasPrefix(inv.SpecificationID, PeppolSpecificationID)
+}
+
+// GermanParties reports whether seller and buyer are German organisations,
+// which Peppol BIS allows to send several notes (PEPPOL-EN16931-R002).
+func GermanParties(inv *Invoice) bool {
+	return inv.Seller.Address.CountryCode == "DE" && inv.Buyer.Address.CountryCode == "DE"
+}
+
+// peppolInvoice returns a copy of the invoice with the Peppol BIS Billing
+// 3.0 specification identifier and business process. Several notes are
+// merged into one unless seller and buyer are German.
+func peppolInvoice(inv *Invoice) *Invoice {
+	out := *inv
+	out.SpecificationID = PeppolSpecificationID
+	if !PeppolBusinessProcessPattern.MatchString(inv.BusinessProcess) {
+		out.BusinessProcess = PeppolBusinessProcess
+	}
+	if len(inv.Notes) > 1 && !GermanParties(inv) {
+		texts := make([]string, len(inv.Notes))
+		for i, note := range inv.Notes {
+			texts[i] = note.Text
+		}
+		out.Notes = []Note{{Text: strings.Join(texts, "\n")}}
+	}
+	return &out
+}
+
+// MarshalPeppol writes the invoice as UBL Invoice or CreditNote according to
+// Peppol BIS Billing 3.0.
+func MarshalPeppol(inv *Invoice) []byte {
+	return MarshalUBL(peppolInvoice(inv))
+}
+
+// peppolLosses lists the values replaced or merged for Peppol BIS, in
+// addition to the losses of UBL.
+func peppolLosses(inv *Invoice) []DroppedField {
+	losses := targetLosses(inv, SyntaxUBL)
+	if inv.SpecificationID != PeppolSpecificationID {
+		losses = append(losses, DroppedField{Path: "BT-24", Value: inv.SpecificationID, Reason: "replaced by the Peppol BIS 3.0 specification identifier"})
+	}
+	if inv.BusinessProcess != "" && !PeppolBusinessProcessPattern.MatchString(inv.BusinessProcess) {
+		losses = append(losses, DroppedField{Path: "BT-23", Value: inv.BusinessProcess, Reason: "replaced by the Peppol billing process " + PeppolBusinessProcess})
+	}
+	if len(inv.Notes) > 1 && !GermanParties(inv) {
+		for _, note := range inv.Notes {
+			if note.SubjectCode != "" {
+				losses = append(losses, DroppedField{Path: "BT-21", Value: note.SubjectCode, Reason: "Peppol BIS allows one note, the notes were merged"})
+			}
+		}
+	}
+	return losses
+}
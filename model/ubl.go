@@ -0,0 +1,590 @@
+package model
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// UBL 2.1 structures as read by ParseUBL. Invoice and CreditNote share
+// them; the type code and line elements differ by name only.
+
+type ublID struct {
+	Value         string `xml:",chardata"`
+	SchemeID      string `xml:"schemeID,attr"`
+	ListID        string `xml:"listID,attr"`
+	ListVersionID string `xml:"listVersionID,attr"`
+}
+
+type ublQuantity struct {
+	Value    string `xml:",chardata"`
+	UnitCode string `xml:"unitCode,attr"`
+}
+
+type ublAmount struct {
+	Value      string `xml:",chardata"`
+	CurrencyID string `xml:"currencyID,attr"`
+}
+
+type ublAddress struct {
+	StreetName           string `xml:"StreetName"`
+	AdditionalStreetName string `xml:"AdditionalStreetName"`
+	CityName             string `xml:"CityName"`
+	PostalZone           string `xml:"PostalZone"`
+	CountrySubentity     string `xml:"CountrySubentity"`
+	AddressLine          struct {
+		Line string `xml:"Line"`
+	} `xml:"AddressLine"`
+	Country struct {
+		IdentificationCode string `xml:"IdentificationCode"`
+	} `xml:"Country"`
+}
+
+type ublParty struct {
+	EndpointID          ublID `xml:"EndpointID"`
+	PartyIdentification []struct {
+		ID ublID `xml:"ID"`
+	} `xml:"PartyIdentification"`
+	PartyName struct {
+		Name string `xml:"Name"`
+	} `xml:"PartyName"`
+	PostalAddress  ublAddress `xml:"PostalAddress"`
+	PartyTaxScheme []struct {
+		CompanyID string `xml:"CompanyID"`
+		TaxScheme struct {
+			ID string `xml:"ID"`
+		} `xml:"TaxScheme"`
+	} `xml:"PartyTaxScheme"`
+	PartyLegalEntity struct {
+		RegistrationName string `xml:"RegistrationName"`
+		CompanyID        ublID  `xml:"CompanyID"`
+		CompanyLegalForm string `xml:"CompanyLegalForm"`
+	} `xml:"PartyLegalEntity"`
+	Contact struct {
+		Name           string `xml:"Name"`
+		Telephone      string `xml:"Telephone"`
+		ElectronicMail string `xml:"ElectronicMail"`
+	} `xml:"Contact"`
+}
+
+type ublPeriod struct {
+	StartDate       string `xml:"StartDate"`
+	EndDate         string `xml:"EndDate"`
+	DescriptionCode string `xml:"DescriptionCode"`
+}
+
+type ublTaxCategory struct {
+	ID                     string `xml:"ID"`
+	Percent                string `xml:"Percent"`
+	TaxExemptionReasonCode string `xml:"TaxExemptionReasonCode"`
+	TaxExemptionReason     string `xml:"TaxExemptionReason"`
+	TaxScheme              struct {
+		ID string `xml:"ID"`
+	} `xml:"TaxScheme"`
+}
+
+type ublAllowanceCharge struct {
+	ChargeIndicator           string         `xml:"ChargeIndicator"`
+	AllowanceChargeReasonCode string         `xml:"AllowanceChargeReasonCode"`
+	AllowanceChargeReason     string         `xml:"AllowanceChargeReason"`
+	MultiplierFactorNumeric   string         `xml:"MultiplierFactorNumeric"`
+	Amount                    string         `xml:"Amount"`
+	BaseAmount                string         `xml:"BaseAmount"`
+	TaxCategory               ublTaxCategory `xml:"TaxCategory"`
+}
+
+type ublDocumentReference struct {
+	ID                  ublID  `xml:"ID"`
+	IssueDate           string `xml:"IssueDate"`
+	DocumentTypeCode    string `xml:"DocumentTypeCode"`
+	DocumentDescription string `xml:"DocumentDescription"`
+	Attachment          struct {
+		EmbeddedDocumentBinaryObject struct {
+			Value    string `xml:",chardata"`
+			MimeCode string `xml:"mimeCode,attr"`
+			Filename string `xml:"filename,attr"`
+		} `xml:"EmbeddedDocumentBinaryObject"`
+		ExternalReference struct {
+			URI string `xml:"URI"`
+		} `xml:"ExternalReference"`
+	} `xml:"Attachment"`
+}
+
+type ublLine struct {
+	ID                  string       `xml:"ID"`
+	Note                []string     `xml:"Note"`
+	InvoicedQuantity    *ublQuantity `xml:"InvoicedQuantity"`
+	CreditedQuantity    *ublQuantity `xml:"CreditedQuantity"`
+	LineExtensionAmount string       `xml:"LineExtensionAmount"`
+	AccountingCost      string       `xml:"AccountingCost"`
+	InvoicePeriod       ublPeriod    `xml:"InvoicePeriod"`
+	OrderLineReference  struct {
+		LineID string `xml:"LineID"`
+	} `xml:"OrderLineReference"`
+	DocumentReference ublDocumentReference `xml:"DocumentReference"`
+	AllowanceCharge   []ublAllowanceCharge `xml:"AllowanceCharge"`
+	Item              struct {
+		Description              string `xml:"Description"`
+		Name                     string `xml:"Name"`
+		BuyersItemIdentification struct {
+			ID string `xml:"ID"`
+		} `xml:"BuyersItemIdentification"`
+		SellersItemIdentification struct {
+			ID string `xml:"ID"`
+		} `xml:"SellersItemIdentification"`
+		StandardItemIdentification struct {
+			ID ublID `xml:"ID"`
+		} `xml:"StandardItemIdentification"`
+		OriginCountry struct {
+			IdentificationCode string `xml:"IdentificationCode"`
+		} `xml:"OriginCountry"`
+		CommodityClassification []struct {
+			ItemClassificationCode ublID `xml:"ItemClassificationCode"`
+		} `xml:"CommodityClassification"`
+		ClassifiedTaxCategory  ublTaxCategory `xml:"ClassifiedTaxCategory"`
+		AdditionalItemProperty []struct {
+			Name  string `xml:"Name"`
+			Value string `xml:"Value"`
+		} `xml:"AdditionalItemProperty"`
+	} `xml:"Item"`
+	Price struct {
+		PriceAmount     string      `xml:"PriceAmount"`
+		BaseQuantity    ublQuantity `xml:"BaseQuantity"`
+		AllowanceCharge struct {
+			ChargeIndicator string `xml:"ChargeIndicator"`
+			Amount          string `xml:"Amount"`
+			BaseAmount      string `xml:"BaseAmount"`
+		} `xml:"AllowanceCharge"`
+	} `xml:"Price"`
+}
+
+type ublInvoice struct {
+	XMLName              xml.Name
+	UBLVersionID         string    `xml:"UBLVersionID"`
+	CustomizationID      string    `xml:"CustomizationID"`
+	ProfileID            string    `xml:"ProfileID"`
+	ID                   string    `xml:"ID"`
+	IssueDate            string    `xml:"IssueDate"`
+	DueDate              string    `xml:"DueDate"`
+	InvoiceTypeCode      string    `xml:"InvoiceTypeCode"`
+	CreditNoteTypeCode   string    `xml:"CreditNoteTypeCode"`
+	Note                 []string  `xml:"Note"`
+	TaxPointDate         string    `xml:"TaxPointDate"`
+	DocumentCurrencyCode string    `xml:"DocumentCurrencyCode"`
+	TaxCurrencyCode      string    `xml:"TaxCurrencyCode"`
+	AccountingCost       string    `xml:"AccountingCost"`
+	BuyerReference       string    `xml:"BuyerReference"`
+	InvoicePeriod        ublPeriod `xml:"InvoicePeriod"`
+	OrderReference       struct {
+		ID           string `xml:"ID"`
+		SalesOrderID string `xml:"SalesOrderID"`
+	} `xml:"OrderReference"`
+	BillingReference []struct {
+		InvoiceDocumentReference ublDocumentReference `xml:"InvoiceDocumentReference"`
+	} `xml:"BillingReference"`
+	DespatchDocumentReference   ublDocumentReference   `xml:"DespatchDocumentReference"`
+	ReceiptDocumentReference    ublDocumentReference   `xml:"ReceiptDocumentReference"`
+	OriginatorDocumentReference ublDocumentReference   `xml:"OriginatorDocumentReference"`
+	ContractDocumentReference   ublDocumentReference   `xml:"ContractDocumentReference"`
+	AdditionalDocumentReference []ublDocumentReference `xml:"AdditionalDocumentReference"`
+	ProjectReference            ublDocumentReference   `xml:"ProjectReference"`
+	AccountingSupplierParty     struct {
+		Party ublParty `xml:"Party"`
+	} `xml:"AccountingSupplierParty"`
+	AccountingCustomerParty struct {
+		Party ublParty `xml:"Party"`
+	} `xml:"AccountingCustomerParty"`
+	PayeeParty             *ublParty `xml:"PayeeParty"`
+	TaxRepresentativeParty *ublParty `xml:"TaxRepresentativeParty"`
+	Delivery               *struct {
+		ActualDeliveryDate string `xml:"ActualDeliveryDate"`
+		DeliveryLocation   struct {
+			ID      ublID      `xml:"ID"`
+			Address ublAddress `xml:"Address"`
+		} `xml:"DeliveryLocation"`
+		DeliveryParty struct {
+			PartyName struct {
+				Name string `xml:"Name"`
+			} `xml:"PartyName"`
+		} `xml:"DeliveryParty"`
+	} `xml:"Delivery"`
+	PaymentMeans []struct {
+		PaymentMeansCode struct {
+			Value string `xml:",chardata"`
+			Name  string `xml:"name,attr"`
+		} `xml:"PaymentMeansCode"`
+		PaymentDueDate string   `xml:"PaymentDueDate"`
+		PaymentID      []string `xml:"PaymentID"`
+		CardAccount    struct {
+			PrimaryAccountNumberID string `xml:"PrimaryAccountNumberID"`
+			NetworkID              string `xml:"NetworkID"`
+			HolderName             string `xml:"HolderName"`
+		} `xml:"CardAccount"`
+		PayeeFinancialAccount struct {
+			ID                         string `xml:"ID"`
+			Name                       string `xml:"Name"`
+			FinancialInstitutionBranch struct {
+				ID string `xml:"ID"`
+			} `xml:"FinancialInstitutionBranch"`
+		} `xml:"PayeeFinancialAccount"`
+		PaymentMandate struct {
+			ID                    string `xml:"ID"`
+			PayerFinancialAccount struct {
+				ID string `xml:"ID"`
+			} `xml:"PayerFinancialAccount"`
+		} `xml:"PaymentMandate"`
+	} `xml:"PaymentMeans"`
+	PaymentTerms []struct {
+		Note string `xml:"Note"`
+	} `xml:"PaymentTerms"`
+	AllowanceCharge []ublAllowanceCharge `xml:"AllowanceCharge"`
+	TaxTotal        []struct {
+		TaxAmount   ublAmount `xml:"TaxAmount"`
+		TaxSubtotal []struct {
+			TaxableAmount string         `xml:"TaxableAmount"`
+			TaxAmount     string         `xml:"TaxAmount"`
+			TaxCategory   ublTaxCategory `xml:"TaxCategory"`
+		} `xml:"TaxSubtotal"`
+	} `xml:"TaxTotal"`
+	LegalMonetaryTotal struct {
+		LineExtensionAmount   string `xml:"LineExtensionAmount"`
+		TaxExclusiveAmount    string `xml:"TaxExclusiveAmount"`
+		TaxInclusiveAmount    string `xml:"TaxInclusiveAmount"`
+		AllowanceTotalAmount  string `xml:"AllowanceTotalAmount"`
+		ChargeTotalAmount     string `xml:"ChargeTotalAmount"`
+		PrepaidAmount         string `xml:"PrepaidAmount"`
+		PayableRoundingAmount string `xml:"PayableRoundingAmount"`
+		PayableAmount         string `xml:"PayableAmount"`
+	} `xml:"LegalMonetaryTotal"`
+	InvoiceLine    []ublLine `xml:"InvoiceLine"`
+	CreditNoteLine []ublLine `xml:"CreditNoteLine"`
+}
+
+// ParseUBL reads a UBL 2.1 Invoice or CreditNote.
+func ParseUBL(r io.Reader) (*Invoice, error) {
+	return parseUBL(r, &parser{})
+}
+
+func parseUBL(r io.Reader, p *parser) (*Invoice, error) {
+	var doc ublInvoice
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("error decoding XML: %w", err)
+	}
+	if doc.XMLName.Local != "Invoice" && doc.XMLName.Local != "CreditNote" {
+		return nil, fmt.Errorf("unsupported document type: %s", doc.XMLName.Local)
+	}
+
+	inv := &Invoice{
+		Syntax:                   SyntaxUBL,
+		Number:                   trim(doc.ID),
+		IssueDate:                p.date("BT-2", doc.IssueDate, ""),
+		TypeCode:                 DocumentTypeCode(firstNonEmpty(doc.InvoiceTypeCode, doc.CreditNoteTypeCode)),
+		CurrencyCode:             trim(doc.DocumentCurrencyCode),
+		TaxCurrencyCode:          trim(doc.TaxCurrencyCode),
+		TaxPointDate:             p.date("BT-7", doc.TaxPointDate, ""),
+		TaxPointDateCode:         trim(doc.InvoicePeriod.DescriptionCode),
+		DueDate:                  p.date("BT-9", doc.DueDate, ""),
+		BuyerReference:           trim(doc.BuyerReference),
+		ProjectReference:         trim(doc.ProjectReference.ID.Value),
+		ContractReference:        trim(doc.ContractDocumentReference.ID.Value),
+		PurchaseOrderReference:   trim(doc.OrderReference.ID),
+		SalesOrderReference:      trim(doc.OrderReference.SalesOrderID),
+		ReceivingAdviceReference: trim(doc.ReceiptDocumentReference.ID.Value),
+		DespatchAdviceReference:  trim(doc.DespatchDocumentReference.ID.Value),
+		TenderReference:          trim(doc.OriginatorDocumentReference.ID.Value),
+		BuyerAccountingReference: trim(doc.AccountingCost),
+		BusinessProcess:          trim(doc.ProfileID),
+		SpecificationID:          trim(doc.CustomizationID),
+		Seller:                   ublPartyOf(doc.AccountingSupplierParty.Party),
+		Buyer:                    ublPartyOf(doc.AccountingCustomerParty.Party),
+		InvoicingPeriod: Period{
+			Start: p.date("BT-73", doc.InvoicePeriod.StartDate, ""),
+			End:   p.date("BT-74", doc.InvoicePeriod.EndDate, ""),
+		},
+	}
+
+	for _, note := range doc.Note {
+		inv.Notes = append(inv.Notes, ublNote(note))
+	}
+	for _, ref := range doc.BillingReference {
+		inv.PrecedingInvoices = append(inv.PrecedingInvoices, PrecedingInvoice{
+			Number:    trim(ref.InvoiceDocumentReference.ID.Value),
+			IssueDate: p.date("BT-26", ref.InvoiceDocumentReference.IssueDate, ""),
+		})
+	}
+	for _, ref := range doc.AdditionalDocumentReference {
+		switch trim(ref.DocumentTypeCode) {
+		case "130":
+			inv.InvoicedObject = Identifier{ID: trim(ref.ID.Value), Scheme: trim(ref.ID.SchemeID)}
+			continue
+		case "50":
+			// A CreditNote carries the project reference this way
+			if inv.ProjectReference == "" {
+				inv.ProjectReference = trim(ref.ID.Value)
+				continue
+			}
+		}
+		supporting := SupportingDocument{
+			ID:          trim(ref.ID.Value),
+			Description: trim(ref.DocumentDescription),
+			URI:         trim(ref.Attachment.ExternalReference.URI),
+		}
+		if object := ref.Attachment.EmbeddedDocumentBinaryObject; trim(object.Value) != "" {
+			supporting.Attachment = &Attachment{
+				MimeCode: trim(object.MimeCode),
+				Filename: trim(object.Filename),
+				Data:     p.base64("BT-125", object.Value),
+			}
+		}
+		inv.SupportingDocuments = append(inv.SupportingDocuments, supporting)
+	}
+
+	if doc.PayeeParty != nil {
+		payee := ublPartyOf(*doc.PayeeParty)
+		payee.Name = firstNonEmpty(doc.PayeeParty.PartyName.Name, payee.Name)
+		payee.TradingName = ""
+		inv.Payee = &payee
+	}
+	if doc.TaxRepresentativeParty != nil {
+		representative := ublPartyOf(*doc.TaxRepresentativeParty)
+		representative.Name = firstNonEmpty(doc.TaxRepresentativeParty.PartyName.Name, representative.Name)
+		representative.TradingName = ""
+		inv.TaxRepresentative = &representative
+	}
+	if delivery := doc.Delivery; delivery != nil {
+		inv.Delivery = &Delivery{
+			PartyName:  trim(delivery.DeliveryParty.PartyName.Name),
+			LocationID: Identifier{ID: trim(delivery.DeliveryLocation.ID.Value), Scheme: trim(delivery.DeliveryLocation.ID.SchemeID)},
+			Date:       p.date("BT-72", delivery.ActualDeliveryDate, ""),
+			Address:    ublAddressOf(delivery.DeliveryLocation.Address),
+		}
+	}
+
+	payment := &inv.PaymentInstructions
+	for _, means := range doc.PaymentMeans {
+		if payment.MeansCode == "" {
+			payment.MeansCode = trim(means.PaymentMeansCode.Value)
+			payment.MeansText = trim(means.PaymentMeansCode.Name)
+		}
+		if due := p.date("BT-9", means.PaymentDueDate, ""); due.IsSet() && !inv.DueDate.IsSet() {
+			// A CreditNote has no DueDate element
+			inv.DueDate = due
+		}
+		if payment.RemittanceInfo == "" && len(means.PaymentID) > 0 {
+			payment.RemittanceInfo = trim(means.PaymentID[0])
+		}
+		account := means.PayeeFinancialAccount
+		if id := trim(account.ID); id != "" {
+			payment.CreditTransfers = append(payment.CreditTransfers, CreditTransfer{
+				AccountID:   id,
+				AccountName: trim(account.Name),
+				ProviderID:  trim(account.FinancialInstitutionBranch.ID),
+			})
+		}
+		if card := means.CardAccount; trim(card.PrimaryAccountNumberID) != "" {
+			payment.Card = &PaymentCard{AccountNumber: trim(card.PrimaryAccountNumberID), HolderName: trim(card.HolderName)}
+		}
+		if mandate := means.PaymentMandate; trim(mandate.ID) != "" || trim(mandate.PayerFinancialAccount.ID) != "" {
+			payment.DirectDebit = &DirectDebit{
+				MandateID:      trim(mandate.ID),
+				DebitedAccount: trim(mandate.PayerFinancialAccount.ID),
+			}
+		}
+	}
+	// The creditor identifier (BT-90) is a seller identifier with scheme SEPA
+	identifiers := inv.Seller.Identifiers[:0]
+	for _, id := range inv.Seller.Identifiers {
+		if id.Scheme != "SEPA" {
+			identifiers = append(identifiers, id)
+			continue
+		}
+		if payment.DirectDebit == nil {
+			payment.DirectDebit = &DirectDebit{}
+		}
+		payment.DirectDebit.CreditorID = id.ID
+	}
+	inv.Seller.Identifiers = identifiers
+
+	var terms []string
+	for _, term := range doc.PaymentTerms {
+		if note := trim(term.Note); note != "" {
+			terms = append(terms, note)
+		}
+	}
+	inv.PaymentTerms = strings.Join(terms, "\n")
+
+	for _, ac := range doc.AllowanceCharge {
+		if isTrue(ac.ChargeIndicator) {
+			inv.Charges = append(inv.Charges, p.ublAllowanceCharge("BG-21", ac))
+		} else {
+			inv.Allowances = append(inv.Allowances, p.ublAllowanceCharge("BG-20", ac))
+		}
+	}
+
+	for _, total := range doc.TaxTotal {
+		currency := trim(total.TaxAmount.CurrencyID)
+		if currency != "" && currency != inv.CurrencyCode && currency == inv.TaxCurrencyCode {
+			inv.Totals.TaxAccounting = p.decimal("BT-111", total.TaxAmount.Value)
+			continue
+		}
+		inv.Totals.Tax = p.decimal("BT-110", total.TaxAmount.Value)
+		for _, sub := range total.TaxSubtotal {
+			inv.VATBreakdown = append(inv.VATBreakdown, VATBreakdown{
+				TaxableAmount:       p.decimal("BT-116", sub.TaxableAmount),
+				TaxAmount:           p.decimal("BT-117", sub.TaxAmount),
+				Category:            VATCategory(trim(sub.TaxCategory.ID)),
+				Rate:                p.decimal("BT-119", sub.TaxCategory.Percent),
+				ExemptionReason:     trim(sub.TaxCategory.TaxExemptionReason),
+				ExemptionReasonCode: trim(sub.TaxCategory.TaxExemptionReasonCode),
+			})
+		}
+	}
+
+	sums := doc.LegalMonetaryTotal
+	inv.Totals.LineNet = p.decimal("BT-106", sums.LineExtensionAmount)
+	inv.Totals.Allowances = p.decimal("BT-107", sums.AllowanceTotalAmount)
+	inv.Totals.Charges = p.decimal("BT-108", sums.ChargeTotalAmount)
+	inv.Totals.TaxBasis = p.decimal("BT-109", sums.TaxExclusiveAmount)
+	inv.Totals.Grand = p.decimal("BT-112", sums.TaxInclusiveAmount)
+	inv.Totals.Prepaid = p.decimal("BT-113", sums.PrepaidAmount)
+	inv.Totals.Rounding = p.decimal("BT-114", sums.PayableRoundingAmount)
+	inv.Totals.DuePayable = p.decimal("BT-115", sums.PayableAmount)
+
+	for _, line := range append(doc.InvoiceLine, doc.CreditNoteLine...) {
+		inv.Lines = append(inv.Lines, p.ublLine(line))
+	}
+
+	if p.err != nil {
+		return nil, p.err
+	}
+	return inv, nil
+}
+
+func (p *parser) ublLine(l ublLine) Line {
+	line := Line{
+		ID:                  trim(l.ID),
+		Note:                strings.Join(l.Note, "\n"),
+		NetAmount:           p.decimal("BT-131", l.LineExtensionAmount),
+		OrderLineReference:  trim(l.OrderLineReference.LineID),
+		AccountingReference: trim(l.AccountingCost),
+		Period: Period{
+			Start: p.date("BT-134", l.InvoicePeriod.StartDate, ""),
+			End:   p.date("BT-135", l.InvoicePeriod.EndDate, ""),
+		},
+		Price: Price{
+			Net:              p.decimal("BT-146", l.Price.PriceAmount),
+			Discount:         p.decimal("BT-147", l.Price.AllowanceCharge.Amount),
+			Gross:            p.decimal("BT-148", l.Price.AllowanceCharge.BaseAmount),
+			BaseQuantity:     p.decimal("BT-149", l.Price.BaseQuantity.Value),
+			BaseQuantityUnit: trim(l.Price.BaseQuantity.UnitCode),
+		},
+		VATCategory: VATCategory(trim(l.Item.ClassifiedTaxCategory.ID)),
+		VATRate:     p.decimal("BT-152", l.Item.ClassifiedTaxCategory.Percent),
+		Item: Item{
+			Name:          trim(l.Item.Name),
+			Description:   trim(l.Item.Description),
+			SellerID:      trim(l.Item.SellersItemIdentification.ID),
+			BuyerID:       trim(l.Item.BuyersItemIdentification.ID),
+			StandardID:    Identifier{ID: trim(l.Item.StandardItemIdentification.ID.Value), Scheme: trim(l.Item.StandardItemIdentification.ID.SchemeID)},
+			OriginCountry: trim(l.Item.OriginCountry.IdentificationCode),
+		},
+	}
+	line.Note = trim(line.Note)
+
+	quantity := l.InvoicedQuantity
+	if quantity == nil {
+		quantity = l.CreditedQuantity
+	}
+	if quantity != nil {
+		line.Quantity = p.decimal("BT-129", quantity.Value)
+		line.UnitCode = trim(quantity.UnitCode)
+	}
+
+	if ref := l.DocumentReference; trim(ref.ID.Value) != "" {
+		line.ObjectID = Identifier{ID: trim(ref.ID.Value), Scheme: trim(ref.ID.SchemeID)}
+	}
+	for _, ac := range l.AllowanceCharge {
+		if isTrue(ac.ChargeIndicator) {
+			line.Charges = append(line.Charges, p.ublAllowanceCharge("BG-28", ac))
+		} else {
+			line.Allowances = append(line.Allowances, p.ublAllowanceCharge("BG-27", ac))
+		}
+	}
+	for _, class := range l.Item.CommodityClassification {
+		code := class.ItemClassificationCode
+		line.Item.Classifications = append(line.Item.Classifications, Identifier{
+			ID:            trim(code.Value),
+			Scheme:        trim(code.ListID),
+			SchemeVersion: trim(code.ListVersionID),
+		})
+	}
+	for _, property := range l.Item.AdditionalItemProperty {
+		line.Item.Attributes = append(line.Item.Attributes, ItemAttribute{Name: trim(property.Name), Value: trim(property.Value)})
+	}
+	return line
+}
+
+func ublPartyOf(party ublParty) Party {
+	result := Party{
+		Name:                trim(party.PartyLegalEntity.RegistrationName),
+		TradingName:         trim(party.PartyName.Name),
+		LegalRegistrationID: Identifier{ID: trim(party.PartyLegalEntity.CompanyID.Value), Scheme: trim(party.PartyLegalEntity.CompanyID.SchemeID)},
+		AdditionalLegalInfo: trim(party.PartyLegalEntity.CompanyLegalForm),
+		ElectronicAddress:   Identifier{ID: trim(party.EndpointID.Value), Scheme: trim(party.EndpointID.SchemeID)},
+		Address:             ublAddressOf(party.PostalAddress),
+		Contact: Contact{
+			Name:  trim(party.Contact.Name),
+			Phone: trim(party.Contact.Telephone),
+			Email: trim(party.Contact.ElectronicMail),
+		},
+	}
+	for _, identification := range party.PartyIdentification {
+		if id := trim(identification.ID.Value); id != "" {
+			result.Identifiers = append(result.Identifiers, Identifier{ID: id, Scheme: trim(identification.ID.SchemeID)})
+		}
+	}
+	for _, scheme := range party.PartyTaxScheme {
+		if trim(scheme.TaxScheme.ID) == "VAT" {
+			result.VATID = trim(scheme.CompanyID)
+		} else {
+			result.TaxRegistrationID = trim(scheme.CompanyID)
+		}
+	}
+	return result
+}
+
+func ublAddressOf(address ublAddress) Address {
+	return Address{
+		Line1:       trim(address.StreetName),
+		Line2:       trim(address.AdditionalStreetName),
+		Line3:       trim(address.AddressLine.Line),
+		City:        trim(address.CityName),
+		PostCode:    trim(address.PostalZone),
+		Subdivision: trim(address.CountrySubentity),
+		CountryCode: trim(address.Country.IdentificationCode),
+	}
+}
+
+// ublNote splits the subject code that UBL carries as "#CODE#text" prefix.
+func ublNote(note string) Note {
+	note = trim(note)
+	if strings.HasPrefix(note, "#") {
+		if code, text, ok := strings.Cut(note[1:], "#"); ok && len(code) <= 3 {
+			return Note{SubjectCode: code, Text: trim(text)}
+		}
+	}
+	return Note{Text: note}
+}
+
+func (p *parser) ublAllowanceCharge(group string, ac ublAllowanceCharge) AllowanceCharge {
+	return AllowanceCharge{
+		Amount:      p.decimal(group+" amount", ac.Amount),
+		BaseAmount:  p.decimal(group+" base amount", ac.BaseAmount),
+		Percentage:  p.decimal(group+" percentage", ac.MultiplierFactorNumeric),
+		VATCategory: VATCategory(trim(ac.TaxCategory.ID)),
+		VATRate:     p.decimal(group+" VAT rate", ac.TaxCategory.Percent),
+		Reason:      trim(ac.AllowanceChargeReason),
+		ReasonCode:  trim(ac.AllowanceChargeReasonCode),
+	}
+}
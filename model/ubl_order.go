@@ -0,0 +1,160 @@
+package model
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// UBL 2.1 Order structures as read by ParseUBLOrder. Line items share the
+// invoice line structure; the quantity is named Quantity.
+
+type ublOrderLine struct {
+	Note     []string `xml:"Note"`
+	LineItem struct {
+		ublLine
+		Quantity ublQuantity `xml:"Quantity"`
+		Delivery struct {
+			RequestedDeliveryPeriod ublPeriod `xml:"RequestedDeliveryPeriod"`
+		} `xml:"Delivery"`
+	} `xml:"LineItem"`
+}
+
+type ublOrder struct {
+	CustomizationID        string   `xml:"CustomizationID"`
+	ProfileID              string   `xml:"ProfileID"`
+	ID                     string   `xml:"ID"`
+	SalesOrderID           string   `xml:"SalesOrderID"`
+	IssueDate              string   `xml:"IssueDate"`
+	OrderTypeCode          string   `xml:"OrderTypeCode"`
+	Note                   []string `xml:"Note"`
+	DocumentCurrencyCode   string   `xml:"DocumentCurrencyCode"`
+	CustomerReference      string   `xml:"CustomerReference"`
+	OrderDocumentReference struct {
+		ID string `xml:"ID"`
+	} `xml:"OrderDocumentReference"`
+	QuotationDocumentReference struct {
+		ID string `xml:"ID"`
+	} `xml:"QuotationDocumentReference"`
+	Contract struct {
+		ID string `xml:"ID"`
+	} `xml:"Contract"`
+	BuyerCustomerParty struct {
+		Party ublParty `xml:"Party"`
+	} `xml:"BuyerCustomerParty"`
+	SellerSupplierParty struct {
+		Party ublParty `xml:"Party"`
+	} `xml:"SellerSupplierParty"`
+	Delivery struct {
+		DeliveryLocation struct {
+			Address ublAddress `xml:"Address"`
+		} `xml:"DeliveryLocation"`
+		RequestedDeliveryPeriod ublPeriod `xml:"RequestedDeliveryPeriod"`
+		DeliveryParty           *ublParty `xml:"DeliveryParty"`
+	} `xml:"Delivery"`
+	PaymentTerms []struct {
+		Note string `xml:"Note"`
+	} `xml:"PaymentTerms"`
+	AllowanceCharge []ublAllowanceCharge `xml:"AllowanceCharge"`
+	TaxTotal        struct {
+		TaxAmount string `xml:"TaxAmount"`
+	} `xml:"TaxTotal"`
+	AnticipatedMonetaryTotal struct {
+		LineExtensionAmount  string `xml:"LineExtensionAmount"`
+		TaxExclusiveAmount   string `xml:"TaxExclusiveAmount"`
+		TaxInclusiveAmount   string `xml:"TaxInclusiveAmount"`
+		AllowanceTotalAmount string `xml:"AllowanceTotalAmount"`
+		ChargeTotalAmount    string `xml:"ChargeTotalAmount"`
+		PayableAmount        string `xml:"PayableAmount"`
+	} `xml:"AnticipatedMonetaryTotal"`
+	OrderLine []ublOrderLine `xml:"OrderLine"`
+}
+
+// ParseUBLOrder reads a UBL 2.1 Order. Orders without OrderTypeCode are
+// read as orders (220).
+func ParseUBLOrder(r io.Reader) (*Order, error) {
+	var doc ublOrder
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("error decoding XML: %w", err)
+	}
+
+	p := &parser{}
+	order := &Order{
+		Syntax:              SyntaxUBL,
+		Number:              trim(doc.ID),
+		IssueDate:           p.date("issue date", doc.IssueDate, ""),
+		TypeCode:            firstNonEmpty(doc.OrderTypeCode, OrderTypeOrder),
+		CurrencyCode:        trim(doc.DocumentCurrencyCode),
+		BuyerReference:      trim(doc.CustomerReference),
+		OrderReference:      trim(doc.OrderDocumentReference.ID),
+		SalesOrderReference: trim(doc.SalesOrderID),
+		ContractReference:   trim(doc.Contract.ID),
+		QuotationReference:  trim(doc.QuotationDocumentReference.ID),
+		BusinessProcess:     trim(doc.ProfileID),
+		SpecificationID:     trim(doc.CustomizationID),
+		Seller:              ublPartyOf(doc.SellerSupplierParty.Party),
+		Buyer:               ublPartyOf(doc.BuyerCustomerParty.Party),
+	}
+	for _, note := range doc.Note {
+		if note := ublNote(note); note.Text != "" {
+			order.Notes = append(order.Notes, note)
+		}
+	}
+
+	delivery := doc.Delivery
+	location := ublAddressOf(delivery.DeliveryLocation.Address)
+	if delivery.DeliveryParty != nil {
+		party := ublPartyOf(*delivery.DeliveryParty)
+		if party.Address == (Address{}) {
+			party.Address = location
+		}
+		order.ShipTo = &party
+	} else if location != (Address{}) {
+		order.ShipTo = &Party{Address: location}
+	}
+	period := delivery.RequestedDeliveryPeriod
+	order.DeliveryDate = p.date("requested delivery date", firstNonEmpty(period.StartDate, period.EndDate), "")
+
+	var terms []string
+	for _, term := range doc.PaymentTerms {
+		if note := trim(term.Note); note != "" {
+			terms = append(terms, note)
+		}
+	}
+	order.PaymentTerms = strings.Join(terms, "\n")
+	for _, ac := range doc.AllowanceCharge {
+		if isTrue(ac.ChargeIndicator) {
+			order.Charges = append(order.Charges, p.ublAllowanceCharge("charge", ac))
+		} else {
+			order.Allowances = append(order.Allowances, p.ublAllowanceCharge("allowance", ac))
+		}
+	}
+
+	sums := doc.AnticipatedMonetaryTotal
+	order.Totals = Totals{
+		LineNet:    p.decimal("line extension amount", sums.LineExtensionAmount),
+		Allowances: p.decimal("allowance total amount", sums.AllowanceTotalAmount),
+		Charges:    p.decimal("charge total amount", sums.ChargeTotalAmount),
+		TaxBasis:   p.decimal("tax exclusive amount", sums.TaxExclusiveAmount),
+		Tax:        p.decimal("tax amount", doc.TaxTotal.TaxAmount),
+		Grand:      p.decimal("tax inclusive amount", sums.TaxInclusiveAmount),
+		DuePayable: p.decimal("payable amount", sums.PayableAmount),
+	}
+
+	for _, l := range doc.OrderLine {
+		item := l.LineItem
+		line := OrderLine{Line: p.ublLine(item.ublLine)}
+		line.Quantity = p.decimal("quantity", item.Quantity.Value)
+		line.UnitCode = trim(item.Quantity.UnitCode)
+		line.Note = trim(strings.Join(append(l.Note, line.Note), "\n"))
+		period := item.Delivery.RequestedDeliveryPeriod
+		line.DeliveryDate = p.date("line delivery date", firstNonEmpty(period.StartDate, period.EndDate), "")
+		order.Lines = append(order.Lines, line)
+	}
+
+	if p.err != nil {
+		return nil, p.err
+	}
+	return order, nil
+}
@@ -0,0 +1,330 @@
+package model
+
+import "encoding/base64"
+
+// UBL 2.1 namespaces
+const (
+	NamespaceUBLInvoice    = "urn:oasis:names:specification:ubl:schema:xsd:Invoice-2"
+	NamespaceUBLCreditNote = "urn:oasis:names:specification:ubl:schema:xsd:CreditNote-2"
+	NamespaceUBLCAC        = "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2"
+	NamespaceUBLCBC        = "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2"
+)
+
+// MarshalUBL writes the invoice as UBL 2.1 Invoice, or as CreditNote if the
+// type code denotes a credit note. In a CreditNote the due date (BT-9) is
+// carried by the payment means, so it requires a payment means code.
+func MarshalUBL(inv *Invoice) []byte {
+	creditNote := inv.TypeCode.IsCreditNote()
+	rootName, namespace, lineName, quantityName := "Invoice", NamespaceUBLInvoice, "cac:InvoiceLine", "cbc:InvoicedQuantity"
+	if creditNote {
+		rootName, namespace, lineName, quantityName = "CreditNote", NamespaceUBLCreditNote, "cac:CreditNoteLine", "cbc:CreditedQuantity"
+	}
+	root := newXMLNode(rootName,
+		"xmlns", namespace,
+		"xmlns:cac", NamespaceUBLCAC,
+		"xmlns:cbc", NamespaceUBLCBC)
+
+	root.leaf("cbc:CustomizationID", inv.SpecificationID)
+	root.leaf("cbc:ProfileID", inv.BusinessProcess)
+	root.leaf("cbc:ID", inv.Number)
+	root.leaf("cbc:IssueDate", inv.IssueDate.XSDate())
+	if creditNote {
+		root.leaf("cbc:CreditNoteTypeCode", string(inv.TypeCode))
+	} else {
+		root.leaf("cbc:DueDate", inv.DueDate.XSDate())
+		root.leaf("cbc:InvoiceTypeCode", string(inv.TypeCode))
+	}
+	for _, note := range inv.Notes {
+		text := note.Text
+		if note.SubjectCode != "" {
+			text = "#" + note.SubjectCode + "#" + text
+		}
+		root.leaf("cbc:Note", text)
+	}
+	root.leaf("cbc:TaxPointDate", inv.TaxPointDate.XSDate())
+	root.leaf("cbc:DocumentCurrencyCode", inv.CurrencyCode)
+	root.leaf("cbc:TaxCurrencyCode", inv.TaxCurrencyCode)
+	root.leaf("cbc:AccountingCost", inv.BuyerAccountingReference)
+	root.leaf("cbc:BuyerReference", inv.BuyerReference)
+
+	period := root.elem("cac:InvoicePeriod")
+	period.leaf("cbc:StartDate", inv.InvoicingPeriod.Start.XSDate())
+	period.leaf("cbc:EndDate", inv.InvoicingPeriod.End.XSDate())
+	period.leaf("cbc:DescriptionCode", inv.TaxPointDateCode)
+
+	order := root.elem("cac:OrderReference")
+	order.leaf("cbc:ID", inv.PurchaseOrderReference)
+	if inv.PurchaseOrderReference == "" && inv.SalesOrderReference != "" {
+		order.leaf("cbc:ID", "NA") // The order ID is mandatory
+	}
+	order.leaf("cbc:SalesOrderID", inv.SalesOrderReference)
+
+	for _, preceding := range inv.PrecedingInvoices {
+		ref := root.elem("cac:BillingReference").elem("cac:InvoiceDocumentReference")
+		ref.leaf("cbc:ID", preceding.Number)
+		ref.leaf("cbc:IssueDate", preceding.IssueDate.XSDate())
+	}
+	root.elem("cac:DespatchDocumentReference").leaf("cbc:ID", inv.DespatchAdviceReference)
+	root.elem("cac:ReceiptDocumentReference").leaf("cbc:ID", inv.ReceivingAdviceReference)
+	if !creditNote {
+		root.elem("cac:OriginatorDocumentReference").leaf("cbc:ID", inv.TenderReference)
+	}
+	root.elem("cac:ContractDocumentReference").leaf("cbc:ID", inv.ContractReference)
+	if inv.InvoicedObject.IsSet() {
+		ref := root.elem("cac:AdditionalDocumentReference")
+		ref.leaf("cbc:ID", inv.InvoicedObject.ID, "schemeID", inv.InvoicedObject.Scheme)
+		ref.leaf("cbc:DocumentTypeCode", "130")
+	}
+	for _, doc := range inv.SupportingDocuments {
+		ref := root.elem("cac:AdditionalDocumentReference")
+		ref.leaf("cbc:ID", doc.ID)
+		ref.leaf("cbc:DocumentDescription", doc.Description)
+		attachment := ref.elem("cac:Attachment")
+		if object := doc.Attachment; object != nil {
+			attachment.leaf("cbc:EmbeddedDocumentBinaryObject", base64.StdEncoding.EncodeToString(object.Data),
+				"mimeCode", object.MimeCode, "filename", object.Filename)
+		}
+		attachment.elem("cac:ExternalReference").leaf("cbc:URI", doc.URI)
+	}
+	if creditNote {
+		// A CreditNote has no project reference; it is sent as additional
+		// document reference with type 50 instead
+		if inv.ProjectReference != "" {
+			ref := root.elem("cac:AdditionalDocumentReference")
+			ref.leaf("cbc:ID", inv.ProjectReference)
+			ref.leaf("cbc:DocumentTypeCode", "50")
+		}
+		root.elem("cac:OriginatorDocumentReference").leaf("cbc:ID", inv.TenderReference)
+	} else {
+		root.elem("cac:ProjectReference").leaf("cbc:ID", inv.ProjectReference)
+	}
+
+	seller := inv.Seller
+	if debit := inv.PaymentInstructions.DirectDebit; debit != nil && debit.CreditorID != "" {
+		// The SEPA creditor identifier is a seller identifier in UBL
+		seller.Identifiers = append(append([]Identifier(nil), seller.Identifiers...), Identifier{ID: debit.CreditorID, Scheme: "SEPA"})
+	}
+	ublWriteParty(root.elem("cac:AccountingSupplierParty").elem("cac:Party"), seller)
+	ublWriteParty(root.elem("cac:AccountingCustomerParty").elem("cac:Party"), inv.Buyer)
+	if inv.Payee != nil {
+		payee := root.elem("cac:PayeeParty")
+		for _, id := range inv.Payee.Identifiers {
+			payee.elem("cac:PartyIdentification").leaf("cbc:ID", id.ID, "schemeID", id.Scheme)
+		}
+		payee.elem("cac:PartyName").leaf("cbc:Name", inv.Payee.Name)
+		payee.elem("cac:PartyLegalEntity").leaf("cbc:CompanyID", inv.Payee.LegalRegistrationID.ID, "schemeID", inv.Payee.LegalRegistrationID.Scheme)
+	}
+	if rep := inv.TaxRepresentative; rep != nil {
+		party := root.elem("cac:TaxRepresentativeParty")
+		party.elem("cac:PartyName").leaf("cbc:Name", rep.Name)
+		ublWriteAddress(party.elem("cac:PostalAddress"), rep.Address)
+		ublWriteTaxScheme(party, rep.VATID, "VAT")
+	}
+	if d := inv.Delivery; d != nil {
+		delivery := root.elem("cac:Delivery")
+		delivery.leaf("cbc:ActualDeliveryDate", d.Date.XSDate())
+		location := delivery.elem("cac:DeliveryLocation")
+		location.leaf("cbc:ID", d.LocationID.ID, "schemeID", d.LocationID.Scheme)
+		ublWriteAddress(location.elem("cac:Address"), d.Address)
+		delivery.elem("cac:DeliveryParty").elem("cac:PartyName").leaf("cbc:Name", d.PartyName)
+	}
+
+	ublWritePaymentMeans(root, inv, creditNote)
+	root.elem("cac:PaymentTerms").leaf("cbc:Note", inv.PaymentTerms)
+
+	for _, allowance := range inv.Allowances {
+		ublWriteAllowanceCharge(root, allowance, false, inv.CurrencyCode, true)
+	}
+	for _, charge := range inv.Charges {
+		ublWriteAllowanceCharge(root, charge, true, inv.CurrencyCode, true)
+	}
+
+	taxTotal := root.elem("cac:TaxTotal")
+	taxTotal.leaf("cbc:TaxAmount", inv.Totals.Tax.String(), "currencyID", inv.CurrencyCode)
+	for _, vat := range inv.VATBreakdown {
+		sub := taxTotal.elem("cac:TaxSubtotal")
+		sub.leaf("cbc:TaxableAmount", vat.TaxableAmount.String(), "currencyID", inv.CurrencyCode)
+		sub.leaf("cbc:TaxAmount", vat.TaxAmount.String(), "currencyID", inv.CurrencyCode)
+		category := sub.elem("cac:TaxCategory")
+		category.leaf("cbc:ID", string(vat.Category))
+		category.leaf("cbc:Percent", vat.Rate.String())
+		category.leaf("cbc:TaxExemptionReasonCode", vat.ExemptionReasonCode)
+		category.leaf("cbc:TaxExemptionReason", vat.ExemptionReason)
+		category.elem("cac:TaxScheme").leaf("cbc:ID", "VAT")
+	}
+	if inv.Totals.TaxAccounting.IsSet() {
+		root.elem("cac:TaxTotal").leaf("cbc:TaxAmount", inv.Totals.TaxAccounting.String(), "currencyID", inv.TaxCurrencyCode)
+	}
+
+	totals := inv.Totals
+	sums := root.elem("cac:LegalMonetaryTotal")
+	sums.leaf("cbc:LineExtensionAmount", totals.LineNet.String(), "currencyID", inv.CurrencyCode)
+	sums.leaf("cbc:TaxExclusiveAmount", totals.TaxBasis.String(), "currencyID", inv.CurrencyCode)
+	sums.leaf("cbc:TaxInclusiveAmount", totals.Grand.String(), "currencyID", inv.CurrencyCode)
+	sums.leaf("cbc:AllowanceTotalAmount", totals.Allowances.String(), "currencyID", inv.CurrencyCode)
+	sums.leaf("cbc:ChargeTotalAmount", totals.Charges.String(), "currencyID", inv.CurrencyCode)
+	sums.leaf("cbc:PrepaidAmount", totals.Prepaid.String(), "currencyID", inv.CurrencyCode)
+	sums.leaf("cbc:PayableRoundingAmount", totals.Rounding.String(), "currencyID", inv.CurrencyCode)
+	sums.leaf("cbc:PayableAmount", totals.DuePayable.String(), "currencyID", inv.CurrencyCode)
+
+	for _, line := range inv.Lines {
+		ublWriteLine(root.elem(lineName), line, quantityName, inv.CurrencyCode)
+	}
+	return marshalXML(root)
+}
+
+func ublWriteLine(node *xmlNode, line Line, quantityName, currency string) {
+	node.leaf("cbc:ID", line.ID)
+	node.leaf("cbc:Note", line.Note)
+	node.leaf(quantityName, line.Quantity.String(), "unitCode", line.UnitCode)
+	node.leaf("cbc:LineExtensionAmount", line.NetAmount.String(), "currencyID", currency)
+	node.leaf("cbc:AccountingCost", line.AccountingReference)
+	period := node.elem("cac:InvoicePeriod")
+	period.leaf("cbc:StartDate", line.Period.Start.XSDate())
+	period.leaf("cbc:EndDate", line.Period.End.XSDate())
+	node.elem("cac:OrderLineReference").leaf("cbc:LineID", line.OrderLineReference)
+	if line.ObjectID.IsSet() {
+		ref := node.elem("cac:DocumentReference")
+		ref.leaf("cbc:ID", line.ObjectID.ID, "schemeID", line.ObjectID.Scheme)
+		ref.leaf("cbc:DocumentTypeCode", "130")
+	}
+	for _, allowance := range line.Allowances {
+		ublWriteAllowanceCharge(node, allowance, false, currency, false)
+	}
+	for _, charge := range line.Charges {
+		ublWriteAllowanceCharge(node, charge, true, currency, false)
+	}
+
+	item := node.elem("cac:Item")
+	item.leaf("cbc:Description", line.Item.Description)
+	item.leaf("cbc:Name", line.Item.Name)
+	item.elem("cac:BuyersItemIdentification").leaf("cbc:ID", line.Item.BuyerID)
+	item.elem("cac:SellersItemIdentification").leaf("cbc:ID", line.Item.SellerID)
+	item.elem("cac:StandardItemIdentification").leaf("cbc:ID", line.Item.StandardID.ID, "schemeID", line.Item.StandardID.Scheme)
+	item.elem("cac:OriginCountry").leaf("cbc:IdentificationCode", line.Item.OriginCountry)
+	for _, class := range line.Item.Classifications {
+		item.elem("cac:CommodityClassification").leaf("cbc:ItemClassificationCode", class.ID,
+			"listID", class.Scheme, "listVersionID", class.SchemeVersion)
+	}
+	category := item.elem("cac:ClassifiedTaxCategory")
+	category.leaf("cbc:ID", string(line.VATCategory))
+	category.leaf("cbc:Percent", line.VATRate.String())
+	if line.VATCategory != "" {
+		category.elem("cac:TaxScheme").leaf("cbc:ID", "VAT")
+	}
+	for _, attribute := range line.Item.Attributes {
+		property := item.elem("cac:AdditionalItemProperty")
+		property.leaf("cbc:Name", attribute.Name)
+		property.leaf("cbc:Value", attribute.Value)
+	}
+
+	price := node.elem("cac:Price")
+	price.leaf("cbc:PriceAmount", line.Price.Net.String(), "currencyID", currency)
+	price.leaf("cbc:BaseQuantity", line.Price.BaseQuantity.String(), "unitCode", line.Price.BaseQuantityUnit)
+	if line.Price.Discount.IsSet() || line.Price.Gross.IsSet() {
+		discount := price.elem("cac:AllowanceCharge")
+		discount.leaf("cbc:ChargeIndicator", "false")
+		discount.leaf("cbc:Amount", line.Price.Discount.String(), "currencyID", currency)
+		discount.leaf("cbc:BaseAmount", line.Price.Gross.String(), "currencyID", currency)
+	}
+}
+
+func ublWriteParty(node *xmlNode, party Party) {
+	node.leaf("cbc:EndpointID", party.ElectronicAddress.ID, "schemeID", party.ElectronicAddress.Scheme)
+	for _, id := range party.Identifiers {
+		node.elem("cac:PartyIdentification").leaf("cbc:ID", id.ID, "schemeID", id.Scheme)
+	}
+	node.elem("cac:PartyName").leaf("cbc:Name", party.TradingName)
+	ublWriteAddress(node.elem("cac:PostalAddress"), party.Address)
+	ublWriteTaxScheme(node, party.VATID, "VAT")
+	ublWriteTaxScheme(node, party.TaxRegistrationID, "FC")
+
+	legal := node.elem("cac:PartyLegalEntity")
+	legal.leaf("cbc:RegistrationName", party.Name)
+	legal.leaf("cbc:CompanyID", party.LegalRegistrationID.ID, "schemeID", party.LegalRegistrationID.Scheme)
+	legal.leaf("cbc:CompanyLegalForm", party.AdditionalLegalInfo)
+
+	contact := node.elem("cac:Contact")
+	contact.leaf("cbc:Name", party.Contact.Name)
+	contact.leaf("cbc:Telephone", party.Contact.Phone)
+	contact.leaf("cbc:ElectronicMail", party.Contact.Email)
+}
+
+func ublWriteTaxScheme(party *xmlNode, companyID, scheme string) {
+	if companyID == "" {
+		return
+	}
+	taxScheme := party.elem("cac:PartyTaxScheme")
+	taxScheme.leaf("cbc:CompanyID", companyID)
+	taxScheme.elem("cac:TaxScheme").leaf("cbc:ID", scheme)
+}
+
+func ublWriteAddress(node *xmlNode, address Address) {
+	node.leaf("cbc:StreetName", address.Line1)
+	node.leaf("cbc:AdditionalStreetName", address.Line2)
+	node.leaf("cbc:CityName", address.City)
+	node.leaf("cbc:PostalZone", address.PostCode)
+	node.leaf("cbc:CountrySubentity", address.Subdivision)
+	node.elem("cac:AddressLine").leaf("cbc:Line", address.Line3)
+	node.elem("cac:Country").leaf("cbc:IdentificationCode", address.CountryCode)
+}
+
+func ublWritePaymentMeans(root *xmlNode, inv *Invoice, creditNote bool) {
+	payment := inv.PaymentInstructions
+	if payment.MeansCode == "" {
+		return
+	}
+	newMeans := func() *xmlNode {
+		means := root.elem("cac:PaymentMeans")
+		means.leaf("cbc:PaymentMeansCode", payment.MeansCode, "name", payment.MeansText)
+		if creditNote {
+			means.leaf("cbc:PaymentDueDate", inv.DueDate.XSDate())
+		}
+		means.leaf("cbc:PaymentID", payment.RemittanceInfo)
+		return means
+	}
+
+	means := newMeans()
+	if card := payment.Card; card != nil {
+		account := means.elem("cac:CardAccount")
+		account.leaf("cbc:PrimaryAccountNumberID", card.AccountNumber)
+		account.leaf("cbc:NetworkID", "NA") // Mandatory in UBL, not part of EN 16931
+		account.leaf("cbc:HolderName", card.HolderName)
+	}
+	for i, transfer := range payment.CreditTransfers {
+		if i > 0 {
+			means = newMeans()
+		}
+		account := means.elem("cac:PayeeFinancialAccount")
+		account.leaf("cbc:ID", transfer.AccountID)
+		account.leaf("cbc:Name", transfer.AccountName)
+		account.elem("cac:FinancialInstitutionBranch").leaf("cbc:ID", transfer.ProviderID)
+	}
+	if debit := payment.DirectDebit; debit != nil {
+		mandate := means.elem("cac:PaymentMandate")
+		mandate.leaf("cbc:ID", debit.MandateID)
+		mandate.elem("cac:PayerFinancialAccount").leaf("cbc:ID", debit.DebitedAccount)
+	}
+}
+
+func ublWriteAllowanceCharge(parent *xmlNode, ac AllowanceCharge, charge bool, currency string, header bool) {
+	node := parent.elem("cac:AllowanceCharge")
+	indicator := "false"
+	if charge {
+		indicator = "true"
+	}
+	node.leaf("cbc:ChargeIndicator", indicator)
+	node.leaf("cbc:AllowanceChargeReasonCode", ac.ReasonCode)
+	node.leaf("cbc:AllowanceChargeReason", ac.Reason)
+	node.leaf("cbc:MultiplierFactorNumeric", ac.Percentage.String())
+	node.leaf("cbc:Amount", ac.Amount.String(), "currencyID", currency)
+	node.leaf("cbc:BaseAmount", ac.BaseAmount.String(), "currencyID", currency)
+	if header {
+		category := node.elem("cac:TaxCategory")
+		category.leaf("cbc:ID", string(ac.VATCategory))
+		category.leaf("cbc:Percent", ac.VATRate.String())
+		if ac.VATCategory != "" {
+			category.elem("cac:TaxScheme").leaf("cbc:ID", "VAT")
+		}
+	}
+}
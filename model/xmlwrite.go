@@ -0,0 +1,91 @@
+package model
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+)
+
+// xmlNode is an element of a document being written. Elements without text
+// and without non-empty children are left out, so the writers can build the
+// full structure and let absent values vanish.
+type xmlNode struct {
+	name     string
+	attrs    []xml.Attr
+	text     string
+	children []*xmlNode
+}
+
+func newXMLNode(name string, attrs ...string) *xmlNode {
+	n := &xmlNode{name: name}
+	n.setAttrs(attrs)
+	return n
+}
+
+// setAttrs adds name/value pairs, skipping empty values.
+func (n *xmlNode) setAttrs(attrs []string) {
+	for i := 0; i+1 < len(attrs); i += 2 {
+		if attrs[i+1] != "" {
+			n.attrs = append(n.attrs, xml.Attr{Name: xml.Name{Local: attrs[i]}, Value: attrs[i+1]})
+		}
+	}
+}
+
+// elem appends a child element.
+func (n *xmlNode) elem(name string, attrs ...string) *xmlNode {
+	child := newXMLNode(name, attrs...)
+	n.children = append(n.children, child)
+	return child
+}
+
+// leaf appends a child element with text, unless value is empty.
+func (n *xmlNode) leaf(name, value string, attrs ...string) {
+	if value == "" {
+		return
+	}
+	n.elem(name, attrs...).text = value
+}
+
+func (n *xmlNode) empty() bool {
+	if n.text != "" {
+		return false
+	}
+	for _, child := range n.children {
+		if !child.empty() {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *xmlNode) write(b *bytes.Buffer, depth int) {
+	if n.empty() {
+		return
+	}
+	indent := strings.Repeat("  ", depth)
+	b.WriteString(indent + "<" + n.name)
+	for _, attr := range n.attrs {
+		b.WriteString(" " + attr.Name.Local + `="`)
+		xml.EscapeText(b, []byte(attr.Value))
+		b.WriteString(`"`)
+	}
+	b.WriteString(">")
+	if n.text != "" {
+		xml.EscapeText(b, []byte(n.text))
+	} else {
+		b.WriteString("\n")
+		for _, child := range n.children {
+			child.write(b, depth+1)
+		}
+		b.WriteString(indent)
+	}
+	b.WriteString("</" + n.name + ">\n")
+}
+
+// marshalXML returns the document with XML declaration.
+func marshalXML(root *xmlNode) []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	root.write(&b, 0)
+	return b.Bytes()
+}
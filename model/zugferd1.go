@@ -0,0 +1,173 @@
+package model
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// NamespaceZUGFeRD1 is the namespace of the ZUGFeRD 1.0 root element
+// CrossIndustryDocument.
+const NamespaceZUGFeRD1 = "urn:ferd:CrossIndustryDocument:invoice:1p0"
+
+// SourceZUGFeRD1 names ZUGFeRD 1.0 as source of a conversion report.
+const SourceZUGFeRD1 = "ZUGFeRD 1.0"
+
+// zugferd1Elements maps the ZUGFeRD 1.0 element names that were renamed in
+// CII D16B. Elements not listed kept their name.
+var zugferd1Elements = map[string]string{
+	"CrossIndustryDocument":                     "CrossIndustryInvoice",
+	"SpecifiedExchangedDocumentContext":         "ExchangedDocumentContext",
+	"HeaderExchangedDocument":                   "ExchangedDocument",
+	"SpecifiedSupplyChainTradeTransaction":      "SupplyChainTradeTransaction",
+	"ApplicableSupplyChainTradeAgreement":       "ApplicableHeaderTradeAgreement",
+	"ApplicableSupplyChainTradeDelivery":        "ApplicableHeaderTradeDelivery",
+	"ApplicableSupplyChainTradeSettlement":      "ApplicableHeaderTradeSettlement",
+	"SpecifiedSupplyChainTradeAgreement":        "SpecifiedLineTradeAgreement",
+	"SpecifiedSupplyChainTradeDelivery":         "SpecifiedLineTradeDelivery",
+	"SpecifiedSupplyChainTradeSettlement":       "SpecifiedLineTradeSettlement",
+	"SpecifiedLogisticsServiceCharge":           "SpecifiedTradeAllowanceCharge",
+	"ApplicablePercent":                         "RateApplicablePercent",
+	"SpecifiedTradeSettlementMonetarySummation": "SpecifiedTradeSettlementLineMonetarySummation",
+}
+
+// zugferd1Guidelines maps the ZUGFeRD 1.0 profiles to the specification
+// identifiers of ZUGFeRD 2.x; COMFORT became EN 16931.
+var zugferd1Guidelines = map[string]string{
+	"urn:ferd:CrossIndustryDocument:invoice:1p0:basic":    "urn:cen.eu:en16931:2017#compliant#urn:factur-x.eu:1p0:basic",
+	"urn:ferd:CrossIndustryDocument:invoice:1p0:comfort":  "urn:cen.eu:en16931:2017",
+	"urn:ferd:CrossIndustryDocument:invoice:1p0:extended": "urn:cen.eu:en16931:2017#conformant#urn:factur-x.eu:1p0:extended",
+}
+
+// zugferd1Name returns the CII D16B name of a ZUGFeRD 1.0 element.
+func zugferd1Name(parent, local string) string {
+	switch {
+	case local == "SpecifiedTradeSettlementMonetarySummation" && parent == "ApplicableSupplyChainTradeSettlement":
+		return "SpecifiedTradeSettlementHeaderMonetarySummation"
+	case local == "ID" && strings.HasSuffix(parent, "ReferencedDocument"):
+		return "IssuerAssignedID"
+	case local == "IssueDateTime" && strings.HasSuffix(parent, "ReferencedDocument"):
+		// The document date of references is a formatted date in D16B
+		return "FormattedIssueDateTime"
+	case parent == "SpecifiedLogisticsServiceCharge":
+		// Freight and similar costs are a document level charge in D16B
+		switch local {
+		case "Description":
+			return "Reason"
+		case "AppliedAmount":
+			return "ActualAmount"
+		case "AppliedTradeTax":
+			return "CategoryTradeTax"
+		}
+	}
+	if name, ok := zugferd1Elements[local]; ok {
+		return name
+	}
+	return local
+}
+
+// zugferd1Date returns an ISO 8601 date or date time as date in format 102
+// (CCYYMMDD). Other values are returned unchanged.
+func zugferd1Date(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) >= 10 && value[4] == '-' && value[7] == '-' {
+		return value[:4] + value[5:7] + value[8:10]
+	}
+	return value
+}
+
+// upgradeZUGFeRD1 renames the elements of a ZUGFeRD 1.0 document to CII
+// D16B and maps the profile. The result keeps the element order of the
+// source and has no namespaces; it is meant for ParseCII, which matches
+// local names only.
+func upgradeZUGFeRD1(data []byte) ([]byte, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var b bytes.Buffer
+	encoder := xml.NewEncoder(&b)
+	var source, target []string // Open elements by 1.0 and by D16B name
+	encode := func(token xml.Token) {
+		_ = encoder.EncodeToken(token) // Errors of the buffer surface at Flush
+	}
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error decoding XML: %w", err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			parent := ""
+			if len(source) > 0 {
+				parent = source[len(source)-1]
+			}
+			name := zugferd1Name(parent, t.Name.Local)
+			var attrs []xml.Attr
+			for _, attr := range t.Attr {
+				if attr.Name.Space == "" && attr.Name.Local != "xmlns" {
+					attrs = append(attrs, attr)
+				}
+			}
+			encode(xml.StartElement{Name: xml.Name{Local: name}, Attr: attrs})
+			source, target = append(source, t.Name.Local), append(target, name)
+			if t.Name.Local == "SpecifiedLogisticsServiceCharge" {
+				indicator := xml.Name{Local: "ChargeIndicator"}
+				encode(xml.StartElement{Name: indicator})
+				encode(xml.StartElement{Name: xml.Name{Local: "Indicator"}})
+				encode(xml.CharData("true"))
+				encode(xml.EndElement{Name: xml.Name{Local: "Indicator"}})
+				encode(xml.EndElement{Name: indicator})
+			}
+		case xml.EndElement:
+			if len(target) == 0 {
+				return nil, fmt.Errorf("error decoding XML: unexpected end element %s", t.Name.Local)
+			}
+			encode(xml.EndElement{Name: xml.Name{Local: target[len(target)-1]}})
+			source, target = source[:len(source)-1], target[:len(target)-1]
+		case xml.CharData:
+			if n := len(source); n >= 2 && source[n-1] == "IssueDateTime" && strings.HasSuffix(source[n-2], "ReferencedDocument") && strings.TrimSpace(string(t)) != "" {
+				// Plain xs:date or xs:dateTime values become a DateTimeString
+				dateTime := xml.Name{Local: "DateTimeString"}
+				encode(xml.StartElement{Name: dateTime, Attr: []xml.Attr{{Name: xml.Name{Local: "format"}, Value: "102"}}})
+				encode(xml.CharData(zugferd1Date(string(t))))
+				encode(xml.EndElement{Name: dateTime})
+				continue
+			}
+			if n := len(source); n >= 2 && source[n-1] == "ID" && source[n-2] == "GuidelineSpecifiedDocumentContextParameter" {
+				if guideline, ok := zugferd1Guidelines[strings.TrimSpace(string(t))]; ok {
+					t = xml.CharData(guideline)
+				}
+			}
+			if len(source) > 0 {
+				encode(t.Copy())
+			}
+		}
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// ParseZUGFeRD1 reads a ZUGFeRD 1.0 CrossIndustryDocument. The document is
+// upgraded to CII D16B first; the result reads like a ZUGFeRD 2.x invoice
+// of the corresponding profile.
+func ParseZUGFeRD1(r io.Reader) (*Invoice, error) {
+	return parseZUGFeRD1(r, &parser{})
+}
+
+func parseZUGFeRD1(r io.Reader, p *parser) (*Invoice, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading document: %w", err)
+	}
+	upgraded, err := upgradeZUGFeRD1(data)
+	if err != nil {
+		return nil, err
+	}
+	return parseCII(bytes.NewReader(upgraded), p)
+}
@@ -0,0 +1,123 @@
+package model
+
+import (
+	"bytes"
+	"encoding/xml"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The fixture follows the structure of the ZUGFeRD 1.0 COMFORT sample
+// invoice 471102; amounts and identifiers are made up to be consistent.
+const zugferd1Fixture = "testdata/zugferd1_comfort.xml"
+
+func TestUpgradeZUGFeRD1(t *testing.T) {
+	data, err := os.ReadFile(zugferd1Fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upgraded, err := upgradeZUGFeRD1(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths := make(map[string]string)
+	var stack []string
+	decoder := xml.NewDecoder(bytes.NewReader(upgraded))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name.Local)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if text := strings.TrimSpace(string(t)); text != "" {
+				paths[strings.Join(stack, "/")] = text
+			}
+		}
+	}
+
+	for _, name := range []string{"CrossIndustryDocument", "HeaderExchangedDocument", "ApplicableSupplyChainTradeSettlement", "SpecifiedLogisticsServiceCharge", "ApplicablePercent", "AppliedAmount"} {
+		if bytes.Contains(upgraded, []byte("<"+name+">")) {
+			t.Errorf("upgraded document still contains %s", name)
+		}
+	}
+
+	tests := map[string]string{
+		"CrossIndustryInvoice/ExchangedDocumentContext/GuidelineSpecifiedDocumentContextParameter/ID":                                                                                  "urn:cen.eu:en16931:2017",
+		"CrossIndustryInvoice/ExchangedDocument/IssueDateTime/DateTimeString":                                                                                                          "20130305",
+		"CrossIndustryInvoice/SupplyChainTradeTransaction/ApplicableHeaderTradeAgreement/BuyerOrderReferencedDocument/IssuerAssignedID":                                                "AB-312",
+		"CrossIndustryInvoice/SupplyChainTradeTransaction/ApplicableHeaderTradeAgreement/BuyerOrderReferencedDocument/FormattedIssueDateTime/DateTimeString":                           "20130301",
+		"CrossIndustryInvoice/SupplyChainTradeTransaction/ApplicableHeaderTradeSettlement/SpecifiedTradeAllowanceCharge/ChargeIndicator/Indicator":                                     "true",
+		"CrossIndustryInvoice/SupplyChainTradeTransaction/ApplicableHeaderTradeSettlement/SpecifiedTradeAllowanceCharge/ActualAmount":                                                  "5.80",
+		"CrossIndustryInvoice/SupplyChainTradeTransaction/ApplicableHeaderTradeSettlement/SpecifiedTradeAllowanceCharge/CategoryTradeTax/RateApplicablePercent":                        "19.00",
+		"CrossIndustryInvoice/SupplyChainTradeTransaction/ApplicableHeaderTradeSettlement/SpecifiedTradeSettlementHeaderMonetarySummation/GrandTotalAmount":                            "536.77",
+		"CrossIndustryInvoice/SupplyChainTradeTransaction/IncludedSupplyChainTradeLineItem/SpecifiedLineTradeSettlement/SpecifiedTradeSettlementLineMonetarySummation/LineTotalAmount": "275.00",
+	}
+	for path, want := range tests {
+		if got := paths[path]; got != want {
+			t.Errorf("%s = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestParseZUGFeRD1(t *testing.T) {
+	f, err := os.Open(zugferd1Fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	inv, err := ParseZUGFeRD1(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if inv.Number != "471102" {
+		t.Errorf("Number = %q", inv.Number)
+	}
+	if want := NewDate(2013, time.March, 5); inv.IssueDate != want {
+		t.Errorf("IssueDate = %v, want %v", inv.IssueDate, want)
+	}
+	if inv.SpecificationID != "urn:cen.eu:en16931:2017" {
+		t.Errorf("SpecificationID = %q", inv.SpecificationID)
+	}
+	if inv.PurchaseOrderReference != "AB-312" {
+		t.Errorf("PurchaseOrderReference = %q", inv.PurchaseOrderReference)
+	}
+	if inv.Seller.VATID != "DE136695976" || inv.Seller.TaxRegistrationID != "201/113/40209" {
+		t.Errorf("Seller tax IDs = %q, %q", inv.Seller.VATID, inv.Seller.TaxRegistrationID)
+	}
+	if len(inv.Charges) != 1 || inv.Charges[0].Amount.String() != "5.80" || inv.Charges[0].Reason != "Versandkosten" || inv.Charges[0].VATRate.String() != "19.00" {
+		t.Errorf("Charges = %+v", inv.Charges)
+	}
+	if len(inv.VATBreakdown) != 2 || inv.VATBreakdown[1].Rate.String() != "7.00" {
+		t.Errorf("VATBreakdown = %+v", inv.VATBreakdown)
+	}
+	if inv.Totals.Charges.String() != "5.80" || inv.Totals.Tax.String() != "57.97" || inv.Totals.DuePayable.String() != "536.77" {
+		t.Errorf("Totals = %+v", inv.Totals)
+	}
+	if len(inv.Lines) != 2 || inv.Lines[0].NetAmount.String() != "198.00" || inv.Lines[1].Quantity.String() != "50.0000" {
+		t.Errorf("Lines = %+v", inv.Lines)
+	}
+}
+
+func TestZUGFeRD1Date(t *testing.T) {
+	tests := map[string]string{
+		"2013-03-01":          "20130301",
+		"2013-03-01T00:00:00": "20130301",
+		" 2013-03-01 ":        "20130301",
+		"20130301":            "20130301",
+		"01.03.2013":          "01.03.2013",
+	}
+	for value, want := range tests {
+		if got := zugferd1Date(value); got != want {
+			t.Errorf("zugferd1Date(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
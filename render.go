@@ -0,0 +1,424 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"eBill-Convert/model"
+	"eBill-Convert/utils"
+)
+
+// viewField is one labelled value of a rendered invoice.
+type viewField struct {
+	Field   string
+	Label   string
+	Value   string
+	Problem string // Set if the value failed its check, e.g. "IBAN ungültig"
+
+	id string // Identifier shown in Value, compared with identifier issues
+}
+
+// viewSection groups the fields of one business group (BG) of EN 16931.
+// Sections of orders and despatch advices take their labels from their own
+// mapping.
+type viewSection struct {
+	Field  string
+	Title  string
+	Fields []viewField
+	labels map[string]string
+}
+
+func (s *viewSection) add(field, value string) {
+	s.addShown(field, value, value)
+}
+
+// addShown adds value, which shows the identifier id with its scheme or
+// other decoration.
+func (s *viewSection) addShown(field, value, id string) {
+	if value == "" {
+		return
+	}
+	s.Fields = append(s.Fields, viewField{Field: field, Label: s.label(field), Value: value, id: id})
+}
+
+func (s *viewSection) label(field string) string {
+	if label, ok := s.labels[field]; ok {
+		return label
+	}
+	return fieldLabel(field)
+}
+
+func (s *viewSection) addID(field string, id model.Identifier) {
+	if !id.IsSet() {
+		return
+	}
+	value := id.ID
+	if id.Scheme != "" {
+		value = fmt.Sprintf("%s (%s)", id.ID, id.Scheme)
+	}
+	s.addShown(field, value, id.ID)
+}
+
+// identifierProblems name the identifier checks of utils.IdentifierIssues.
+var identifierProblems = map[string]string{
+	"ID-IBAN":    "IBAN ungültig",
+	"ID-BIC":     "BIC ungültig",
+	"ID-VAT":     "USt-IdNr. ungültig",
+	"ID-STNR":    "Steuernummer ungültig",
+	"ID-GLN":     "GLN ungültig",
+	"ID-GTIN":    "GTIN ungültig",
+	"ID-LEITWEG": "Leitweg-ID ungültig",
+}
+
+// markIdentifiers marks the fields showing an identifier that failed its
+// check. Identifiers are compared without white space and case.
+func markIdentifiers(sections []viewSection, issues []utils.ValidationIssue) {
+	for _, issue := range issues {
+		value := normalizeShownID(issue.Value)
+		if value == "" {
+			continue
+		}
+		for i := range sections {
+			for j := range sections[i].Fields {
+				field := &sections[i].Fields[j]
+				if field.Field == issue.Field && normalizeShownID(field.id) == value {
+					field.Problem = identifierProblems[issue.Rule]
+				}
+			}
+		}
+	}
+}
+
+func normalizeShownID(id string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(id), ""))
+}
+
+// viewLocale is the locale of numbers and amounts in rendered invoices.
+const viewLocale = "de-DE"
+
+// addAmount adds an amount rounded to two decimals, e.g. "1.234,56 €".
+func (s *viewSection) addAmount(field string, value model.Decimal, currency string) {
+	s.add(field, model.NewMoney(value.RoundAmount(), currency).Format(viewLocale))
+}
+
+// addPrice adds an item price with two to four decimals.
+func (s *viewSection) addPrice(field string, value model.Decimal, currency string) {
+	s.add(field, model.NewMoney(value.RoundPrice(), currency).Format(viewLocale))
+}
+
+func (s *viewSection) addQuantity(field string, value model.Decimal) {
+	s.add(field, value.Format(viewLocale))
+}
+
+func (s *viewSection) addPercent(field string, value model.Decimal) {
+	if value.IsSet() {
+		s.add(field, value.Format(viewLocale)+" %")
+	}
+}
+
+func (s *viewSection) addDate(field string, value model.Date) {
+	s.add(field, value.Format(viewLocale))
+}
+
+// addressFields lists the business terms of lines 1 to 3, city, post code,
+// subdivision and country code of one party's address.
+type addressFields [7]string
+
+func (s *viewSection) addAddress(fields addressFields, address model.Address) {
+	values := []string{address.Line1, address.Line2, address.Line3, address.City, address.PostCode, address.Subdivision, address.CountryCode}
+	for i, value := range values {
+		s.add(fields[i], value)
+	}
+}
+
+// invoiceView lays out the invoice as the list of sections shared by the PDF
+// and HTML renderers. Empty sections are left out.
+func invoiceView(inv *model.Invoice) []viewSection {
+	// Load CSV if not already loaded
+	loadCSV()
+
+	var sections []viewSection
+	appendSection := func(section viewSection) {
+		if len(section.Fields) > 0 {
+			sections = append(sections, section)
+		}
+	}
+	newSection := func(field string, index, count int) viewSection {
+		title := fieldLabel(field)
+		if count > 1 {
+			title = fmt.Sprintf("%s %d", title, index+1)
+		}
+		return viewSection{Field: field, Title: title}
+	}
+
+	document := newSection("BG-0", 0, 1)
+	document.add("BT-1", inv.Number)
+	document.addDate("BT-2", inv.IssueDate)
+	document.add("BT-3", string(inv.TypeCode))
+	document.add("BT-5", inv.CurrencyCode)
+	document.add("BT-6", inv.TaxCurrencyCode)
+	document.addDate("BT-7", inv.TaxPointDate)
+	document.add("BT-8", inv.TaxPointDateCode)
+	document.addDate("BT-9", inv.DueDate)
+	document.add("BT-10", inv.BuyerReference)
+	document.add("BT-11", inv.ProjectReference)
+	document.add("BT-12", inv.ContractReference)
+	document.add("BT-13", inv.PurchaseOrderReference)
+	document.add("BT-14", inv.SalesOrderReference)
+	document.add("BT-15", inv.ReceivingAdviceReference)
+	document.add("BT-16", inv.DespatchAdviceReference)
+	document.add("BT-17", inv.TenderReference)
+	document.addID("BT-18", inv.InvoicedObject)
+	document.add("BT-19", inv.BuyerAccountingReference)
+	document.add("BT-20", inv.PaymentTerms)
+	appendSection(document)
+
+	for i, note := range inv.Notes {
+		section := newSection("BG-1", i, len(inv.Notes))
+		section.add("BT-21", note.SubjectCode)
+		section.add("BT-22", note.Text)
+		appendSection(section)
+	}
+
+	process := newSection("BG-2", 0, 1)
+	process.add("BT-23", inv.BusinessProcess)
+	specification := inv.SpecificationID
+	if profile := utils.ProfileName(specification); profile != specification {
+		specification = fmt.Sprintf("%s (%s)", specification, profile)
+	}
+	process.add("BT-24", specification)
+	appendSection(process)
+
+	for i, preceding := range inv.PrecedingInvoices {
+		section := newSection("BG-3", i, len(inv.PrecedingInvoices))
+		section.add("BT-25", preceding.Number)
+		section.addDate("BT-26", preceding.IssueDate)
+		appendSection(section)
+	}
+
+	seller := newSection("BG-4", 0, 1)
+	seller.add("BT-27", inv.Seller.Name)
+	seller.add("BT-28", inv.Seller.TradingName)
+	for _, id := range inv.Seller.Identifiers {
+		seller.addID("BT-29", id)
+	}
+	seller.addID("BT-30", inv.Seller.LegalRegistrationID)
+	seller.add("BT-31", inv.Seller.VATID)
+	seller.add("BT-32", inv.Seller.TaxRegistrationID)
+	seller.add("BT-33", inv.Seller.AdditionalLegalInfo)
+	seller.addShown("BT-34", utils.EndpointName(inv.Seller.ElectronicAddress), inv.Seller.ElectronicAddress.ID)
+	seller.addAddress(addressFields{"BT-35", "BT-36", "BT-162", "BT-37", "BT-38", "BT-39", "BT-40"}, inv.Seller.Address)
+	seller.add("BT-41", inv.Seller.Contact.Name)
+	seller.add("BT-42", inv.Seller.Contact.Phone)
+	seller.add("BT-43", inv.Seller.Contact.Email)
+	appendSection(seller)
+
+	buyer := newSection("BG-7", 0, 1)
+	buyer.add("BT-44", inv.Buyer.Name)
+	buyer.add("BT-45", inv.Buyer.TradingName)
+	for _, id := range inv.Buyer.Identifiers {
+		buyer.addID("BT-46", id)
+	}
+	buyer.addID("BT-47", inv.Buyer.LegalRegistrationID)
+	buyer.add("BT-48", inv.Buyer.VATID)
+	buyer.addShown("BT-49", utils.EndpointName(inv.Buyer.ElectronicAddress), inv.Buyer.ElectronicAddress.ID)
+	buyer.addAddress(addressFields{"BT-50", "BT-51", "BT-163", "BT-52", "BT-53", "BT-54", "BT-55"}, inv.Buyer.Address)
+	buyer.add("BT-56", inv.Buyer.Contact.Name)
+	buyer.add("BT-57", inv.Buyer.Contact.Phone)
+	buyer.add("BT-58", inv.Buyer.Contact.Email)
+	appendSection(buyer)
+
+	if payee := inv.Payee; payee != nil {
+		section := newSection("BG-10", 0, 1)
+		section.add("BT-59", payee.Name)
+		for _, id := range payee.Identifiers {
+			section.addID("BT-60", id)
+		}
+		section.addID("BT-61", payee.LegalRegistrationID)
+		appendSection(section)
+	}
+
+	if representative := inv.TaxRepresentative; representative != nil {
+		section := newSection("BG-11", 0, 1)
+		section.add("BT-62", representative.Name)
+		section.add("BT-63", representative.VATID)
+		section.addAddress(addressFields{"BT-64", "BT-65", "BT-164", "BT-66", "BT-67", "BT-68", "BT-69"}, representative.Address)
+		appendSection(section)
+	}
+
+	if delivery := inv.Delivery; delivery != nil {
+		section := newSection("BG-13", 0, 1)
+		section.add("BT-70", delivery.PartyName)
+		section.addID("BT-71", delivery.LocationID)
+		section.addDate("BT-72", delivery.Date)
+		section.addAddress(addressFields{"BT-75", "BT-76", "BT-165", "BT-77", "BT-78", "BT-79", "BT-80"}, delivery.Address)
+		appendSection(section)
+	}
+
+	period := newSection("BG-14", 0, 1)
+	period.addDate("BT-73", inv.InvoicingPeriod.Start)
+	period.addDate("BT-74", inv.InvoicingPeriod.End)
+	appendSection(period)
+
+	payment := inv.PaymentInstructions
+	instructions := newSection("BG-16", 0, 1)
+	instructions.add("BT-81", payment.MeansCode)
+	instructions.add("BT-82", payment.MeansText)
+	instructions.add("BT-83", payment.RemittanceInfo)
+	for _, transfer := range payment.CreditTransfers {
+		instructions.add("BT-84", transfer.AccountID)
+		instructions.add("BT-85", transfer.AccountName)
+		instructions.add("BT-86", transfer.ProviderID)
+	}
+	if card := payment.Card; card != nil {
+		instructions.add("BT-87", card.AccountNumber)
+		instructions.add("BT-88", card.HolderName)
+	}
+	if debit := payment.DirectDebit; debit != nil {
+		instructions.add("BT-89", debit.MandateID)
+		instructions.add("BT-90", debit.CreditorID)
+		instructions.add("BT-91", debit.DebitedAccount)
+	}
+	appendSection(instructions)
+
+	for i, allowance := range inv.Allowances {
+		section := newSection("BG-20", i, len(inv.Allowances))
+		section.addAmount("BT-92", allowance.Amount, inv.CurrencyCode)
+		section.addAmount("BT-93", allowance.BaseAmount, inv.CurrencyCode)
+		section.addPercent("BT-94", allowance.Percentage)
+		section.add("BT-95", string(allowance.VATCategory))
+		section.addPercent("BT-96", allowance.VATRate)
+		section.add("BT-97", allowance.Reason)
+		section.add("BT-98", allowance.ReasonCode)
+		appendSection(section)
+	}
+	for i, charge := range inv.Charges {
+		section := newSection("BG-21", i, len(inv.Charges))
+		section.addAmount("BT-99", charge.Amount, inv.CurrencyCode)
+		section.addAmount("BT-100", charge.BaseAmount, inv.CurrencyCode)
+		section.addPercent("BT-101", charge.Percentage)
+		section.add("BT-102", string(charge.VATCategory))
+		section.addPercent("BT-103", charge.VATRate)
+		section.add("BT-104", charge.Reason)
+		section.add("BT-105", charge.ReasonCode)
+		appendSection(section)
+	}
+
+	totals := newSection("BG-22", 0, 1)
+	totals.addAmount("BT-106", inv.Totals.LineNet, inv.CurrencyCode)
+	totals.addAmount("BT-107", inv.Totals.Allowances, inv.CurrencyCode)
+	totals.addAmount("BT-108", inv.Totals.Charges, inv.CurrencyCode)
+	totals.addAmount("BT-109", inv.Totals.TaxBasis, inv.CurrencyCode)
+	totals.addAmount("BT-110", inv.Totals.Tax, inv.CurrencyCode)
+	totals.addAmount("BT-111", inv.Totals.TaxAccounting, inv.TaxCurrencyCode)
+	totals.addAmount("BT-112", inv.Totals.Grand, inv.CurrencyCode)
+	totals.addAmount("BT-113", inv.Totals.Prepaid, inv.CurrencyCode)
+	totals.addAmount("BT-114", inv.Totals.Rounding, inv.CurrencyCode)
+	totals.addAmount("BT-115", inv.Totals.DuePayable, inv.CurrencyCode)
+	appendSection(totals)
+
+	for i, vat := range inv.VATBreakdown {
+		section := newSection("BG-23", i, len(inv.VATBreakdown))
+		section.addAmount("BT-116", vat.TaxableAmount, inv.CurrencyCode)
+		section.addAmount("BT-117", vat.TaxAmount, inv.CurrencyCode)
+		section.add("BT-118", string(vat.Category))
+		section.addPercent("BT-119", vat.Rate)
+		section.add("BT-120", vat.ExemptionReason)
+		section.add("BT-121", vat.ExemptionReasonCode)
+		appendSection(section)
+	}
+
+	for i, doc := range inv.SupportingDocuments {
+		section := newSection("BG-24", i, len(inv.SupportingDocuments))
+		section.add("BT-122", doc.ID)
+		section.add("BT-123", doc.Description)
+		section.add("BT-124", doc.URI)
+		if doc.Attachment != nil {
+			section.add("BT-125", doc.Attachment.Filename)
+		}
+		appendSection(section)
+	}
+
+	for i, line := range inv.Lines {
+		section := newSection("BG-25", i, len(inv.Lines))
+		section.add("BT-126", line.ID)
+		section.add("BT-127", line.Note)
+		section.addID("BT-128", line.ObjectID)
+		section.addQuantity("BT-129", line.Quantity)
+		section.add("BT-130", line.UnitCode)
+		section.addAmount("BT-131", line.NetAmount, inv.CurrencyCode)
+		section.add("BT-132", line.OrderLineReference)
+		section.add("BT-133", line.AccountingReference)
+		section.addDate("BT-134", line.Period.Start)
+		section.addDate("BT-135", line.Period.End)
+		for _, allowance := range line.Allowances {
+			section.addAmount("BT-136", allowance.Amount, inv.CurrencyCode)
+			section.add("BT-139", allowance.Reason)
+		}
+		for _, charge := range line.Charges {
+			section.addAmount("BT-141", charge.Amount, inv.CurrencyCode)
+			section.add("BT-144", charge.Reason)
+		}
+		section.addPrice("BT-146", line.Price.Net, inv.CurrencyCode)
+		section.addPrice("BT-147", line.Price.Discount, inv.CurrencyCode)
+		section.addPrice("BT-148", line.Price.Gross, inv.CurrencyCode)
+		section.addQuantity("BT-149", line.Price.BaseQuantity)
+		section.add("BT-150", line.Price.BaseQuantityUnit)
+		section.add("BT-151", string(line.VATCategory))
+		section.addPercent("BT-152", line.VATRate)
+		section.add("BT-153", line.Item.Name)
+		section.add("BT-154", line.Item.Description)
+		section.add("BT-155", line.Item.SellerID)
+		section.add("BT-156", line.Item.BuyerID)
+		section.addID("BT-157", line.Item.StandardID)
+		for _, classification := range line.Item.Classifications {
+			section.addID("BT-158", classification)
+		}
+		section.add("BT-159", line.Item.OriginCountry)
+		for _, attribute := range line.Item.Attributes {
+			section.Fields = append(section.Fields, viewField{Field: "BT-160", Label: attribute.Name, Value: attribute.Value})
+		}
+		appendSection(section)
+	}
+
+	return sections
+}
+
+// envelopeView shows the transmission data of an SBDH envelope; without
+// envelope it is empty.
+func envelopeView(h *utils.SBDH) []viewSection {
+	if h == nil {
+		return nil
+	}
+	section := viewSection{Title: "Übermittlung (SBDH)"}
+	add := func(label, value string) {
+		if value != "" {
+			section.Fields = append(section.Fields, viewField{Label: label, Value: value})
+		}
+	}
+	add("Absender", h.Sender.Identifier.Value)
+	add("Empfänger", h.Receiver.Identifier.Value)
+	add("Nachrichtenkennung", h.DocumentIdentification.InstanceIdentifier)
+	add("Erstellt", h.DocumentIdentification.CreationDateAndTime)
+	documentType := h.Scope("DOCUMENTID")
+	if documentType == "" {
+		documentType = h.DocumentIdentification.Type
+	}
+	add("Dokumenttyp", documentType)
+	add("Prozess", h.Scope("PROCESSID"))
+	return []viewSection{section}
+}
+
+// fieldLabel returns the German label of a business term from
+// translations.csv. Its codes are assigned per XML path, so the first row
+// of the term is taken.
+func fieldLabel(field string) string {
+	csvMutex.RLock()
+	defer csvMutex.RUnlock()
+	for _, mapping := range csvData {
+		if mapping.Field == field {
+			return mapping.GermanLabel
+		}
+	}
+	return field
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"fmt"
+
+	"eBill-Convert/model"
+	"eBill-Convert/utils"
+)
+
+// viewBuilder collects the non-empty sections of an order or despatch
+// advice, labelled from one label mapping.
+type viewBuilder struct {
+	labels   map[string]string
+	sections []viewSection
+}
+
+func (b *viewBuilder) section(field string, index, count int) viewSection {
+	title := b.labels[field]
+	if count > 1 {
+		title = fmt.Sprintf("%s %d", title, index+1)
+	}
+	return viewSection{Field: field, Title: title, labels: b.labels}
+}
+
+func (b *viewBuilder) append(section viewSection) {
+	if len(section.Fields) > 0 {
+		b.sections = append(b.sections, section)
+	}
+}
+
+// addCode adds a code followed by its meaning, e.g. "220 (Bestellung)".
+func (s *viewSection) addCode(field, code string, names map[string]string) {
+	if name, ok := names[code]; ok {
+		code = fmt.Sprintf("%s (%s)", code, name)
+	}
+	s.add(field, code)
+}
+
+// addParty adds the fields of an order or despatch advice party.
+func (s *viewSection) addParty(party model.Party) {
+	s.add("party.name", party.Name)
+	s.add("party.tradingName", party.TradingName)
+	for _, id := range party.Identifiers {
+		s.addID("party.id", id)
+	}
+	s.addID("party.legalId", party.LegalRegistrationID)
+	s.add("party.vatId", party.VATID)
+	s.add("party.taxId", party.TaxRegistrationID)
+	s.add("party.endpoint", utils.EndpointName(party.ElectronicAddress))
+	s.addAddress(addressFields{"address.line1", "address.line2", "address.line3", "address.city", "address.postCode", "address.subdivision", "address.country"}, party.Address)
+	s.add("contact.name", party.Contact.Name)
+	s.add("contact.phone", party.Contact.Phone)
+	s.add("contact.email", party.Contact.Email)
+}
+
+func (s *viewSection) addItem(item model.Item) {
+	s.add("item.name", item.Name)
+	s.add("item.description", item.Description)
+	s.add("item.sellerId", item.SellerID)
+	s.add("item.buyerId", item.BuyerID)
+	s.addID("item.standardId", item.StandardID)
+	s.add("item.originCountry", item.OriginCountry)
+}
+
+func (b *viewBuilder) notes(field string, notes []model.Note) {
+	for i, note := range notes {
+		section := b.section(field, i, len(notes))
+		section.add("note.subject", note.SubjectCode)
+		section.add("note.text", note.Text)
+		b.append(section)
+	}
+}
+
+func (b *viewBuilder) process(businessProcess, specificationID string) {
+	section := b.section("process", 0, 1)
+	section.add("process.id", businessProcess)
+	section.add("process.specification", specificationID)
+	b.append(section)
+}
+
+// orderTitle is the name of an order by its type code.
+func orderTitle(order *model.Order) string {
+	if title, ok := orderTypes[order.TypeCode]; ok {
+		return title
+	}
+	return orderTypes[model.OrderTypeOrder]
+}
+
+// orderView lays out an order, order change or order response as
+// the list of sections shared by the PDF and HTML renderers.
+func orderView(order *model.Order) []viewSection {
+	b := &viewBuilder{labels: orderLabels}
+	currency := order.CurrencyCode
+
+	document := b.section("order", 0, 1)
+	document.Title = orderTitle(order)
+	document.add("order.number", order.Number)
+	document.addDate("order.date", order.IssueDate)
+	document.addCode("order.type", order.TypeCode, orderTypes)
+	document.add("order.currency", currency)
+	document.add("order.buyerReference", order.BuyerReference)
+	document.add("order.reference", order.OrderReference)
+	document.add("order.salesOrder", order.SalesOrderReference)
+	document.add("order.contract", order.ContractReference)
+	document.add("order.quotation", order.QuotationReference)
+	document.addDate("order.deliveryDate", order.DeliveryDate)
+	document.add("order.paymentTerms", order.PaymentTerms)
+	b.append(document)
+
+	b.notes("note", order.Notes)
+	b.process(order.BusinessProcess, order.SpecificationID)
+
+	seller := b.section("seller", 0, 1)
+	seller.addParty(order.Seller)
+	b.append(seller)
+	buyer := b.section("buyer", 0, 1)
+	buyer.addParty(order.Buyer)
+	b.append(buyer)
+	if order.ShipTo != nil {
+		shipTo := b.section("shipTo", 0, 1)
+		shipTo.addParty(*order.ShipTo)
+		b.append(shipTo)
+	}
+
+	allowanceCharges := func(field string, acs []model.AllowanceCharge) {
+		for i, ac := range acs {
+			section := b.section(field, i, len(acs))
+			section.addAmount("ac.amount", ac.Amount, currency)
+			section.addAmount("ac.baseAmount", ac.BaseAmount, currency)
+			section.addPercent("ac.percentage", ac.Percentage)
+			section.add("ac.vatCategory", string(ac.VATCategory))
+			section.addPercent("ac.vatRate", ac.VATRate)
+			section.add("ac.reason", ac.Reason)
+			section.add("ac.reasonCode", ac.ReasonCode)
+			b.append(section)
+		}
+	}
+	allowanceCharges("allowance", order.Allowances)
+	allowanceCharges("charge", order.Charges)
+
+	totals := b.section("totals", 0, 1)
+	totals.addAmount("totals.lineNet", order.Totals.LineNet, currency)
+	totals.addAmount("totals.allowances", order.Totals.Allowances, currency)
+	totals.addAmount("totals.charges", order.Totals.Charges, currency)
+	totals.addAmount("totals.taxBasis", order.Totals.TaxBasis, currency)
+	totals.addAmount("totals.tax", order.Totals.Tax, currency)
+	totals.addAmount("totals.grand", order.Totals.Grand, currency)
+	b.append(totals)
+
+	for i, line := range order.Lines {
+		section := b.section("line", i, len(order.Lines))
+		section.add("line.id", line.ID)
+		section.add("line.note", line.Note)
+		section.addCode("line.status", line.StatusCode, orderLineStatus)
+		section.addQuantity("line.quantity", line.Quantity)
+		section.addQuantity("line.agreedQuantity", line.AgreedQuantity)
+		section.add("line.unit", line.UnitCode)
+		section.addDate("line.deliveryDate", line.DeliveryDate)
+		section.addPrice("line.netPrice", line.Price.Net, currency)
+		section.addPrice("line.grossPrice", line.Price.Gross, currency)
+		section.addQuantity("line.baseQuantity", line.Price.BaseQuantity)
+		section.addAmount("line.netAmount", line.NetAmount, currency)
+		section.add("line.vatCategory", string(line.VATCategory))
+		section.addPercent("line.vatRate", line.VATRate)
+		section.addItem(line.Item)
+		for _, attribute := range line.Item.Attributes {
+			section.Fields = append(section.Fields, viewField{Field: "item.attribute", Label: attribute.Name, Value: attribute.Value})
+		}
+		b.append(section)
+	}
+
+	return b.sections
+}
+
+// despatchView lays out a UBL despatch advice as the list of sections
+// shared by the PDF and HTML renderers.
+func despatchView(advice *model.DespatchAdvice) []viewSection {
+	b := &viewBuilder{labels: despatchLabels}
+
+	document := b.section("despatch", 0, 1)
+	document.add("despatch.number", advice.Number)
+	document.addDate("despatch.date", advice.IssueDate)
+	document.add("despatch.order", advice.OrderReference)
+	b.append(document)
+
+	b.notes("note", advice.Notes)
+	b.process(advice.BusinessProcess, advice.SpecificationID)
+
+	parties := []struct {
+		field string
+		party *model.Party
+	}{
+		{"supplier", &advice.Supplier},
+		{"customer", &advice.Customer},
+		{"seller", advice.Seller},
+		{"buyer", advice.Buyer},
+	}
+	for _, p := range parties {
+		if p.party != nil {
+			section := b.section(p.field, 0, 1)
+			section.addParty(*p.party)
+			b.append(section)
+		}
+	}
+
+	shipment := advice.Shipment
+	section := b.section("shipment", 0, 1)
+	section.add("shipment.id", shipment.ID)
+	if shipment.GrossWeight.IsSet() {
+		section.add("shipment.grossWeight", fmt.Sprintf("%s %s", shipment.GrossWeight.Format(viewLocale), shipment.WeightUnit))
+	}
+	section.addDate("shipment.despatchDate", shipment.DespatchDate)
+	section.addDate("shipment.deliveryStart", shipment.DeliveryPeriod.Start)
+	section.addDate("shipment.deliveryEnd", shipment.DeliveryPeriod.End)
+	section.addAddress(addressFields{"address.line1", "address.line2", "address.line3", "address.city", "address.postCode", "address.subdivision", "address.country"}, shipment.DeliveryAddress)
+	section.add("shipment.carrier", shipment.Carrier)
+	b.append(section)
+
+	for i, line := range advice.Lines {
+		section := b.section("line", i, len(advice.Lines))
+		section.add("line.id", line.ID)
+		section.add("line.note", line.Note)
+		section.addQuantity("line.quantity", line.Quantity)
+		section.add("line.unit", line.UnitCode)
+		section.addQuantity("line.outstandingQuantity", line.OutstandingQuantity)
+		section.add("line.outstandingReason", line.OutstandingReason)
+		section.add("line.order", line.OrderReference)
+		section.add("line.orderLine", line.OrderLineReference)
+		section.addItem(line.Item)
+		section.add("line.lotNumber", line.LotNumber)
+		section.addDate("line.expiryDate", line.ExpiryDate)
+		b.append(section)
+	}
+
+	return b.sections
+}
+
+// orderTypes are the German names of the Order-X document types.
+var orderTypes = map[string]string{
+	model.OrderTypeOrder:    "Bestellung",
+	model.OrderTypeChange:   "Bestelländerung",
+	model.OrderTypeResponse: "Auftragsbestätigung",
+}
+
+// orderLineStatus are the German names of the UNTDID 1229 line status codes
+// of order changes and responses.
+var orderLineStatus = map[string]string{
+	"1":  "hinzugefügt",
+	"3":  "geändert",
+	"5":  "angenommen",
+	"6":  "mit Änderungen angenommen",
+	"7":  "abgelehnt",
+	"42": "bereits geliefert",
+}
+
+// withCommonLabels adds the labels of parties, addresses, items, notes and
+// process shared by orders and despatch advices.
+func withCommonLabels(labels map[string]string) map[string]string {
+	common := map[string]string{
+		"note":                  "Bemerkung",
+		"note.subject":          "Code für den Betreff der Bemerkung",
+		"note.text":             "Bemerkung",
+		"process":               "Prozesssteuerung",
+		"process.id":            "Geschäftsprozesstyp",
+		"process.specification": "Spezifikationskennung",
+		"party.name":            "Name",
+		"party.tradingName":     "Handelsname",
+		"party.id":              "Kennung",
+		"party.legalId":         "Registernummer",
+		"party.vatId":           "Umsatzsteuer-Identifikationsnummer",
+		"party.taxId":           "Steuernummer",
+		"party.endpoint":        "Elektronische Adresse",
+		"address.line1":         "Straße und Hausnummer",
+		"address.line2":         "Adresszusatz",
+		"address.line3":         "Adresszeile 3",
+		"address.city":          "Ort",
+		"address.postCode":      "Postleitzahl",
+		"address.subdivision":   "Bundesland",
+		"address.country":       "Ländercode",
+		"contact.name":          "Ansprechpartner",
+		"contact.phone":         "Telefon",
+		"contact.email":         "E-Mail",
+		"item.name":             "Artikelname",
+		"item.description":      "Artikelbeschreibung",
+		"item.sellerId":         "Artikelnummer des Verkäufers",
+		"item.buyerId":          "Artikelnummer des Käufers",
+		"item.standardId":       "Artikelkennung",
+		"item.originCountry":    "Ursprungsland",
+		"line.id":               "Positionsnummer",
+		"line.note":             "Bemerkung zur Position",
+		"line.unit":             "Einheit",
+	}
+	for field, label := range common {
+		labels[field] = label
+	}
+	return labels
+}
+
+// orderLabels are the German labels of orders, order changes and order
+// responses.
+var orderLabels = withCommonLabels(map[string]string{
+	"order":                "Bestellung",
+	"order.number":         "Belegnummer",
+	"order.date":           "Belegdatum",
+	"order.type":           "Code für den Belegtyp",
+	"order.currency":       "Code für die Währung",
+	"order.buyerReference": "Käuferreferenz",
+	"order.reference":      "Bezug auf Bestellung",
+	"order.salesOrder":     "Auftragsnummer des Verkäufers",
+	"order.contract":       "Vertragsreferenz",
+	"order.quotation":      "Angebotsreferenz",
+	"order.deliveryDate":   "Gewünschtes Lieferdatum",
+	"order.paymentTerms":   "Zahlungsbedingungen",
+	"seller":               "Verkäufer",
+	"buyer":                "Käufer",
+	"shipTo":               "Lieferanschrift",
+	"allowance":            "Nachlass auf Dokumentenebene",
+	"charge":               "Zuschlag auf Dokumentenebene",
+	"ac.amount":            "Betrag",
+	"ac.baseAmount":        "Grundbetrag",
+	"ac.percentage":        "Prozentsatz",
+	"ac.vatCategory":       "Umsatzsteuerkategorie",
+	"ac.vatRate":           "Umsatzsteuersatz",
+	"ac.reason":            "Grund",
+	"ac.reasonCode":        "Code für den Grund",
+	"totals":               "Gesamtbeträge",
+	"totals.lineNet":       "Summe der Nettobeträge aller Positionen",
+	"totals.allowances":    "Summe der Nachlässe",
+	"totals.charges":       "Summe der Zuschläge",
+	"totals.taxBasis":      "Gesamtbetrag ohne Umsatzsteuer",
+	"totals.tax":           "Umsatzsteuer",
+	"totals.grand":         "Gesamtbetrag einschließlich Umsatzsteuer",
+	"line":                 "Bestellposition",
+	"line.status":          "Status der Position",
+	"line.quantity":        "Bestellte Menge",
+	"line.agreedQuantity":  "Bestätigte Menge",
+	"line.deliveryDate":    "Gewünschtes Lieferdatum",
+	"line.netPrice":        "Nettopreis",
+	"line.grossPrice":      "Bruttopreis",
+	"line.baseQuantity":    "Basismenge",
+	"line.netAmount":       "Nettobetrag",
+	"line.vatCategory":     "Umsatzsteuerkategorie",
+	"line.vatRate":         "Umsatzsteuersatz",
+})
+
+// despatchLabels are the German labels of despatch advices.
+var despatchLabels = withCommonLabels(map[string]string{
+	"despatch":                 "Lieferavis",
+	"despatch.number":          "Nummer des Lieferavis",
+	"despatch.date":            "Ausstellungsdatum",
+	"despatch.order":           "Bestellreferenz",
+	"supplier":                 "Lieferant",
+	"customer":                 "Warenempfänger",
+	"seller":                   "Verkäufer",
+	"buyer":                    "Käufer",
+	"shipment":                 "Sendung",
+	"shipment.id":              "Sendungsnummer",
+	"shipment.grossWeight":     "Bruttogewicht",
+	"shipment.despatchDate":    "Versanddatum",
+	"shipment.deliveryStart":   "Voraussichtliche Lieferung ab",
+	"shipment.deliveryEnd":     "Voraussichtliche Lieferung bis",
+	"shipment.carrier":         "Spediteur",
+	"line":                     "Lieferposition",
+	"line.quantity":            "Gelieferte Menge",
+	"line.outstandingQuantity": "Ausstehende Menge",
+	"line.outstandingReason":   "Grund für die ausstehende Menge",
+	"line.order":               "Bestellreferenz",
+	"line.orderLine":           "Referenz zur Bestellposition",
+	"line.lotNumber":           "Chargennummer",
+	"line.expiryDate":          "Verfallsdatum",
+})
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"eBill-Convert/model"
+	"eBill-Convert/utils"
+)
+
+func TestMarkIdentifiers(t *testing.T) {
+	var section viewSection
+	section.addID("BT-29", model.Identifier{ID: "4000001000006", Scheme: "0088"})
+	section.addID("BT-29", model.Identifier{ID: "40000010000061", Scheme: "0088"})
+	section.add("BT-84", "DE89 3704 0044 0532 0130 01")
+	section.add("BT-31", "DE136695976")
+	issues := []utils.ValidationIssue{
+		{Rule: "ID-GLN", Field: "BT-29", Value: "4000001000006"},
+		{Rule: "ID-IBAN", Field: "BT-84", Value: "de89370400440532013001"},
+		{Rule: "ID-VAT", Field: "BT-31", Value: ""}, // Matches no field
+	}
+	markIdentifiers([]viewSection{section}, issues)
+
+	want := []string{"GLN ungültig", "", "IBAN ungültig", ""}
+	for i, field := range section.Fields {
+		if field.Problem != want[i] {
+			t.Errorf("%s %q: problem %q, want %q", field.Field, field.Value, field.Problem, want[i])
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"eBill-Convert/utils"
+)
+
+// xmlDocumentView lays out any XML document element by element, labelled
+// from translations.csv. It shows the documents without semantic view,
+// such as XR documents, and those whose semantic view cannot be built.
+func xmlDocumentView(xmlData []byte, envelope *utils.SBDH) (*documentView, error) {
+	loadCSV()
+
+	view := &documentView{Title: "Dokument"}
+	section := viewSection{}
+	elementCounts := make(map[string]int)
+	err := walkXML(xmlData, func(currentPath, text string, groupStack []string) {
+		header, label := elementLabels(currentPath, groupStack, elementCounts)
+		if header != "" && header != section.Title {
+			if len(section.Fields) > 0 {
+				view.Sections = append(view.Sections, section)
+			}
+			section = viewSection{Title: header}
+		}
+		section.Fields = append(section.Fields, viewField{Field: lookupField(currentPath), Label: label, Value: text})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(section.Fields) > 0 {
+		view.Sections = append(view.Sections, section)
+	}
+	view.Sections = append(view.Sections, envelopeView(envelope)...)
+	return view, nil
+}
+
+// walkXML calls fn for every non-empty text node with the element path and
+// the stack of currently open elements.
+func walkXML(xmlData []byte, fn func(currentPath, text string, groupStack []string)) error {
+	xmlReader := bytes.NewReader(xmlData)
+	decoder := xml.NewDecoder(xmlReader)
+	var currentPath string
+	var groupStack []string
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error decoding XML: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			name := t.Name.Local
+			if currentPath == "" {
+				currentPath = "/" + name
+			} else {
+				currentPath += "/" + name
+			}
+			groupStack = append(groupStack, name)
+
+		case xml.CharData:
+			text := strings.TrimSpace(string(t))
+			if text != "" {
+				fn(currentPath, text, groupStack)
+			}
+		case xml.EndElement:
+			if len(groupStack) > 0 {
+				groupStack = groupStack[:len(groupStack)-1]
+			}
+
+			parts := strings.Split(currentPath, "/")
+			if len(parts) > 0 {
+				currentPath = strings.Join(parts[:len(parts)-1], "/")
+			} else {
+				currentPath = ""
+			}
+
+		}
+
+	}
+
+	return nil
+}
+
+// elementLabels returns the group header to print before the element (empty
+// if unchanged) and the label of the element itself.
+func elementLabels(currentPath string, groupStack []string, elementCounts map[string]int) (string, string) {
+
+	germanLabel := lookupLabel(currentPath)
+
+	parts := strings.Split(currentPath, "/")
+	elementName := parts[len(parts)-1]
+	elementName = strings.TrimSpace(elementName)
+
+	header := ""
+
+	if len(groupStack) > 1 {
+		header = lookupHeader(currentPath)
+
+		if header != "" {
+			// Print header if changed
+			lastHeader := groupStack[len(groupStack)-2]
+			lastHeader = strings.TrimSpace(lastHeader)
+			if header == lastHeader {
+				header = ""
+			}
+		}
+
+	}
+
+	label := elementName
+
+	if germanLabel != "" {
+		label = germanLabel
+	}
+
+	elementCountKey := currentPath
+	elementCounts[elementCountKey]++
+	if elementCounts[elementCountKey] > 1 {
+		label = fmt.Sprintf("%s %d", label, elementCounts[elementCountKey])
+
+	}
+
+	return header, label
+}
+
+func lookupLabel(xmlPath string) string {
+	csvMutex.RLock()
+	defer csvMutex.RUnlock()
+	for _, mapping := range csvData {
+		if comparePaths(mapping.GermanPath, xmlPath) {
+			return mapping.GermanLabel
+		}
+	}
+	return ""
+}
+
+func lookupField(xmlPath string) string {
+	csvMutex.RLock()
+	defer csvMutex.RUnlock()
+	for _, mapping := range csvData {
+		if comparePaths(mapping.GermanPath, xmlPath) {
+			return mapping.Field
+		}
+	}
+	return ""
+}
+
+func lookupHeader(xmlPath string) string {
+	csvMutex.RLock()
+	defer csvMutex.RUnlock()
+	for _, mapping := range csvData {
+		if comparePaths(mapping.GermanPath, xmlPath) {
+			parts := strings.Split(mapping.GermanPath, "/")
+			if len(parts) > 1 {
+				return parts[len(parts)-2]
+			}
+		}
+	}
+	return ""
+}
+
+func comparePaths(path1, path2 string) bool {
+	parts1 := strings.Split(path1, "/")
+	parts2 := strings.Split(path2, "/")
+	if len(parts1) != len(parts2) {
+		return false
+	}
+	for i := range parts1 {
+		part1 := strings.Split(parts1[i], ":")
+		part2 := strings.Split(parts2[i], ":")
+		if part1[len(part1)-1] != part2[len(part2)-1] {
+			return false
+		}
+	}
+	return true
+}
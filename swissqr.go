@@ -0,0 +1,188 @@
+package main
+
+import (
+	"log"
+
+	"eBill-Convert/model"
+	"eBill-Convert/utils"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Swiss QR-bill layout in mm, see SIX Implementation Guidelines QR-bill,
+// section 3.4.
+const (
+	swissBillHeight    = 105.0
+	swissReceiptWidth  = 62.0
+	swissQRCodeSize    = 46.0
+	swissCrossSize     = 7.0
+	swissPaymentInfoAt = swissReceiptWidth + 56.0
+)
+
+// addSwissQRBillPDF draws a Swiss QR-bill payment part (receipt and payment
+// part) on the bottom of the last page, adding a page if there is no room.
+// Invoices whose payment data cannot form a valid QR-bill are rendered
+// without it.
+func addSwissQRBillPDF(pdf *gofpdf.Fpdf, inv *model.Invoice) error {
+	bill, err := utils.SwissQRBillFromInvoice(inv)
+	if err != nil {
+		log.Printf("Skipping Swiss QR-bill: %v", err)
+		return nil
+	}
+	if bill == nil {
+		return nil
+	}
+	qr, err := bill.QRCode()
+	if err != nil {
+		log.Printf("Skipping Swiss QR-bill: %v", err)
+		return nil
+	}
+
+	pageWidth, pageHeight := pdf.GetPageSize()
+	top := pageHeight - swissBillHeight
+	if pdf.GetY() > top {
+		pdf.AddPage()
+	}
+	autoPageBreak, breakMargin := pdf.GetAutoPageBreak()
+	pdf.SetAutoPageBreak(false, 0)
+	defer pdf.SetAutoPageBreak(autoPageBreak, breakMargin)
+
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	// Perforation lines
+	pdf.SetDrawColor(0, 0, 0)
+	pdf.SetLineWidth(0.2)
+	pdf.SetDashPattern([]float64{1, 1}, 0)
+	pdf.Line(0, top, pageWidth, top)
+	pdf.Line(swissReceiptWidth, top, swissReceiptWidth, pageHeight)
+	pdf.SetDashPattern([]float64{}, 0)
+
+	// Receipt
+	x := 5.0
+	y := top + 5
+	swissText(pdf, x, y, "B", 11, tr("Empfangsschein"))
+	y += 7
+	y = swissBlock(pdf, x, y, 6, 8, tr("Konto / Zahlbar an"), swissCreditorLines(bill, tr))
+	if bill.ReferenceType != utils.SwissReferenceNone {
+		y = swissBlock(pdf, x, y, 6, 8, tr("Referenz"), []string{bill.FormatReference()})
+	}
+	swissPayableBy(pdf, x, y, 6, 8, 52, 20, bill, tr)
+	swissAmount(pdf, x, top+68, 6, 8, 13, 30, 10, bill, tr)
+	pdf.SetFont("Arial", "B", 6)
+	pdf.SetXY(x, top+82)
+	pdf.CellFormat(swissReceiptWidth-10, 3, tr("Annahmestelle"), "", 0, "R", false, 0, "")
+
+	// Payment part
+	x = swissReceiptWidth + 5
+	swissText(pdf, x, top+5, "B", 11, tr("Zahlteil"))
+	module := swissQRCodeSize / float64(qr.Size)
+	drawQRCode(pdf, qr, x-4*module, top+17-4*module, swissQRCodeSize+8*module)
+	drawSwissCross(pdf, x+(swissQRCodeSize-swissCrossSize)/2, top+17+(swissQRCodeSize-swissCrossSize)/2)
+	swissAmount(pdf, x, top+68, 8, 10, 14, 40, 15, bill, tr)
+
+	x = swissPaymentInfoAt
+	y = top + 5
+	y = swissBlock(pdf, x, y, 8, 10, tr("Konto / Zahlbar an"), swissCreditorLines(bill, tr))
+	if bill.ReferenceType != utils.SwissReferenceNone {
+		y = swissBlock(pdf, x, y, 8, 10, tr("Referenz"), []string{bill.FormatReference()})
+	}
+	if bill.Message != "" {
+		y = swissBlock(pdf, x, y, 8, 10, tr("Zusätzliche Informationen"), []string{tr(bill.Message)})
+	}
+	swissPayableBy(pdf, x, y, 8, 10, 65, 25, bill, tr)
+
+	pdf.SetFont("Arial", "", 12)
+	return nil
+}
+
+func swissText(pdf *gofpdf.Fpdf, x, y float64, style string, size float64, text string) {
+	pdf.SetFont("Arial", style, size)
+	pdf.SetXY(x, y)
+	pdf.Cell(0, size*0.4, text)
+}
+
+// swissBlock prints a heading with its value lines and returns the y
+// position of the next block.
+func swissBlock(pdf *gofpdf.Fpdf, x, y, headingSize, valueSize float64, heading string, lines []string) float64 {
+	swissText(pdf, x, y, "B", headingSize, heading)
+	y += headingSize * 0.45
+	for _, line := range lines {
+		swissText(pdf, x, y, "", valueSize, line)
+		y += valueSize * 0.45
+	}
+	return y + valueSize*0.45
+}
+
+func swissCreditorLines(bill *utils.SwissQRBill, tr func(string) string) []string {
+	return append([]string{bill.FormatIBAN()}, swissAddressLines(bill.Creditor, tr)...)
+}
+
+func swissAddressLines(address utils.SwissAddress, tr func(string) string) []string {
+	lines := []string{tr(address.Name)}
+	if street := address.Street; street != "" {
+		if address.BuildingNumber != "" {
+			street += " " + address.BuildingNumber
+		}
+		lines = append(lines, tr(street))
+	}
+	town := address.PostalCode + " " + address.Town
+	if address.Country != "CH" && address.Country != "LI" {
+		town = address.Country + "-" + town
+	}
+	return append(lines, tr(town))
+}
+
+// swissPayableBy prints the debtor, or an empty field with corner marks
+// to be filled in by hand if the debtor is unknown.
+func swissPayableBy(pdf *gofpdf.Fpdf, x, y, headingSize, valueSize, boxWidth, boxHeight float64, bill *utils.SwissQRBill, tr func(string) string) {
+	if bill.Debtor != nil {
+		swissBlock(pdf, x, y, headingSize, valueSize, tr("Zahlbar durch"), swissAddressLines(*bill.Debtor, tr))
+		return
+	}
+	swissText(pdf, x, y, "B", headingSize, tr("Zahlbar durch (Name/Adresse)"))
+	drawSwissCornerMarks(pdf, x, y+headingSize*0.5, boxWidth, boxHeight)
+}
+
+// swissAmount prints currency and amount, with corner marks for a hand
+// written amount if the invoice does not state one.
+func swissAmount(pdf *gofpdf.Fpdf, x, y, headingSize, valueSize, amountOffset, boxWidth, boxHeight float64, bill *utils.SwissQRBill, tr func(string) string) {
+	swissText(pdf, x, y, "B", headingSize, tr("Währung"))
+	swissText(pdf, x+amountOffset, y, "B", headingSize, tr("Betrag"))
+	swissText(pdf, x, y+headingSize*0.5, "", valueSize, bill.Currency)
+	if bill.Amount != "" {
+		swissText(pdf, x+amountOffset, y+headingSize*0.5, "", valueSize, bill.FormatAmount())
+		return
+	}
+	drawSwissCornerMarks(pdf, x+amountOffset, y+headingSize*0.5, boxWidth, boxHeight)
+}
+
+func drawSwissCornerMarks(pdf *gofpdf.Fpdf, x, y, width, height float64) {
+	const mark = 3.0
+	pdf.SetLineWidth(0.3)
+	pdf.Line(x, y, x+mark, y)
+	pdf.Line(x, y, x, y+mark)
+	pdf.Line(x+width-mark, y, x+width, y)
+	pdf.Line(x+width, y, x+width, y+mark)
+	pdf.Line(x, y+height, x+mark, y+height)
+	pdf.Line(x, y+height-mark, x, y+height)
+	pdf.Line(x+width-mark, y+height, x+width, y+height)
+	pdf.Line(x+width, y+height-mark, x+width, y+height)
+}
+
+// drawSwissCross draws the Swiss cross logo in the centre of the QR code:
+// a black square with white border carrying a white cross.
+func drawSwissCross(pdf *gofpdf.Fpdf, x, y float64) {
+	const border = 0.5
+	const arm = swissCrossSize - 2*border
+	const barLength, barWidth = arm * 0.6, arm * 0.19
+
+	pdf.SetFillColor(255, 255, 255)
+	pdf.Rect(x, y, swissCrossSize, swissCrossSize, "F")
+	pdf.SetFillColor(0, 0, 0)
+	pdf.Rect(x+border, y+border, arm, arm, "F")
+	pdf.SetFillColor(255, 255, 255)
+	center := swissCrossSize / 2
+	pdf.Rect(x+center-barWidth/2, y+center-barLength/2, barWidth, barLength, "F")
+	pdf.Rect(x+center-barLength/2, y+center-barWidth/2, barLength, barWidth, "F")
+	pdf.SetFillColor(0, 0, 0)
+}
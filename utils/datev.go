@@ -0,0 +1,408 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"eBill-Convert/model"
+)
+
+// DATEV booking directions: purchase invoices are booked against the
+// supplier's creditor account, sales invoices against the customer's
+// debtor account.
+const (
+	DATEVPurchase = "purchase"
+	DATEVSales    = "sales"
+)
+
+// DATEVConfig holds the header data and account mapping of a DATEV export.
+type DATEVConfig struct {
+	ConsultantNumber int    `json:"consultantNumber"` // Beraternummer
+	ClientNumber     int    `json:"clientNumber"`     // Mandantennummer
+	FiscalYearStart  string `json:"fiscalYearStart"`  // MM-DD, default 01-01
+	AccountLength    int    `json:"accountLength"`    // Sachkontenlänge, default 4
+	Chart            string `json:"chart"`            // SKR, default 03
+	Direction        string `json:"direction"`        // purchase (default) or sales
+
+	// Account and contra account used when no mapping applies. Defaults are
+	// 4980 (Betriebsbedarf) and 70000 (creditor) for purchase invoices, 8400
+	// (Erlöse) and 10000 (debtor) for sales invoices.
+	DefaultAccount       string `json:"defaultAccount"`
+	DefaultContraAccount string `json:"defaultContraAccount"`
+
+	// Categories maps "S:19", "S:7", "AE" etc. to the account of the VAT
+	// category with rate, or of the category alone.
+	Categories map[string]string `json:"categories,omitempty"`
+
+	// Partners maps the VAT identifier, an identifier or the name of the
+	// supplier (the customer for sales) to its accounts.
+	Partners map[string]DATEVPartner `json:"partners,omitempty"`
+
+	// TaxKeys overrides the BU-Schlüssel per "category:rate" or category.
+	TaxKeys map[string]string `json:"taxKeys,omitempty"`
+}
+
+// DATEVPartner is the account mapping of one business partner.
+type DATEVPartner struct {
+	Account       string `json:"account,omitempty"`       // Expense or revenue account
+	ContraAccount string `json:"contraAccount,omitempty"` // Creditor or debtor account
+}
+
+// DefaultDATEVConfig books purchase invoices in SKR03.
+func DefaultDATEVConfig() DATEVConfig {
+	return DATEVConfig{
+		FiscalYearStart: "01-01",
+		AccountLength:   4,
+		Chart:           "03",
+		Direction:       DATEVPurchase,
+	}
+}
+
+// LoadDATEVConfig reads a JSON configuration on top of the defaults.
+func LoadDATEVConfig(path string) (DATEVConfig, error) {
+	config := DefaultDATEVConfig()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("invalid DATEV configuration %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// datevTaxKeys are the SKR03/SKR04 BU-Schlüssel of the automatic VAT
+// accounts per direction, VAT category and rate.
+var datevTaxKeys = map[string]map[string]string{
+	DATEVPurchase: {
+		"S:19":  "9",  // 19 % Vorsteuer
+		"S:7":   "8",  // 7 % Vorsteuer
+		"AE:19": "94", // § 13b UStG, 19 % Vorsteuer und Umsatzsteuer
+		"AE:7":  "91", // § 13b UStG, 7 % Vorsteuer und Umsatzsteuer
+		"K:19":  "19", // Innergemeinschaftlicher Erwerb 19 %
+		"K:7":   "18", // Innergemeinschaftlicher Erwerb 7 %
+	},
+	DATEVSales: {
+		"S:19": "3", // 19 % Umsatzsteuer
+		"S:7":  "2", // 7 % Umsatzsteuer
+		"E":    "1", // Umsatzsteuerfrei mit Vorsteuerabzug
+	},
+}
+
+// datevColumns are the leading columns of the Buchungsstapel format 13;
+// DATEV accepts files ending after any column.
+var datevColumns = []string{
+	"Umsatz (ohne Soll/Haben-Kz)", "Soll/Haben-Kennzeichen", "WKZ Umsatz", "Kurs",
+	"Basis-Umsatz", "WKZ Basis-Umsatz", "Konto", "Gegenkonto (ohne BU-Schlüssel)",
+	"BU-Schlüssel", "Belegdatum", "Belegfeld 1", "Belegfeld 2", "Skonto", "Buchungstext",
+	"Postensperre", "Diverse Adressnummer", "Geschäftspartnerbank", "Sachverhalt",
+	"Zinssperre", "Beleglink",
+}
+
+// DATEVDocument is an invoice to be exported with its original file.
+type DATEVDocument struct {
+	Invoice  *model.Invoice
+	Filename string // Name of the original XML or PDF
+	Data     []byte // Original file, only needed for bundles
+
+	guid string
+}
+
+// DATEVExport writes the invoices as DATEV Buchungsstapel (EXTF) with one
+// booking per VAT category and rate of each invoice. The file is encoded in
+// Windows-1252 as expected by DATEV.
+func DATEVExport(docs []DATEVDocument, config DATEVConfig, now time.Time) ([]byte, error) {
+	var from, to model.Date
+	for i, doc := range docs {
+		if !doc.Invoice.IssueDate.IsSet() {
+			return nil, fmt.Errorf("%s: issue date (BT-2) missing", doc.Filename)
+		}
+		// Foreign currency rows need an exchange rate per booking, which
+		// invoices do not carry
+		if currency := doc.Invoice.CurrencyCode; currency != "" && currency != "EUR" {
+			return nil, fmt.Errorf("%s: invoice currency %s is not EUR, book it manually", doc.Filename, currency)
+		}
+		if i == 0 || doc.Invoice.IssueDate.Time().Before(from.Time()) {
+			from = doc.Invoice.IssueDate
+		}
+		if i == 0 || doc.Invoice.IssueDate.Time().After(to.Time()) {
+			to = doc.Invoice.IssueDate
+		}
+	}
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("no invoices to export")
+	}
+
+	fiscalYearStart, err := time.Parse("2006-01-02", fmt.Sprintf("%04d-%s", from.Time().Year(), config.FiscalYearStart))
+	if err != nil {
+		return nil, fmt.Errorf("invalid fiscalYearStart %q, expected MM-DD", config.FiscalYearStart)
+	}
+	if fiscalYearStart.After(from.Time()) {
+		fiscalYearStart = fiscalYearStart.AddDate(-1, 0, 0)
+	}
+	// DATEV imports a Buchungsstapel into a single fiscal year
+	if !to.Time().Before(fiscalYearStart.AddDate(1, 0, 0)) {
+		return nil, fmt.Errorf("invoices from %s to %s span more than one fiscal year, export them separately", from, to)
+	}
+
+	var b bytes.Buffer
+	header := []string{
+		`"EXTF"`, "700", "21", `"Buchungsstapel"`, "13",
+		now.Format("20060102150405") + fmt.Sprintf("%03d", now.Nanosecond()/1e6),
+		"", `"RE"`, `""`, `""`,
+		fmt.Sprint(config.ConsultantNumber), fmt.Sprint(config.ClientNumber),
+		fiscalYearStart.Format("20060102"), fmt.Sprint(config.AccountLength),
+		from.Time().Format("20060102"), to.Time().Format("20060102"),
+		datevText("E-Rechnungen", 30), `""`, "1", "0", "0", `"EUR"`,
+		"", `""`, "", "", datevText(config.Chart, 2), "", "", "", `""`,
+	}
+	b.WriteString(strings.Join(header, ";") + "\r\n")
+	b.WriteString(strings.Join(datevColumns, ";") + "\r\n")
+
+	for i := range docs {
+		for _, row := range datevBookings(&docs[i], config) {
+			b.WriteString(strings.Join(row, ";") + "\r\n")
+		}
+	}
+	return encodeWindows1252(b.String()), nil
+}
+
+// datevBookings returns the booking rows of one invoice.
+func datevBookings(doc *DATEVDocument, config DATEVConfig) [][]string {
+	inv := doc.Invoice
+	partner := inv.Seller
+	if config.Direction == DATEVSales {
+		partner = inv.Buyer
+	}
+	accounts := config.partner(partner)
+	defaultAccount, defaultContra := "4980", "70000"
+	if config.Direction == DATEVSales {
+		defaultAccount, defaultContra = "8400", "10000"
+	}
+	contra := firstNonEmpty(accounts.ContraAccount, config.DefaultContraAccount, defaultContra)
+
+	// A credit note reverses the booking, as does a negative amount
+	debit := !inv.TypeCode.IsCreditNote()
+	beleglink := ""
+	if doc.guid != "" {
+		beleglink = datevText(fmt.Sprintf("BEDI \"%s\"", doc.guid), 210)
+	}
+	dueDate := ""
+	if inv.DueDate.IsSet() {
+		dueDate = inv.DueDate.Time().Format("020106")
+	}
+
+	var rows [][]string
+	for _, vat := range inv.VATBreakdown {
+		key := datevCategoryKey(vat.Category, vat.Rate)
+		account := firstNonEmpty(accounts.Account, config.Categories[key], config.Categories[string(vat.Category)], config.DefaultAccount, defaultAccount)
+		amount := vat.TaxableAmount.Add(vat.TaxAmount).RoundAmount()
+		side := debit
+		if amount.Sign() < 0 {
+			amount, side = amount.Neg(), !side
+		}
+		if amount.Sign() == 0 {
+			continue
+		}
+		soll := "S"
+		if !side {
+			soll = "H"
+		}
+
+		konto, gegenkonto := account, contra
+		if config.Direction == DATEVSales {
+			konto, gegenkonto = contra, account
+		}
+		rows = append(rows, []string{
+			strings.Replace(amount.String(), ".", ",", 1), `"` + soll + `"`, "", "", "", "",
+			konto, gegenkonto, datevText(config.taxKey(key, vat.Category), 4),
+			inv.IssueDate.Time().Format("0201"),
+			datevText(datevDocumentField(inv.Number), 36), datevText(dueDate, 12), "",
+			datevText(partner.Name, 60), "", "", "", "", "", beleglink,
+		})
+	}
+	return rows
+}
+
+func datevCategoryKey(category model.VATCategory, rate model.Decimal) string {
+	if !rate.IsSet() {
+		return string(category)
+	}
+	value := rate.String()
+	if strings.Contains(value, ".") {
+		value = strings.TrimRight(strings.TrimRight(value, "0"), ".")
+	}
+	return string(category) + ":" + value
+}
+
+// partner looks up the accounts by VAT identifier, identifiers and name.
+func (c DATEVConfig) partner(party model.Party) DATEVPartner {
+	candidates := []string{party.VATID, party.TaxRegistrationID}
+	for _, id := range party.Identifiers {
+		candidates = append(candidates, id.ID)
+	}
+	candidates = append(candidates, party.Name)
+	for _, candidate := range candidates {
+		if accounts, ok := c.Partners[candidate]; ok && candidate != "" {
+			return accounts
+		}
+	}
+	return DATEVPartner{}
+}
+
+func (c DATEVConfig) taxKey(key string, category model.VATCategory) string {
+	if value, ok := c.TaxKeys[key]; ok {
+		return value
+	}
+	if value, ok := c.TaxKeys[string(category)]; ok {
+		return value
+	}
+	keys := datevTaxKeys[c.Direction]
+	if value, ok := keys[key]; ok {
+		return value
+	}
+	return keys[string(category)]
+}
+
+// datevDocumentField keeps the characters DATEV allows in Belegfeld 1.
+func datevDocumentField(number string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', strings.ContainsRune("$&%*+-/", r):
+			return r
+		}
+		return -1
+	}, number)
+}
+
+// datevText quotes a text field, truncated to n characters.
+func datevText(s string, n int) string {
+	if s == "" {
+		return ""
+	}
+	return `"` + strings.ReplaceAll(truncateRunes(s, n), `"`, `""`) + `"`
+}
+
+// encodeWindows1252 encodes s in Windows-1252; characters outside the code
+// page become "?".
+func encodeWindows1252(s string) []byte {
+	var b bytes.Buffer
+	for _, r := range s {
+		switch {
+		case r < 0x80 || (r >= 0xa0 && r <= 0xff):
+			b.WriteByte(byte(r))
+		case r == '€':
+			b.WriteByte(0x80)
+		case r == '’':
+			b.WriteByte(0x92)
+		case r == '–':
+			b.WriteByte(0x96)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.Bytes()
+}
+
+// DATEVBundle packs the Buchungsstapel, the original files and the
+// document.xml of the DATEV XML interface into a ZIP archive for the
+// document import of DATEV Unternehmen online. Each booking links its
+// document through the Beleglink column.
+func DATEVBundle(docs []DATEVDocument, config DATEVConfig, now time.Time) ([]byte, error) {
+	for i := range docs {
+		guid, err := newGUID()
+		if err != nil {
+			return nil, err
+		}
+		docs[i].guid = guid
+	}
+	csvData, err := DATEVExport(docs, config, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest bytes.Buffer
+	manifest.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n")
+	manifest.WriteString(`<archive xmlns="http://xml.datev.de/bedi/tps/document/v05.0" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" version="5.0" generatingSystem="eBill-Convert">` + "\n")
+	fmt.Fprintf(&manifest, "  <header>\n    <date>%s</date>\n  </header>\n  <content>\n", now.Format("2006-01-02T15:04:05"))
+
+	var b bytes.Buffer
+	archive := zip.NewWriter(&b)
+	names := map[string]bool{"document.xml": true, "EXTF_Buchungsstapel.csv": true}
+	for _, doc := range docs {
+		name := uniqueName(names, doc.Filename)
+		fmt.Fprintf(&manifest, "    <document guid=\"%s\" processID=\"1\" type=\"2\">\n", doc.guid)
+		fmt.Fprintf(&manifest, "      <description>%s</description>\n", xmlEscape(doc.Invoice.Number))
+		fmt.Fprintf(&manifest, "      <extension xsi:type=\"File\" name=\"%s\"/>\n", xmlEscape(name))
+		manifest.WriteString("    </document>\n")
+
+		w, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(doc.Data); err != nil {
+			return nil, err
+		}
+	}
+	manifest.WriteString("  </content>\n</archive>\n")
+
+	for name, data := range map[string][]byte{"EXTF_Buchungsstapel.csv": csvData, "document.xml": manifest.Bytes()} {
+		w, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// uniqueName returns name, numbered if it is already taken.
+func uniqueName(taken map[string]bool, name string) string {
+	base, ext := name, ""
+	if i := strings.LastIndex(name, "."); i > 0 {
+		base, ext = name[:i], name[i:]
+	}
+	for n := 2; taken[name]; n++ {
+		name = fmt.Sprintf("%s_%d%s", base, n, ext)
+	}
+	taken[name] = true
+	return name
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// newGUID returns a random UUID (version 4).
+func newGUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"eBill-Convert/model"
+)
+
+func TestDATEVExport(t *testing.T) {
+	rate, _ := model.ParseDecimal("19")
+	taxable, _ := model.ParseDecimal("100.00")
+	tax, _ := model.ParseDecimal("19.00")
+	inv := &model.Invoice{
+		Number:       "RE-2024/0815",
+		IssueDate:    model.NewDate(2024, time.January, 31),
+		CurrencyCode: "EUR",
+		Seller:       model.Party{Name: "Muster GmbH", VATID: "DE136695976"},
+		VATBreakdown: []model.VATBreakdown{{Category: "S", Rate: rate, TaxableAmount: taxable, TaxAmount: tax}},
+	}
+	now := time.Date(2024, time.February, 1, 12, 0, 0, 0, time.UTC)
+
+	data, err := DATEVExport([]DATEVDocument{{Invoice: inv, Filename: "re.xml"}}, DefaultDATEVConfig(), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(data), "\r\n")
+	if want := `119,00;"S";;;;;4980;70000;"9";3101;"RE-2024/0815";;;"Muster GmbH";;;;;;`; lines[2] != want {
+		t.Errorf("booking = %s, want %s", lines[2], want)
+	}
+
+	inv.CurrencyCode = "USD"
+	if _, err := DATEVExport([]DATEVDocument{{Invoice: inv, Filename: "re.xml"}}, DefaultDATEVConfig(), now); err == nil || !strings.Contains(err.Error(), "USD") {
+		t.Errorf("USD invoice: error = %v", err)
+	}
+}
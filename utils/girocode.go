@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"eBill-Convert/model"
+)
+
+// GiroCode holds the data of an EPC069-12 SEPA credit transfer QR code.
+type GiroCode struct {
+	BIC        string
+	Name       string
+	IBAN       string
+	Amount     string // Euro amount with two decimals, empty if unknown
+	Reference  string // Structured creditor reference (ISO 11649)
+	Remittance string // Unstructured remittance information
+}
+
+// GiroCodeFromInvoice extracts the SEPA credit transfer data of an invoice.
+// It returns nil when the invoice carries no usable payment means (type
+// code 30 or 58 with IBAN, invoice currency EUR).
+func GiroCodeFromInvoice(inv *model.Invoice) (*GiroCode, error) {
+	if inv.CurrencyCode != "" && inv.CurrencyCode != "EUR" {
+		return nil, nil
+	}
+
+	payment := inv.PaymentInstructions
+	if payment.MeansCode != "58" && payment.MeansCode != "30" {
+		return nil, nil
+	}
+	for _, transfer := range payment.CreditTransfers {
+		iban := normalizeIBAN(transfer.AccountID)
+		if iban == "" {
+			continue
+		}
+
+		code := &GiroCode{
+			BIC:  strings.ToUpper(transfer.ProviderID),
+			IBAN: iban,
+		}
+
+		// The beneficiary is the payee if it differs from the seller
+		if inv.Payee != nil {
+			code.Name = inv.Payee.Name
+		}
+		if code.Name == "" {
+			code.Name = inv.Seller.Name
+		}
+		if code.Name == "" {
+			code.Name = transfer.AccountName
+		}
+
+		if due := inv.Totals.DuePayable; due.IsSet() {
+			if due.Sign() <= 0 {
+				return nil, nil // Nothing left to pay
+			}
+			code.Amount = due.Round(2).String()
+		}
+
+		reference := payment.RemittanceInfo
+		if reference == "" {
+			reference = inv.Number
+		}
+		if isCreditorReference(reference) {
+			code.Reference = strings.ReplaceAll(reference, " ", "")
+		} else {
+			code.Remittance = reference
+		}
+
+		return code, nil
+	}
+
+	return nil, nil
+}
+
+// Payload returns the EPC069-12 version 002 text content of the QR code.
+func (g *GiroCode) Payload() (string, error) {
+	if g.Name == "" {
+		return "", fmt.Errorf("beneficiary name missing")
+	}
+	if g.IBAN == "" {
+		return "", fmt.Errorf("beneficiary IBAN missing")
+	}
+	if g.Reference != "" && g.Remittance != "" {
+		return "", fmt.Errorf("structured and unstructured remittance are mutually exclusive")
+	}
+
+	amount := ""
+	if g.Amount != "" {
+		value, ok := new(big.Rat).SetString(g.Amount)
+		if !ok || value.Cmp(big.NewRat(1, 100)) < 0 || value.Cmp(big.NewRat(99999999999, 100)) > 0 {
+			return "", fmt.Errorf("amount out of range: %q", g.Amount)
+		}
+		amount = "EUR" + value.FloatString(2)
+	}
+
+	lines := []string{
+		"BCD",
+		"002",
+		"1", // UTF-8
+		"SCT",
+		g.BIC,
+		truncateRunes(g.Name, 70),
+		g.IBAN,
+		amount,
+		"", // Purpose
+		truncateRunes(g.Reference, 35),
+		truncateRunes(g.Remittance, 140),
+	}
+
+	payload := strings.TrimRight(strings.Join(lines, "\n"), "\n")
+	if len(payload) > 331 {
+		return "", fmt.Errorf("payload exceeds 331 bytes")
+	}
+	return payload, nil
+}
+
+// QRCode encodes the payload with error correction level M as required by
+// the EPC guidelines.
+func (g *GiroCode) QRCode() (*QRCode, error) {
+	payload, err := g.Payload()
+	if err != nil {
+		return nil, err
+	}
+	return EncodeQR([]byte(payload), QRErrorCorrectionM, 13)
+}
@@ -0,0 +1,385 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"eBill-Convert/model"
+)
+
+// Identifier schemes of ISO 6523 carrying GS1 check digits
+const (
+	schemeGLN  = "0088"
+	schemeGTIN = "0160"
+)
+
+// ibanLengths is the length of the IBAN of each country in the SWIFT IBAN
+// registry.
+var ibanLengths = map[string]int{
+	"AD": 24, "AE": 23, "AL": 28, "AT": 20, "AZ": 28, "BA": 20, "BE": 16, "BG": 22, "BH": 22, "BI": 27,
+	"BR": 29, "BY": 28, "CH": 21, "CR": 22, "CY": 28, "CZ": 24, "DE": 22, "DJ": 27, "DK": 18, "DO": 28,
+	"EE": 20, "EG": 29, "ES": 24, "FI": 18, "FK": 18, "FO": 18, "FR": 27, "GB": 22, "GE": 22, "GI": 23,
+	"GL": 18, "GR": 27, "GT": 28, "HR": 21, "HU": 28, "IE": 22, "IL": 23, "IQ": 23, "IS": 26, "IT": 27,
+	"JO": 30, "KW": 30, "KZ": 20, "LB": 28, "LC": 32, "LI": 21, "LT": 20, "LU": 20, "LV": 21, "LY": 25,
+	"MC": 27, "MD": 24, "ME": 22, "MK": 19, "MN": 20, "MR": 27, "MT": 31, "MU": 30, "NI": 28, "NL": 18,
+	"NO": 15, "OM": 23, "PK": 24, "PL": 28, "PS": 29, "PT": 25, "QA": 29, "RO": 24, "RS": 22, "RU": 33,
+	"SA": 24, "SC": 31, "SD": 18, "SE": 24, "SI": 19, "SK": 24, "SM": 27, "SO": 23, "ST": 25, "SV": 28,
+	"TL": 23, "TN": 24, "TR": 26, "UA": 29, "VA": 22, "VG": 24, "XK": 20, "YE": 30,
+}
+
+var (
+	ibanPattern     = regexp.MustCompile(`^[A-Z]{2}[0-9]{2}[A-Z0-9]+$`)
+	bicPattern      = regexp.MustCompile(`^[A-Z]{4}[A-Z]{2}[A-Z0-9]{2}([A-Z0-9]{3})?$`)
+	leitwegPattern  = regexp.MustCompile(`^[0-9]{2,12}(-[0-9A-Z]{1,30})?-[0-9]{2}$`)
+	steuerPattern   = regexp.MustCompile(`^[0-9/ ]+$`)
+	vatPrefixFormat = regexp.MustCompile(`^[A-Z]{2}`)
+)
+
+// vatFormats are the formats of the VAT identifiers of the EU member states
+// and Northern Ireland after the country prefix.
+var vatFormats = map[string]*regexp.Regexp{
+	"AT": regexp.MustCompile(`^U[0-9]{8}$`),
+	"BE": regexp.MustCompile(`^[01][0-9]{9}$`),
+	"BG": regexp.MustCompile(`^[0-9]{9,10}$`),
+	"CY": regexp.MustCompile(`^[0-9]{8}[A-Z]$`),
+	"CZ": regexp.MustCompile(`^[0-9]{8,10}$`),
+	"DE": regexp.MustCompile(`^[0-9]{9}$`),
+	"DK": regexp.MustCompile(`^[0-9]{8}$`),
+	"EE": regexp.MustCompile(`^[0-9]{9}$`),
+	"EL": regexp.MustCompile(`^[0-9]{9}$`),
+	"ES": regexp.MustCompile(`^[A-Z0-9][0-9]{7}[A-Z0-9]$`),
+	"FI": regexp.MustCompile(`^[0-9]{8}$`),
+	"FR": regexp.MustCompile(`^[A-HJ-NP-Z0-9]{2}[0-9]{9}$`),
+	"HR": regexp.MustCompile(`^[0-9]{11}$`),
+	"HU": regexp.MustCompile(`^[0-9]{8}$`),
+	"IE": regexp.MustCompile(`^([0-9]{7}[A-W][A-IW]?|[0-9][A-Z+*][0-9]{5}[A-W])$`),
+	"IT": regexp.MustCompile(`^[0-9]{11}$`),
+	"LT": regexp.MustCompile(`^([0-9]{9}|[0-9]{12})$`),
+	"LU": regexp.MustCompile(`^[0-9]{8}$`),
+	"LV": regexp.MustCompile(`^[0-9]{11}$`),
+	"MT": regexp.MustCompile(`^[0-9]{8}$`),
+	"NL": regexp.MustCompile(`^[0-9]{9}B[0-9]{2}$`),
+	"PL": regexp.MustCompile(`^[0-9]{10}$`),
+	"PT": regexp.MustCompile(`^[0-9]{9}$`),
+	"RO": regexp.MustCompile(`^[0-9]{2,10}$`),
+	"SE": regexp.MustCompile(`^[0-9]{10}01$`),
+	"SI": regexp.MustCompile(`^[0-9]{8}$`),
+	"SK": regexp.MustCompile(`^[0-9]{10}$`),
+	"XI": regexp.MustCompile(`^([0-9]{9}|[0-9]{12}|GD[0-9]{3}|HA[0-9]{3})$`),
+}
+
+// vatCheckDigits verify the check digit of the VAT identifiers of member
+// states that define one; the others are checked for their format only.
+var vatCheckDigits = map[string]func(number string) bool{
+	"AT": func(n string) bool {
+		sum := 0
+		for i, d := range digits(n[1:8]) {
+			if i%2 == 1 {
+				d = d*2/10 + d*2%10
+			}
+			sum += d
+		}
+		return (10-(sum+4)%10)%10 == digit(n, 8)
+	},
+	"BE": func(n string) bool { return 97-numberMod(n[:8], 97) == numberMod(n[8:], 100) },
+	"DE": func(n string) bool { return iso7064Mod11_10(n) },
+	"DK": func(n string) bool { return weightedSum(n, 2, 7, 6, 5, 4, 3, 2, 1)%11 == 0 },
+	"EE": func(n string) bool { return (10-weightedSum(n[:8], 3, 7, 1, 3, 7, 1, 3, 7)%10)%10 == digit(n, 8) },
+	"EL": func(n string) bool {
+		return weightedSum(n[:8], 256, 128, 64, 32, 16, 8, 4, 2)%11%10 == digit(n, 8)
+	},
+	"FI": func(n string) bool {
+		check := 11 - weightedSum(n[:7], 7, 9, 10, 5, 8, 4, 2)%11
+		return check%11 == digit(n, 7)
+	},
+	"FR": func(n string) bool {
+		if n[0] < '0' || n[0] > '9' || n[1] < '0' || n[1] > '9' {
+			return true // Keys with letters follow an unpublished scheme
+		}
+		return (12+3*numberMod(n[2:], 97))%97 == numberMod(n[:2], 100)
+	},
+	"HR": func(n string) bool { return iso7064Mod11_10(n) },
+	"HU": func(n string) bool { return (10-weightedSum(n[:7], 9, 7, 3, 1, 9, 7, 3)%10)%10 == digit(n, 7) },
+	"IT": func(n string) bool { return luhn(n) },
+	"LU": func(n string) bool { return numberMod(n[:6], 89) == numberMod(n[6:], 100) },
+	"NL": func(n string) bool {
+		return weightedSum(n[:8], 9, 8, 7, 6, 5, 4, 3, 2)%11 == digit(n, 8) || mod97("NL"+n) == 1
+	},
+	"PL": func(n string) bool { return weightedSum(n[:9], 6, 5, 7, 2, 3, 4, 5, 6, 7)%11 == digit(n, 9) },
+	"PT": func(n string) bool {
+		check := 11 - weightedSum(n[:8], 9, 8, 7, 6, 5, 4, 3, 2)%11
+		if check >= 10 {
+			check = 0
+		}
+		return check == digit(n, 8)
+	},
+	"SE": func(n string) bool { return luhn(n[:10]) },
+	"SI": func(n string) bool {
+		check := 11 - weightedSum(n[:7], 8, 7, 6, 5, 4, 3, 2)%11
+		if check == 10 {
+			check = 0
+		}
+		return n[0] != '0' && check == digit(n, 7)
+	},
+	"SK": func(n string) bool { return numberMod(n, 11) == 0 },
+}
+
+// steuernummerPrefixes are the federal state codes heading the 13 digit
+// Steuernummer of the ELSTER format.
+var steuernummerPrefixes = []string{"10", "11", "21", "22", "23", "24", "26", "27", "28", "30", "31", "32", "40", "41", "5", "9"}
+
+// CheckIBAN verifies the country specific length and the MOD 97-10 check
+// digits of an IBAN.
+func CheckIBAN(iban string) error {
+	iban = normalizeIBAN(iban)
+	if !ibanPattern.MatchString(iban) {
+		return fmt.Errorf("not an IBAN")
+	}
+	length, ok := ibanLengths[iban[:2]]
+	if !ok {
+		return fmt.Errorf("unknown IBAN country %s", iban[:2])
+	}
+	if len(iban) != length {
+		return fmt.Errorf("an IBAN of %s has %d characters, not %d", iban[:2], length, len(iban))
+	}
+	if mod97(iban[4:]+iban[:4]) != 1 {
+		return fmt.Errorf("wrong check digits")
+	}
+	return nil
+}
+
+// CheckBIC verifies the format of a BIC (ISO 9362).
+func CheckBIC(bic string) error {
+	if !bicPattern.MatchString(normalizeIBAN(bic)) {
+		return fmt.Errorf("a BIC has 8 or 11 characters: bank, country, location and optional branch code")
+	}
+	return nil
+}
+
+// CheckVATID verifies the format of an EU VAT identifier and, for member
+// states defining one, its check digit. Identifiers of other countries are
+// not checked.
+func CheckVATID(id string) error {
+	id = strings.ToUpper(strings.NewReplacer(" ", "", ".", "", "-", "").Replace(id))
+	if !vatPrefixFormat.MatchString(id) {
+		return fmt.Errorf("country prefix missing")
+	}
+	country, number := id[:2], id[2:]
+	format, ok := vatFormats[country]
+	if !ok {
+		return nil
+	}
+	if !format.MatchString(number) {
+		return fmt.Errorf("not a VAT identifier of %s", country)
+	}
+	if check, ok := vatCheckDigits[country]; ok && !check(number) {
+		return fmt.Errorf("wrong check digit")
+	}
+	return nil
+}
+
+// CheckSteuernummer verifies the format of a German tax number, either in
+// the 10 or 11 digit notation of the federal states or in the 13 digit
+// ELSTER format.
+func CheckSteuernummer(number string) error {
+	if !steuerPattern.MatchString(number) {
+		return fmt.Errorf("a Steuernummer consists of digits")
+	}
+	number = strings.NewReplacer("/", "", " ", "").Replace(number)
+	switch len(number) {
+	case 10, 11:
+		return nil
+	case 13:
+		for _, prefix := range steuernummerPrefixes {
+			if strings.HasPrefix(number, prefix) && number[4] == '0' {
+				return nil
+			}
+		}
+		return fmt.Errorf("not a Steuernummer in ELSTER format")
+	}
+	return fmt.Errorf("a Steuernummer has 10, 11 or 13 digits")
+}
+
+// CheckGS1 verifies the length and the check digit of a GLN (scheme 0088)
+// or GTIN (scheme 0160).
+func CheckGS1(id, scheme string) error {
+	switch {
+	case strings.Trim(id, "0123456789") != "":
+		return fmt.Errorf("consists of digits only")
+	case scheme == schemeGLN && len(id) != 13:
+		return fmt.Errorf("a GLN has 13 digits")
+	case scheme == schemeGTIN && len(id) != 8 && len(id) != 12 && len(id) != 13 && len(id) != 14:
+		return fmt.Errorf("a GTIN has 8, 12, 13 or 14 digits")
+	}
+	sum := 0
+	for i, d := range digits(id[:len(id)-1]) {
+		if (len(id)-1-i)%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	if (10-sum%10)%10 != digit(id, len(id)-1) {
+		return fmt.Errorf("wrong check digit")
+	}
+	return nil
+}
+
+// IsLeitwegID reports whether ref has the form of a Leitweg-ID: coarse
+// address, optional fine address and two check digits.
+func IsLeitwegID(ref string) bool {
+	return leitwegPattern.MatchString(strings.ToUpper(strings.TrimSpace(ref)))
+}
+
+// CheckLeitwegID verifies the ISO 7064 MOD 97-10 check digits of a
+// Leitweg-ID.
+func CheckLeitwegID(id string) error {
+	id = strings.ToUpper(strings.TrimSpace(id))
+	if !leitwegPattern.MatchString(id) {
+		return fmt.Errorf("not a Leitweg-ID")
+	}
+	if mod97(strings.ReplaceAll(id, "-", "")) != 1 {
+		return fmt.Errorf("wrong check digits")
+	}
+	return nil
+}
+
+// IdentifierIssues checks the bank accounts, VAT identifiers, German tax
+// numbers, GLNs, GTINs and, for XRechnung, the Leitweg-ID of the invoice. The issues carry
+// the offending value, so that renderers can highlight it.
+func IdentifierIssues(inv *model.Invoice) []ValidationIssue {
+	var issues []ValidationIssue
+	report := func(rule, severity, field, value, name string, err error) {
+		if err != nil {
+			issues = append(issues, ValidationIssue{
+				Rule:     rule,
+				Severity: severity,
+				Field:    field,
+				Value:    value,
+				Message:  fmt.Sprintf("Invalid %s %s: %v.", name, value, err),
+			})
+		}
+	}
+	iban := func(field, value string) {
+		// Other account identifiers are allowed outside SEPA
+		if normalized := normalizeIBAN(value); ibanPattern.MatchString(normalized) && ibanLengths[normalized[:2]] > 0 {
+			report("ID-IBAN", "error", field, value, "IBAN", CheckIBAN(value))
+		}
+	}
+	vat := func(field, value string) {
+		if value != "" {
+			report("ID-VAT", "error", field, value, "VAT identifier", CheckVATID(value))
+		}
+	}
+	gs1 := func(field string, id model.Identifier) {
+		if id.ID == "" {
+			return // Nothing to check, e.g. <ram:GlobalID schemeID="0088"/>
+		}
+		switch id.Scheme {
+		case schemeGLN:
+			report("ID-GLN", "error", field, id.ID, "GLN", CheckGS1(id.ID, id.Scheme))
+		case schemeGTIN:
+			report("ID-GTIN", "error", field, id.ID, "GTIN", CheckGS1(id.ID, id.Scheme))
+		}
+	}
+	party := func(party *model.Party, identifiers, legal, vatID, address string) {
+		for _, id := range party.Identifiers {
+			gs1(identifiers, id)
+		}
+		gs1(legal, party.LegalRegistrationID)
+		if vatID != "" {
+			vat(vatID, party.VATID)
+		}
+		if address != "" {
+			gs1(address, party.ElectronicAddress)
+		}
+	}
+
+	// Elsewhere BT-10 is a free buyer reference such as "2024-01"
+	if ref := inv.BuyerReference; ProfileName(inv.SpecificationID) == "XRECHNUNG" && IsLeitwegID(ref) {
+		report("ID-LEITWEG", "error", "BT-10", ref, "Leitweg-ID", CheckLeitwegID(ref))
+	}
+	party(&inv.Seller, "BT-29", "BT-30", "BT-31", "BT-34")
+	if number := inv.Seller.TaxRegistrationID; number != "" && (inv.Seller.Address.CountryCode == "DE" || inv.Seller.Address.CountryCode == "") {
+		report("ID-STNR", "warning", "BT-32", number, "Steuernummer", CheckSteuernummer(number))
+	}
+	party(&inv.Buyer, "BT-46", "BT-47", "BT-48", "BT-49")
+	if payee := inv.Payee; payee != nil {
+		party(payee, "BT-60", "BT-61", "", "")
+	}
+	if representative := inv.TaxRepresentative; representative != nil {
+		vat("BT-63", representative.VATID)
+	}
+	if delivery := inv.Delivery; delivery != nil {
+		gs1("BT-71", delivery.LocationID)
+	}
+	for _, transfer := range inv.PaymentInstructions.CreditTransfers {
+		iban("BT-84", transfer.AccountID)
+		if transfer.ProviderID != "" {
+			report("ID-BIC", "error", "BT-86", transfer.ProviderID, "BIC", CheckBIC(transfer.ProviderID))
+		}
+	}
+	if debit := inv.PaymentInstructions.DirectDebit; debit != nil {
+		iban("BT-91", debit.DebitedAccount)
+	}
+	for _, line := range inv.Lines {
+		gs1("BT-157", line.Item.StandardID)
+	}
+	return issues
+}
+
+func digit(s string, i int) int {
+	return int(s[i] - '0')
+}
+
+func digits(s string) []int {
+	result := make([]int, len(s))
+	for i := range s {
+		result[i] = digit(s, i)
+	}
+	return result
+}
+
+func weightedSum(s string, weights ...int) int {
+	sum := 0
+	for i, d := range digits(s) {
+		sum += d * weights[i]
+	}
+	return sum
+}
+
+// numberMod returns the remainder of the decimal number s.
+func numberMod(s string, m int) int {
+	remainder := 0
+	for _, d := range digits(s) {
+		remainder = (remainder*10 + d) % m
+	}
+	return remainder
+}
+
+func luhn(s string) bool {
+	sum := 0
+	for i, d := range digits(s) {
+		if (len(s)-i)%2 == 0 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// iso7064Mod11_10 verifies the trailing ISO 7064 MOD 11,10 check digit.
+func iso7064Mod11_10(s string) bool {
+	product := 10
+	for _, d := range digits(s[:len(s)-1]) {
+		sum := (d + product) % 10
+		if sum == 0 {
+			sum = 10
+		}
+		product = sum * 2 % 11
+	}
+	return (11-product)%10 == digit(s, len(s)-1)
+}
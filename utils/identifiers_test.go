@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"testing"
+
+	"eBill-Convert/model"
+)
+
+func TestCheckIBAN(t *testing.T) {
+	tests := map[string]bool{
+		"DE89370400440532013000":        true,
+		"DE02 1203 0000 0000 2020 51":   true,
+		"de02120300000000202051":        true,
+		"GB29NWBK60161331926819":        true,
+		"CH9300762011623852957":         true,
+		"FR1420041010050500013M02606":   true,
+		"DE89370400440532013001":        false, // Check digits
+		"DE8937040044053201300":         false, // Length
+		"XX89370400440532013000":        false, // Country
+		"DE89 3704 0044 0532 0130 00 X": false,
+		"":                              false,
+	}
+	for iban, valid := range tests {
+		if err := CheckIBAN(iban); (err == nil) != valid {
+			t.Errorf("CheckIBAN(%q) = %v", iban, err)
+		}
+	}
+}
+
+func TestCheckBIC(t *testing.T) {
+	tests := map[string]bool{
+		"COBADEFFXXX": true,
+		"COBADEFF":    true,
+		"bylademm":    true,
+		"COBADEF":     false,
+		"COBA1EFFXXX": false,
+		"COBADEFFXX":  false,
+	}
+	for bic, valid := range tests {
+		if err := CheckBIC(bic); (err == nil) != valid {
+			t.Errorf("CheckBIC(%q) = %v", bic, err)
+		}
+	}
+}
+
+func TestCheckVATID(t *testing.T) {
+	tests := map[string]bool{
+		"DE136695976":    true,
+		"DE 136 695 976": true,
+		"de136695976":    true,
+		"DE136695977":    false, // Check digit
+		"DE13669597":     false, // Length
+		"ATU13585627":    true,
+		"ATU13585626":    false,
+		"136695976":      false, // Prefix
+		"CHE123456789":   true,  // Not checked outside the EU
+	}
+	for id, valid := range tests {
+		if err := CheckVATID(id); (err == nil) != valid {
+			t.Errorf("CheckVATID(%q) = %v", id, err)
+		}
+	}
+}
+
+func TestCheckSteuernummer(t *testing.T) {
+	tests := map[string]bool{
+		"201/113/40209":  true,
+		"21/815/08150":   true,
+		"9181081508155":  true, // ELSTER, Bavaria
+		"9181181508155":  false,
+		"201/113/402":    false,
+		"201/113/40209a": false,
+	}
+	for number, valid := range tests {
+		if err := CheckSteuernummer(number); (err == nil) != valid {
+			t.Errorf("CheckSteuernummer(%q) = %v", number, err)
+		}
+	}
+}
+
+func TestCheckGS1(t *testing.T) {
+	tests := []struct {
+		id, scheme string
+		valid      bool
+	}{
+		{"4000001000005", schemeGLN, true},
+		{"4000001000006", schemeGLN, false},
+		{"400000100000", schemeGLN, false},
+		{"4006381333931", schemeGTIN, true},
+		{"96385074", schemeGTIN, true},
+		{"036000291452", schemeGTIN, true},
+		{"04006381333931", schemeGTIN, true},
+		{"4006381333932", schemeGTIN, false},
+		{"40063813339", schemeGTIN, false},
+		{"400638133393X", schemeGTIN, false},
+	}
+	for _, test := range tests {
+		if err := CheckGS1(test.id, test.scheme); (err == nil) != test.valid {
+			t.Errorf("CheckGS1(%q, %s) = %v", test.id, test.scheme, err)
+		}
+	}
+}
+
+func TestCheckLeitwegID(t *testing.T) {
+	tests := map[string]bool{
+		"04011000-12345-03":  true,
+		" 04011000-12345-03": true,
+		"04011000-12345-04":  false,
+		"04011000-1234A-03":  false,
+		"2024-01":            false,
+	}
+	for id, valid := range tests {
+		if err := CheckLeitwegID(id); (err == nil) != valid {
+			t.Errorf("CheckLeitwegID(%q) = %v", id, err)
+		}
+	}
+}
+
+func TestIdentifierIssues(t *testing.T) {
+	inv := &model.Invoice{
+		BuyerReference: "04011000-12345-04",
+		Seller: model.Party{
+			VATID:             "DE136695977",
+			TaxRegistrationID: "201/113/40209",
+			Identifiers:       []model.Identifier{{ID: "4000001000005", Scheme: schemeGLN}, {Scheme: schemeGLN}}, // Empty IDs are not checked
+		},
+		PaymentInstructions: model.PaymentInstructions{CreditTransfers: []model.CreditTransfer{
+			{AccountID: "DE89 3704 0044 0532 0130 01", ProviderID: "COBADEFFXXX"},
+			{AccountID: "12345678"}, // Not an IBAN, allowed outside SEPA
+		}},
+		Lines: []model.Line{{Item: model.Item{StandardID: model.Identifier{ID: "4006381333932", Scheme: schemeGTIN}}}},
+	}
+
+	want := map[string]string{
+		"BT-31":  "DE136695977",
+		"BT-84":  "DE89 3704 0044 0532 0130 01",
+		"BT-157": "4006381333932",
+	}
+	check := func() {
+		t.Helper()
+		issues := IdentifierIssues(inv)
+		got := make(map[string]string)
+		for _, issue := range issues {
+			got[issue.Field] = issue.Value
+		}
+		if len(got) != len(want) || len(issues) != len(want) {
+			t.Errorf("issues = %+v, want fields %v", issues, want)
+		}
+		for field, value := range want {
+			if got[field] != value {
+				t.Errorf("%s = %q, want %q", field, got[field], value)
+			}
+		}
+	}
+	check()
+
+	// The Leitweg-ID is checked on XRechnung invoices only
+	inv.SpecificationID = "urn:cen.eu:en16931:2017#compliant#urn:xeinkauf.de:kosit:xrechnung_3.0"
+	want["BT-10"] = "04011000-12345-04"
+	check()
+}
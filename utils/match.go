@@ -0,0 +1,284 @@
+package utils
+
+import (
+	"fmt"
+
+	"eBill-Convert/model"
+)
+
+// MatchTolerances are the accepted deviations of invoiced quantities and
+// unit prices, in percent of the ordered or delivered values.
+type MatchTolerances struct {
+	QuantityPercent model.Decimal `json:"quantityPercent"`
+	PricePercent    model.Decimal `json:"pricePercent"`
+}
+
+// MatchReport is the outcome of matching an invoice against its order and
+// despatch advice.
+type MatchReport struct {
+	Matched        bool            `json:"matched"` // No error, i.e. no deviation beyond the tolerances
+	Invoice        string          `json:"invoice"`
+	Order          string          `json:"order,omitempty"`
+	DespatchAdvice string          `json:"despatchAdvice,omitempty"`
+	Tolerances     MatchTolerances `json:"tolerances"`
+	Lines          []LineMatch     `json:"lines"`
+	Issues         []MatchIssue    `json:"issues"`
+}
+
+// LineMatch relates an invoice line to its order line and despatch lines.
+type LineMatch struct {
+	InvoiceLine       string        `json:"invoiceLine"`
+	OrderLine         string        `json:"orderLine,omitempty"`
+	DespatchLines     []string      `json:"despatchLines,omitempty"`
+	MatchedBy         string        `json:"matchedBy,omitempty"` // line reference or article ID
+	InvoicedQuantity  model.Decimal `json:"invoicedQuantity"`
+	OrderedQuantity   model.Decimal `json:"orderedQuantity"`
+	DeliveredQuantity model.Decimal `json:"deliveredQuantity"`
+	InvoicedPrice     model.Decimal `json:"invoicedPrice"` // Net price per unit
+	OrderedPrice      model.Decimal `json:"orderedPrice"`
+}
+
+// MatchIssue is a discrepancy between the documents.
+type MatchIssue struct {
+	Kind      string        `json:"kind"`     // reference, currency, unmatched, unit, quantity or price
+	Severity  string        `json:"severity"` // error or warning
+	Line      string        `json:"line,omitempty"`
+	Message   string        `json:"message"`
+	Deviation model.Decimal `json:"deviation"` // Percent of the ordered or delivered value
+}
+
+// Ways of relating lines
+const (
+	matchedByLineReference = "line reference"
+	matchedByArticleID     = "article ID"
+)
+
+// matcher collects the issues of one match.
+type matcher struct {
+	report     *MatchReport
+	tolerances MatchTolerances
+}
+
+func (m *matcher) issue(kind, severity, line, message string) {
+	m.report.Issues = append(m.report.Issues, MatchIssue{Kind: kind, Severity: severity, Line: line, Message: message})
+}
+
+// Match matches the invoice line by line against the order and the despatch
+// advice, either of which may be nil. Lines are related by the order line
+// reference (BT-132) and otherwise by seller, buyer or standard article ID.
+// Quantities and unit prices deviating beyond the tolerances are errors, as
+// are references to other documents; ordered or delivered lines that are
+// not invoiced are warnings, since invoices may be partial.
+func Match(inv *model.Invoice, order *model.Order, advice *model.DespatchAdvice, tolerances MatchTolerances) *MatchReport {
+	report := &MatchReport{Invoice: inv.Number, Tolerances: tolerances, Lines: []LineMatch{}, Issues: []MatchIssue{}}
+	m := &matcher{report: report, tolerances: tolerances}
+
+	if order != nil {
+		report.Order = order.Number
+		if ref := inv.PurchaseOrderReference; ref == "" {
+			m.issue("reference", "warning", "", "The invoice does not reference an order (BT-13).")
+		} else if !orderNumbered(order, ref) {
+			m.issue("reference", "error", "", fmt.Sprintf("The invoice references order %s (BT-13), not %s.", ref, order.Number))
+		}
+		if order.CurrencyCode != "" && inv.CurrencyCode != order.CurrencyCode {
+			m.issue("currency", "error", "", fmt.Sprintf("The invoice currency %s differs from the order currency %s.", inv.CurrencyCode, order.CurrencyCode))
+		}
+	}
+	if advice != nil {
+		report.DespatchAdvice = advice.Number
+		if ref := inv.DespatchAdviceReference; ref != "" && ref != advice.Number {
+			m.issue("reference", "error", "", fmt.Sprintf("The invoice references despatch advice %s (BT-16), not %s.", ref, advice.Number))
+		}
+		if order != nil && advice.OrderReference != "" && !orderNumbered(order, advice.OrderReference) {
+			m.issue("reference", "error", "", fmt.Sprintf("The despatch advice references order %s, not %s.", advice.OrderReference, order.Number))
+		}
+	}
+
+	invoicedOrderLines := map[int]bool{}
+	invoicedDespatchLines := map[int]bool{}
+	for _, line := range inv.Lines {
+		match := LineMatch{InvoiceLine: line.ID, InvoicedQuantity: line.Quantity, InvoicedPrice: unitPrice(line.Price)}
+
+		var orderLine *model.OrderLine
+		if order != nil {
+			if i, by := findOrderLine(line, order.Lines); i >= 0 {
+				orderLine = &order.Lines[i]
+				invoicedOrderLines[i] = true
+				match.OrderLine = orderLine.ID
+				match.MatchedBy = by
+				match.OrderedQuantity = orderLine.AgreedQuantity
+				if !match.OrderedQuantity.IsSet() {
+					match.OrderedQuantity = orderLine.Quantity
+				}
+				match.OrderedPrice = unitPrice(orderLine.Price)
+			} else {
+				m.issue("unmatched", "error", line.ID, "The invoice line matches no order line.")
+			}
+		}
+
+		if advice != nil {
+			delivered := model.NewDecimal(0, 0)
+			for _, i := range findDespatchLines(line, orderLine, order, advice.Lines) {
+				invoicedDespatchLines[i] = true
+				despatchLine := advice.Lines[i]
+				match.DespatchLines = append(match.DespatchLines, despatchLine.ID)
+				delivered = delivered.Add(despatchLine.Quantity)
+				m.unit(line, despatchLine.UnitCode, "despatch")
+			}
+			if len(match.DespatchLines) == 0 {
+				m.issue("unmatched", "error", line.ID, "The invoice line matches no despatch line.")
+			} else {
+				match.DeliveredQuantity = delivered
+				m.deviation("quantity", line.ID, "delivered quantity", match.InvoicedQuantity, delivered, m.tolerances.QuantityPercent)
+			}
+		}
+
+		if orderLine != nil {
+			m.unit(line, orderLine.UnitCode, "order")
+			m.deviation("quantity", line.ID, "ordered quantity", match.InvoicedQuantity, match.OrderedQuantity, m.tolerances.QuantityPercent)
+			m.deviation("price", line.ID, "ordered unit price", match.InvoicedPrice, match.OrderedPrice, m.tolerances.PricePercent)
+		}
+		report.Lines = append(report.Lines, match)
+	}
+
+	if order != nil {
+		for i, line := range order.Lines {
+			if !invoicedOrderLines[i] {
+				m.issue("unmatched", "warning", line.ID, fmt.Sprintf("Order line %s is not invoiced.", line.ID))
+			}
+		}
+	}
+	if advice != nil {
+		for i, line := range advice.Lines {
+			if !invoicedDespatchLines[i] {
+				m.issue("unmatched", "warning", line.ID, fmt.Sprintf("Despatch line %s is not invoiced.", line.ID))
+			}
+		}
+	}
+
+	report.Matched = true
+	for _, issue := range report.Issues {
+		if issue.Severity == "error" {
+			report.Matched = false
+		}
+	}
+	return report
+}
+
+// unit reports an invoice line whose unit differs from the unit of the
+// order or despatch line.
+func (m *matcher) unit(line model.Line, unit, document string) {
+	if line.UnitCode != "" && unit != "" && line.UnitCode != unit {
+		m.issue("unit", "error", line.ID, fmt.Sprintf("The invoiced unit %s differs from the %s unit %s.", line.UnitCode, document, unit))
+	}
+}
+
+// deviation reports an invoiced value that deviates from the expected value
+// by more than tolerance percent. Missing values are not compared.
+func (m *matcher) deviation(kind, line, name string, invoiced, expected, tolerance model.Decimal) {
+	if !invoiced.IsSet() || !expected.IsSet() {
+		return
+	}
+	difference := invoiced.Sub(expected)
+	if difference.Sign() == 0 {
+		return
+	}
+	if expected.Sign() == 0 {
+		m.issue(kind, "error", line, fmt.Sprintf("The invoiced %s %s differs from the %s 0.", kind, invoiced, name))
+		return
+	}
+	percent := difference.Mul(model.NewDecimal(100, 0)).Div(expected, 2)
+	if absDecimal(percent).Cmp(tolerance) <= 0 {
+		return
+	}
+	m.report.Issues = append(m.report.Issues, MatchIssue{
+		Kind:      kind,
+		Severity:  "error",
+		Line:      line,
+		Message:   fmt.Sprintf("The invoiced %s %s differs from the %s %s by %s %%.", kind, invoiced, name, expected, percent),
+		Deviation: percent,
+	})
+}
+
+func absDecimal(d model.Decimal) model.Decimal {
+	if d.Sign() < 0 {
+		return d.Neg()
+	}
+	return d
+}
+
+// unitPrice returns the net price per unit of quantity (BT-146 / BT-149).
+func unitPrice(price model.Price) model.Decimal {
+	if !price.Net.IsSet() || !price.BaseQuantity.IsSet() || price.BaseQuantity.Sign() == 0 {
+		return price.Net
+	}
+	return price.Net.Div(price.BaseQuantity, 6)
+}
+
+// orderNumbered reports whether number denotes the order or, for a change
+// or response, the order it refers to.
+func orderNumbered(order *model.Order, number string) bool {
+	return number == order.Number || (order.OrderReference != "" && number == order.OrderReference)
+}
+
+// findOrderLine returns the index of the order line of the invoice line and
+// how it was found, or -1.
+func findOrderLine(line model.Line, lines []model.OrderLine) (int, string) {
+	if ref := line.OrderLineReference; ref != "" {
+		for i, orderLine := range lines {
+			if orderLine.ID == ref {
+				return i, matchedByLineReference
+			}
+		}
+	}
+	for i, orderLine := range lines {
+		if sameArticle(line.Item, orderLine.Item) {
+			return i, matchedByArticleID
+		}
+	}
+	return -1, ""
+}
+
+// findDespatchLines returns the indexes of the despatch lines of the
+// invoice line, related by order line or article ID.
+func findDespatchLines(line model.Line, orderLine *model.OrderLine, order *model.Order, lines []model.DespatchLine) []int {
+	ref := line.OrderLineReference
+	if orderLine != nil {
+		ref = orderLine.ID
+	}
+	var found []int
+	if ref != "" {
+		for i, despatchLine := range lines {
+			if despatchLine.OrderLineReference != ref {
+				continue
+			}
+			if order != nil && despatchLine.OrderReference != "" && !orderNumbered(order, despatchLine.OrderReference) {
+				continue
+			}
+			found = append(found, i)
+		}
+	}
+	if len(found) > 0 {
+		return found
+	}
+	for i, despatchLine := range lines {
+		if sameArticle(line.Item, despatchLine.Item) {
+			found = append(found, i)
+		}
+	}
+	return found
+}
+
+// sameArticle reports whether both items carry the same seller, buyer or
+// standard article ID.
+func sameArticle(a, b model.Item) bool {
+	switch {
+	case a.SellerID != "" && a.SellerID == b.SellerID:
+		return true
+	case a.BuyerID != "" && a.BuyerID == b.BuyerID:
+		return true
+	case a.StandardID.ID != "" && a.StandardID.ID == b.StandardID.ID && a.StandardID.Scheme == b.StandardID.Scheme:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package utils
+
+import "strings"
+
+func normalizeIBAN(iban string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(iban), ""))
+}
+
+// isCreditorReference reports whether ref is a valid ISO 11649 RF reference.
+func isCreditorReference(ref string) bool {
+	ref = strings.ToUpper(strings.ReplaceAll(ref, " ", ""))
+	if len(ref) < 5 || len(ref) > 25 || !strings.HasPrefix(ref, "RF") {
+		return false
+	}
+	return mod97(ref[4:]+ref[:4]) == 1
+}
+
+// mod97 computes the ISO 7064 MOD 97-10 remainder of an alphanumeric
+// string, letters counting as 10 to 35. It returns -1 for other characters.
+func mod97(s string) int {
+	remainder := 0
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			remainder = (remainder*10 + int(c-'0')) % 97
+		case c >= 'A' && c <= 'Z':
+			remainder = (remainder*100 + int(c-'A') + 10) % 97
+		default:
+			return -1
+		}
+	}
+	return remainder
+}
+
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) > n {
+		return string(runes[:n])
+	}
+	return s
+}
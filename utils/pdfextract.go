@@ -0,0 +1,521 @@
+package utils
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// EmbeddedFile is a file attached to a PDF document.
+type EmbeddedFile struct {
+	Name string
+	Data []byte
+}
+
+// Attachment names used by ZUGFeRD, Factur-X and XRechnung hybrid PDFs,
+// in order of preference.
+var invoiceAttachmentNames = []string{
+	"factur-x.xml",
+	"zugferd-invoice.xml",
+	"ZUGFeRD-invoice.xml",
+	"xrechnung.xml",
+}
+
+// IsPDF reports whether data starts with a PDF header.
+func IsPDF(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimLeft(data, "\x00\t\r\n "), []byte("%PDF-"))
+}
+
+// ExtractInvoiceXML returns the invoice XML embedded in a hybrid PDF. Known
+// attachment names are preferred, otherwise the first XML attachment is
+// used.
+func ExtractInvoiceXML(pdf []byte) (*EmbeddedFile, error) {
+	files, err := ExtractEmbeddedFiles(pdf)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range invoiceAttachmentNames {
+		for i := range files {
+			if strings.EqualFold(files[i].Name, name) {
+				return &files[i], nil
+			}
+		}
+	}
+	for i := range files {
+		if strings.HasSuffix(strings.ToLower(files[i].Name), ".xml") {
+			return &files[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no embedded invoice XML found")
+}
+
+// ExtractEmbeddedFiles returns all embedded files of a PDF document. Only
+// unencrypted documents with uncompressed or Flate compressed streams are
+// supported, which covers PDF/A-3 hybrid invoices.
+func ExtractEmbeddedFiles(pdf []byte) ([]EmbeddedFile, error) {
+	if !IsPDF(pdf) {
+		return nil, fmt.Errorf("not a PDF document")
+	}
+	doc, err := indexPDF(pdf)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := doc.trailerValue("Encrypt"); ok {
+		return nil, fmt.Errorf("encrypted PDF documents are not supported")
+	}
+
+	var files []EmbeddedFile
+	used := make(map[int]bool)
+	for _, num := range doc.order {
+		dict, ok := doc.object(num).(pdfDict)
+		if !ok {
+			continue
+		}
+		ef, ok := doc.resolve(dict["EF"]).(pdfDict)
+		if !ok {
+			continue
+		}
+		ref, ok := ef["UF"].(pdfRef)
+		if !ok {
+			ref, ok = ef["F"].(pdfRef)
+		}
+		if !ok || used[ref.num] {
+			continue
+		}
+
+		name := ""
+		for _, key := range []string{"UF", "F"} {
+			if s, ok := doc.resolve(dict[key]).(pdfString); ok && len(s) > 0 {
+				name = decodePDFText(s)
+				break
+			}
+		}
+		data, err := doc.stream(ref.num)
+		if err != nil {
+			return nil, fmt.Errorf("error reading embedded file %q: %w", name, err)
+		}
+		if name == "" {
+			name = fmt.Sprintf("attachment-%d", len(files)+1)
+		}
+		used[ref.num] = true
+		files = append(files, EmbeddedFile{Name: name, Data: data})
+	}
+
+	// Embedded file streams without file specification
+	for _, num := range doc.order {
+		if used[num] {
+			continue
+		}
+		if dict, ok := doc.object(num).(pdfDict); ok && dict["Type"] == pdfName("EmbeddedFile") {
+			data, err := doc.stream(num)
+			if err != nil {
+				return nil, fmt.Errorf("error reading embedded file: %w", err)
+			}
+			files = append(files, EmbeddedFile{Name: fmt.Sprintf("attachment-%d", len(files)+1), Data: data})
+		}
+	}
+
+	return files, nil
+}
+
+type pdfName string
+type pdfString []byte
+type pdfArray []any
+type pdfDict map[string]any
+type pdfRef struct{ num, gen int }
+
+// pdfObject is an indirect object, either located in the file or taken
+// from an object stream.
+type pdfObject struct {
+	offset int // Offset of the object value in the file, -1 if compressed
+	value  any
+	parsed bool
+}
+
+type pdfDocument struct {
+	data    []byte
+	objects map[int]*pdfObject
+	order   []int
+	trailer []pdfDict
+}
+
+var pdfObjectHeader = regexp.MustCompile(`(?:^|[\r\n\s])(\d+)\s+(\d+)\s+obj\b`)
+var pdfTrailer = regexp.MustCompile(`trailer\s*<<`)
+
+// indexPDF locates all indirect objects by scanning for object headers,
+// which also works for files with damaged cross reference tables.
+func indexPDF(data []byte) (*pdfDocument, error) {
+	doc := &pdfDocument{data: data, objects: make(map[int]*pdfObject)}
+	for _, match := range pdfObjectHeader.FindAllSubmatchIndex(data, -1) {
+		num, _ := strconv.Atoi(string(data[match[2]:match[3]]))
+		if _, seen := doc.objects[num]; !seen {
+			doc.order = append(doc.order, num)
+		}
+		// Later definitions win, as in incremental updates
+		doc.objects[num] = &pdfObject{offset: match[1]}
+	}
+	if len(doc.objects) == 0 {
+		return nil, fmt.Errorf("no PDF objects found")
+	}
+
+	for _, match := range pdfTrailer.FindAllIndex(data, -1) {
+		p := &pdfParser{data: data, pos: match[1] - 2}
+		if dict, ok := p.parseValue().(pdfDict); ok {
+			doc.trailer = append(doc.trailer, dict)
+		}
+	}
+
+	// Objects compressed into object streams
+	for _, num := range append([]int(nil), doc.order...) {
+		dict, ok := doc.object(num).(pdfDict)
+		if !ok {
+			continue
+		}
+		if dict["Type"] == pdfName("XRef") {
+			doc.trailer = append(doc.trailer, dict)
+		}
+		if dict["Type"] != pdfName("ObjStm") {
+			continue
+		}
+		content, err := doc.stream(num)
+		if err != nil {
+			continue
+		}
+		n, _ := doc.resolve(dict["N"]).(int)
+		first, _ := doc.resolve(dict["First"]).(int)
+		header := &pdfParser{data: content}
+		for i := 0; i < n; i++ {
+			objNum, ok1 := header.parseValue().(int)
+			offset, ok2 := header.parseValue().(int)
+			if !ok1 || !ok2 || first+offset >= len(content) {
+				break
+			}
+			if _, exists := doc.objects[objNum]; exists {
+				continue
+			}
+			p := &pdfParser{data: content, pos: first + offset}
+			doc.objects[objNum] = &pdfObject{offset: -1, value: p.parseValue(), parsed: true}
+			doc.order = append(doc.order, objNum)
+		}
+	}
+
+	return doc, nil
+}
+
+func (d *pdfDocument) trailerValue(key string) (any, bool) {
+	for _, dict := range d.trailer {
+		if value, ok := dict[key]; ok {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+func (d *pdfDocument) object(num int) any {
+	obj, ok := d.objects[num]
+	if !ok {
+		return nil
+	}
+	if !obj.parsed {
+		p := &pdfParser{data: d.data, pos: obj.offset}
+		obj.value = p.parseValue()
+		obj.parsed = true
+	}
+	return obj.value
+}
+
+func (d *pdfDocument) resolve(value any) any {
+	for depth := 0; depth < 32; depth++ {
+		ref, ok := value.(pdfRef)
+		if !ok {
+			return value
+		}
+		value = d.object(ref.num)
+	}
+	return nil
+}
+
+// stream returns the decoded stream data of an object.
+func (d *pdfDocument) stream(num int) ([]byte, error) {
+	obj, ok := d.objects[num]
+	if !ok || obj.offset < 0 {
+		return nil, fmt.Errorf("stream object %d not found", num)
+	}
+	dict, ok := d.object(num).(pdfDict)
+	if !ok {
+		return nil, fmt.Errorf("object %d is not a stream", num)
+	}
+
+	p := &pdfParser{data: d.data, pos: obj.offset}
+	p.parseValue()
+	p.skipSpace()
+	if !bytes.HasPrefix(d.data[p.pos:], []byte("stream")) {
+		return nil, fmt.Errorf("object %d is not a stream", num)
+	}
+	start := p.pos + len("stream")
+	if start < len(d.data) && d.data[start] == '\r' {
+		start++
+	}
+	if start < len(d.data) && d.data[start] == '\n' {
+		start++
+	}
+
+	length, ok := d.resolve(dict["Length"]).(int)
+	if !ok || length < 0 || start+length > len(d.data) {
+		// Fall back to the endstream keyword
+		end := bytes.Index(d.data[start:], []byte("endstream"))
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated stream in object %d", num)
+		}
+		length = len(bytes.TrimRight(d.data[start:start+end], "\r\n"))
+	}
+	raw := d.data[start : start+length]
+
+	var filters []any
+	switch f := d.resolve(dict["Filter"]).(type) {
+	case pdfName:
+		filters = []any{f}
+	case pdfArray:
+		filters = f
+	}
+	for _, filter := range filters {
+		switch d.resolve(filter) {
+		case pdfName("FlateDecode"):
+			r, err := zlib.NewReader(bytes.NewReader(raw))
+			if err != nil {
+				return nil, fmt.Errorf("error decompressing stream %d: %w", num, err)
+			}
+			decoded, err := io.ReadAll(r)
+			if err != nil && len(decoded) == 0 {
+				return nil, fmt.Errorf("error decompressing stream %d: %w", num, err)
+			}
+			raw = decoded
+		default:
+			return nil, fmt.Errorf("unsupported stream filter %v", filter)
+		}
+	}
+	return raw, nil
+}
+
+// decodePDFText decodes a PDF text string, UTF-16BE with byte order mark
+// or PDFDocEncoding (treated as Latin-1).
+func decodePDFText(s pdfString) string {
+	if len(s) >= 2 && s[0] == 0xFE && s[1] == 0xFF {
+		units := make([]uint16, 0, len(s)/2)
+		for i := 2; i+1 < len(s); i += 2 {
+			units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+		}
+		return string(utf16.Decode(units))
+	}
+	runes := make([]rune, len(s))
+	for i, b := range s {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// pdfParser reads PDF values (without stream data) from a byte slice.
+type pdfParser struct {
+	data []byte
+	pos  int
+}
+
+func (p *pdfParser) skipSpace() {
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		if c == '%' {
+			for p.pos < len(p.data) && p.data[p.pos] != '\n' && p.data[p.pos] != '\r' {
+				p.pos++
+			}
+			continue
+		}
+		if !isPDFSpace(c) {
+			return
+		}
+		p.pos++
+	}
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func (p *pdfParser) parseValue() any {
+	p.skipSpace()
+	if p.pos >= len(p.data) {
+		return nil
+	}
+
+	switch c := p.data[p.pos]; {
+	case c == '<' && p.pos+1 < len(p.data) && p.data[p.pos+1] == '<':
+		p.pos += 2
+		dict := pdfDict{}
+		for {
+			p.skipSpace()
+			if p.pos >= len(p.data) {
+				return dict
+			}
+			if bytes.HasPrefix(p.data[p.pos:], []byte(">>")) {
+				p.pos += 2
+				return dict
+			}
+			key, ok := p.parseValue().(pdfName)
+			if !ok {
+				return dict
+			}
+			dict[string(key)] = p.parseValue()
+		}
+	case c == '[':
+		p.pos++
+		var array pdfArray
+		for {
+			p.skipSpace()
+			if p.pos >= len(p.data) {
+				return array
+			}
+			if p.data[p.pos] == ']' {
+				p.pos++
+				return array
+			}
+			array = append(array, p.parseValue())
+		}
+	case c == '(':
+		return p.parseLiteralString()
+	case c == '<':
+		return p.parseHexString()
+	case c == '/':
+		p.pos++
+		start := p.pos
+		for p.pos < len(p.data) && !isPDFSpace(p.data[p.pos]) && !isPDFDelimiter(p.data[p.pos]) {
+			p.pos++
+		}
+		return pdfName(p.data[start:p.pos])
+	}
+
+	token := p.readToken()
+	if token == "" {
+		p.pos++ // Skip stray delimiter
+		return nil
+	}
+	switch token {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+	if n, err := strconv.Atoi(token); err == nil {
+		// An integer may start an indirect reference "num gen R"
+		save := p.pos
+		p.skipSpace()
+		gen, err := strconv.Atoi(p.readToken())
+		if err == nil {
+			p.skipSpace()
+			if p.readToken() == "R" {
+				return pdfRef{num: n, gen: gen}
+			}
+		}
+		p.pos = save
+		return n
+	}
+	if f, err := strconv.ParseFloat(token, 64); err == nil {
+		return f
+	}
+	return token
+}
+
+func (p *pdfParser) readToken() string {
+	start := p.pos
+	for p.pos < len(p.data) && !isPDFSpace(p.data[p.pos]) && !isPDFDelimiter(p.data[p.pos]) {
+		p.pos++
+	}
+	return string(p.data[start:p.pos])
+}
+
+func (p *pdfParser) parseLiteralString() pdfString {
+	p.pos++ // (
+	var out []byte
+	depth := 1
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		p.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return out
+			}
+		case '\\':
+			if p.pos >= len(p.data) {
+				return out
+			}
+			e := p.data[p.pos]
+			p.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if p.pos < len(p.data) && p.data[p.pos] == '\n' {
+					p.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					value := int(e - '0')
+					for i := 0; i < 2 && p.pos < len(p.data) && p.data[p.pos] >= '0' && p.data[p.pos] <= '7'; i++ {
+						value = value*8 + int(p.data[p.pos]-'0')
+						p.pos++
+					}
+					c = byte(value)
+				} else {
+					c = e
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+func (p *pdfParser) parseHexString() pdfString {
+	p.pos++ // <
+	var digits []byte
+	for p.pos < len(p.data) && p.data[p.pos] != '>' {
+		if c := p.data[p.pos]; !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+		p.pos++
+	}
+	p.pos++ // >
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	for i := range out {
+		v, _ := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		out[i] = byte(v)
+	}
+	return out
+}
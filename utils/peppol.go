@@ -0,0 +1,272 @@
+package utils
+
+import (
+	"fmt"
+
+	"eBill-Convert/model"
+)
+
+// peppolRule is a business rule of Peppol BIS Billing 3.0. check returns
+// the location of every violation, e.g. "BT-23" or "BG-25[2].BT-131".
+type peppolRule struct {
+	rule    string
+	message string
+	check   func(inv *model.Invoice) []string
+}
+
+// peppolSlack is the rounding tolerance of the Peppol calculation rules.
+var peppolSlack = model.NewDecimal(2, 2)
+
+var hundred = model.NewDecimal(100, 0)
+
+// within reports whether a and b differ by at most the Peppol slack.
+func within(a, b model.Decimal) bool {
+	diff := a.Sub(b)
+	if diff.Sign() < 0 {
+		diff = diff.Neg()
+	}
+	return diff.Cmp(peppolSlack) <= 0
+}
+
+// violation returns the location as single violation if failed is true.
+func violation(failed bool, location string) []string {
+	if failed {
+		return []string{location}
+	}
+	return nil
+}
+
+// Rules of Peppol BIS Billing 3.0 that can be checked on the semantic model;
+// rules on the XML syntax itself, such as empty elements, are left out.
+var peppolRules = []peppolRule{
+	{"PEPPOL-EN16931-R001", "Business process MUST be provided.",
+		func(inv *model.Invoice) []string { return violation(inv.BusinessProcess == "", "BT-23") }},
+	{"PEPPOL-EN16931-R002", "No more than one note is allowed on document level, unless both the buyer and seller are German organizations.",
+		func(inv *model.Invoice) []string {
+			return violation(len(inv.Notes) > 1 && !model.GermanParties(inv), "BG-1")
+		}},
+	{"PEPPOL-EN16931-R003", "A buyer reference or purchase order reference MUST be provided.",
+		func(inv *model.Invoice) []string {
+			return violation(inv.BuyerReference == "" && inv.PurchaseOrderReference == "", "BT-10")
+		}},
+	{"PEPPOL-EN16931-R004", "Specification identifier MUST have the value '" + model.PeppolSpecificationID + "'.",
+		func(inv *model.Invoice) []string {
+			return violation(inv.SpecificationID != model.PeppolSpecificationID, "BT-24")
+		}},
+	{"PEPPOL-EN16931-R005", "VAT accounting currency code MUST be different from invoice currency code when provided.",
+		func(inv *model.Invoice) []string {
+			return violation(inv.TaxCurrencyCode != "" && inv.TaxCurrencyCode == inv.CurrencyCode, "BT-6")
+		}},
+	{"PEPPOL-EN16931-R007", "Business process MUST be in the format 'urn:fdc:peppol.eu:2017:poacc:billing:NN:1.0' where NN indicates the process number.",
+		func(inv *model.Invoice) []string {
+			return violation(inv.BusinessProcess != "" && !model.PeppolBusinessProcessPattern.MatchString(inv.BusinessProcess), "BT-23")
+		}},
+	{"PEPPOL-EN16931-R010", "Buyer electronic address MUST be provided.",
+		func(inv *model.Invoice) []string { return violation(!inv.Buyer.ElectronicAddress.IsSet(), "BT-49") }},
+	{"PEPPOL-EN16931-R020", "Seller electronic address MUST be provided.",
+		func(inv *model.Invoice) []string { return violation(!inv.Seller.ElectronicAddress.IsSet(), "BT-34") }},
+	{"PEPPOL-EN16931-R040", "Allowance/charge amount must equal base amount * percentage/100 if base amount and percentage exists.",
+		func(inv *model.Invoice) []string {
+			return checkAllowanceCharges(inv, func(ac model.AllowanceCharge) bool {
+				return ac.BaseAmount.IsSet() && ac.Percentage.IsSet() &&
+					!within(ac.Amount, ac.BaseAmount.Mul(ac.Percentage).Div(hundred, model.AmountDecimals))
+			})
+		}},
+	{"PEPPOL-EN16931-R041", "Allowance/charge base amount MUST be provided when allowance/charge percentage is provided.",
+		func(inv *model.Invoice) []string {
+			return checkAllowanceCharges(inv, func(ac model.AllowanceCharge) bool {
+				return ac.Percentage.IsSet() && !ac.BaseAmount.IsSet()
+			})
+		}},
+	{"PEPPOL-EN16931-R042", "Allowance/charge percentage MUST be provided when allowance/charge base amount is provided.",
+		func(inv *model.Invoice) []string {
+			return checkAllowanceCharges(inv, func(ac model.AllowanceCharge) bool {
+				return ac.BaseAmount.IsSet() && !ac.Percentage.IsSet()
+			})
+		}},
+	{"PEPPOL-EN16931-R046", "Item net price MUST equal (Gross price - Allowance amount) when gross price is provided.",
+		func(inv *model.Invoice) []string {
+			return checkLines(inv, "BT-146", func(line model.Line) bool {
+				price := line.Price
+				return price.Gross.IsSet() && price.Net.Cmp(price.Gross.Sub(price.Discount)) != 0
+			})
+		}},
+	{"PEPPOL-EN16931-R055", "Invoice total VAT amount and Invoice total VAT amount in accounting currency MUST have the same operational sign.",
+		func(inv *model.Invoice) []string {
+			tax, accounting := inv.Totals.Tax, inv.Totals.TaxAccounting
+			return violation(tax.IsSet() && accounting.IsSet() && tax.Sign()*accounting.Sign() < 0, "BT-111")
+		}},
+	{"PEPPOL-EN16931-R061", "Mandate reference MUST be provided for direct debit.",
+		func(inv *model.Invoice) []string {
+			payment := inv.PaymentInstructions
+			return violation(payment.MeansCode == "59" && (payment.DirectDebit == nil || payment.DirectDebit.MandateID == ""), "BT-89")
+		}},
+	{"PEPPOL-EN16931-R110", "Start date of line period MUST be within invoice period.",
+		func(inv *model.Invoice) []string {
+			return checkLines(inv, "BT-134", func(line model.Line) bool { return !inPeriod(line.Period.Start, inv.InvoicingPeriod) })
+		}},
+	{"PEPPOL-EN16931-R111", "End date of line period MUST be within invoice period.",
+		func(inv *model.Invoice) []string {
+			return checkLines(inv, "BT-135", func(line model.Line) bool { return !inPeriod(line.Period.End, inv.InvoicingPeriod) })
+		}},
+	{"PEPPOL-EN16931-R120", "Invoice line net amount MUST equal (Invoiced quantity * (Item net price/item price base quantity) + Sum of invoice line charge amount - sum of invoice line allowance amount.",
+		func(inv *model.Invoice) []string {
+			return checkLines(inv, "BT-131", func(line model.Line) bool {
+				if !line.Quantity.IsSet() || !line.Price.Net.IsSet() || line.Price.BaseQuantity.Sign() < 0 {
+					return false
+				}
+				net := line.Quantity.Mul(line.Price.Net)
+				if line.Price.BaseQuantity.Sign() > 0 {
+					net = net.Div(line.Price.BaseQuantity, model.AmountDecimals)
+				}
+				for _, charge := range line.Charges {
+					net = net.Add(charge.Amount)
+				}
+				for _, allowance := range line.Allowances {
+					net = net.Sub(allowance.Amount)
+				}
+				return !within(line.NetAmount, net)
+			})
+		}},
+	{"PEPPOL-EN16931-R121", "Base quantity MUST be a positive number above zero.",
+		func(inv *model.Invoice) []string {
+			return checkLines(inv, "BT-149", func(line model.Line) bool {
+				return line.Price.BaseQuantity.IsSet() && line.Price.BaseQuantity.Sign() <= 0
+			})
+		}},
+	{"PEPPOL-EN16931-R130", "Unit code of price base quantity MUST be same as invoiced quantity.",
+		func(inv *model.Invoice) []string {
+			return checkLines(inv, "BT-150", func(line model.Line) bool {
+				return line.Price.BaseQuantityUnit != "" && line.Price.BaseQuantityUnit != line.UnitCode
+			})
+		}},
+	{"PEPPOL-EN16931-CL008", "Electronic address identifier scheme must be from the codelist 'Electronic Address Identifier Scheme'.",
+		func(inv *model.Invoice) []string {
+			var locations []string
+			if address := inv.Seller.ElectronicAddress; address.IsSet() && !easCodes[address.Scheme] {
+				locations = append(locations, "BT-34-1")
+			}
+			if address := inv.Buyer.ElectronicAddress; address.IsSet() && !easCodes[address.Scheme] {
+				locations = append(locations, "BT-49-1")
+			}
+			return locations
+		}},
+}
+
+// checkAllowanceCharges returns the document and line allowances and charges
+// for which failed reports true.
+func checkAllowanceCharges(inv *model.Invoice, failed func(model.AllowanceCharge) bool) []string {
+	var locations []string
+	check := func(at string, acs []model.AllowanceCharge) {
+		for i, ac := range acs {
+			if failed(ac) {
+				locations = append(locations, fmt.Sprintf("%s[%d]", at, i))
+			}
+		}
+	}
+	check("BG-20", inv.Allowances)
+	check("BG-21", inv.Charges)
+	for _, line := range inv.Lines {
+		check(fmt.Sprintf("BG-25[%s].BG-27", line.ID), line.Allowances)
+		check(fmt.Sprintf("BG-25[%s].BG-28", line.ID), line.Charges)
+	}
+	return locations
+}
+
+// checkLines returns the term of every line for which failed reports true.
+func checkLines(inv *model.Invoice, term string, failed func(model.Line) bool) []string {
+	var locations []string
+	for _, line := range inv.Lines {
+		if failed(line) {
+			locations = append(locations, fmt.Sprintf("BG-25[%s].%s", line.ID, term))
+		}
+	}
+	return locations
+}
+
+// inPeriod reports whether the date lies within the period; absent dates
+// and open period ends always match.
+func inPeriod(date model.Date, period model.Period) bool {
+	if !date.IsSet() {
+		return true
+	}
+	t := date.Time()
+	if period.Start.IsSet() && t.Before(period.Start.Time()) {
+		return false
+	}
+	if period.End.IsSet() && t.After(period.End.Time()) {
+		return false
+	}
+	return true
+}
+
+// peppolIssues checks the invoice against the Peppol BIS Billing 3.0 rules.
+func peppolIssues(inv *model.Invoice) []ValidationIssue {
+	var issues []ValidationIssue
+	for _, rule := range peppolRules {
+		for _, location := range rule.check(inv) {
+			issues = append(issues, ValidationIssue{
+				Rule:     rule.rule,
+				Severity: "error",
+				Field:    location,
+				Message:  rule.message,
+			})
+		}
+	}
+	return issues
+}
+
+// easCodes is the Peppol code list of electronic address schemes (EAS).
+var easCodes = map[string]bool{
+	"0002": true, "0007": true, "0009": true, "0037": true, "0060": true, "0088": true, "0096": true,
+	"0097": true, "0106": true, "0130": true, "0135": true, "0142": true, "0147": true, "0151": true,
+	"0154": true, "0158": true, "0170": true, "0177": true, "0183": true, "0184": true, "0188": true,
+	"0190": true, "0191": true, "0192": true, "0193": true, "0194": true, "0195": true, "0196": true,
+	"0198": true, "0199": true, "0200": true, "0201": true, "0202": true, "0203": true, "0204": true,
+	"0205": true, "0208": true, "0209": true, "0210": true, "0211": true, "0212": true, "0213": true,
+	"0215": true, "0216": true, "0217": true, "0218": true, "0219": true, "0220": true, "0221": true,
+	"0225": true, "0230": true, "0235": true, "0240": true,
+	"9901": true, "9910": true, "9913": true, "9914": true, "9915": true, "9918": true, "9919": true,
+	"9920": true, "9922": true, "9923": true, "9924": true, "9925": true, "9926": true, "9927": true,
+	"9928": true, "9929": true, "9930": true, "9931": true, "9932": true, "9933": true, "9934": true,
+	"9935": true, "9936": true, "9937": true, "9938": true, "9939": true, "9940": true, "9941": true,
+	"9942": true, "9943": true, "9944": true, "9945": true, "9946": true, "9947": true, "9948": true,
+	"9949": true, "9950": true, "9951": true, "9952": true, "9953": true, "9957": true, "9959": true,
+	"AN": true, "AQ": true, "AS": true, "AU": true, "EM": true,
+}
+
+// easNames are short names of common electronic address schemes.
+var easNames = map[string]string{
+	"0002": "FR:SIRENE",
+	"0007": "SE:ORGNR",
+	"0060": "DUNS",
+	"0088": "GLN",
+	"0106": "NL:KVK",
+	"0151": "AU:ABN",
+	"0184": "DK:DIGST",
+	"0190": "NL:OINO",
+	"0192": "NO:ORG",
+	"0204": "Leitweg-ID",
+	"0208": "BE:EN",
+	"0209": "GS1",
+	"0211": "IT:PIVA",
+	"9914": "AT:VAT",
+	"9925": "BE:VAT",
+	"9930": "DE:VAT",
+	"9944": "NL:VAT",
+	"9957": "FR:VAT",
+	"EM":   "E-Mail",
+}
+
+// EndpointName formats an electronic address (BT-34, BT-49) the way Peppol
+// writes participant identifiers, e.g. "0088:4012345000009 (GLN)".
+func EndpointName(address model.Identifier) string {
+	if address.Scheme == "" {
+		return address.ID
+	}
+	value := address.Scheme + ":" + address.ID
+	if name, ok := easNames[address.Scheme]; ok {
+		value += " (" + name + ")"
+	}
+	return value
+}
@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DocumentInfo describes the syntax and profile of an e-invoice.
+type DocumentInfo struct {
+	Syntax        string `json:"syntax"`        // CII or UBL
+	DocumentType  string `json:"documentType"`  // Root element name
+	GuidelineID   string `json:"guidelineId"`   // BT-24 specification identifier
+	Profile       string `json:"profile"`       // Human readable profile name
+	InvoiceNumber string `json:"invoiceNumber"` // BT-1
+}
+
+// Known BT-24 specification identifiers and their profile names. Entries
+// are matched in order, the first prefix match wins.
+var profiles = []struct {
+	prefix  string
+	profile string
+}{
+	{"urn:factur-x.eu:1p0:minimum", "MINIMUM"},
+	{"urn:factur-x.eu:1p0:basicwl", "BASIC WL"},
+	{"urn:cen.eu:en16931:2017#compliant#urn:factur-x.eu:1p0:basic", "BASIC"},
+	{"urn:cen.eu:en16931:2017#conformant#urn:factur-x.eu:1p0:extended", "EXTENDED"},
+	{"urn:cen.eu:en16931:2017#compliant#urn:xoev-de:kosit:standard:xrechnung", "XRECHNUNG"},
+	{"urn:cen.eu:en16931:2017#compliant#urn:xeinkauf.de:kosit:xrechnung", "XRECHNUNG"},
+	{"urn:cen.eu:en16931:2017#compliant#urn:fdc:peppol.eu:2017:poacc:billing:3.0", "PEPPOL BIS 3.0"},
+	{"urn:cen.eu:en16931:2017", "EN 16931"},
+	{"urn:ferd:CrossIndustryDocument:invoice:1p0:basic", "ZUGFeRD 1.0 BASIC"},
+	{"urn:ferd:CrossIndustryDocument:invoice:1p0:comfort", "ZUGFeRD 1.0 COMFORT"},
+	{"urn:ferd:CrossIndustryDocument:invoice:1p0:extended", "ZUGFeRD 1.0 EXTENDED"},
+}
+
+// ProfileName maps a specification identifier to its profile name. Unknown
+// identifiers are returned unchanged.
+func ProfileName(guidelineID string) string {
+	for _, p := range profiles {
+		if strings.HasPrefix(guidelineID, p.prefix) {
+			return p.profile
+		}
+	}
+	return guidelineID
+}
+
+// DetectDocument determines syntax, profile and invoice number of a CII,
+// ZUGFeRD 1.0 or UBL document.
+func DetectDocument(r io.Reader) (*DocumentInfo, error) {
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no root element found")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error decoding XML: %w", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		info := &DocumentInfo{DocumentType: start.Name.Local}
+		switch start.Name.Local {
+		case "CrossIndustryInvoice":
+			var cii struct {
+				ExchangedDocumentContext struct {
+					GuidelineSpecifiedDocumentContextParameter struct {
+						ID string `xml:"ID"`
+					} `xml:"GuidelineSpecifiedDocumentContextParameter"`
+				} `xml:"ExchangedDocumentContext"`
+				ExchangedDocument struct {
+					ID string `xml:"ID"`
+				} `xml:"ExchangedDocument"`
+			}
+			if err := decoder.DecodeElement(&cii, &start); err != nil {
+				return nil, fmt.Errorf("error decoding XML: %w", err)
+			}
+			info.Syntax = "CII"
+			info.GuidelineID = strings.TrimSpace(cii.ExchangedDocumentContext.GuidelineSpecifiedDocumentContextParameter.ID)
+			info.InvoiceNumber = strings.TrimSpace(cii.ExchangedDocument.ID)
+		case "CrossIndustryDocument":
+			// ZUGFeRD 1.0, the predecessor of CII D16B
+			var zf struct {
+				SpecifiedExchangedDocumentContext struct {
+					GuidelineSpecifiedDocumentContextParameter struct {
+						ID string `xml:"ID"`
+					} `xml:"GuidelineSpecifiedDocumentContextParameter"`
+				} `xml:"SpecifiedExchangedDocumentContext"`
+				HeaderExchangedDocument struct {
+					ID string `xml:"ID"`
+				} `xml:"HeaderExchangedDocument"`
+			}
+			if err := decoder.DecodeElement(&zf, &start); err != nil {
+				return nil, fmt.Errorf("error decoding XML: %w", err)
+			}
+			info.Syntax = "CII"
+			info.GuidelineID = strings.TrimSpace(zf.SpecifiedExchangedDocumentContext.GuidelineSpecifiedDocumentContextParameter.ID)
+			info.InvoiceNumber = strings.TrimSpace(zf.HeaderExchangedDocument.ID)
+		case "Invoice", "CreditNote":
+			var ubl struct {
+				CustomizationID string `xml:"CustomizationID"`
+				ID              string `xml:"ID"`
+			}
+			if err := decoder.DecodeElement(&ubl, &start); err != nil {
+				return nil, fmt.Errorf("error decoding XML: %w", err)
+			}
+			info.Syntax = "UBL"
+			info.GuidelineID = strings.TrimSpace(ubl.CustomizationID)
+			info.InvoiceNumber = strings.TrimSpace(ubl.ID)
+		default:
+			return nil, fmt.Errorf("unsupported document type: %s", start.Name.Local)
+		}
+
+		info.Profile = ProfileName(info.GuidelineID)
+		return info, nil
+	}
+}
@@ -0,0 +1,476 @@
+package utils
+
+import (
+	"fmt"
+)
+
+// QRErrorCorrection is the error correction level of a QR code symbol.
+type QRErrorCorrection int
+
+const (
+	QRErrorCorrectionL QRErrorCorrection = iota // ~7% recovery
+	QRErrorCorrectionM                          // ~15% recovery
+	QRErrorCorrectionQ                          // ~25% recovery
+	QRErrorCorrectionH                          // ~30% recovery
+)
+
+// formatBits returns the two bit value stored in the format information.
+func (e QRErrorCorrection) formatBits() int {
+	return [...]int{1, 0, 3, 2}[e]
+}
+
+// Error correction codewords per block, indexed by level and version.
+var qrEccCodewordsPerBlock = [4][41]int{
+	{-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+// Number of error correction blocks, indexed by level and version.
+var qrNumErrorCorrectionBlocks = [4][41]int{
+	{-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+// QRCode is an encoded QR code symbol. Modules are addressed as [y][x],
+// true meaning a dark module. The quiet zone is not included.
+type QRCode struct {
+	Version int
+	Size    int
+	Modules [][]bool
+
+	level      QRErrorCorrection
+	isFunction [][]bool
+}
+
+// EncodeQR encodes data in byte mode using the smallest version (up to
+// maxVersion, 40 if zero) that fits at the given error correction level.
+func EncodeQR(data []byte, level QRErrorCorrection, maxVersion int) (*QRCode, error) {
+	if maxVersion <= 0 || maxVersion > 40 {
+		maxVersion = 40
+	}
+
+	version := 0
+	for v := 1; v <= maxVersion; v++ {
+		capacityBits := qrNumDataCodewords(v, level) * 8
+		usedBits := 4 + qrCharCountBits(v) + len(data)*8
+		if usedBits <= capacityBits {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, fmt.Errorf("data too long for QR code: %d bytes", len(data))
+	}
+
+	// Segment header, payload, terminator and padding
+	var bits qrBitBuffer
+	bits.append(0x4, 4)
+	bits.append(len(data), qrCharCountBits(version))
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	capacityBits := qrNumDataCodewords(version, level) * 8
+	bits.append(0, min(4, capacityBits-len(bits)))
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacityBits; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	codewords := make([]byte, len(bits)/8)
+	for i, bit := range bits {
+		if bit {
+			codewords[i>>3] |= 1 << (7 - uint(i&7))
+		}
+	}
+
+	qr := &QRCode{Version: version, Size: version*4 + 17, level: level}
+	qr.Modules = make([][]bool, qr.Size)
+	qr.isFunction = make([][]bool, qr.Size)
+	for i := range qr.Modules {
+		qr.Modules[i] = make([]bool, qr.Size)
+		qr.isFunction[i] = make([]bool, qr.Size)
+	}
+
+	qr.drawFunctionPatterns()
+	qr.drawCodewords(qr.addEccAndInterleave(codewords))
+
+	// Pick the mask with the lowest penalty score
+	bestMask, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		qr.applyMask(mask)
+		qr.drawFormatBits(mask)
+		penalty := qr.penaltyScore()
+		if bestPenalty < 0 || penalty < bestPenalty {
+			bestMask, bestPenalty = mask, penalty
+		}
+		qr.applyMask(mask) // XOR again to undo
+	}
+	qr.applyMask(bestMask)
+	qr.drawFormatBits(bestMask)
+
+	return qr, nil
+}
+
+type qrBitBuffer []bool
+
+func (b *qrBitBuffer) append(value, length int) {
+	for i := length - 1; i >= 0; i-- {
+		*b = append(*b, (value>>uint(i))&1 != 0)
+	}
+}
+
+func qrCharCountBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+	return 16
+}
+
+func qrNumRawDataModules(version int) int {
+	result := (16*version+128)*version + 64
+	if version >= 2 {
+		numAlign := version/7 + 2
+		result -= (25*numAlign-10)*numAlign - 55
+		if version >= 7 {
+			result -= 36
+		}
+	}
+	return result
+}
+
+func qrNumDataCodewords(version int, level QRErrorCorrection) int {
+	return qrNumRawDataModules(version)/8 -
+		qrEccCodewordsPerBlock[level][version]*qrNumErrorCorrectionBlocks[level][version]
+}
+
+func qrAlignmentPatternPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	numAlign := version/7 + 2
+	step := (version*8 + numAlign*3 + 5) / (numAlign*4 - 4) * 2
+	result := make([]int, numAlign)
+	result[0] = 6
+	for i, pos := numAlign-1, version*4+17-7; i >= 1; i, pos = i-1, pos-step {
+		result[i] = pos
+	}
+	return result
+}
+
+func (qr *QRCode) setFunctionModule(x, y int, dark bool) {
+	qr.Modules[y][x] = dark
+	qr.isFunction[y][x] = true
+}
+
+func (qr *QRCode) drawFunctionPatterns() {
+	// Timing patterns
+	for i := 0; i < qr.Size; i++ {
+		qr.setFunctionModule(6, i, i%2 == 0)
+		qr.setFunctionModule(i, 6, i%2 == 0)
+	}
+
+	// Finder patterns
+	qr.drawFinderPattern(3, 3)
+	qr.drawFinderPattern(qr.Size-4, 3)
+	qr.drawFinderPattern(3, qr.Size-4)
+
+	// Alignment patterns, skipping the three finder corners
+	positions := qrAlignmentPatternPositions(qr.Version)
+	n := len(positions)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			if (i == 0 && j == 0) || (i == 0 && j == n-1) || (i == n-1 && j == 0) {
+				continue
+			}
+			qr.drawAlignmentPattern(positions[i], positions[j])
+		}
+	}
+
+	// Reserve format area, then version information
+	qr.drawFormatBits(0)
+	qr.drawVersion()
+}
+
+func (qr *QRCode) drawFinderPattern(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			dist := max(abs(dx), abs(dy))
+			xx, yy := x+dx, y+dy
+			if xx >= 0 && xx < qr.Size && yy >= 0 && yy < qr.Size {
+				qr.setFunctionModule(xx, yy, dist != 2 && dist != 4)
+			}
+		}
+	}
+}
+
+func (qr *QRCode) drawAlignmentPattern(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			qr.setFunctionModule(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+func (qr *QRCode) drawFormatBits(mask int) {
+	data := qr.level.formatBits()<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+
+	// First copy around the top left finder
+	for i := 0; i <= 5; i++ {
+		qr.setFunctionModule(8, i, qrBit(bits, i))
+	}
+	qr.setFunctionModule(8, 7, qrBit(bits, 6))
+	qr.setFunctionModule(8, 8, qrBit(bits, 7))
+	qr.setFunctionModule(7, 8, qrBit(bits, 8))
+	for i := 9; i < 15; i++ {
+		qr.setFunctionModule(14-i, 8, qrBit(bits, i))
+	}
+
+	// Second copy split between the other two finders
+	for i := 0; i < 8; i++ {
+		qr.setFunctionModule(qr.Size-1-i, 8, qrBit(bits, i))
+	}
+	for i := 8; i < 15; i++ {
+		qr.setFunctionModule(8, qr.Size-15+i, qrBit(bits, i))
+	}
+	qr.setFunctionModule(8, qr.Size-8, true) // Always dark
+}
+
+func (qr *QRCode) drawVersion() {
+	if qr.Version < 7 {
+		return
+	}
+	rem := qr.Version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := qr.Version<<12 | rem
+	for i := 0; i < 18; i++ {
+		bit := qrBit(bits, i)
+		a, b := qr.Size-11+i%3, i/3
+		qr.setFunctionModule(a, b, bit)
+		qr.setFunctionModule(b, a, bit)
+	}
+}
+
+// addEccAndInterleave splits data into blocks, appends the Reed-Solomon
+// error correction codewords and interleaves the result.
+func (qr *QRCode) addEccAndInterleave(data []byte) []byte {
+	numBlocks := qrNumErrorCorrectionBlocks[qr.level][qr.Version]
+	blockEccLen := qrEccCodewordsPerBlock[qr.level][qr.Version]
+	rawCodewords := qrNumRawDataModules(qr.Version) / 8
+	numShortBlocks := numBlocks - rawCodewords%numBlocks
+	shortBlockLen := rawCodewords / numBlocks
+
+	divisor := reedSolomonDivisor(blockEccLen)
+	blocks := make([][]byte, numBlocks)
+	for i, k := 0, 0; i < numBlocks; i++ {
+		datLen := shortBlockLen - blockEccLen
+		if i >= numShortBlocks {
+			datLen++
+		}
+		dat := data[k : k+datLen]
+		k += datLen
+		block := make([]byte, 0, shortBlockLen+1)
+		block = append(block, dat...)
+		if i < numShortBlocks {
+			block = append(block, 0) // Placeholder, skipped when interleaving
+		}
+		block = append(block, reedSolomonRemainder(dat, divisor)...)
+		blocks[i] = block
+	}
+
+	result := make([]byte, 0, rawCodewords)
+	for i := range blocks[0] {
+		for j, block := range blocks {
+			if i != shortBlockLen-blockEccLen || j >= numShortBlocks {
+				result = append(result, block[i])
+			}
+		}
+	}
+	return result
+}
+
+func (qr *QRCode) drawCodewords(data []byte) {
+	i := 0
+	for right := qr.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < qr.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = qr.Size - 1 - vert
+				}
+				if !qr.isFunction[y][x] && i < len(data)*8 {
+					qr.Modules[y][x] = qrBit(int(data[i>>3]), 7-(i&7))
+					i++
+				}
+			}
+		}
+	}
+}
+
+func (qr *QRCode) applyMask(mask int) {
+	for y := 0; y < qr.Size; y++ {
+		for x := 0; x < qr.Size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !qr.isFunction[y][x] {
+				qr.Modules[y][x] = !qr.Modules[y][x]
+			}
+		}
+	}
+}
+
+// penaltyScore rates the current module layout using the four rules of
+// ISO/IEC 18004 section 7.8.3. Lower is better.
+func (qr *QRCode) penaltyScore() int {
+	size := qr.Size
+	penalty := 0
+	at := func(x, y int, horizontal bool) bool {
+		if horizontal {
+			return qr.Modules[y][x]
+		}
+		return qr.Modules[x][y]
+	}
+
+	for _, horizontal := range []bool{true, false} {
+		for y := 0; y < size; y++ {
+			// Runs of five or more same-coloured modules
+			runLen := 1
+			for x := 1; x < size; x++ {
+				if at(x, y, horizontal) == at(x-1, y, horizontal) {
+					runLen++
+					if runLen == 5 {
+						penalty += 3
+					} else if runLen > 5 {
+						penalty++
+					}
+				} else {
+					runLen = 1
+				}
+			}
+
+			// Finder-like patterns 1011101 with four light modules on one side
+			for x := 0; x+7 <= size; x++ {
+				if !(at(x, y, horizontal) && !at(x+1, y, horizontal) && at(x+2, y, horizontal) &&
+					at(x+3, y, horizontal) && at(x+4, y, horizontal) && !at(x+5, y, horizontal) && at(x+6, y, horizontal)) {
+					continue
+				}
+				lightBefore, lightAfter := true, true
+				for k := 1; k <= 4; k++ {
+					if x-k >= 0 && at(x-k, y, horizontal) {
+						lightBefore = false
+					}
+					if x+6+k < size && at(x+6+k, y, horizontal) {
+						lightAfter = false
+					}
+				}
+				if lightBefore || lightAfter {
+					penalty += 40
+				}
+			}
+		}
+	}
+
+	// 2x2 blocks of the same colour
+	dark := 0
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if qr.Modules[y][x] {
+				dark++
+			}
+			if x+1 < size && y+1 < size {
+				c := qr.Modules[y][x]
+				if c == qr.Modules[y][x+1] && c == qr.Modules[y+1][x] && c == qr.Modules[y+1][x+1] {
+					penalty += 3
+				}
+			}
+		}
+	}
+
+	// Balance of dark and light modules
+	total := size * size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	penalty += max(k, 0) * 10
+
+	return penalty
+}
+
+func reedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = reedSolomonMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = reedSolomonMultiply(root, 0x02)
+	}
+	return result
+}
+
+func reedSolomonRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, d := range divisor {
+			result[i] ^= reedSolomonMultiply(d, factor)
+		}
+	}
+	return result
+}
+
+// reedSolomonMultiply multiplies two elements of GF(2^8/0x11D).
+func reedSolomonMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>uint(i))&1) * int(x)
+	}
+	return byte(z)
+}
+
+func qrBit(x, i int) bool {
+	return (x>>uint(i))&1 != 0
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,290 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The vectors are taken from ISO/IEC 18004 (the 1-M "HELLO WORLD" example
+// of annex I, the format and version information tables) and the
+// capacity tables.
+
+func TestReedSolomon(t *testing.T) {
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := reedSolomonRemainder(data, reedSolomonDivisor(len(want))); !bytes.Equal(got, want) {
+		t.Errorf("ECC = %v, want %v", got, want)
+	}
+}
+
+func TestQRCapacity(t *testing.T) {
+	tests := []struct {
+		version   int
+		level     QRErrorCorrection
+		raw, data int
+	}{
+		{1, QRErrorCorrectionL, 208, 19},
+		{1, QRErrorCorrectionM, 208, 16},
+		{1, QRErrorCorrectionQ, 208, 13},
+		{1, QRErrorCorrectionH, 208, 9},
+		{7, QRErrorCorrectionM, 1568, 124},
+		{25, QRErrorCorrectionM, 12708, 1000},
+		{40, QRErrorCorrectionL, 29648, 2956},
+		{40, QRErrorCorrectionH, 29648, 1276},
+	}
+	for _, test := range tests {
+		if got := qrNumRawDataModules(test.version); got != test.raw {
+			t.Errorf("raw modules of version %d = %d, want %d", test.version, got, test.raw)
+		}
+		if got := qrNumDataCodewords(test.version, test.level); got != test.data {
+			t.Errorf("data codewords of %d-%d = %d, want %d", test.version, test.level, got, test.data)
+		}
+	}
+}
+
+func TestQRAlignmentPatternPositions(t *testing.T) {
+	tests := map[int][]int{
+		1:  nil,
+		2:  {6, 18},
+		7:  {6, 22, 38},
+		14: {6, 26, 46, 66},
+		32: {6, 34, 60, 86, 112, 138},
+		40: {6, 30, 58, 86, 114, 142, 170},
+	}
+	for version, want := range tests {
+		if got := qrAlignmentPatternPositions(version); !reflect.DeepEqual(got, want) {
+			t.Errorf("version %d = %v, want %v", version, got, want)
+		}
+	}
+}
+
+func TestQRFormatBits(t *testing.T) {
+	tests := []struct {
+		level QRErrorCorrection
+		mask  int
+		want  string
+	}{
+		{QRErrorCorrectionL, 0, "111011111000100"},
+		{QRErrorCorrectionM, 0, "101010000010010"},
+		{QRErrorCorrectionQ, 0, "011010101011111"},
+		{QRErrorCorrectionH, 0, "001011010001001"},
+		{QRErrorCorrectionM, 5, "100000011001110"},
+	}
+	for _, test := range tests {
+		qr := newTestQR(1, test.level)
+		qr.drawFormatBits(test.mask)
+		if got := fmt.Sprintf("%015b", readFormatBits(qr)); got != test.want {
+			t.Errorf("format %d/%d = %s, want %s", test.level, test.mask, got, test.want)
+		}
+	}
+}
+
+func TestQRVersionBits(t *testing.T) {
+	tests := map[int]int{7: 0x07C94, 8: 0x085BC, 21: 0x15683, 40: 0x28C69}
+	for version, want := range tests {
+		qr := newTestQR(version, QRErrorCorrectionM)
+		qr.drawVersion()
+		got := 0
+		for i := 17; i >= 0; i-- {
+			got = got<<1 | boolBit(qr.Modules[i/3][qr.Size-11+i%3])
+			if qr.Modules[i/3][qr.Size-11+i%3] != qr.Modules[qr.Size-11+i%3][i/3] {
+				t.Errorf("version %d: copies differ at bit %d", version, i)
+			}
+		}
+		if got != want {
+			t.Errorf("version %d = %#05x, want %#05x", version, got, want)
+		}
+	}
+}
+
+func TestEncodeQR(t *testing.T) {
+	tests := []struct {
+		data    string
+		level   QRErrorCorrection
+		version int
+	}{
+		{"HELLO WORLD", QRErrorCorrectionM, 1},
+		{strings.Repeat("a", 14), QRErrorCorrectionM, 1},
+		{strings.Repeat("a", 15), QRErrorCorrectionM, 2},
+		{strings.Repeat("a", 17), QRErrorCorrectionL, 1},
+		{strings.Repeat("0123456789", 12), QRErrorCorrectionQ, 9},
+		{strings.Repeat("SPC\n0200\n1\nCH4431999123000889012\n", 20), QRErrorCorrectionM, 20},
+		{strings.Repeat("x", 2953), QRErrorCorrectionL, 40},
+	}
+	for _, test := range tests {
+		qr, err := EncodeQR([]byte(test.data), test.level, 0)
+		if err != nil {
+			t.Errorf("%d bytes: %v", len(test.data), err)
+			continue
+		}
+		if qr.Version != test.version || qr.Size != test.version*4+17 {
+			t.Errorf("%d bytes: version %d size %d, want version %d", len(test.data), qr.Version, qr.Size, test.version)
+			continue
+		}
+		if got, err := decodeTestQR(qr); err != nil {
+			t.Errorf("%d bytes: %v", len(test.data), err)
+		} else if got != test.data {
+			t.Errorf("%d bytes: decoded %q", len(test.data), got)
+		}
+	}
+
+	if _, err := EncodeQR(bytes.Repeat([]byte("x"), 2954), QRErrorCorrectionL, 0); err == nil {
+		t.Error("2954 bytes at level L: no error")
+	}
+	if _, err := EncodeQR(bytes.Repeat([]byte("x"), 998), QRErrorCorrectionM, 25); err == nil {
+		t.Error("998 bytes limited to version 25: no error")
+	}
+}
+
+func newTestQR(version int, level QRErrorCorrection) *QRCode {
+	qr := &QRCode{Version: version, Size: version*4 + 17, level: level}
+	qr.Modules = make([][]bool, qr.Size)
+	qr.isFunction = make([][]bool, qr.Size)
+	for i := range qr.Modules {
+		qr.Modules[i] = make([]bool, qr.Size)
+		qr.isFunction[i] = make([]bool, qr.Size)
+	}
+	return qr
+}
+
+func boolBit(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// readFormatBits returns the format information next to the top left
+// finder, most significant bit first, checking the second copy.
+func readFormatBits(qr *QRCode) int {
+	var first, second [15]bool
+	for i := 0; i <= 5; i++ {
+		first[i] = qr.Modules[i][8]
+	}
+	first[6], first[7], first[8] = qr.Modules[7][8], qr.Modules[8][8], qr.Modules[8][7]
+	for i := 9; i < 15; i++ {
+		first[i] = qr.Modules[8][14-i]
+	}
+	for i := 0; i < 8; i++ {
+		second[i] = qr.Modules[8][qr.Size-1-i]
+	}
+	for i := 8; i < 15; i++ {
+		second[i] = qr.Modules[qr.Size-15+i][8]
+	}
+	if first != second {
+		return -1
+	}
+	bits := 0
+	for i := 14; i >= 0; i-- {
+		bits = bits<<1 | boolBit(first[i])
+	}
+	return bits
+}
+
+// decodeTestQR reads a byte mode symbol back: it unmasks the data modules,
+// deinterleaves the blocks, checks their error correction codewords and
+// returns the payload.
+func decodeTestQR(qr *QRCode) (string, error) {
+	format := readFormatBits(qr)
+	if format < 0 {
+		return "", fmt.Errorf("format information copies differ")
+	}
+	format ^= 0x5412
+	if level := [...]QRErrorCorrection{QRErrorCorrectionM, QRErrorCorrectionL, QRErrorCorrectionH, QRErrorCorrectionQ}[format>>13]; level != qr.level {
+		return "", fmt.Errorf("format level %d, want %d", level, qr.level)
+	}
+	mask := format >> 10 & 7
+	masks := [8]func(x, y int) bool{
+		func(x, y int) bool { return (x+y)%2 == 0 },
+		func(x, y int) bool { return y%2 == 0 },
+		func(x, y int) bool { return x%3 == 0 },
+		func(x, y int) bool { return (x+y)%3 == 0 },
+		func(x, y int) bool { return (x/3+y/2)%2 == 0 },
+		func(x, y int) bool { return x*y%2+x*y%3 == 0 },
+		func(x, y int) bool { return (x*y%2+x*y%3)%2 == 0 },
+		func(x, y int) bool { return ((x+y)%2+x*y%3)%2 == 0 },
+	}
+
+	// Data modules in placement order: two module columns from the right,
+	// alternately upwards and downwards, skipping the vertical timing pattern
+	var codewords []byte
+	bit := 0
+	for right := qr.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < qr.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = qr.Size - 1 - vert
+				}
+				if qr.isFunction[y][x] {
+					continue
+				}
+				if bit%8 == 0 {
+					codewords = append(codewords, 0)
+				}
+				if qr.Modules[y][x] != masks[mask](x, y) {
+					codewords[bit/8] |= 1 << (7 - bit%8)
+				}
+				bit++
+			}
+		}
+	}
+	raw := qrNumRawDataModules(qr.Version) / 8
+	codewords = codewords[:raw] // Remainder bits
+
+	numBlocks := qrNumErrorCorrectionBlocks[qr.level][qr.Version]
+	eccLen := qrEccCodewordsPerBlock[qr.level][qr.Version]
+	shortLen := raw / numBlocks
+	numShort := numBlocks - raw%numBlocks
+	data := make([][]byte, numBlocks)
+	ecc := make([][]byte, numBlocks)
+	next := 0
+	for i := 0; i <= shortLen-eccLen; i++ {
+		for b := range data {
+			if i == shortLen-eccLen && b < numShort {
+				continue
+			}
+			data[b] = append(data[b], codewords[next])
+			next++
+		}
+	}
+	for i := 0; i < eccLen; i++ {
+		for b := range ecc {
+			ecc[b] = append(ecc[b], codewords[next])
+			next++
+		}
+	}
+
+	var payload []byte
+	divisor := reedSolomonDivisor(eccLen)
+	for b := range data {
+		if !bytes.Equal(reedSolomonRemainder(data[b], divisor), ecc[b]) {
+			return "", fmt.Errorf("block %d: error correction codewords do not match", b)
+		}
+		payload = append(payload, data[b]...)
+	}
+
+	read := func(pos, n int) int {
+		value := 0
+		for i := pos; i < pos+n; i++ {
+			value = value<<1 | int(payload[i/8]>>(7-i%8)&1)
+		}
+		return value
+	}
+	if mode := read(0, 4); mode != 0x4 {
+		return "", fmt.Errorf("mode %#x, want byte mode", mode)
+	}
+	countBits := qrCharCountBits(qr.Version)
+	count := read(4, countBits)
+	result := make([]byte, count)
+	for i := range result {
+		result[i] = byte(read(4+countBits+8*i, 8))
+	}
+	return string(result), nil
+}
@@ -0,0 +1,239 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+
+	"eBill-Convert/model"
+)
+
+// NamespaceSBDH is the namespace of the Standard Business Document Header.
+const NamespaceSBDH = "http://www.unece.org/cefact/namespaces/StandardBusinessDocumentHeader"
+
+// Identifier schemes of Peppol participants, document types and processes
+const (
+	sbdhParticipantAuthority = "iso6523-actorid-upis"
+	sbdhDocumentScheme       = "busdox-docid-qns"
+	sbdhProcessScheme        = "cenbii-procid-ubl"
+)
+
+// SBDH is the Standard Business Document Header of a document received
+// through Peppol.
+type SBDH struct {
+	XMLName                xml.Name            `xml:"StandardBusinessDocumentHeader" json:"-"`
+	HeaderVersion          string              `xml:"HeaderVersion" json:"headerVersion"`
+	Sender                 SBDHPartner         `xml:"Sender" json:"sender"`
+	Receiver               SBDHPartner         `xml:"Receiver" json:"receiver"`
+	DocumentIdentification SBDHIdentification  `xml:"DocumentIdentification" json:"documentIdentification"`
+	Scopes                 []SBDHBusinessScope `xml:"BusinessScope>Scope" json:"scopes,omitempty"`
+}
+
+// SBDHPartner is the sender or receiver of a document.
+type SBDHPartner struct {
+	Identifier SBDHIdentifier `xml:"Identifier" json:"identifier"`
+}
+
+// SBDHIdentifier is a participant identifier such as "0088:4012345000009".
+type SBDHIdentifier struct {
+	Authority string `xml:"Authority,attr,omitempty" json:"authority,omitempty"`
+	Value     string `xml:",chardata" json:"value"`
+}
+
+// SBDHIdentification identifies the wrapped document.
+type SBDHIdentification struct {
+	Standard            string `xml:"Standard" json:"standard"`
+	TypeVersion         string `xml:"TypeVersion" json:"typeVersion"`
+	InstanceIdentifier  string `xml:"InstanceIdentifier" json:"instanceIdentifier"`
+	Type                string `xml:"Type" json:"type"`
+	CreationDateAndTime string `xml:"CreationDateAndTime" json:"creationDateAndTime"`
+}
+
+// SBDHBusinessScope is a scope such as the document type (DOCUMENTID) or
+// the process (PROCESSID) of the exchange.
+type SBDHBusinessScope struct {
+	Type               string `xml:"Type" json:"type"`
+	InstanceIdentifier string `xml:"InstanceIdentifier" json:"instanceIdentifier"`
+	Identifier         string `xml:"Identifier,omitempty" json:"identifier,omitempty"`
+}
+
+// Scope returns the instance identifier of the business scope of the type,
+// e.g. PROCESSID, or "".
+func (h *SBDH) Scope(scopeType string) string {
+	for _, scope := range h.Scopes {
+		if scope.Type == scopeType {
+			return scope.InstanceIdentifier
+		}
+	}
+	return ""
+}
+
+// IsSBDH reports whether data is an XML document wrapped in a
+// StandardBusinessDocument.
+func IsSBDH(data []byte) bool {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return false
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local == "StandardBusinessDocument"
+		}
+	}
+}
+
+// UnwrapSBDH splits a StandardBusinessDocument into its header and the
+// wrapped document. The document is returned as it appears in the envelope,
+// preceded by an XML declaration.
+func UnwrapSBDH(data []byte) (*SBDH, []byte, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var header *SBDH
+	depth := 0
+	for {
+		offset := decoder.InputOffset()
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, nil, fmt.Errorf("SBDH contains no document")
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("error decoding XML: %w", err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 1 {
+				if t.Name.Local != "StandardBusinessDocument" {
+					return nil, nil, fmt.Errorf("not an SBDH: root element %s", t.Name.Local)
+				}
+				continue
+			}
+			if t.Name.Local == "StandardBusinessDocumentHeader" {
+				header = &SBDH{}
+				if err := decoder.DecodeElement(header, &t); err != nil {
+					return nil, nil, fmt.Errorf("error decoding SBDH: %w", err)
+				}
+				depth--
+				continue
+			}
+			// The first element besides the header is the business document
+			if err := decoder.Skip(); err != nil {
+				return nil, nil, fmt.Errorf("error decoding XML: %w", err)
+			}
+			if header == nil {
+				return nil, nil, fmt.Errorf("SBDH contains no StandardBusinessDocumentHeader")
+			}
+			document := data[offset:decoder.InputOffset()]
+			return header, append([]byte(xml.Header), document...), nil
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
+
+// SBDHOptions are the parameters of a new SBDH envelope. Empty participant
+// identifiers are taken from the electronic addresses of seller (sender) and
+// buyer (receiver).
+type SBDHOptions struct {
+	Sender     string // Participant identifier, e.g. "0088:4012345000009"
+	Receiver   string
+	InstanceID string // Default is a random UUID
+	Created    time.Time
+}
+
+// WrapSBDH wraps a UBL invoice or credit note in a StandardBusinessDocument
+// for transmission through Peppol.
+func WrapSBDH(document []byte, opts SBDHOptions) ([]byte, error) {
+	inv, err := model.Parse(bytes.NewReader(document))
+	if err != nil {
+		return nil, err
+	}
+	root, namespace, err := rootName(document)
+	if err != nil {
+		return nil, err
+	}
+	if namespace != model.NamespaceUBLInvoice && namespace != model.NamespaceUBLCreditNote {
+		return nil, fmt.Errorf("only UBL documents can be wrapped in an SBDH")
+	}
+
+	participant := func(value string, address model.Identifier, role string) (SBDHPartner, error) {
+		if value == "" && address.IsSet() {
+			value = address.Scheme + ":" + address.ID
+		}
+		if value == "" {
+			return SBDHPartner{}, fmt.Errorf("%s participant identifier missing", role)
+		}
+		return SBDHPartner{Identifier: SBDHIdentifier{Authority: sbdhParticipantAuthority, Value: value}}, nil
+	}
+	sender, err := participant(opts.Sender, inv.Seller.ElectronicAddress, "sender")
+	if err != nil {
+		return nil, err
+	}
+	receiver, err := participant(opts.Receiver, inv.Buyer.ElectronicAddress, "receiver")
+	if err != nil {
+		return nil, err
+	}
+	if opts.InstanceID == "" {
+		if opts.InstanceID, err = newGUID(); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Created.IsZero() {
+		opts.Created = time.Now()
+	}
+
+	header := SBDH{
+		HeaderVersion: "1.0",
+		Sender:        sender,
+		Receiver:      receiver,
+		DocumentIdentification: SBDHIdentification{
+			Standard:            namespace,
+			TypeVersion:         "2.1",
+			InstanceIdentifier:  opts.InstanceID,
+			Type:                root,
+			CreationDateAndTime: opts.Created.UTC().Format(time.RFC3339),
+		},
+		Scopes: []SBDHBusinessScope{
+			{Type: "DOCUMENTID", InstanceIdentifier: fmt.Sprintf("%s::%s##%s::2.1", namespace, root, inv.SpecificationID), Identifier: sbdhDocumentScheme},
+			{Type: "PROCESSID", InstanceIdentifier: inv.BusinessProcess, Identifier: sbdhProcessScheme},
+		},
+	}
+	if country := inv.Seller.Address.CountryCode; country != "" {
+		header.Scopes = append(header.Scopes, SBDHBusinessScope{Type: "COUNTRY_C1", InstanceIdentifier: country})
+	}
+	headerXML, err := xml.MarshalIndent(header, "  ", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error encoding SBDH: %w", err)
+	}
+
+	body := bytes.TrimSpace(document)
+	if bytes.HasPrefix(body, []byte("<?xml")) {
+		if end := bytes.Index(body, []byte("?>")); end >= 0 {
+			body = bytes.TrimSpace(body[end+2:])
+		}
+	}
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	fmt.Fprintf(&b, "<StandardBusinessDocument xmlns=%q>\n", NamespaceSBDH)
+	b.Write(headerXML)
+	b.WriteString("\n")
+	b.Write(body)
+	b.WriteString("\n</StandardBusinessDocument>\n")
+	return b.Bytes(), nil
+}
+
+// rootName returns the local name and namespace of the root element.
+func rootName(data []byte) (string, string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", "", fmt.Errorf("error decoding XML: %w", err)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local, start.Name.Space, nil
+		}
+	}
+}
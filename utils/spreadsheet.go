@@ -0,0 +1,338 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+
+	"eBill-Convert/model"
+)
+
+// Column kinds of a sheet
+const (
+	CellText = iota
+	CellNumber
+	CellAmount // Number shown with two decimals
+	CellDate
+)
+
+// SheetColumn is a column of a sheet, titled with the BT code and name.
+type SheetColumn struct {
+	Title string
+	Kind  int
+}
+
+// SheetCell holds the value of a cell in the field of its column kind.
+type SheetCell struct {
+	Text   string
+	Number model.Decimal
+	Date   model.Date
+}
+
+// Sheet is a table of invoice headers or invoice lines.
+type Sheet struct {
+	Name    string
+	Columns []SheetColumn
+	Rows    [][]SheetCell
+}
+
+// CSVOptions control the CSV format. The defaults of DefaultCSVOptions
+// follow translations.csv and German spreadsheet programs.
+type CSVOptions struct {
+	Separator    rune
+	DecimalComma bool
+}
+
+// DefaultCSVOptions returns ";" as separator and decimal comma.
+func DefaultCSVOptions() CSVOptions {
+	return CSVOptions{Separator: ';', DecimalComma: true}
+}
+
+var invoiceColumns = []SheetColumn{
+	{"BT-1 Invoice number", CellText},
+	{"BT-2 Issue date", CellDate},
+	{"BT-3 Type code", CellText},
+	{"BT-5 Currency", CellText},
+	{"BT-9 Due date", CellDate},
+	{"BT-10 Buyer reference", CellText},
+	{"BT-13 Purchase order", CellText},
+	{"BT-27 Seller", CellText},
+	{"BT-31 Seller VAT ID", CellText},
+	{"BT-44 Buyer", CellText},
+	{"BT-48 Buyer VAT ID", CellText},
+	{"BT-106 Sum of line net amounts", CellAmount},
+	{"BT-107 Allowances", CellAmount},
+	{"BT-108 Charges", CellAmount},
+	{"BT-109 Total without VAT", CellAmount},
+	{"BT-110 VAT", CellAmount},
+	{"BT-112 Total with VAT", CellAmount},
+	{"BT-113 Paid", CellAmount},
+	{"BT-115 Amount due", CellAmount},
+}
+
+var lineColumns = []SheetColumn{
+	{"BT-1 Invoice number", CellText},
+	{"BT-2 Issue date", CellDate},
+	{"BT-27 Seller", CellText},
+	{"BT-44 Buyer", CellText},
+	{"BT-126 Line ID", CellText},
+	{"BT-155 Article number", CellText},
+	{"BT-153 Item name", CellText},
+	{"BT-129 Quantity", CellNumber},
+	{"BT-130 Unit", CellText},
+	{"BT-146 Net price", CellNumber},
+	{"BT-149 Price base quantity", CellNumber},
+	{"BT-151 VAT category", CellText},
+	{"BT-152 VAT %", CellNumber},
+	{"BT-131 Line net amount", CellAmount},
+	{"BT-5 Currency", CellText},
+}
+
+// InvoiceSheets flattens the invoices into a sheet of invoice headers and a
+// sheet of invoice lines.
+func InvoiceSheets(invoices []*model.Invoice) []Sheet {
+	headers := Sheet{Name: "Invoices", Columns: invoiceColumns}
+	lines := Sheet{Name: "Lines", Columns: lineColumns}
+	text := func(s string) SheetCell { return SheetCell{Text: s} }
+	number := func(d model.Decimal) SheetCell { return SheetCell{Number: d} }
+	date := func(d model.Date) SheetCell { return SheetCell{Date: d} }
+
+	for _, inv := range invoices {
+		t := inv.Totals
+		headers.Rows = append(headers.Rows, []SheetCell{
+			text(inv.Number), date(inv.IssueDate), text(string(inv.TypeCode)), text(inv.CurrencyCode),
+			date(inv.DueDate), text(inv.BuyerReference), text(inv.PurchaseOrderReference),
+			text(inv.Seller.Name), text(inv.Seller.VATID), text(inv.Buyer.Name), text(inv.Buyer.VATID),
+			number(t.LineNet), number(t.Allowances), number(t.Charges), number(t.TaxBasis),
+			number(t.Tax), number(t.Grand), number(t.Prepaid), number(t.DuePayable),
+		})
+		for _, line := range inv.Lines {
+			lines.Rows = append(lines.Rows, []SheetCell{
+				text(inv.Number), date(inv.IssueDate), text(inv.Seller.Name), text(inv.Buyer.Name),
+				text(line.ID), text(line.Item.SellerID), text(line.Item.Name),
+				number(line.Quantity), text(line.UnitCode), number(line.Price.Net),
+				number(line.Price.BaseQuantity), text(string(line.VATCategory)), number(line.VATRate),
+				number(line.NetAmount), text(inv.CurrencyCode),
+			})
+		}
+	}
+	return []Sheet{headers, lines}
+}
+
+// WriteCSV writes the sheet as CSV with a header row of column titles.
+// Dates are written as YYYY-MM-DD.
+func WriteCSV(sheet Sheet, opts CSVOptions) ([]byte, error) {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.Comma = opts.Separator
+	if opts.DecimalComma && opts.Separator == ',' {
+		return nil, fmt.Errorf("decimal comma requires a separator other than \",\"")
+	}
+
+	titles := make([]string, len(sheet.Columns))
+	for i, column := range sheet.Columns {
+		titles[i] = column.Title
+	}
+	if err := w.Write(titles); err != nil {
+		return nil, err
+	}
+	record := make([]string, len(sheet.Columns))
+	for _, row := range sheet.Rows {
+		for i, column := range sheet.Columns {
+			record[i] = cellText(row[i], column.Kind, opts.DecimalComma)
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return b.Bytes(), w.Error()
+}
+
+func cellText(cell SheetCell, kind int, decimalComma bool) string {
+	switch kind {
+	case CellNumber, CellAmount:
+		if !cell.Number.IsSet() {
+			return ""
+		}
+		s := cell.Number.String()
+		if kind == CellAmount {
+			s = cell.Number.RoundAmount().String()
+		}
+		if decimalComma {
+			s = strings.Replace(s, ".", ",", 1)
+		}
+		return s
+	case CellDate:
+		if !cell.Date.IsSet() {
+			return ""
+		}
+		return cell.Date.XSDate()
+	default:
+		return cell.Text
+	}
+}
+
+// Cell styles of styles.xml
+const (
+	xlsxStyleDefault = 0
+	xlsxStyleHeader  = 1
+	xlsxStyleDate    = 2
+	xlsxStyleAmount  = 3
+)
+
+// xlsxEpoch is day 0 of the serial dates of the 1900 date system.
+var xlsxEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// WriteXLSX writes the sheets as Office Open XML workbook with numbers and
+// dates as numeric cells and a frozen title row.
+func WriteXLSX(sheets []Sheet) ([]byte, error) {
+	files := []struct {
+		name string
+		data string
+	}{
+		{"[Content_Types].xml", xlsxContentTypes(len(sheets))},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbook(sheets)},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels(len(sheets))},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for i, sheet := range sheets {
+		files = append(files, struct {
+			name string
+			data string
+		}{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), xlsxSheet(sheet)})
+	}
+
+	var b bytes.Buffer
+	archive := zip.NewWriter(&b)
+	for _, file := range files {
+		w, err := archive.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write([]byte(file.data)); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func xlsxSheet(sheet Sheet) string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	b.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	b.WriteString(`<sheetData>`)
+
+	b.WriteString(`<row r="1">`)
+	for i, column := range sheet.Columns {
+		fmt.Fprintf(&b, `<c r="%s1" t="inlineStr" s="%d"><is><t>%s</t></is></c>`, xlsxColumn(i), xlsxStyleHeader, xmlEscape(column.Title))
+	}
+	b.WriteString(`</row>`)
+
+	for r, row := range sheet.Rows {
+		fmt.Fprintf(&b, `<row r="%d">`, r+2)
+		for i, column := range sheet.Columns {
+			ref := fmt.Sprintf("%s%d", xlsxColumn(i), r+2)
+			cell := row[i]
+			switch column.Kind {
+			case CellNumber, CellAmount:
+				if !cell.Number.IsSet() {
+					continue
+				}
+				style := xlsxStyleDefault
+				if column.Kind == CellAmount {
+					style = xlsxStyleAmount
+				}
+				fmt.Fprintf(&b, `<c r="%s" s="%d"><v>%s</v></c>`, ref, style, cell.Number)
+			case CellDate:
+				if !cell.Date.IsSet() {
+					continue
+				}
+				days := int(cell.Date.Time().Sub(xlsxEpoch).Hours() / 24)
+				fmt.Fprintf(&b, `<c r="%s" s="%d"><v>%d</v></c>`, ref, xlsxStyleDate, days)
+			default:
+				if cell.Text == "" {
+					continue
+				}
+				fmt.Fprintf(&b, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, xmlEscape(cell.Text))
+			}
+		}
+		b.WriteString(`</row>`)
+	}
+	b.WriteString(`</sheetData></worksheet>`)
+	return b.String()
+}
+
+// xlsxColumn returns the column letters of the zero based index.
+func xlsxColumn(index int) string {
+	name := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = string(rune('A'+(index-1)%26)) + name
+	}
+	return name
+}
+
+func xlsxContentTypes(sheets int) string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	b.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	b.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	b.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	b.WriteString(`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	for i := 1; i <= sheets; i++ {
+		fmt.Fprintf(&b, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i)
+	}
+	b.WriteString(`</Types>`)
+	return b.String()
+}
+
+func xlsxWorkbook(sheets []Sheet) string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	for i, sheet := range sheets {
+		fmt.Fprintf(&b, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(sheet.Name), i+1, i+1)
+	}
+	b.WriteString(`</sheets></workbook>`)
+	return b.String()
+}
+
+func xlsxWorkbookRels(sheets int) string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i := 1; i <= sheets; i++ {
+		fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i, i)
+	}
+	fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, sheets+1)
+	b.WriteString(`</Relationships>`)
+	return b.String()
+}
+
+const xlsxRootRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+// xlsxStyles defines the cell styles default, header (bold), date
+// (built-in format 14) and amount (built-in format 4, #,##0.00).
+const xlsxStyles = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="4">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`<xf numFmtId="14" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="4" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`</cellXfs></styleSheet>`
@@ -0,0 +1,265 @@
+package utils
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"eBill-Convert/model"
+)
+
+// Swiss QR-bill reference types
+const (
+	SwissReferenceQRR  = "QRR"  // QR reference, requires a QR-IBAN
+	SwissReferenceSCOR = "SCOR" // ISO 11649 creditor reference
+	SwissReferenceNone = "NON"
+)
+
+// SwissAddress is a structured (type S) address of a Swiss QR-bill.
+type SwissAddress struct {
+	Name           string
+	Street         string
+	BuildingNumber string
+	PostalCode     string
+	Town           string
+	Country        string
+}
+
+// SwissQRBill holds the data of a Swiss QR-bill payment part as defined by
+// the SIX Swiss Payment Standards, version 2.x.
+type SwissQRBill struct {
+	IBAN          string
+	Creditor      SwissAddress
+	Amount        string // Two decimals, empty if unknown
+	Currency      string // CHF or EUR
+	Debtor        *SwissAddress
+	ReferenceType string
+	Reference     string
+	Message       string
+}
+
+// SwissQRBillFromInvoice extracts the payment part data of an invoice. It
+// returns nil without error unless the invoice is in CHF and carries a
+// QR-IBAN or a creditor reference.
+func SwissQRBillFromInvoice(inv *model.Invoice) (*SwissQRBill, error) {
+	if inv.CurrencyCode != "CHF" {
+		return nil, nil
+	}
+
+	payment := inv.PaymentInstructions
+	reference := strings.ReplaceAll(payment.RemittanceInfo, " ", "")
+	for _, transfer := range payment.CreditTransfers {
+		iban := normalizeIBAN(transfer.AccountID)
+		if iban == "" {
+			continue
+		}
+
+		bill := &SwissQRBill{IBAN: iban, Currency: "CHF"}
+		switch {
+		case IsQRIBAN(iban):
+			if !isQRReference(reference) {
+				return nil, fmt.Errorf("QR-IBAN %s requires a valid QR reference, got %q", iban, reference)
+			}
+			bill.ReferenceType, bill.Reference = SwissReferenceQRR, reference
+		case isCreditorReference(reference):
+			bill.ReferenceType, bill.Reference = SwissReferenceSCOR, strings.ToUpper(reference)
+		default:
+			continue
+		}
+
+		creditor := inv.Seller
+		if inv.Payee != nil && inv.Payee.Name != "" {
+			creditor = *inv.Payee
+		}
+		bill.Creditor = swissAddressOf(creditor)
+		if debtor := swissAddressOf(inv.Buyer); debtor.complete() {
+			bill.Debtor = &debtor
+		}
+
+		if due := inv.Totals.DuePayable; due.IsSet() {
+			if due.Sign() <= 0 {
+				return nil, nil // Nothing left to pay
+			}
+			bill.Amount = due.Round(2).String()
+		}
+
+		if inv.Number != "" {
+			bill.Message = "Rechnung " + inv.Number
+		}
+
+		return bill, nil
+	}
+
+	return nil, nil
+}
+
+func swissAddressOf(party model.Party) SwissAddress {
+	street, number := splitStreet(party.Address.Line1)
+	return SwissAddress{
+		Name:           party.Name,
+		Street:         street,
+		BuildingNumber: number,
+		PostalCode:     party.Address.PostCode,
+		Town:           party.Address.City,
+		Country:        strings.ToUpper(party.Address.CountryCode),
+	}
+}
+
+// complete reports whether the address has the name, postal code, town and
+// country a structured address requires.
+func (a SwissAddress) complete() bool {
+	return a.Name != "" && a.PostalCode != "" && a.Town != "" && len(a.Country) == 2
+}
+
+// postBoxes are address lines whose number is not a house number.
+var postBoxes = map[string]bool{"postfach": true, "case postale": true, "casella postale": true, "po box": true, "p.o. box": true}
+
+// splitStreet separates a trailing house number such as "12" or "12a" from
+// an address line. Lines without one are returned as street.
+func splitStreet(line string) (street, number string) {
+	line = strings.TrimSpace(line)
+	i := strings.LastIndex(line, " ")
+	if i < 0 {
+		return line, ""
+	}
+	street, number = strings.TrimSpace(line[:i]), line[i+1:]
+	if len(number) > 16 || number[0] < '0' || number[0] > '9' || postBoxes[strings.ToLower(street)] {
+		return line, ""
+	}
+	return street, number
+}
+
+// Payload returns the SPC version 0200 text content of the QR code.
+func (b *SwissQRBill) Payload() (string, error) {
+	if (!strings.HasPrefix(b.IBAN, "CH") && !strings.HasPrefix(b.IBAN, "LI")) || len(b.IBAN) != 21 || mod97(b.IBAN[4:]+b.IBAN[:4]) != 1 {
+		return "", fmt.Errorf("invalid Swiss IBAN: %q", b.IBAN)
+	}
+	if b.Currency != "CHF" && b.Currency != "EUR" {
+		return "", fmt.Errorf("unsupported currency: %q", b.Currency)
+	}
+	if !b.Creditor.complete() {
+		return "", fmt.Errorf("creditor name and address incomplete")
+	}
+	if IsQRIBAN(b.IBAN) != (b.ReferenceType == SwissReferenceQRR) {
+		return "", fmt.Errorf("reference type %s does not match IBAN", b.ReferenceType)
+	}
+
+	amount := ""
+	if b.Amount != "" {
+		value, ok := new(big.Rat).SetString(b.Amount)
+		if !ok || value.Cmp(big.NewRat(1, 100)) < 0 || value.Cmp(big.NewRat(99999999999, 100)) > 0 {
+			return "", fmt.Errorf("amount out of range: %q", b.Amount)
+		}
+		amount = value.FloatString(2)
+	}
+
+	lines := []string{"SPC", "0200", "1", b.IBAN}
+	lines = append(lines, b.Creditor.lines()...)
+	lines = append(lines, "", "", "", "", "", "", "") // Ultimate creditor, reserved
+	lines = append(lines, amount, b.Currency)
+	if b.Debtor != nil && b.Debtor.complete() {
+		lines = append(lines, b.Debtor.lines()...)
+	} else {
+		lines = append(lines, "", "", "", "", "", "", "")
+	}
+	lines = append(lines, b.ReferenceType, b.Reference, truncateRunes(b.Message, 140), "EPD")
+
+	payload := strings.Join(lines, "\n")
+	if len([]rune(payload)) > 997 {
+		return "", fmt.Errorf("payload exceeds 997 characters")
+	}
+	return payload, nil
+}
+
+func (a SwissAddress) lines() []string {
+	return []string{
+		"S",
+		truncateRunes(a.Name, 70),
+		truncateRunes(a.Street, 70),
+		truncateRunes(a.BuildingNumber, 16),
+		truncateRunes(a.PostalCode, 16),
+		truncateRunes(a.Town, 35),
+		a.Country,
+	}
+}
+
+// QRCode encodes the payload with error correction level M, limited to
+// version 25 as required by the implementation guidelines.
+func (b *SwissQRBill) QRCode() (*QRCode, error) {
+	payload, err := b.Payload()
+	if err != nil {
+		return nil, err
+	}
+	return EncodeQR([]byte(payload), QRErrorCorrectionM, 25)
+}
+
+// IsQRIBAN reports whether iban is a Swiss or Liechtenstein QR-IBAN, i.e.
+// its institution identification lies between 30000 and 31999.
+func IsQRIBAN(iban string) bool {
+	iban = normalizeIBAN(iban)
+	if len(iban) != 21 || (!strings.HasPrefix(iban, "CH") && !strings.HasPrefix(iban, "LI")) {
+		return false
+	}
+	iid := iban[4:9]
+	return iid >= "30000" && iid <= "31999"
+}
+
+// isQRReference validates a 27 digit QR reference with its recursive
+// modulo 10 check digit.
+func isQRReference(ref string) bool {
+	if len(ref) != 27 {
+		return false
+	}
+	table := [10]int{0, 9, 4, 6, 8, 2, 7, 1, 3, 5}
+	carry := 0
+	for i, c := range ref {
+		if c < '0' || c > '9' {
+			return false
+		}
+		if i < 26 {
+			carry = table[(carry+int(c-'0'))%10]
+		}
+	}
+	return (10-carry)%10 == int(ref[26]-'0')
+}
+
+// FormatReference groups the reference for display: QR references as
+// 2+5x5 digits from the left, creditor references in blocks of four.
+func (b *SwissQRBill) FormatReference() string {
+	if b.ReferenceType == SwissReferenceQRR && len(b.Reference) == 27 {
+		return b.Reference[:2] + " " + groupRunes(b.Reference[2:], 5)
+	}
+	return groupRunes(b.Reference, 4)
+}
+
+// FormatIBAN groups the IBAN in blocks of four for display.
+func (b *SwissQRBill) FormatIBAN() string {
+	return groupRunes(b.IBAN, 4)
+}
+
+// FormatAmount renders the amount with spaces as thousands separators.
+func (b *SwissQRBill) FormatAmount() string {
+	if b.Amount == "" {
+		return ""
+	}
+	integer, fraction, _ := strings.Cut(b.Amount, ".")
+	var grouped strings.Builder
+	for i, c := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			grouped.WriteByte(' ')
+		}
+		grouped.WriteRune(c)
+	}
+	return grouped.String() + "." + fraction
+}
+
+func groupRunes(s string, n int) string {
+	var result strings.Builder
+	for i, c := range []rune(s) {
+		if i > 0 && i%n == 0 {
+			result.WriteByte(' ')
+		}
+		result.WriteRune(c)
+	}
+	return result.String()
+}
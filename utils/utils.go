@@ -4,12 +4,15 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io"
-	"strings"
+
+	"eBill-Convert/model"
 )
 
 // Define structs to match the target XML structure
 type Invoice struct {
 	XMLName                       xml.Name                         `xml:"invoice"`
+	Xmlns                         string                           `xml:"xmlns,attr,omitempty"`
+	XmlnsXR                       string                           `xml:"xmlns:xr,attr,omitempty"`
 	InvoiceNumber                 *Identifier                      `xml:"Invoice_number,omitempty"`
 	InvoiceIssueDate              *Date                            `xml:"Invoice_issue_date,omitempty"`
 	InvoiceTypeCode               *Code                            `xml:"Invoice_type_code,omitempty"`
@@ -133,6 +136,7 @@ type PrecedingInvoiceReference struct {
 // BG-4: SELLER
 type Party struct {
 	XMLName                           xml.Name              `xml:",omitempty"`
+	SellerName                        *Text                 `xml:"Seller_name,omitempty"`
 	SellerTradingName                 *Text                 `xml:"Seller_trading_name,omitempty"`
 	SellerIdentifier                  *IdentifierWithScheme `xml:"Seller_identifier,omitempty"`
 	SellerLegalRegistrationIdentifier *IdentifierWithScheme `xml:"Seller_legal_registration_identifier,omitempty"`
@@ -303,9 +307,11 @@ type DocumentLevelCharges struct {
 
 // BG-22: DOCUMENT_TOTALS
 type DocumentTotals struct {
-	XMLName xml.Name `xml:"DOCUMENT_TOTALS"`
-	Id      string   `xml:"xr:id,attr"`
-	Src     string   `xml:"xr:src,attr,omitempty"`
+	XMLName                   xml.Name `xml:"DOCUMENT_TOTALS"`
+	Id                        string   `xml:"xr:id,attr"`
+	Src                       string   `xml:"xr:src,attr,omitempty"`
+	SumOfInvoiceLineNetAmount *Text    `xml:"Sum_of_Invoice_line_net_amount,omitempty"`
+	InvoiceLineNetAmount
 }
 
 type InvoiceLineNetAmount struct {
@@ -443,416 +449,18 @@ type ItemAttributes struct {
 	ItemAttributeValue *Text    `xml:"Item_attribute_value,omitempty"`
 }
 
+// TransformXML converts a CII or UBL invoice into the XRechnung XR
+// intermediate format.
 func TransformXML(r io.Reader) (string, error) {
-	// 1. Unmarshal the source XML
-	var sourceXML struct {
-		CrossIndustryInvoice struct {
-			ExchangedDocument struct {
-				ID            string `xml:"ID"`
-				IssueDateTime struct {
-					DateTimeString string `xml:"DateTimeString"`
-				} `xml:"IssueDateTime"`
-				TypeCode     string `xml:"TypeCode"`
-				IncludedNote []struct {
-					SubjectCode string `xml:"SubjectCode"`
-					Content     string `xml:"Content"`
-				} `xml:"IncludedNote"`
-			} `xml:"ExchangedDocument"`
-			ExchangedDocumentContext struct {
-				BusinessProcessSpecifiedDocumentContextParameter struct {
-					ID string `xml:"ID"`
-				} `xml:"BusinessProcessSpecifiedDocumentContextParameter"`
-				GuidelineSpecifiedDocumentContextParameter struct {
-					ID string `xml:"ID"`
-				} `xml:"GuidelineSpecifiedDocumentContextParameter"`
-			} `xml:"ExchangedDocumentContext"`
-			SupplyChainTradeTransaction struct {
-				ApplicableHeaderTradeSettlement struct {
-					InvoiceCurrencyCode string `xml:"InvoiceCurrencyCode"`
-					TaxCurrencyCode     string `xml:"TaxCurrencyCode"`
-					ApplicableTradeTax  []struct {
-						TaxPointDate struct {
-							DateString string `xml:"DateString"`
-						} `xml:"TaxPointDate"`
-						DueDateTypeCode       string `xml:"DueDateTypeCode"`
-						BasisAmount           string `xml:"BasisAmount"`
-						CalculatedAmount      string `xml:"CalculatedAmount"`
-						CategoryCode          string `xml:"CategoryCode"`
-						RateApplicablePercent string `xml:"RateApplicablePercent"`
-						ExemptionReason       string `xml:"ExemptionReason"`
-						ExemptionReasonCode   string `xml:"ExemptionReasonCode"`
-					} `xml:"ApplicableTradeTax"`
-					SpecifiedTradePaymentTerms []struct {
-						DueDateDateTime struct {
-							DateTimeString string `xml:"DateTimeString"`
-						} `xml:"DueDateDateTime"`
-						Description                         string `xml:"Description"`
-						DirectDebitMandateID                string `xml:"DirectDebitMandateID"`
-						ApplicableTradePaymentDiscountTerms struct {
-							BasisPeriodMeasure struct {
-								Text     string `xml:",chardata"`
-								UnitCode string `xml:"unitCode,attr"`
-							} `xml:"BasisPeriodMeasure"`
-							CalculationPercent string `xml:"CalculationPercent"`
-						} `xml:"ApplicableTradePaymentDiscountTerms"`
-					} `xml:"SpecifiedTradePaymentTerms"`
-					InvoiceReferencedDocument struct {
-						IssuerAssignedID       string `xml:"IssuerAssignedID"`
-						FormattedIssueDateTime struct {
-							DateTimeString string `xml:"DateTimeString"`
-						} `xml:"FormattedIssueDateTime"`
-					} `xml:"InvoiceReferencedDocument"`
-					ReceivableSpecifiedTradeAccountingAccount struct {
-						ID string `xml:"ID"`
-					} `xml:"ReceivableSpecifiedTradeAccountingAccount"`
-					PaymentReference                     string `xml:"PaymentReference"`
-					SpecifiedTradeSettlementPaymentMeans []struct {
-						TypeCode                           string `xml:"TypeCode"`
-						Information                        string `xml:"Information"`
-						PayeePartyCreditorFinancialAccount struct {
-							ProprietaryID string `xml:"ProprietaryID"`
-							IBANID        string `xml:"IBANID"`
-							AccountName   string `xml:"AccountName"`
-						} `xml:"PayeePartyCreditorFinancialAccount"`
-						ApplicableTradeSettlementFinancialCard struct {
-							ID             string `xml:"ID"`
-							CardholderName string `xml:"CardholderName"`
-						} `xml:"ApplicableTradeSettlementFinancialCard"`
-						PayeeSpecifiedCreditorFinancialInstitution struct {
-							BICID string `xml:"BICID"`
-						} `xml:"PayeeSpecifiedCreditorFinancialInstitution"`
-						PayerPartyDebtorFinancialAccount struct {
-							IBANID string `xml:"IBANID"`
-						} `xml:"PayerPartyDebtorFinancialAccount"`
-					} `xml:"SpecifiedTradeSettlementPaymentMeans"`
-					SpecifiedTradeAllowanceCharge []struct {
-						ChargeIndicator struct {
-							Indicator string `xml:"Indicator"`
-						} `xml:"ChargeIndicator"`
-						ActualAmount       string `xml:"ActualAmount"`
-						BasisAmount        string `xml:"BasisAmount"`
-						CalculationPercent string `xml:"CalculationPercent"`
-						Reason             string `xml:"Reason"`
-						ReasonCode         string `xml:"ReasonCode"`
-						CategoryTradeTax   struct {
-							CategoryCode          string `xml:"CategoryCode"`
-							RateApplicablePercent string `xml:"RateApplicablePercent"`
-						} `xml:"CategoryTradeTax"`
-					} `xml:"SpecifiedTradeAllowanceCharge"`
-					SpecifiedTradeSettlementHeaderMonetarySummation struct {
-						LineTotalAmount      string `xml:"LineTotalAmount"`
-						AllowanceTotalAmount string `xml:"AllowanceTotalAmount"`
-						ChargeTotalAmount    string `xml:"ChargeTotalAmount"`
-						TaxBasisTotalAmount  string `xml:"TaxBasisTotalAmount"`
-						TaxTotalAmount       []struct {
-							Text       string `xml:",chardata"`
-							CurrencyID string `xml:"currencyID,attr"`
-						} `xml:"TaxTotalAmount"`
-						GrandTotalAmount   string `xml:"GrandTotalAmount"`
-						TotalPrepaidAmount string `xml:"TotalPrepaidAmount"`
-						RoundingAmount     string `xml:"RoundingAmount"`
-						DuePayableAmount   string `xml:"DuePayableAmount"`
-					} `xml:"SpecifiedTradeSettlementHeaderMonetarySummation"`
-					CreditorReferenceID    string `xml:"CreditorReferenceID"`
-					BillingSpecifiedPeriod []struct {
-						StartDateTime struct {
-							DateTimeString string `xml:"DateTimeString"`
-						} `xml:"StartDateTime"`
-						EndDateTime struct {
-							DateTimeString string `xml:"DateTimeString"`
-						} `xml:"EndDateTime"`
-					} `xml:"BillingSpecifiedPeriod"`
-				} `xml:"ApplicableHeaderTradeSettlement"`
-				ApplicableHeaderTradeAgreement struct {
-					BuyerReference            string `xml:"BuyerReference"`
-					SpecifiedProcuringProject struct {
-						ID string `xml:"ID"`
-					} `xml:"SpecifiedProcuringProject"`
-					ContractReferencedDocument struct {
-						IssuerAssignedID string `xml:"IssuerAssignedID"`
-					} `xml:"ContractReferencedDocument"`
-					BuyerOrderReferencedDocument struct {
-						IssuerAssignedID string `xml:"IssuerAssignedID"`
-					} `xml:"BuyerOrderReferencedDocument"`
-					SellerOrderReferencedDocument struct {
-						IssuerAssignedID string `xml:"IssuerAssignedID"`
-					} `xml:"SellerOrderReferencedDocument"`
-					AdditionalReferencedDocument []struct {
-						IssuerAssignedID       string `xml:"IssuerAssignedID"`
-						TypeCode               string `xml:"TypeCode"`
-						ReferenceTypeCode      string `xml:"ReferenceTypeCode"`
-						Name                   string `xml:"Name"`
-						URIID                  string `xml:"URIID"`
-						AttachmentBinaryObject struct {
-							MimeCode string `xml:"mimeCode,attr"`
-							Filename string `xml:"filename,attr"`
-							Text     string `xml:",chardata"`
-						} `xml:"AttachmentBinaryObject"`
-					} `xml:"AdditionalReferencedDocument"`
-					SellerTradeParty struct {
-						Name                       string `xml:"Name"`
-						SpecifiedLegalOrganization struct {
-							TradingBusinessName string `xml:"TradingBusinessName"`
-							ID                  string `xml:"ID"`
-						} `xml:"SpecifiedLegalOrganization"`
-						ID       []string `xml:"ID"`
-						GlobalID []struct {
-							Text     string `xml:",chardata"`
-							SchemeID string `xml:"schemeID,attr"`
-						} `xml:"GlobalID"`
-						SpecifiedTaxRegistration []struct {
-							ID struct {
-								Text     string `xml:",chardata"`
-								SchemeID string `xml:"schemeID,attr"`
-							} `xml:"ID"`
-						} `xml:"SpecifiedTaxRegistration"`
-						Description               string `xml:"Description"`
-						URIUniversalCommunication struct {
-							URIID string `xml:"URIID"`
-						} `xml:"URIUniversalCommunication"`
-						PostalTradeAddress struct {
-							LineOne                string `xml:"LineOne"`
-							LineTwo                string `xml:"LineTwo"`
-							LineThree              string `xml:"LineThree"`
-							CityName               string `xml:"CityName"`
-							PostcodeCode           string `xml:"PostcodeCode"`
-							CountrySubDivisionName string `xml:"CountrySubDivisionName"`
-							CountryID              string `xml:"CountryID"`
-						} `xml:"PostalTradeAddress"`
-						DefinedTradeContact struct {
-							DepartmentName                  string `xml:"DepartmentName"`
-							PersonName                      string `xml:"PersonName"`
-							TelephoneUniversalCommunication struct {
-								CompleteNumber string `xml:"CompleteNumber"`
-							} `xml:"TelephoneUniversalCommunication"`
-							EmailURIUniversalCommunication struct {
-								URIID string `xml:"URIID"`
-							} `xml:"EmailURIUniversalCommunication"`
-						} `xml:"DefinedTradeContact"`
-					} `xml:"SellerTradeParty"`
-					BuyerTradeParty struct {
-						Name                       string `xml:"Name"`
-						SpecifiedLegalOrganization struct {
-							TradingBusinessName string `xml:"TradingBusinessName"`
-							ID                  string `xml:"ID"`
-						} `xml:"SpecifiedLegalOrganization"`
-						ID       []string `xml:"ID"`
-						GlobalID []struct {
-							Text     string `xml:",chardata"`
-							SchemeID string `xml:"schemeID,attr"`
-						} `xml:"GlobalID"`
-						SpecifiedTaxRegistration []struct {
-							ID struct {
-								Text     string `xml:",chardata"`
-								SchemeID string `xml:"schemeID,attr"`
-							} `xml:"ID"`
-						} `xml:"SpecifiedTaxRegistration"`
-						URIUniversalCommunication struct {
-							URIID string `xml:"URIID"`
-						} `xml:"URIUniversalCommunication"`
-						PostalTradeAddress struct {
-							LineOne                string `xml:"LineOne"`
-							LineTwo                string `xml:"LineTwo"`
-							LineThree              string `xml:"LineThree"`
-							CityName               string `xml:"CityName"`
-							PostcodeCode           string `xml:"PostcodeCode"`
-							CountrySubDivisionName string `xml:"CountrySubDivisionName"`
-							CountryID              string `xml:"CountryID"`
-						} `xml:"PostalTradeAddress"`
-						DefinedTradeContact struct {
-							DepartmentName                  string `xml:"DepartmentName"`
-							PersonName                      string `xml:"PersonName"`
-							TelephoneUniversalCommunication struct {
-								CompleteNumber string `xml:"CompleteNumber"`
-							} `xml:"TelephoneUniversalCommunication"`
-							EmailURIUniversalCommunication struct {
-								URIID string `xml:"URIID"`
-							} `xml:"EmailURIUniversalCommunication"`
-						} `xml:"DefinedTradeContact"`
-					} `xml:"BuyerTradeParty"`
-					SellerTaxRepresentativeTradeParty struct {
-						Name                     string `xml:"Name"`
-						SpecifiedTaxRegistration struct {
-							ID string `xml:"ID"`
-						} `xml:"SpecifiedTaxRegistration"`
-						PostalTradeAddress struct {
-							LineOne                string `xml:"LineOne"`
-							LineTwo                string `xml:"LineTwo"`
-							LineThree              string `xml:"LineThree"`
-							CityName               string `xml:"CityName"`
-							PostcodeCode           string `xml:"PostcodeCode"`
-							CountrySubDivisionName string `xml:"CountrySubDivisionName"`
-							CountryID              string `xml:"CountryID"`
-						} `xml:"PostalTradeAddress"`
-					} `xml:"SellerTaxRepresentativeTradeParty"`
-					ApplicableHeaderTradeDelivery struct {
-						ReceivingAdviceReferencedDocument struct {
-							IssuerAssignedID string `xml:"IssuerAssignedID"`
-						} `xml:"ReceivingAdviceReferencedDocument"`
-						DespatchAdviceReferencedDocument struct {
-							IssuerAssignedID string `xml:"IssuerAssignedID"`
-						} `xml:"DespatchAdviceReferencedDocument"`
-						ShipToTradeParty struct {
-							Name     string   `xml:"Name"`
-							ID       []string `xml:"ID"`
-							GlobalID []struct {
-								Text     string `xml:",chardata"`
-								SchemeID string `xml:"schemeID,attr"`
-							} `xml:"GlobalID"`
-							PostalTradeAddress struct {
-								LineOne                string `xml:"LineOne"`
-								LineTwo                string `xml:"LineTwo"`
-								LineThree              string `xml:"LineThree"`
-								CityName               string `xml:"CityName"`
-								PostcodeCode           string `xml:"PostcodeCode"`
-								CountrySubDivisionName string `xml:"CountrySubDivisionName"`
-								CountryID              string `xml:"CountryID"`
-							} `xml:"PostalTradeAddress"`
-						} `xml:"ShipToTradeParty"`
-						ActualDeliverySupplyChainEvent struct {
-							OccurrenceDateTime struct {
-								DateTimeString string `xml:"DateTimeString"`
-							} `xml:"OccurrenceDateTime"`
-						} `xml:"ActualDeliverySupplyChainEvent"`
-					} `xml:"ApplicableHeaderTradeDelivery"`
-				} `xml:"ApplicableHeaderTradeAgreement"`
-				IncludedSupplyChainTradeLineItem []struct {
-					AssociatedDocumentLineDocument struct {
-						LineID       string `xml:"LineID"`
-						IncludedNote []struct {
-							Content string `xml:"Content"`
-						} `xml:"IncludedNote"`
-					} `xml:"AssociatedDocumentLineDocument"`
-					SpecifiedLineTradeSettlement struct {
-						AdditionalReferencedDocument struct {
-							IssuerAssignedID  string `xml:"IssuerAssignedID"`
-							TypeCode          string `xml:"TypeCode"`
-							ReferenceTypeCode string `xml:"ReferenceTypeCode"`
-						} `xml:"AdditionalReferencedDocument"`
-						SpecifiedTradeSettlementLineMonetarySummation struct {
-							LineTotalAmount string `xml:"LineTotalAmount"`
-						} `xml:"SpecifiedTradeSettlementLineMonetarySummation"`
-						ReceivableSpecifiedTradeAccountingAccount struct {
-							ID string `xml:"ID"`
-						} `xml:"ReceivableSpecifiedTradeAccountingAccount"`
-						BillingSpecifiedPeriod []struct {
-							StartDateTime struct {
-								DateTimeString string `xml:"DateTimeString"`
-							} `xml:"StartDateTime"`
-							EndDateTime struct {
-								DateTimeString string `xml:"DateTimeString"`
-							} `xml:"EndDateTime"`
-						} `xml:"BillingSpecifiedPeriod"`
-						SpecifiedTradeAllowanceCharge []struct {
-							ChargeIndicator struct {
-								Indicator string `xml:"Indicator"`
-							} `xml:"ChargeIndicator"`
-							ActualAmount       string `xml:"ActualAmount"`
-							BasisAmount        string `xml:"BasisAmount"`
-							CalculationPercent string `xml:"CalculationPercent"`
-							Reason             string `xml:"Reason"`
-							ReasonCode         string `xml:"ReasonCode"`
-						} `xml:"SpecifiedTradeAllowanceCharge"`
-						ApplicableTradeTax struct {
-							CategoryCode          string `xml:"CategoryCode"`
-							RateApplicablePercent string `xml:"RateApplicablePercent"`
-						} `xml:"ApplicableTradeTax"`
-					} `xml:"SpecifiedLineTradeSettlement"`
-					SpecifiedLineTradeDelivery struct {
-						BilledQuantity struct {
-							Text     string `xml:",chardata"`
-							UnitCode string `xml:"unitCode,attr"`
-						} `xml:"BilledQuantity"`
-					} `xml:"SpecifiedLineTradeDelivery"`
-					SpecifiedLineTradeAgreement struct {
-						NetPriceProductTradePrice struct {
-							ChargeAmount  string `xml:"ChargeAmount"`
-							BasisQuantity struct {
-								Text     string `xml:",chardata"`
-								UnitCode string `xml:"unitCode,attr"`
-							} `xml:"BasisQuantity"`
-						} `xml:"NetPriceProductTradePrice"`
-						GrossPriceProductTradePrice struct {
-							AppliedTradeAllowanceCharge struct {
-								ActualAmount string `xml:"ActualAmount"`
-							} `xml:"AppliedTradeAllowanceCharge"`
-							ChargeAmount  string `xml:"ChargeAmount"`
-							BasisQuantity struct {
-								Text     string `xml:",chardata"`
-								UnitCode string `xml:"unitCode,attr"`
-							} `xml:"BasisQuantity"`
-						} `xml:"GrossPriceProductTradePrice"`
-						BuyerOrderReferencedDocument struct {
-							LineID string `xml:"LineID"`
-						} `xml:"BuyerOrderReferencedDocument"`
-					} `xml:"SpecifiedLineTradeAgreement"`
-					SpecifiedTradeProduct struct {
-						Name             string `xml:"Name"`
-						Description      string `xml:"Description"`
-						SellerAssignedID string `xml:"SellerAssignedID"`
-						BuyerAssignedID  string `xml:"BuyerAssignedID"`
-						GlobalID         struct {
-							Text     string `xml:",chardata"`
-							SchemeID string `xml:"schemeID,attr"`
-						} `xml:"GlobalID"`
-						DesignatedProductClassification struct {
-							ClassCode struct {
-								Text          string `xml:",chardata"`
-								ListID        string `xml:"listID,attr"`
-								ListVersionID string `xml:"listVersionID,attr"`
-							} `xml:"ClassCode"`
-						} `xml:"DesignatedProductClassification"`
-						OriginTradeCountry struct {
-							ID string `xml:"ID"`
-						} `xml:"OriginTradeCountry"`
-						ApplicableProductCharacteristic []struct {
-							Description string `xml:"Description"`
-							Value       string `xml:"Value"`
-						} `xml:"ApplicableProductCharacteristic"`
-					} `xml:"SpecifiedTradeProduct"`
-				} `xml:"IncludedSupplyChainTradeLineItem"`
-			} `xml:"SupplyChainTradeTransaction"`
-		} `xml:"CrossIndustryInvoice"`
-	}
-
-	decoder := xml.NewDecoder(r)
-	if err := decoder.Decode(&sourceXML); err != nil {
-		return "", fmt.Errorf("error decoding XML: %w", err)
-	}
-
-	// 2. Transform into the target XML structure
-	targetXML := Invoice{
-		XMLName: xml.Name{Local: "xr:invoice"},
-		InvoiceNumber: &Identifier{
-			XMLName: xml.Name{Local: "xr:Invoice_number"},
-			Text:    sourceXML.CrossIndustryInvoice.ExchangedDocument.ID,
-		},
-		InvoiceIssueDate: &Date{
-			XMLName: xml.Name{Local: "xr:Invoice_issue_date"},
-			Text:    formatDate(sourceXML.CrossIndustryInvoice.ExchangedDocument.IssueDateTime.DateTimeString),
-		},
-		InvoiceTypeCode: &Code{
-			XMLName: xml.Name{Local: "xr:Invoice_type_code"},
-			// ... (Logic for InvoiceTypeCode) ...
-		},
-		// ... (Other fields) ...
+	inv, err := model.Parse(r)
+	if err != nil {
+		return "", err
 	}
 
-	// ... (Processing for nested structures like INVOICE_NOTE, etc.) ...
-
-	// 3. Marshal the target XML
-	output, err := xml.MarshalIndent(targetXML, "", "  ")
+	output, err := xml.MarshalIndent(InvoiceFromModel(inv), "", "  ")
 	if err != nil {
 		return "", fmt.Errorf("error marshalling XML: %w", err)
 	}
 
 	return string(output), nil
 }
-
-// Helper functions for formatting, mapping, etc. (e.g., formatDate)
-func formatDate(dateStr string) string {
-	// Implement logic to format the date (e.g., remove hyphens)
-	return strings.ReplaceAll(dateStr, "-", "")
-}
-
-// ... (Other helper functions as needed) ...
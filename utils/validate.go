@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"eBill-Convert/model"
+)
+
+// ValidationIssue is a single finding of the validator.
+type ValidationIssue struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"` // error or warning
+	Field    string `json:"field,omitempty"`
+	Value    string `json:"value,omitempty"` // Offending value, e.g. an invalid IBAN
+	Message  string `json:"message"`
+}
+
+// ValidationReport is the outcome of validating one document.
+type ValidationReport struct {
+	Valid    bool              `json:"valid"`
+	Document *DocumentInfo     `json:"document,omitempty"`
+	Issues   []ValidationIssue `json:"issues"`
+}
+
+// presenceRule requires a business term to carry a value.
+type presenceRule struct {
+	rule    string
+	field   string
+	message string
+	present func(inv *model.Invoice) bool
+}
+
+// Mandatory elements of EN 16931, see the business rules BR-01 to BR-16.
+var presenceRules = []presenceRule{
+	{"BR-01", "BT-24", "An Invoice shall have a Specification identifier.",
+		func(inv *model.Invoice) bool { return inv.SpecificationID != "" }},
+	{"BR-02", "BT-1", "An Invoice shall have an Invoice number.",
+		func(inv *model.Invoice) bool { return inv.Number != "" }},
+	{"BR-03", "BT-2", "An Invoice shall have an Invoice issue date.",
+		func(inv *model.Invoice) bool { return inv.IssueDate.IsSet() }},
+	{"BR-04", "BT-3", "An Invoice shall have an Invoice type code.",
+		func(inv *model.Invoice) bool { return inv.TypeCode != "" }},
+	{"BR-05", "BT-5", "An Invoice shall have an Invoice currency code.",
+		func(inv *model.Invoice) bool { return inv.CurrencyCode != "" }},
+	{"BR-06", "BT-27", "An Invoice shall contain the Seller name.",
+		func(inv *model.Invoice) bool { return inv.Seller.Name != "" }},
+	{"BR-07", "BT-44", "An Invoice shall contain the Buyer name.",
+		func(inv *model.Invoice) bool { return inv.Buyer.Name != "" }},
+	{"BR-09", "BT-40", "The Seller postal address shall contain a Seller country code.",
+		func(inv *model.Invoice) bool { return inv.Seller.Address.CountryCode != "" }},
+	{"BR-11", "BT-55", "The Buyer postal address shall contain a Buyer country code.",
+		func(inv *model.Invoice) bool { return inv.Buyer.Address.CountryCode != "" }},
+	{"BR-12", "BT-106", "An Invoice shall have the Sum of Invoice line net amount.",
+		func(inv *model.Invoice) bool { return inv.Totals.LineNet.IsSet() }},
+	{"BR-13", "BT-109", "An Invoice shall have the Invoice total amount without VAT.",
+		func(inv *model.Invoice) bool { return inv.Totals.TaxBasis.IsSet() }},
+	{"BR-14", "BT-112", "An Invoice shall have the Invoice total amount with VAT.",
+		func(inv *model.Invoice) bool { return inv.Totals.Grand.IsSet() }},
+	{"BR-15", "BT-115", "An Invoice shall have the Amount due for payment.",
+		func(inv *model.Invoice) bool { return inv.Totals.DuePayable.IsSet() }},
+	{"BR-16", "BG-25", "An Invoice shall have at least one Invoice line.",
+		func(inv *model.Invoice) bool { return len(inv.Lines) > 0 }},
+}
+
+// Validate checks a CII or UBL invoice against the mandatory elements of
+// EN 16931, and Peppol BIS Billing 3.0 invoices against the Peppol rules.
+// Identifiers with check digits or a fixed format are verified as well.
+// Documents that cannot be parsed at all yield an error.
+func Validate(r io.Reader) (*ValidationReport, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading document: %w", err)
+	}
+
+	info, err := DetectDocument(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	inv, err := model.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ValidationReport{Document: info, Issues: []ValidationIssue{}}
+	for _, rule := range presenceRules {
+		if !rule.present(inv) {
+			report.Issues = append(report.Issues, ValidationIssue{
+				Rule:     rule.rule,
+				Severity: "error",
+				Field:    rule.field,
+				Message:  rule.message,
+			})
+		}
+	}
+	if model.IsPeppol(inv) {
+		report.Issues = append(report.Issues, peppolIssues(inv)...)
+	}
+	report.Issues = append(report.Issues, IdentifierIssues(inv)...)
+
+	report.finish()
+	return report, nil
+}
+
+// finish sets Valid according to the collected issues.
+func (r *ValidationReport) finish() {
+	r.Valid = true
+	for _, issue := range r.Issues {
+		if issue.Severity == "error" {
+			r.Valid = false
+		}
+	}
+}
@@ -0,0 +1,448 @@
+package utils
+
+import (
+	"encoding/base64"
+
+	"eBill-Convert/model"
+)
+
+// XRNamespace is the namespace of the XRechnung XR intermediate format.
+const XRNamespace = "urn:ce.eu:en16931:2017:xoev-de:kosit:standard:xrechnung-1"
+
+// InvoiceFromModel maps the semantic model onto the XR structure.
+func InvoiceFromModel(inv *model.Invoice) *Invoice {
+	xr := &Invoice{
+		Xmlns:                      XRNamespace,
+		XmlnsXR:                    XRNamespace,
+		InvoiceNumber:              xrIdentifier(inv.Number),
+		InvoiceIssueDate:           xrDate(inv.IssueDate),
+		InvoiceTypeCode:            xrCode(string(inv.TypeCode)),
+		InvoiceCurrencyCode:        xrCode(inv.CurrencyCode),
+		VATAccountingCurrencyCode:  xrCode(inv.TaxCurrencyCode),
+		ValueAddedTaxPointDateCode: xrCode(inv.TaxPointDateCode),
+		BuyerReference:             xrText(inv.BuyerReference),
+		ProjectReference:           xrReference(inv.ProjectReference),
+		ContractReference:          xrReference(inv.ContractReference),
+		PurchaseOrderReference:     xrReference(inv.PurchaseOrderReference),
+		SalesOrderReference:        xrReference(inv.SalesOrderReference),
+		ReceivingAdviceReference:   xrReference(inv.ReceivingAdviceReference),
+		DespatchAdviceReference:    xrReference(inv.DespatchAdviceReference),
+		TenderOrLotReference:       xrReference(inv.TenderReference),
+		InvoicedObjectIdentifier:   xrSchemeIdentifier(inv.InvoicedObject),
+		BuyerAccountingReference:   xrText(inv.BuyerAccountingReference),
+	}
+	if inv.TaxPointDate.IsSet() {
+		xr.ValueAddedTaxPointDate = &ValueAddedTaxPointDate{Id: "BT-7", Text: inv.TaxPointDate.XSDate()}
+	}
+	if inv.DueDate.IsSet() {
+		xr.PaymentDueDate = &PaymentDueDate{Id: "BT-9", Text: inv.DueDate.XSDate()}
+	}
+	if inv.PaymentTerms != "" {
+		xr.PaymentTerms = &PaymentTerms{Id: "BT-20", Text: inv.PaymentTerms}
+	}
+
+	for _, note := range inv.Notes {
+		xr.InvoiceNote = append(xr.InvoiceNote, &InvoiceNote{
+			Id:                     "BG-1",
+			InvoiceNoteSubjectCode: xrCode(note.SubjectCode),
+			InvoiceNote:            xrText(note.Text),
+		})
+	}
+	xr.ProcessControl = &ProcessControl{
+		Id:                      "BG-2",
+		BusinessProcessType:     xrText(inv.BusinessProcess),
+		SpecificationIdentifier: xrIdentifier(inv.SpecificationID),
+	}
+	for _, preceding := range inv.PrecedingInvoices {
+		// XR holds a single preceding invoice reference
+		xr.PrecedingInvoiceReference = &PrecedingInvoiceReference{
+			Id:                        "BG-3",
+			PrecedingInvoiceReference: xrReference(preceding.Number),
+			PrecedingInvoiceIssueDate: xrDate(preceding.IssueDate),
+		}
+		break
+	}
+
+	xr.Seller = xrSeller(inv.Seller)
+	xr.Buyer = xrBuyer(inv.Buyer)
+	if payee := inv.Payee; payee != nil {
+		xr.Payee = &Party{
+			PayeeName:                        xrText(payee.Name),
+			PayeeLegalRegistrationIdentifier: xrSchemeIdentifier(payee.LegalRegistrationID),
+		}
+		if len(payee.Identifiers) > 0 {
+			xr.Payee.PayeeIdentifier = xrSchemeIdentifier(payee.Identifiers[0])
+		}
+	}
+	if representative := inv.TaxRepresentative; representative != nil {
+		address := representative.Address
+		xr.SellerTaxRepresentativeParty = &TaxRepresentativeParty{
+			Id:                                   "BG-11",
+			SellerTaxRepresentativeName:          xrText(representative.Name),
+			SellerTaxRepresentativeVATIdentifier: xrIdentifier(representative.VATID),
+		}
+		if address.IsSet() {
+			xr.SellerTaxRepresentativeParty.SellerTaxRepresentativePostalAddress = &PostalAddress{
+				Id:                                  "BG-12",
+				TaxRepresentativeAddressLine1:       xrText(address.Line1),
+				TaxRepresentativeAddressLine2:       xrText(address.Line2),
+				TaxRepresentativeAddressLine3:       xrText(address.Line3),
+				TaxRepresentativeCity:               xrText(address.City),
+				TaxRepresentativePostCode:           xrText(address.PostCode),
+				TaxRepresentativeCountrySubdivision: xrText(address.Subdivision),
+				TaxRepresentativeCountryCode:        xrCode(address.CountryCode),
+			}
+		}
+	}
+	if delivery := inv.Delivery; delivery != nil {
+		xr.DeliveryInformation = &DeliveryInformation{
+			Id:                          "BG-13",
+			DeliverToPartyName:          xrText(delivery.PartyName),
+			DeliverToLocationIdentifier: xrSchemeIdentifier(delivery.LocationID),
+			ActualDeliveryDate:          xrDate(delivery.Date),
+		}
+		if address := delivery.Address; address.IsSet() {
+			xr.DeliveryInformation.DeliverToAddress = &PostalAddress{
+				Id:                          "BG-15",
+				DeliverToAddressLine1:       xrText(address.Line1),
+				DeliverToAddressLine2:       xrText(address.Line2),
+				DeliverToAddressLine3:       xrText(address.Line3),
+				DeliverToCity:               xrText(address.City),
+				DeliverToPostCode:           xrText(address.PostCode),
+				DeliverToCountrySubdivision: xrText(address.Subdivision),
+				DeliverToCountryCode:        xrCode(address.CountryCode),
+			}
+		}
+	}
+	if period := inv.InvoicingPeriod; period.IsSet() {
+		xr.InvoicingPeriod = &InvoicingPeriod{
+			Id:                       "BG-14",
+			InvoicingPeriodStartDate: xrDate(period.Start),
+			InvoicingPeriodEndDate:   xrDate(period.End),
+		}
+	}
+
+	xr.PaymentInstructions = xrPaymentInstructions(inv.PaymentInstructions)
+
+	for _, allowance := range inv.Allowances {
+		xr.DocumentLevelAllowances = append(xr.DocumentLevelAllowances, &DocumentLevelAllowances{
+			Id:                               "BG-20",
+			DocumentLevelAllowanceAmount:     xrAmount(allowance.Amount),
+			DocumentLevelAllowanceBaseAmount: xrAmount(allowance.BaseAmount),
+			DocumentLevelAllowancePercentage: xrAmount(allowance.Percentage),
+			DocumentLevelVATCategoryCode:     xrCode(string(allowance.VATCategory)),
+			DocumentLevelVATRate:             xrAmount(allowance.VATRate),
+			DocumentLevelAllowanceReason:     xrText(allowance.Reason),
+			DocumentLevelAllowanceReasonCode: xrCode(allowance.ReasonCode),
+		})
+	}
+	for _, charge := range inv.Charges {
+		xr.DocumentLevelCharges = append(xr.DocumentLevelCharges, &DocumentLevelCharges{
+			Id:                            "BG-21",
+			DocumentLevelChargeAmount:     xrAmount(charge.Amount),
+			DocumentLevelChargeBaseAmount: xrAmount(charge.BaseAmount),
+			DocumentLevelChargePercentage: xrAmount(charge.Percentage),
+			DocumentLevelVATCategoryCode:  xrCode(string(charge.VATCategory)),
+			DocumentLevelVATRate:          xrAmount(charge.VATRate),
+			DocumentLevelChargeReason:     xrText(charge.Reason),
+			DocumentLevelChargeReasonCode: xrCode(charge.ReasonCode),
+		})
+	}
+
+	totals := inv.Totals
+	xr.DocumentTotals = &DocumentTotals{
+		Id:                        "BG-22",
+		SumOfInvoiceLineNetAmount: xrAmount(totals.LineNet),
+		InvoiceLineNetAmount: InvoiceLineNetAmount{
+			SumOfAllowancesOnDocumentLevel:            xrAmount(totals.Allowances),
+			SumOfChargesOnDocumentLevel:               xrAmount(totals.Charges),
+			InvoiceTotalAmountWithoutVAT:              xrAmount(totals.TaxBasis),
+			InvoiceTotalVATAmount:                     xrAmount(totals.Tax),
+			InvoiceTotalVATAmountInAccountingCurrency: xrAmount(totals.TaxAccounting),
+			InvoiceTotalAmountWithVAT:                 xrAmount(totals.Grand),
+			PaidAmount:                                xrAmount(totals.Prepaid),
+			RoundingAmount:                            xrAmount(totals.Rounding),
+			AmountDueForPayment:                       xrAmount(totals.DuePayable),
+		},
+	}
+
+	for _, vat := range inv.VATBreakdown {
+		xr.VATBreakdown = append(xr.VATBreakdown, &VATBreakdown{
+			Id:                       "BG-23",
+			VATCategoryTaxableAmount: xrAmount(vat.TaxableAmount),
+			VATCategoryTaxAmount:     xrAmount(vat.TaxAmount),
+			VATCategoryCode:          xrCode(string(vat.Category)),
+			VATCategoryRate:          xrAmount(vat.Rate),
+			VATExemptionReasonText:   xrText(vat.ExemptionReason),
+			VATExemptionReasonCode:   xrCode(vat.ExemptionReasonCode),
+		})
+	}
+
+	for _, doc := range inv.SupportingDocuments {
+		supporting := &AdditionalSupportingDocuments{
+			Id:                            "BG-24",
+			SupportingDocumentReference:   xrReference(doc.ID),
+			SupportingDocumentDescription: xrText(doc.Description),
+			ExternalDocumentLocation:      xrText(doc.URI),
+		}
+		if attachment := doc.Attachment; attachment != nil {
+			supporting.AttachedDocument = &BinaryObject{
+				Mime_code: attachment.MimeCode,
+				Filename:  attachment.Filename,
+				Text:      base64.StdEncoding.EncodeToString(attachment.Data),
+			}
+		}
+		xr.AdditionalSupportingDocuments = append(xr.AdditionalSupportingDocuments, supporting)
+	}
+
+	for _, line := range inv.Lines {
+		xr.InvoiceLine = append(xr.InvoiceLine, xrLine(line))
+	}
+	return xr
+}
+
+func xrSeller(party model.Party) *Party {
+	seller := &Party{
+		SellerName:                        xrText(party.Name),
+		SellerTradingName:                 xrText(party.TradingName),
+		SellerLegalRegistrationIdentifier: xrSchemeIdentifier(party.LegalRegistrationID),
+		SellerVATIdentifier:               xrIdentifier(party.VATID),
+		SellerTaxRegistrationIdentifier:   xrIdentifier(party.TaxRegistrationID),
+		SellerAdditionalLegalInformation:  xrText(party.AdditionalLegalInfo),
+		SellerElectronicAddress:           xrSchemeIdentifier(party.ElectronicAddress),
+	}
+	if len(party.Identifiers) > 0 {
+		seller.SellerIdentifier = xrSchemeIdentifier(party.Identifiers[0])
+	}
+	if address := party.Address; address.IsSet() {
+		seller.SellerPostalAddress = &PostalAddress{
+			Id:                       "BG-5",
+			SellerAddressLine1:       xrText(address.Line1),
+			SellerAddressLine2:       xrText(address.Line2),
+			SellerAddressLine3:       xrText(address.Line3),
+			SellerCity:               xrText(address.City),
+			SellerPostCode:           xrText(address.PostCode),
+			SellerCountrySubdivision: xrText(address.Subdivision),
+			SellerCountryCode:        xrCode(address.CountryCode),
+		}
+	}
+	if contact := party.Contact; contact.IsSet() {
+		seller.SellerContact = &Contact{
+			Id:                           "BG-6",
+			SellerContactPoint:           xrText(contact.Name),
+			SellerContactTelephoneNumber: xrText(contact.Phone),
+			SellerContactEmailAddress:    xrText(contact.Email),
+		}
+	}
+	return seller
+}
+
+func xrBuyer(party model.Party) *Party {
+	buyer := &Party{
+		BuyerName:                        xrText(party.Name),
+		BuyerTradingName:                 xrText(party.TradingName),
+		BuyerLegalRegistrationIdentifier: xrSchemeIdentifier(party.LegalRegistrationID),
+		BuyerVATIdentifier:               xrIdentifier(party.VATID),
+		BuyerElectronicAddress:           xrSchemeIdentifier(party.ElectronicAddress),
+	}
+	if len(party.Identifiers) > 0 {
+		buyer.BuyerIdentifier = xrSchemeIdentifier(party.Identifiers[0])
+	}
+	if address := party.Address; address.IsSet() {
+		buyer.BuyerPostalAddress = &PostalAddress{
+			Id:                      "BG-8",
+			BuyerAddressLine1:       xrText(address.Line1),
+			BuyerAddressLine2:       xrText(address.Line2),
+			BuyerAddressLine3:       xrText(address.Line3),
+			BuyerCity:               xrText(address.City),
+			BuyerPostCode:           xrText(address.PostCode),
+			BuyerCountrySubdivision: xrText(address.Subdivision),
+			BuyerCountryCode:        xrCode(address.CountryCode),
+		}
+	}
+	if contact := party.Contact; contact.IsSet() {
+		buyer.BuyerContact = &Contact{
+			Id:                          "BG-9",
+			BuyerContactPoint:           xrText(contact.Name),
+			BuyerContactTelephoneNumber: xrText(contact.Phone),
+			BuyerContactEmailAddress:    xrText(contact.Email),
+		}
+	}
+	return buyer
+}
+
+func xrPaymentInstructions(payment model.PaymentInstructions) []*PaymentInstructions {
+	if payment.MeansCode == "" {
+		return nil
+	}
+	instructions := &PaymentInstructions{
+		Id:                    "BG-16",
+		PaymentMeansTypeCode:  xrCode(payment.MeansCode),
+		PaymentMeansText:      xrText(payment.MeansText),
+		RemittanceInformation: xrText(payment.RemittanceInfo),
+	}
+	if card := payment.Card; card != nil {
+		instructions.PaymentCardInformation = &PaymentCardInformation{
+			Id:                              "BG-18",
+			PaymentCardPrimaryAccountNumber: xrText(card.AccountNumber),
+			PaymentCardHolderName:           xrText(card.HolderName),
+		}
+	}
+	if debit := payment.DirectDebit; debit != nil {
+		instructions.DirectDebit = &DirectDebit{
+			Id:                             "BG-19",
+			MandateReferenceIdentifier:     xrIdentifier(debit.MandateID),
+			BankAssignedCreditorIdentifier: xrIdentifier(debit.CreditorID),
+			DebitedAccountIdentifier:       xrIdentifier(debit.DebitedAccount),
+		}
+	}
+
+	// XR allows one credit transfer per payment instructions group
+	if len(payment.CreditTransfers) == 0 {
+		return []*PaymentInstructions{instructions}
+	}
+	var result []*PaymentInstructions
+	for _, transfer := range payment.CreditTransfers {
+		copy := *instructions
+		copy.CreditTransfer = &CreditTransfer{
+			Id:                               "BG-17",
+			PaymentAccountIdentifier:         xrIdentifier(transfer.AccountID),
+			PaymentAccountName:               xrText(transfer.AccountName),
+			PaymentServiceProviderIdentifier: xrText(transfer.ProviderID),
+		}
+		result = append(result, &copy)
+	}
+	return result
+}
+
+func xrLine(line model.Line) *InvoiceLine {
+	xr := &InvoiceLine{
+		Id:                                   "BG-25",
+		InvoiceLineIdentifier:                xrIdentifier(line.ID),
+		InvoiceLineNote:                      xrText(line.Note),
+		InvoiceLineObjectIdentifier:          xrSchemeIdentifier(line.ObjectID),
+		InvoicedQuantity:                     xrAmount(line.Quantity),
+		InvoicedQuantityUnitOfMeasureCode:    xrCode(line.UnitCode),
+		InvoiceLineNetAmount:                 xrAmount(line.NetAmount),
+		ReferencedPurchaseOrderLineReference: xrReference(line.OrderLineReference),
+		InvoiceLineBuyerAccountingReference:  xrText(line.AccountingReference),
+		PriceDetails: &PriceDetails{
+			Id:                                 "BG-29",
+			ItemNetPrice:                       xrAmount(line.Price.Net),
+			ItemPriceDiscount:                  xrAmount(line.Price.Discount),
+			ItemGrossPrice:                     xrAmount(line.Price.Gross),
+			ItemPriceBaseQuantity:              xrAmount(line.Price.BaseQuantity),
+			ItemPriceBaseQuantityUnitOfMeasure: xrCode(line.Price.BaseQuantityUnit),
+		},
+		LineVATInformation: &LineVATInformation{
+			Id:                          "BG-30",
+			InvoicedItemVATCategoryCode: xrCode(string(line.VATCategory)),
+			InvoicedItemVATRate:         xrAmount(line.VATRate),
+		},
+	}
+	if line.Period.IsSet() {
+		xr.InvoiceLinePeriod = &InvoiceLinePeriod{
+			Id:                         "BG-26",
+			InvoiceLinePeriodStartDate: xrDate(line.Period.Start),
+			InvoiceLinePeriodEndDate:   xrDate(line.Period.End),
+		}
+	}
+	for _, allowance := range line.Allowances {
+		xr.InvoiceLineAllowances = append(xr.InvoiceLineAllowances, &InvoiceLineAllowances{
+			Id:                             "BG-27",
+			InvoiceLineAllowanceAmount:     xrAmount(allowance.Amount),
+			InvoiceLineAllowanceBaseAmount: xrAmount(allowance.BaseAmount),
+			InvoiceLineAllowancePercentage: xrAmount(allowance.Percentage),
+			InvoiceLineAllowanceReason:     xrText(allowance.Reason),
+			InvoiceLineAllowanceReasonCode: xrCode(allowance.ReasonCode),
+		})
+	}
+	for _, charge := range line.Charges {
+		xr.InvoiceLineCharges = append(xr.InvoiceLineCharges, &InvoiceLineCharges{
+			Id:                          "BG-28",
+			InvoiceLineChargeAmount:     xrAmount(charge.Amount),
+			InvoiceLineChargeBaseAmount: xrAmount(charge.BaseAmount),
+			InvoiceLineChargePercentage: xrAmount(charge.Percentage),
+			InvoiceLineChargeReason:     xrText(charge.Reason),
+			InvoiceLineChargeReasonCode: xrCode(charge.ReasonCode),
+		})
+	}
+
+	item := line.Item
+	xr.ItemInformation = &ItemInformation{
+		Id:                     "BG-31",
+		ItemName:               xrText(item.Name),
+		ItemDescription:        xrText(item.Description),
+		ItemSellersIdentifier:  xrIdentifier(item.SellerID),
+		ItemBuyersIdentifier:   xrIdentifier(item.BuyerID),
+		ItemStandardIdentifier: xrSchemeIdentifier(item.StandardID),
+		ItemCountryOfOrigin:    xrCode(item.OriginCountry),
+	}
+	if len(item.Classifications) > 0 {
+		xr.ItemInformation.ItemClassificationIdentifier = xrSchemeIdentifier(item.Classifications[0])
+	}
+	for _, attribute := range item.Attributes {
+		xr.ItemInformation.ItemAttributes = append(xr.ItemInformation.ItemAttributes, &ItemAttributes{
+			Id:                 "BG-32",
+			ItemAttributeName:  xrText(attribute.Name),
+			ItemAttributeValue: xrText(attribute.Value),
+		})
+	}
+	return xr
+}
+
+// The helpers below return nil for absent values so that the elements are
+// omitted.
+
+func xrText(value string) *Text {
+	if value == "" {
+		return nil
+	}
+	return &Text{Text: value}
+}
+
+func xrCode(value string) *Code {
+	if value == "" {
+		return nil
+	}
+	return &Code{Text: value}
+}
+
+func xrReference(value string) *DocumentReference {
+	if value == "" {
+		return nil
+	}
+	return &DocumentReference{Text: value}
+}
+
+func xrIdentifier(value string) *Identifier {
+	if value == "" {
+		return nil
+	}
+	return &Identifier{Text: value}
+}
+
+func xrSchemeIdentifier(id model.Identifier) *IdentifierWithScheme {
+	if !id.IsSet() {
+		return nil
+	}
+	return &IdentifierWithScheme{
+		Scheme_identifier:         id.Scheme,
+		Scheme_version_identifier: id.SchemeVersion,
+		Text:                      id.ID,
+	}
+}
+
+func xrAmount(value model.Decimal) *Text {
+	if !value.IsSet() {
+		return nil
+	}
+	return &Text{Text: value.String()}
+}
+
+func xrDate(value model.Date) *Date {
+	if !value.IsSet() {
+		return nil
+	}
+	return &Date{Text: value.XSDate()}
+}
@@ -0,0 +1,472 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"eBill-Convert/model"
+)
+
+// IsXR reports whether data is a document in the XR intermediate format,
+// whose root element is "invoice" (usually as xr:invoice).
+func IsXR(data []byte) bool {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return false
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local == "invoice"
+		}
+	}
+}
+
+// ParseXR reads a document in the XR intermediate format. Elements are
+// matched by local name, so prefixed (xr:Invoice_number) and unprefixed
+// documents are both accepted.
+func ParseXR(r io.Reader) (*Invoice, error) {
+	var xr Invoice
+	if err := xml.NewDecoder(r).Decode(&xr); err != nil {
+		return nil, fmt.Errorf("error decoding XML: %w", err)
+	}
+	return &xr, nil
+}
+
+// TransformXR converts an XR document into CII or UBL.
+func TransformXR(r io.Reader, syntax string) ([]byte, error) {
+	xr, err := ParseXR(r)
+	if err != nil {
+		return nil, err
+	}
+	inv, err := ModelFromInvoice(xr)
+	if err != nil {
+		return nil, err
+	}
+	return model.Marshal(inv, syntax)
+}
+
+// ModelFromInvoice maps an XR structure onto the semantic model; it is the
+// inverse of InvoiceFromModel.
+func ModelFromInvoice(xr *Invoice) (*model.Invoice, error) {
+	p := &xrParser{}
+	inv := &model.Invoice{
+		Syntax:                   model.SyntaxXR,
+		Number:                   xrIdentifierText(xr.InvoiceNumber),
+		IssueDate:                p.date("BT-2", xr.InvoiceIssueDate),
+		TypeCode:                 model.DocumentTypeCode(xrCodeText(xr.InvoiceTypeCode)),
+		CurrencyCode:             xrCodeText(xr.InvoiceCurrencyCode),
+		TaxCurrencyCode:          xrCodeText(xr.VATAccountingCurrencyCode),
+		TaxPointDateCode:         xrCodeText(xr.ValueAddedTaxPointDateCode),
+		BuyerReference:           xrTextValue(xr.BuyerReference),
+		ProjectReference:         xrReferenceText(xr.ProjectReference),
+		ContractReference:        xrReferenceText(xr.ContractReference),
+		PurchaseOrderReference:   xrReferenceText(xr.PurchaseOrderReference),
+		SalesOrderReference:      xrReferenceText(xr.SalesOrderReference),
+		ReceivingAdviceReference: xrReferenceText(xr.ReceivingAdviceReference),
+		DespatchAdviceReference:  xrReferenceText(xr.DespatchAdviceReference),
+		TenderReference:          xrReferenceText(xr.TenderOrLotReference),
+		InvoicedObject:           xrSchemeIdentifierOf(xr.InvoicedObjectIdentifier),
+		BuyerAccountingReference: xrTextValue(xr.BuyerAccountingReference),
+	}
+	if date := xr.ValueAddedTaxPointDate; date != nil {
+		inv.TaxPointDate = p.date("BT-7", &Date{Text: date.Text})
+	}
+	if date := xr.PaymentDueDate; date != nil {
+		inv.DueDate = p.date("BT-9", &Date{Text: date.Text})
+	}
+	if terms := xr.PaymentTerms; terms != nil {
+		inv.PaymentTerms = strings.TrimSpace(terms.Text)
+	}
+
+	for _, note := range xr.InvoiceNote {
+		inv.Notes = append(inv.Notes, model.Note{
+			SubjectCode: xrCodeText(note.InvoiceNoteSubjectCode),
+			Text:        xrTextValue(note.InvoiceNote),
+		})
+	}
+	if control := xr.ProcessControl; control != nil {
+		inv.BusinessProcess = xrTextValue(control.BusinessProcessType)
+		inv.SpecificationID = xrIdentifierText(control.SpecificationIdentifier)
+	}
+	if preceding := xr.PrecedingInvoiceReference; preceding != nil {
+		inv.PrecedingInvoices = []model.PrecedingInvoice{{
+			Number:    xrReferenceText(preceding.PrecedingInvoiceReference),
+			IssueDate: p.date("BT-26", preceding.PrecedingInvoiceIssueDate),
+		}}
+	}
+
+	if seller := xr.Seller; seller != nil {
+		inv.Seller = model.Party{
+			Name:                xrTextValue(seller.SellerName),
+			TradingName:         xrTextValue(seller.SellerTradingName),
+			LegalRegistrationID: xrSchemeIdentifierOf(seller.SellerLegalRegistrationIdentifier),
+			VATID:               xrIdentifierText(seller.SellerVATIdentifier),
+			TaxRegistrationID:   xrIdentifierText(seller.SellerTaxRegistrationIdentifier),
+			AdditionalLegalInfo: xrTextValue(seller.SellerAdditionalLegalInformation),
+			ElectronicAddress:   xrSchemeIdentifierOf(seller.SellerElectronicAddress),
+		}
+		if id := xrSchemeIdentifierOf(seller.SellerIdentifier); id.IsSet() {
+			inv.Seller.Identifiers = []model.Identifier{id}
+		}
+		if address := seller.SellerPostalAddress; address != nil {
+			inv.Seller.Address = model.Address{
+				Line1:       xrTextValue(address.SellerAddressLine1),
+				Line2:       xrTextValue(address.SellerAddressLine2),
+				Line3:       xrTextValue(address.SellerAddressLine3),
+				City:        xrTextValue(address.SellerCity),
+				PostCode:    xrTextValue(address.SellerPostCode),
+				Subdivision: xrTextValue(address.SellerCountrySubdivision),
+				CountryCode: xrCodeText(address.SellerCountryCode),
+			}
+		}
+		if contact := seller.SellerContact; contact != nil {
+			inv.Seller.Contact = model.Contact{
+				Name:  xrTextValue(contact.SellerContactPoint),
+				Phone: xrTextValue(contact.SellerContactTelephoneNumber),
+				Email: xrTextValue(contact.SellerContactEmailAddress),
+			}
+		}
+	}
+	if buyer := xr.Buyer; buyer != nil {
+		inv.Buyer = model.Party{
+			Name:                xrTextValue(buyer.BuyerName),
+			TradingName:         xrTextValue(buyer.BuyerTradingName),
+			LegalRegistrationID: xrSchemeIdentifierOf(buyer.BuyerLegalRegistrationIdentifier),
+			VATID:               xrIdentifierText(buyer.BuyerVATIdentifier),
+			ElectronicAddress:   xrSchemeIdentifierOf(buyer.BuyerElectronicAddress),
+		}
+		if id := xrSchemeIdentifierOf(buyer.BuyerIdentifier); id.IsSet() {
+			inv.Buyer.Identifiers = []model.Identifier{id}
+		}
+		if address := buyer.BuyerPostalAddress; address != nil {
+			inv.Buyer.Address = model.Address{
+				Line1:       xrTextValue(address.BuyerAddressLine1),
+				Line2:       xrTextValue(address.BuyerAddressLine2),
+				Line3:       xrTextValue(address.BuyerAddressLine3),
+				City:        xrTextValue(address.BuyerCity),
+				PostCode:    xrTextValue(address.BuyerPostCode),
+				Subdivision: xrTextValue(address.BuyerCountrySubdivision),
+				CountryCode: xrCodeText(address.BuyerCountryCode),
+			}
+		}
+		if contact := buyer.BuyerContact; contact != nil {
+			inv.Buyer.Contact = model.Contact{
+				Name:  xrTextValue(contact.BuyerContactPoint),
+				Phone: xrTextValue(contact.BuyerContactTelephoneNumber),
+				Email: xrTextValue(contact.BuyerContactEmailAddress),
+			}
+		}
+	}
+	if payee := xr.Payee; payee != nil {
+		inv.Payee = &model.Party{
+			Name:                xrTextValue(payee.PayeeName),
+			LegalRegistrationID: xrSchemeIdentifierOf(payee.PayeeLegalRegistrationIdentifier),
+		}
+		if id := xrSchemeIdentifierOf(payee.PayeeIdentifier); id.IsSet() {
+			inv.Payee.Identifiers = []model.Identifier{id}
+		}
+	}
+	if representative := xr.SellerTaxRepresentativeParty; representative != nil {
+		inv.TaxRepresentative = &model.Party{
+			Name:  xrTextValue(representative.SellerTaxRepresentativeName),
+			VATID: xrIdentifierText(representative.SellerTaxRepresentativeVATIdentifier),
+		}
+		if address := representative.SellerTaxRepresentativePostalAddress; address != nil {
+			inv.TaxRepresentative.Address = model.Address{
+				Line1:       xrTextValue(address.TaxRepresentativeAddressLine1),
+				Line2:       xrTextValue(address.TaxRepresentativeAddressLine2),
+				Line3:       xrTextValue(address.TaxRepresentativeAddressLine3),
+				City:        xrTextValue(address.TaxRepresentativeCity),
+				PostCode:    xrTextValue(address.TaxRepresentativePostCode),
+				Subdivision: xrTextValue(address.TaxRepresentativeCountrySubdivision),
+				CountryCode: xrCodeText(address.TaxRepresentativeCountryCode),
+			}
+		}
+	}
+	if delivery := xr.DeliveryInformation; delivery != nil {
+		inv.Delivery = &model.Delivery{
+			PartyName:  xrTextValue(delivery.DeliverToPartyName),
+			LocationID: xrSchemeIdentifierOf(delivery.DeliverToLocationIdentifier),
+			Date:       p.date("BT-72", delivery.ActualDeliveryDate),
+		}
+		if address := delivery.DeliverToAddress; address != nil {
+			inv.Delivery.Address = model.Address{
+				Line1:       xrTextValue(address.DeliverToAddressLine1),
+				Line2:       xrTextValue(address.DeliverToAddressLine2),
+				Line3:       xrTextValue(address.DeliverToAddressLine3),
+				City:        xrTextValue(address.DeliverToCity),
+				PostCode:    xrTextValue(address.DeliverToPostCode),
+				Subdivision: xrTextValue(address.DeliverToCountrySubdivision),
+				CountryCode: xrCodeText(address.DeliverToCountryCode),
+			}
+		}
+	}
+	if period := xr.InvoicingPeriod; period != nil {
+		inv.InvoicingPeriod = model.Period{
+			Start: p.date("BT-73", period.InvoicingPeriodStartDate),
+			End:   p.date("BT-74", period.InvoicingPeriodEndDate),
+		}
+	}
+
+	// XR repeats the payment instructions for every credit transfer
+	payment := &inv.PaymentInstructions
+	for _, instructions := range xr.PaymentInstructions {
+		if payment.MeansCode == "" {
+			payment.MeansCode = xrCodeText(instructions.PaymentMeansTypeCode)
+			payment.MeansText = xrTextValue(instructions.PaymentMeansText)
+			payment.RemittanceInfo = xrTextValue(instructions.RemittanceInformation)
+		}
+		if transfer := instructions.CreditTransfer; transfer != nil {
+			payment.CreditTransfers = append(payment.CreditTransfers, model.CreditTransfer{
+				AccountID:   xrIdentifierText(transfer.PaymentAccountIdentifier),
+				AccountName: xrTextValue(transfer.PaymentAccountName),
+				ProviderID:  xrTextValue(transfer.PaymentServiceProviderIdentifier),
+			})
+		}
+		if card := instructions.PaymentCardInformation; card != nil && payment.Card == nil {
+			payment.Card = &model.PaymentCard{
+				AccountNumber: xrTextValue(card.PaymentCardPrimaryAccountNumber),
+				HolderName:    xrTextValue(card.PaymentCardHolderName),
+			}
+		}
+		if debit := instructions.DirectDebit; debit != nil && payment.DirectDebit == nil {
+			payment.DirectDebit = &model.DirectDebit{
+				MandateID:      xrIdentifierText(debit.MandateReferenceIdentifier),
+				CreditorID:     xrIdentifierText(debit.BankAssignedCreditorIdentifier),
+				DebitedAccount: xrIdentifierText(debit.DebitedAccountIdentifier),
+			}
+		}
+	}
+
+	for _, allowance := range xr.DocumentLevelAllowances {
+		inv.Allowances = append(inv.Allowances, model.AllowanceCharge{
+			Amount:      p.decimal("BT-92", allowance.DocumentLevelAllowanceAmount),
+			BaseAmount:  p.decimal("BT-93", allowance.DocumentLevelAllowanceBaseAmount),
+			Percentage:  p.decimal("BT-94", allowance.DocumentLevelAllowancePercentage),
+			VATCategory: model.VATCategory(xrCodeText(allowance.DocumentLevelVATCategoryCode)),
+			VATRate:     p.decimal("BT-96", allowance.DocumentLevelVATRate),
+			Reason:      xrTextValue(allowance.DocumentLevelAllowanceReason),
+			ReasonCode:  xrCodeText(allowance.DocumentLevelAllowanceReasonCode),
+		})
+	}
+	for _, charge := range xr.DocumentLevelCharges {
+		inv.Charges = append(inv.Charges, model.AllowanceCharge{
+			Amount:      p.decimal("BT-99", charge.DocumentLevelChargeAmount),
+			BaseAmount:  p.decimal("BT-100", charge.DocumentLevelChargeBaseAmount),
+			Percentage:  p.decimal("BT-101", charge.DocumentLevelChargePercentage),
+			VATCategory: model.VATCategory(xrCodeText(charge.DocumentLevelVATCategoryCode)),
+			VATRate:     p.decimal("BT-103", charge.DocumentLevelVATRate),
+			Reason:      xrTextValue(charge.DocumentLevelChargeReason),
+			ReasonCode:  xrCodeText(charge.DocumentLevelChargeReasonCode),
+		})
+	}
+
+	if totals := xr.DocumentTotals; totals != nil {
+		inv.Totals = model.Totals{
+			LineNet:       p.decimal("BT-106", totals.SumOfInvoiceLineNetAmount),
+			Allowances:    p.decimal("BT-107", totals.SumOfAllowancesOnDocumentLevel),
+			Charges:       p.decimal("BT-108", totals.SumOfChargesOnDocumentLevel),
+			TaxBasis:      p.decimal("BT-109", totals.InvoiceTotalAmountWithoutVAT),
+			Tax:           p.decimal("BT-110", totals.InvoiceTotalVATAmount),
+			TaxAccounting: p.decimal("BT-111", totals.InvoiceTotalVATAmountInAccountingCurrency),
+			Grand:         p.decimal("BT-112", totals.InvoiceTotalAmountWithVAT),
+			Prepaid:       p.decimal("BT-113", totals.PaidAmount),
+			Rounding:      p.decimal("BT-114", totals.RoundingAmount),
+			DuePayable:    p.decimal("BT-115", totals.AmountDueForPayment),
+		}
+	}
+
+	for _, vat := range xr.VATBreakdown {
+		inv.VATBreakdown = append(inv.VATBreakdown, model.VATBreakdown{
+			TaxableAmount:       p.decimal("BT-116", vat.VATCategoryTaxableAmount),
+			TaxAmount:           p.decimal("BT-117", vat.VATCategoryTaxAmount),
+			Category:            model.VATCategory(xrCodeText(vat.VATCategoryCode)),
+			Rate:                p.decimal("BT-119", vat.VATCategoryRate),
+			ExemptionReason:     xrTextValue(vat.VATExemptionReasonText),
+			ExemptionReasonCode: xrCodeText(vat.VATExemptionReasonCode),
+		})
+	}
+
+	for _, doc := range xr.AdditionalSupportingDocuments {
+		supporting := model.SupportingDocument{
+			ID:          xrReferenceText(doc.SupportingDocumentReference),
+			Description: xrTextValue(doc.SupportingDocumentDescription),
+			URI:         xrTextValue(doc.ExternalDocumentLocation),
+		}
+		if object := doc.AttachedDocument; object != nil {
+			supporting.Attachment = &model.Attachment{
+				MimeCode: strings.TrimSpace(object.Mime_code),
+				Filename: strings.TrimSpace(object.Filename),
+				Data:     p.base64("BT-125", object.Text),
+			}
+		}
+		inv.SupportingDocuments = append(inv.SupportingDocuments, supporting)
+	}
+
+	for _, line := range xr.InvoiceLine {
+		inv.Lines = append(inv.Lines, p.line(line))
+	}
+
+	if p.err != nil {
+		return nil, p.err
+	}
+	return inv, nil
+}
+
+func (p *xrParser) line(xr *InvoiceLine) model.Line {
+	line := model.Line{
+		ID:                  xrIdentifierText(xr.InvoiceLineIdentifier),
+		Note:                xrTextValue(xr.InvoiceLineNote),
+		ObjectID:            xrSchemeIdentifierOf(xr.InvoiceLineObjectIdentifier),
+		Quantity:            p.decimal("BT-129", xr.InvoicedQuantity),
+		UnitCode:            xrCodeText(xr.InvoicedQuantityUnitOfMeasureCode),
+		NetAmount:           p.decimal("BT-131", xr.InvoiceLineNetAmount),
+		OrderLineReference:  xrReferenceText(xr.ReferencedPurchaseOrderLineReference),
+		AccountingReference: xrTextValue(xr.InvoiceLineBuyerAccountingReference),
+	}
+	if period := xr.InvoiceLinePeriod; period != nil {
+		line.Period = model.Period{
+			Start: p.date("BT-134", period.InvoiceLinePeriodStartDate),
+			End:   p.date("BT-135", period.InvoiceLinePeriodEndDate),
+		}
+	}
+	for _, allowance := range xr.InvoiceLineAllowances {
+		line.Allowances = append(line.Allowances, model.AllowanceCharge{
+			Amount:     p.decimal("BT-136", allowance.InvoiceLineAllowanceAmount),
+			BaseAmount: p.decimal("BT-137", allowance.InvoiceLineAllowanceBaseAmount),
+			Percentage: p.decimal("BT-138", allowance.InvoiceLineAllowancePercentage),
+			Reason:     xrTextValue(allowance.InvoiceLineAllowanceReason),
+			ReasonCode: xrCodeText(allowance.InvoiceLineAllowanceReasonCode),
+		})
+	}
+	for _, charge := range xr.InvoiceLineCharges {
+		line.Charges = append(line.Charges, model.AllowanceCharge{
+			Amount:     p.decimal("BT-141", charge.InvoiceLineChargeAmount),
+			BaseAmount: p.decimal("BT-142", charge.InvoiceLineChargeBaseAmount),
+			Percentage: p.decimal("BT-143", charge.InvoiceLineChargePercentage),
+			Reason:     xrTextValue(charge.InvoiceLineChargeReason),
+			ReasonCode: xrCodeText(charge.InvoiceLineChargeReasonCode),
+		})
+	}
+	if price := xr.PriceDetails; price != nil {
+		line.Price = model.Price{
+			Net:              p.decimal("BT-146", price.ItemNetPrice),
+			Discount:         p.decimal("BT-147", price.ItemPriceDiscount),
+			Gross:            p.decimal("BT-148", price.ItemGrossPrice),
+			BaseQuantity:     p.decimal("BT-149", price.ItemPriceBaseQuantity),
+			BaseQuantityUnit: xrCodeText(price.ItemPriceBaseQuantityUnitOfMeasure),
+		}
+	}
+	if vat := xr.LineVATInformation; vat != nil {
+		line.VATCategory = model.VATCategory(xrCodeText(vat.InvoicedItemVATCategoryCode))
+		line.VATRate = p.decimal("BT-152", vat.InvoicedItemVATRate)
+	}
+	if item := xr.ItemInformation; item != nil {
+		line.Item = model.Item{
+			Name:          xrTextValue(item.ItemName),
+			Description:   xrTextValue(item.ItemDescription),
+			SellerID:      xrIdentifierText(item.ItemSellersIdentifier),
+			BuyerID:       xrIdentifierText(item.ItemBuyersIdentifier),
+			StandardID:    xrSchemeIdentifierOf(item.ItemStandardIdentifier),
+			OriginCountry: xrCodeText(item.ItemCountryOfOrigin),
+		}
+		if class := xrSchemeIdentifierOf(item.ItemClassificationIdentifier); class.IsSet() {
+			line.Item.Classifications = []model.Identifier{class}
+		}
+		for _, attribute := range item.ItemAttributes {
+			line.Item.Attributes = append(line.Item.Attributes, model.ItemAttribute{
+				Name:  xrTextValue(attribute.ItemAttributeName),
+				Value: xrTextValue(attribute.ItemAttributeValue),
+			})
+		}
+	}
+	return line
+}
+
+// xrParser keeps the first conversion error, like the parsers of the model.
+type xrParser struct {
+	err error
+}
+
+func (p *xrParser) fail(field string, err error) {
+	if p.err == nil {
+		p.err = fmt.Errorf("%s: %w", field, err)
+	}
+}
+
+func (p *xrParser) decimal(field string, value *Text) model.Decimal {
+	text := xrTextValue(value)
+	if text == "" {
+		return model.Decimal{}
+	}
+	d, err := model.ParseDecimal(text)
+	if err != nil {
+		p.fail(field, err)
+	}
+	return d
+}
+
+func (p *xrParser) date(field string, value *Date) model.Date {
+	if value == nil || strings.TrimSpace(value.Text) == "" {
+		return model.Date{}
+	}
+	d, err := model.ParseDate(value.Text, "")
+	if err != nil {
+		p.fail(field, err)
+	}
+	return d
+}
+
+func (p *xrParser) base64(field, value string) []byte {
+	data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), ""))
+	if err != nil {
+		p.fail(field, fmt.Errorf("invalid base64 content"))
+	}
+	return data
+}
+
+// The helpers below return "" for absent elements.
+
+func xrTextValue(value *Text) string {
+	if value == nil {
+		return ""
+	}
+	return strings.TrimSpace(value.Text)
+}
+
+func xrCodeText(value *Code) string {
+	if value == nil {
+		return ""
+	}
+	return strings.TrimSpace(value.Text)
+}
+
+func xrReferenceText(value *DocumentReference) string {
+	if value == nil {
+		return ""
+	}
+	return strings.TrimSpace(value.Text)
+}
+
+func xrIdentifierText(value *Identifier) string {
+	if value == nil {
+		return ""
+	}
+	return strings.TrimSpace(value.Text)
+}
+
+func xrSchemeIdentifierOf(value *IdentifierWithScheme) model.Identifier {
+	if value == nil {
+		return model.Identifier{}
+	}
+	return model.Identifier{
+		ID:            strings.TrimSpace(value.Text),
+		Scheme:        strings.TrimSpace(value.Scheme_identifier),
+		SchemeVersion: strings.TrimSpace(value.Scheme_version_identifier),
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+
+	"eBill-Convert/model"
+	"eBill-Convert/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-openapi/spec"
+)
+
+// handleValidate validates the uploaded invoice, remembers the payment
+// accounts of its seller and warns of those not confirmed.
+func handleValidate(c *gin.Context) {
+	data, err := formFileData(c, "xmlFile")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	xmlData, err := invoiceXML(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	report, err := utils.Validate(bytes.NewReader(xmlData))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if inv, err := model.Parse(bytes.NewReader(xmlData)); err == nil {
+		report.Issues = append(report.Issues, accountIssues(bankAccounts.record(inv))...)
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+func validatePath() spec.PathItem {
+	return spec.PathItem{
+		PathItemProps: spec.PathItemProps{
+			Post: &spec.Operation{
+				OperationProps: spec.OperationProps{
+					Description: "Validates an invoice against the mandatory elements of EN 16931 and, for Peppol BIS Billing 3.0, the Peppol rules. IBANs, BICs, VAT IDs, German tax numbers, GLNs, GTINs (schemes 0088, 0160) and the Leitweg-ID (BT-10) of XRechnung invoices are verified by format and check digits; the issues carry the offending value. The payment accounts (BT-84) of each seller are remembered; the accounts of the first invoice of a seller are trusted, a later new account is reported as warning BANK-ACCOUNT-CHANGED until confirmed with /bankaccounts/confirm.",
+					Consumes:    []string{"multipart/form-data"},
+					Produces:    []string{"application/json"},
+					Parameters: []spec.Parameter{
+						{
+							ParamProps: spec.ParamProps{
+								Name:        "xmlFile",
+								In:          "formData",
+								Description: "The invoice: XML, hybrid PDF, JSON or EDIFACT.",
+								Required:    true,
+								Schema:      &spec.Schema{SchemaProps: spec.SchemaProps{Type: []string{"file"}}},
+							},
+						},
+					},
+					Responses: &spec.Responses{
+						ResponsesProps: spec.ResponsesProps{
+							StatusCodeResponses: map[int]spec.Response{
+								200: {
+									ResponseProps: spec.ResponseProps{
+										Description: "Validation report; valid is false if any error was found.",
+										Schema: &spec.Schema{
+											SchemaProps: spec.SchemaProps{
+												Type: []string{"object"},
+											},
+										},
+									},
+								},
+								400: errorResponse("File missing or not a readable invoice"),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
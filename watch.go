@@ -0,0 +1,407 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	watchWorkers       = 2
+	watchQueueSize     = 256
+	watchRecentEvents  = 50 // Results kept for the status endpoint
+	watchDefaultPeriod = 5 * time.Second
+)
+
+// watchDir is an input directory together with its output directories.
+type watchDir struct {
+	Input   string `json:"input"`
+	Success string `json:"success"`
+	Error   string `json:"error"`
+}
+
+// watchEvent records the outcome of one processed file.
+type watchEvent struct {
+	File      string          `json:"file"`
+	Status    string          `json:"status"`
+	Output    string          `json:"output,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	Duplicate *duplicateCheck `json:"duplicate,omitempty"`
+	Time      time.Time       `json:"time"`
+}
+
+// watchStatus is reported by GET /watch.
+type watchStatus struct {
+	Dirs       []watchDir   `json:"dirs"`
+	Format     string       `json:"format"`
+	Interval   string       `json:"interval"`
+	Waiting    []string     `json:"waiting"` // Seen but still being written
+	Queued     []string     `json:"queued"`
+	Processing []string     `json:"processing"`
+	Stuck      []string     `json:"stuck"` // Failed, but could not be moved to the error folder
+	Processed  int          `json:"processed"`
+	Failed     int          `json:"failed"`
+	Recent     []watchEvent `json:"recent"`
+}
+
+// fileState identifies a version of a file between two polls.
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// watcher polls the input directories and converts new invoices. A file
+// is only picked up once its size and modification time are unchanged
+// between two polls, so files still being written are left alone.
+type watcher struct {
+	dirs     []watchDir
+	format   string
+	interval time.Duration
+	queue    chan string
+
+	mu         sync.Mutex
+	seen       map[string]fileState
+	queued     map[string]bool
+	processing map[string]bool
+	stuck      map[string]fileState // Failed files that could not be moved away
+	processed  int
+	failed     int
+	recent     []watchEvent
+}
+
+var folders *watcher
+
+// newWatcher creates the output directories and starts polling.
+func newWatcher(dirs []watchDir, format string, interval time.Duration) (*watcher, error) {
+	for _, dir := range dirs {
+		for _, path := range []string{dir.Input, dir.Success, filepath.Join(dir.Success, "originals"), dir.Error} {
+			if err := os.MkdirAll(path, 0o755); err != nil {
+				return nil, fmt.Errorf("error creating watch directory: %w", err)
+			}
+		}
+	}
+
+	w := &watcher{
+		dirs:       dirs,
+		format:     format,
+		interval:   interval,
+		queue:      make(chan string, watchQueueSize),
+		seen:       make(map[string]fileState),
+		queued:     make(map[string]bool),
+		processing: make(map[string]bool),
+		stuck:      make(map[string]fileState),
+	}
+	for i := 0; i < watchWorkers; i++ {
+		go w.run()
+	}
+	go func() {
+		for {
+			w.poll()
+			time.Sleep(w.interval)
+		}
+	}()
+	return w, nil
+}
+
+// watchConfigFromEnv reads the watch folder configuration. WATCH_DIRS is a
+// list of input directories separated by the OS path list separator. The
+// success and error folders default to subdirectories of each input.
+func watchConfigFromEnv() ([]watchDir, string, time.Duration, error) {
+	var dirs []watchDir
+	for _, input := range filepath.SplitList(os.Getenv("WATCH_DIRS")) {
+		if input = strings.TrimSpace(input); input == "" {
+			continue
+		}
+		dir := watchDir{
+			Input:   input,
+			Success: filepath.Join(input, "success"),
+			Error:   filepath.Join(input, "error"),
+		}
+		// Shared folders get one subdirectory per input
+		if success := os.Getenv("WATCH_SUCCESS_DIR"); success != "" {
+			dir.Success = filepath.Join(success, filepath.Base(input))
+		}
+		if failed := os.Getenv("WATCH_ERROR_DIR"); failed != "" {
+			dir.Error = filepath.Join(failed, filepath.Base(input))
+		}
+		dirs = append(dirs, dir)
+	}
+
+	format := os.Getenv("WATCH_FORMAT")
+	if format == "" {
+		format = "pdf"
+	}
+	if format != "pdf" && format != "html" {
+		return nil, "", 0, fmt.Errorf("unsupported WATCH_FORMAT: %s", format)
+	}
+
+	interval := watchDefaultPeriod
+	if value := os.Getenv("WATCH_INTERVAL"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return nil, "", 0, fmt.Errorf("invalid WATCH_INTERVAL: %s", value)
+		}
+		interval = d
+	}
+	return dirs, format, interval, nil
+}
+
+// poll queues the files that did not change since the previous poll.
+func (w *watcher) poll() {
+	present := make(map[string]bool)
+	for _, dir := range w.dirs {
+		entries, err := os.ReadDir(dir.Input)
+		if err != nil {
+			log.Printf("Error reading watch directory %s: %v", dir.Input, err)
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if !entry.Type().IsRegular() || !isWatchedFile(name) {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue // Removed in the meantime
+			}
+			path := filepath.Join(dir.Input, name)
+			present[path] = true
+			state := fileState{size: info.Size(), modTime: info.ModTime()}
+
+			w.mu.Lock()
+			if stuck, ok := w.stuck[path]; ok && stuck == state {
+				w.mu.Unlock()
+				continue // Retried once the file is replaced
+			}
+			delete(w.stuck, path)
+			if !w.queued[path] && !w.processing[path] {
+				if previous, ok := w.seen[path]; ok && previous == state && state.size > 0 {
+					select {
+					case w.queue <- path:
+						w.queued[path] = true
+						delete(w.seen, path)
+					default:
+						// Queue full, retried with the next poll
+					}
+				} else {
+					w.seen[path] = state
+				}
+			}
+			w.mu.Unlock()
+		}
+	}
+
+	w.mu.Lock()
+	for path := range w.seen {
+		if !present[path] {
+			delete(w.seen, path)
+		}
+	}
+	for path := range w.stuck {
+		if !present[path] {
+			delete(w.stuck, path)
+		}
+	}
+	w.mu.Unlock()
+}
+
+// isWatchedFile excludes hidden and temporary files of copy tools.
+func isWatchedFile(name string) bool {
+	if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "~") {
+		return false
+	}
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".xml" || ext == ".pdf"
+}
+
+func (w *watcher) run() {
+	for path := range w.queue {
+		w.mu.Lock()
+		delete(w.queued, path)
+		w.processing[path] = true
+		w.mu.Unlock()
+
+		event := w.process(path)
+
+		w.mu.Lock()
+		delete(w.processing, path)
+		if event.Status == "ok" {
+			w.processed++
+		} else {
+			w.failed++
+		}
+		w.recent = append(w.recent, event)
+		if len(w.recent) > watchRecentEvents {
+			w.recent = w.recent[len(w.recent)-watchRecentEvents:]
+		}
+		w.mu.Unlock()
+	}
+}
+
+// process converts one file and moves it to the success or error folder.
+func (w *watcher) process(path string) watchEvent {
+	dir := w.dirFor(path)
+	name := filepath.Base(path)
+	event := watchEvent{File: path, Status: "error", Time: time.Now().UTC()}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		event.Error = fmt.Sprintf("file read error: %v", err)
+		log.Printf("Watch: %s: %s", path, event.Error)
+		return event
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		event.Error = fmt.Sprintf("file read error: %v", err)
+		log.Printf("Watch: %s: %s", path, event.Error)
+		return event
+	}
+
+	result := convertBatchInput(batchInput{Name: name, Data: data}, w.format)
+	if result.Status == "ok" {
+		output := uniquePath(dir.Success, result.Output)
+		if err := writeFileAtomic(output, result.data); err != nil {
+			result.Error = fmt.Sprintf("error writing output: %v", err)
+		} else if err := moveFile(path, uniquePath(filepath.Join(dir.Success, "originals"), name)); err != nil {
+			// The original stays in the input folder, so drop its output
+			os.Remove(output)
+			result.Error = fmt.Sprintf("error moving original: %v", err)
+		} else {
+			// Fingerprinted only now, so a retry is not its own duplicate
+			event.Status, event.Output = "ok", output
+			event.Duplicate = fingerprints.record(sourceWatch, name, result.xml)
+			log.Printf("Watch: converted %s to %s", path, output)
+			return event
+		}
+	}
+
+	event.Error = result.Error
+	log.Printf("Watch: %s failed: %s", path, event.Error)
+
+	target := uniquePath(dir.Error, name)
+	if err := moveFile(path, target); err != nil {
+		log.Printf("Watch: error moving %s: %v", path, err)
+		// Not picked up again until the file changes
+		w.mu.Lock()
+		w.stuck[path] = fileState{size: info.Size(), modTime: info.ModTime()}
+		w.mu.Unlock()
+		return event
+	}
+	sidecar := fmt.Sprintf("file: %s\ntime: %s\nerror: %s\n", name, event.Time.Format(time.RFC3339), event.Error)
+	if err := writeFileAtomic(target+".error.txt", []byte(sidecar)); err != nil {
+		log.Printf("Watch: error writing error file for %s: %v", path, err)
+	}
+	event.Output = target
+	return event
+}
+
+func (w *watcher) dirFor(path string) watchDir {
+	for _, dir := range w.dirs {
+		if filepath.Dir(path) == filepath.Clean(dir.Input) {
+			return dir
+		}
+	}
+	return w.dirs[0]
+}
+
+func (w *watcher) status() watchStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	status := watchStatus{
+		Dirs:       w.dirs,
+		Format:     w.format,
+		Interval:   w.interval.String(),
+		Waiting:    []string{},
+		Queued:     []string{},
+		Processing: []string{},
+		Stuck:      []string{},
+		Processed:  w.processed,
+		Failed:     w.failed,
+		Recent:     append([]watchEvent{}, w.recent...),
+	}
+	for path := range w.seen {
+		status.Waiting = append(status.Waiting, path)
+	}
+	for path := range w.queued {
+		status.Queued = append(status.Queued, path)
+	}
+	for path := range w.processing {
+		status.Processing = append(status.Processing, path)
+	}
+	for path := range w.stuck {
+		status.Stuck = append(status.Stuck, path)
+	}
+	return status
+}
+
+// uniquePath returns a path in dir for name that does not exist yet. If
+// dir cannot be read the first path is returned, so that writing to it
+// reports the error.
+func uniquePath(dir, name string) string {
+	ext := filepath.Ext(name)
+	path := filepath.Join(dir, name)
+	for n := 2; ; n++ {
+		if _, err := os.Lstat(path); err != nil {
+			return path
+		}
+		path = filepath.Join(dir, fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, ext), n, ext))
+	}
+}
+
+// writeFileAtomic writes through a temporary file so that consumers of the
+// output folder never see partial documents.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// moveFile renames src to dst, copying if both are on different devices.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp")
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+func handleWatchStatus(c *gin.Context) {
+	if folders == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "watch folders not configured"})
+		return
+	}
+	c.JSON(http.StatusOK, folders.status())
+}
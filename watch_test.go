@@ -0,0 +1,195 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestWatcher returns a watcher of a temporary input folder without
+// starting its workers and polling.
+func newTestWatcher(t *testing.T) *watcher {
+	t.Helper()
+	input := t.TempDir()
+	dir := watchDir{Input: input, Success: filepath.Join(input, "success"), Error: filepath.Join(input, "error")}
+	for _, path := range []string{dir.Success, filepath.Join(dir.Success, "originals"), dir.Error} {
+		if err := os.MkdirAll(path, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &watcher{
+		dirs:       []watchDir{dir},
+		format:     "html",
+		queue:      make(chan string, watchQueueSize),
+		seen:       make(map[string]fileState),
+		queued:     make(map[string]bool),
+		processing: make(map[string]bool),
+		stuck:      make(map[string]fileState),
+	}
+}
+
+// queuedPaths drains the queue.
+func queuedPaths(w *watcher) []string {
+	var paths []string
+	for {
+		select {
+		case path := <-w.queue:
+			paths = append(paths, filepath.Base(path))
+			w.mu.Lock()
+			delete(w.queued, path)
+			w.mu.Unlock()
+		default:
+			return paths
+		}
+	}
+}
+
+func writeTestFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIsWatchedFile(t *testing.T) {
+	tests := map[string]bool{
+		"invoice.xml":      true,
+		"invoice.PDF":      true,
+		"invoice.json":     false,
+		".invoice.xml":     false,
+		"~invoice.xml":     false,
+		"invoice.xml.part": false,
+	}
+	for name, watched := range tests {
+		if got := isWatchedFile(name); got != watched {
+			t.Errorf("isWatchedFile(%s) = %v", name, got)
+		}
+	}
+}
+
+func TestWatchPoll(t *testing.T) {
+	w := newTestWatcher(t)
+	input := w.dirs[0].Input
+	then := time.Now().Add(-time.Minute)
+	writeTestFile(t, filepath.Join(input, "stable.xml"), []byte("<a/>"), then)
+	writeTestFile(t, filepath.Join(input, "growing.xml"), []byte("<a"), then)
+	writeTestFile(t, filepath.Join(input, "empty.xml"), nil, then)
+	writeTestFile(t, filepath.Join(input, ".hidden.xml"), []byte("<a/>"), then)
+
+	w.poll()
+	if got := queuedPaths(w); len(got) != 0 {
+		t.Errorf("first poll queued %v", got)
+	}
+
+	// Only files unchanged since the previous poll are picked up
+	writeTestFile(t, filepath.Join(input, "growing.xml"), []byte("<a/>"), then)
+	w.poll()
+	if got := strings.Join(queuedPaths(w), ","); got != "stable.xml" {
+		t.Errorf("second poll queued %s", got)
+	}
+	w.poll()
+	if got := strings.Join(queuedPaths(w), ","); got != "growing.xml" {
+		t.Errorf("third poll queued %s", got)
+	}
+
+	// Removed files are forgotten
+	for _, name := range []string{"stable.xml", "growing.xml", "empty.xml"} {
+		os.Remove(filepath.Join(input, name))
+	}
+	w.poll()
+	if len(w.seen) != 0 {
+		t.Errorf("seen = %v", w.seen)
+	}
+}
+
+func TestWatchProcess(t *testing.T) {
+	w := newTestWatcher(t)
+	dir := w.dirs[0]
+	then := time.Now().Add(-time.Minute)
+
+	path := filepath.Join(dir.Input, "invoice.xml")
+	writeTestFile(t, path, testInvoice("RE-1", "DE136695976", "20240131"), then)
+	event := w.process(path)
+	if event.Status != "ok" || event.Output != filepath.Join(dir.Success, "invoice.html") {
+		t.Errorf("event = %+v", event)
+	}
+	if _, err := os.Stat(filepath.Join(dir.Success, "originals", "invoice.xml")); err != nil {
+		t.Errorf("original: %v", err)
+	}
+
+	// A second file of the same name gets a numbered output
+	writeTestFile(t, path, testInvoice("RE-2", "DE136695976", "20240131"), then)
+	if event := w.process(path); event.Output != filepath.Join(dir.Success, "invoice-2.html") {
+		t.Errorf("event = %+v", event)
+	}
+
+	broken := filepath.Join(dir.Input, "broken.xml")
+	writeTestFile(t, broken, []byte("<Invoice"), then)
+	event = w.process(broken)
+	if event.Status != "error" || event.Output != filepath.Join(dir.Error, "broken.xml") {
+		t.Errorf("event = %+v", event)
+	}
+	if sidecar, err := os.ReadFile(filepath.Join(dir.Error, "broken.xml.error.txt")); err != nil || !strings.Contains(string(sidecar), "error: ") {
+		t.Errorf("error file = %q, %v", sidecar, err)
+	}
+	if _, err := os.Stat(broken); !os.IsNotExist(err) {
+		t.Errorf("input still present: %v", err)
+	}
+}
+
+func TestWatchProcessUnmovable(t *testing.T) {
+	w := newTestWatcher(t)
+	dir := w.dirs[0]
+	then := time.Now().Add(-time.Minute)
+
+	// Without originals and error folder the file can be moved nowhere
+	os.RemoveAll(filepath.Join(dir.Success, "originals"))
+	os.RemoveAll(dir.Error)
+	path := filepath.Join(dir.Input, "invoice.xml")
+	writeTestFile(t, path, testInvoice("RE-1", "DE136695976", "20240131"), then)
+
+	event := w.process(path)
+	if event.Status != "error" || !strings.Contains(event.Error, "error moving original") {
+		t.Errorf("event = %+v", event)
+	}
+	if _, err := os.Stat(filepath.Join(dir.Success, "invoice.html")); !os.IsNotExist(err) {
+		t.Errorf("output of unmoved original kept: %v", err)
+	}
+	if _, ok := w.stuck[path]; !ok {
+		t.Fatal("file not marked as stuck")
+	}
+
+	// Not picked up again until the file changes
+	w.poll()
+	w.poll()
+	if got := queuedPaths(w); len(got) != 0 {
+		t.Errorf("stuck file queued: %v", got)
+	}
+	writeTestFile(t, path, testInvoice("RE-1", "DE136695976", "20240131"), then.Add(time.Second))
+	w.poll()
+	w.poll()
+	if got := strings.Join(queuedPaths(w), ","); got != "invoice.xml" {
+		t.Errorf("changed file queued %q", got)
+	}
+}
+
+func TestUniquePath(t *testing.T) {
+	dir := t.TempDir()
+	if got := uniquePath(dir, "a.pdf"); got != filepath.Join(dir, "a.pdf") {
+		t.Errorf("free name = %s", got)
+	}
+	os.WriteFile(filepath.Join(dir, "a.pdf"), nil, 0o644)
+	os.WriteFile(filepath.Join(dir, "a-2.pdf"), nil, 0o644)
+	if got := uniquePath(dir, "a.pdf"); got != filepath.Join(dir, "a-3.pdf") {
+		t.Errorf("taken name = %s", got)
+	}
+	missing := filepath.Join(dir, "missing")
+	if got := uniquePath(missing, "a.pdf"); got != filepath.Join(missing, "a.pdf") {
+		t.Errorf("missing folder = %s", got)
+	}
+}